@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/optable/match/pkg/psi"
+	"github.com/optable/match/test/emails"
+)
+
+// benchProtocols are the protocols run by bench -proto all
+var benchProtocols = []psi.Protocol{
+	psi.ProtocolDHPSI,
+	psi.ProtocolNPSI,
+	psi.ProtocolBPSI,
+	psi.ProtocolKKRTPSI,
+	psi.ProtocolKKRTPSIKOS,
+	psi.ProtocolVOLEPSI,
+}
+
+// bench runs protocols between a local sender and receiver
+// of generated identifiers, reporting a session for each run
+func bench(ctx context.Context, args []string, _ io.Writer) (*Summary, *Config, error) {
+	fs, cfg, err := newFlagSet("bench", args)
+	if err != nil {
+		return nil, nil, err
+	}
+	fs.StringVar(&cfg.Protocol, "proto", cfg.Protocol, "The comma-separated psi protocols (bpsi,npsi,dhpsi,kkrt,kkrt-kos,vole), or all")
+	var (
+		senderSize   = fs.Int("sender-size", 1000, "The number of sender identifiers")
+		receiverSize = fs.Int("receiver-size", 10000, "The number of receiver identifiers")
+		common       = fs.Int("common", 100, "The number of identifiers in common")
+		runs         = fs.Int("runs", 1, "The number of runs of each protocol")
+	)
+	if err := parse(fs, args); err != nil {
+		return nil, nil, err
+	}
+	if *common < 0 || *common > *senderSize || *common > *receiverSize {
+		return nil, cfg, usageError{errors.New("-common must be between 0 and the smallest of -sender-size and -receiver-size")}
+	}
+	protocols := benchProtocols
+	if cfg.Protocol != "all" {
+		protocols = nil
+		for _, name := range strings.Split(cfg.Protocol, ",") {
+			p, err := psi.ParseProtocol(strings.TrimSpace(name))
+			if err != nil {
+				return nil, cfg, usageError{err}
+			}
+			protocols = append(protocols, p)
+		}
+	}
+
+	logger := newLogger(cfg)
+	commons := emails.Common(*common, emails.HashLen)
+	senderIDs := collect(emails.Mix(commons, *senderSize-*common, emails.HashLen))
+	receiverIDs := collect(emails.Mix(commons, *receiverSize-*common, emails.HashLen))
+	s, r := int64(len(senderIDs)), int64(len(receiverIDs))
+	summary := &Summary{Protocol: cfg.Protocol, SenderSize: &s, ReceiverSize: &r}
+
+	for _, p := range protocols {
+		for i := 0; i < *runs; i++ {
+			if err := ctx.Err(); err != nil {
+				return summary, cfg, err
+			}
+			run := Summary{Command: "bench", Protocol: p.String(), SenderSize: &s, ReceiverSize: &r}
+			start := time.Now()
+			matches, err := benchRun(ctx, p, senderIDs, receiverIDs)
+			run.Duration = time.Since(start).Seconds()
+			if err != nil {
+				run.Error = err.Error()
+				run.ExitCode = exitFailure
+			} else {
+				run.Matches = &matches
+			}
+			logger.Info("ran", "protocol", p.String(), "run", i, "matches", matches, "seconds", run.Duration, "error", run.Error)
+			summary.Sessions = append(summary.Sessions, run)
+		}
+	}
+
+	for _, run := range summary.Sessions {
+		if run.Error != "" {
+			return summary, cfg, errors.New("some runs failed")
+		}
+	}
+	return summary, cfg, nil
+}
+
+// benchRun runs protocol p over an in-memory connection
+// and returns the size of the intersection
+func benchRun(ctx context.Context, p psi.Protocol, senderIDs, receiverIDs [][]byte) (int, error) {
+	senderConn, receiverConn := net.Pipe()
+	defer closeOnDone(ctx, senderConn)()
+	defer closeOnDone(ctx, receiverConn)()
+
+	done := make(chan error)
+	go func() {
+		s, err := psi.NewSender(p, senderConn)
+		if err == nil {
+			err = s.Send(ctx, int64(len(senderIDs)), replay(senderIDs))
+		}
+		senderConn.Close()
+		done <- err
+	}()
+	r, err := psi.NewReceiver(p, receiverConn)
+	var intersection [][]byte
+	if err == nil {
+		intersection, err = r.Intersect(ctx, int64(len(receiverIDs)), replay(receiverIDs))
+	}
+	receiverConn.Close()
+	return len(intersection), errors.Join(err, <-done)
+}
+
+// collect reads identifiers to exhaustion
+func collect(identifiers <-chan []byte) [][]byte {
+	var ids [][]byte
+	for id := range identifiers {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// replay returns a closed, buffered channel of ids
+func replay(ids [][]byte) <-chan []byte {
+	c := make(chan []byte, len(ids))
+	for _, id := range ids {
+		c <- id
+	}
+	close(c)
+	return c
+}
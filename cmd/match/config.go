@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/optable/match/pkg/input"
+	"github.com/optable/match/pkg/limits"
+	"gopkg.in/yaml.v3"
+)
+
+// Config is the configuration of every command, read from a YAML or JSON
+// file given with -config. The flags of a command override the file.
+type Config struct {
+	Protocol string `json:"protocol" yaml:"protocol"`
+	// Address is the address the sender dials and the receiver listens on
+	Address string       `json:"address" yaml:"address"`
+	Input   InputConfig  `json:"input" yaml:"input"`
+	Output  OutputConfig `json:"output" yaml:"output"`
+	TLS     TLSConfig    `json:"tls" yaml:"tls"`
+	Limits  LimitsConfig `json:"limits" yaml:"limits"`
+	Server  ServerConfig `json:"server" yaml:"server"`
+	// Summary is the path of the JSON summary of a command, - for stdout
+	Summary   string `json:"summary" yaml:"summary"`
+	Verbosity int    `json:"verbosity" yaml:"verbosity"`
+}
+
+type InputConfig struct {
+	Path        string `json:"path" yaml:"path"`
+	Format      string `json:"format" yaml:"format"`
+	Header      bool   `json:"header" yaml:"header"`
+	Column      string `json:"column" yaml:"column"`
+	ColumnIndex int    `json:"column_index" yaml:"column_index"`
+	Field       string `json:"field" yaml:"field"`
+}
+
+type OutputConfig struct {
+	// Path is a file, - for stdout, or the directory
+	// of the intersections of each session of serve
+	Path   string `json:"path" yaml:"path"`
+	Format string `json:"format" yaml:"format"`
+}
+
+type TLSConfig struct {
+	Cert string `json:"cert" yaml:"cert"`
+	Key  string `json:"key" yaml:"key"`
+	// CA verifies the certificate of the peer: that of the receiver
+	// for the sender, and that of the sender, then required, for the receiver
+	CA         string `json:"ca" yaml:"ca"`
+	ServerName string `json:"server_name" yaml:"server_name"`
+}
+
+type LimitsConfig struct {
+	MaxCardinality int64    `json:"max_cardinality" yaml:"max_cardinality"`
+	MaxBytes       int64    `json:"max_bytes" yaml:"max_bytes"`
+	StageTimeout   Duration `json:"stage_timeout" yaml:"stage_timeout"`
+}
+
+type ServerConfig struct {
+	QuotaSessions int      `json:"quota_sessions" yaml:"quota_sessions"`
+	QuotaWindow   Duration `json:"quota_window" yaml:"quota_window"`
+	MinSenderSize int64    `json:"min_sender_size" yaml:"min_sender_size"`
+	MaxOverlap    float64  `json:"max_overlap" yaml:"max_overlap"`
+	AuditLog      string   `json:"audit_log" yaml:"audit_log"`
+}
+
+// Duration is a time.Duration read from strings such as "1h30m"
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalText(b []byte) (err error) {
+	d.Duration, err = time.ParseDuration(string(b))
+	return err
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// Set and String make Duration a flag.Value
+func (d *Duration) Set(s string) error {
+	return d.UnmarshalText([]byte(s))
+}
+
+// defaultConfig returns the configuration used when no file overrides it
+func defaultConfig() Config {
+	return Config{
+		Protocol: "npsi",
+		Address:  "127.0.0.1:6667",
+		Input:    InputConfig{Format: "lines"},
+		Output:   OutputConfig{Path: "common-ids.txt", Format: "txt"},
+		Limits:   LimitsConfig{MaxCardinality: limits.DefaultMaxCardinality},
+		Summary:  "-",
+	}
+}
+
+// loadConfig reads the configuration file at path over the defaults,
+// as JSON if its extension is .json and as YAML otherwise
+func loadConfig(path string) (Config, error) {
+	cfg := defaultConfig()
+	if path == "" {
+		return cfg, nil
+	}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		d := json.NewDecoder(bytes.NewReader(b))
+		d.DisallowUnknownFields()
+		err = d.Decode(&cfg)
+	} else {
+		d := yaml.NewDecoder(bytes.NewReader(b))
+		d.KnownFields(true)
+		err = d.Decode(&cfg)
+	}
+	if err != nil {
+		return cfg, fmt.Errorf("config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// configPath finds the value of the -config flag in args,
+// which must be known before the other flags are defined
+func configPath(args []string) string {
+	for i, arg := range args {
+		name, value, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		if !strings.HasPrefix(arg, "-") || name != "config" {
+			continue
+		}
+		if hasValue {
+			return value
+		}
+		if i+1 < len(args) {
+			return args[i+1]
+		}
+	}
+	return ""
+}
+
+// newFlagSet returns the flag set of command, with the common flags
+// bound to cfg, which is loaded from the file given with -config
+func newFlagSet(command string, args []string) (*flag.FlagSet, *Config, error) {
+	cfg, err := loadConfig(configPath(args))
+	if err != nil {
+		return nil, nil, usageError{err}
+	}
+
+	fs := flag.NewFlagSet(command, flag.ContinueOnError)
+	fs.String("config", "", "A YAML or JSON configuration file, overridden by the flags")
+	fs.StringVar(&cfg.Summary, "summary", cfg.Summary, "The path of the JSON summary of the command, - for stdout")
+	fs.IntVar(&cfg.Verbosity, "v", cfg.Verbosity, "Verbosity level, 0 for info level messages, 1 for debug messages and 2 for trace level messages")
+	return fs, &cfg, nil
+}
+
+// protocolFlags binds the flags of the protocol and the limits to cfg
+func protocolFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.StringVar(&cfg.Protocol, "proto", cfg.Protocol, "The psi protocol (bpsi,npsi,dhpsi,kkrt,kkrt-kos,vole)")
+	fs.Int64Var(&cfg.Limits.MaxCardinality, "max-cardinality", cfg.Limits.MaxCardinality, "The largest number of identifiers the peer can announce")
+	fs.Int64Var(&cfg.Limits.MaxBytes, "max-bytes", cfg.Limits.MaxBytes, "The largest number of bytes read from the peer, unlimited if 0")
+	fs.Var(&cfg.Limits.StageTimeout, "stage-timeout", "The longest duration of a protocol stage, such as 10m, unlimited if 0")
+}
+
+// inputFlags binds the flags of the input file to cfg
+func inputFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.StringVar(&cfg.Input.Path, "in", cfg.Input.Path, "The file of the identifiers, optionally compressed with gzip or zstd")
+	fs.StringVar(&cfg.Input.Format, "format", cfg.Input.Format, "The format of the input file (lines,csv,ndjson)")
+	fs.BoolVar(&cfg.Input.Header, "header", cfg.Input.Header, "Skip the header row of a csv input file")
+	fs.StringVar(&cfg.Input.Column, "column", cfg.Input.Column, "The name of the csv column of the identifiers, which requires -header")
+	fs.IntVar(&cfg.Input.ColumnIndex, "column-index", cfg.Input.ColumnIndex, "The zero-based index of the csv column of the identifiers when -column is not set")
+	fs.StringVar(&cfg.Input.Field, "field", cfg.Input.Field, "The dot-separated path of the ndjson field of the identifiers")
+}
+
+// outputFlags binds the flags of the output file to cfg
+func outputFlags(fs *flag.FlagSet, cfg *Config, usage string) {
+	fs.StringVar(&cfg.Output.Path, "out", cfg.Output.Path, usage)
+	fs.StringVar(&cfg.Output.Format, "out-format", cfg.Output.Format, "The format of the output (txt,csv,ndjson)")
+}
+
+// tlsFlags binds the TLS flags to cfg
+func tlsFlags(fs *flag.FlagSet, cfg *Config) {
+	fs.StringVar(&cfg.TLS.Cert, "tls-cert", cfg.TLS.Cert, "The PEM certificate presented to the peer, enables TLS")
+	fs.StringVar(&cfg.TLS.Key, "tls-key", cfg.TLS.Key, "The PEM private key of -tls-cert")
+	fs.StringVar(&cfg.TLS.CA, "tls-ca", cfg.TLS.CA, "The PEM certificates of the authorities verifying the peer, enables TLS")
+	fs.StringVar(&cfg.TLS.ServerName, "tls-server-name", cfg.TLS.ServerName, "The name verified in the certificate of the receiver, the host of the address if empty")
+}
+
+// options returns the input.Options of c
+func (c InputConfig) options() (input.Options, error) {
+	opts := input.Options{Header: c.Header, Column: c.Column, ColumnIndex: c.ColumnIndex, Field: c.Field}
+	switch c.Format {
+	case "lines", "":
+		opts.Format = input.Lines
+	case "csv":
+		opts.Format = input.CSV
+	case "ndjson":
+		opts.Format = input.NDJSON
+	default:
+		return opts, usageError{fmt.Errorf("%w: %s", input.ErrUnsupportedFormat, c.Format)}
+	}
+	return opts, nil
+}
+
+// limits returns the limits.Limits of c
+func (c LimitsConfig) limits() limits.Limits {
+	return limits.Limits{MaxCardinality: c.MaxCardinality, MaxBytes: c.MaxBytes, StageTimeout: c.StageTimeout.Duration}
+}
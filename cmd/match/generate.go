@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/optable/match/pkg/input"
+	"github.com/optable/match/test/emails"
+	"golang.org/x/sync/errgroup"
+)
+
+// generate writes sender and receiver files of
+// random identifiers with a number of them in common
+func generate(ctx context.Context, args []string, _ io.Writer) (*Summary, *Config, error) {
+	fs, cfg, err := newFlagSet("generate", args)
+	if err != nil {
+		return nil, nil, err
+	}
+	var (
+		senderSize   = fs.Int("sender-size", 1000, "The number of sender identifiers")
+		receiverSize = fs.Int("receiver-size", 10000, "The number of receiver identifiers")
+		common       = fs.Int("common", 100, "The number of identifiers in common")
+		senderOut    = fs.String("sender-out", "sender-ids.txt", "The file of the sender identifiers")
+		receiverOut  = fs.String("receiver-out", "receiver-ids.txt", "The file of the receiver identifiers")
+		index        = fs.Bool("index", false, "Write the count of each file to its sidecar index, see input.Count")
+	)
+	if err := parse(fs, args); err != nil {
+		return nil, nil, err
+	}
+	if *common < 0 || *common > *senderSize || *common > *receiverSize {
+		return nil, cfg, usageError{errors.New("-common must be between 0 and the smallest of -sender-size and -receiver-size")}
+	}
+
+	s, r, c := int64(*senderSize), int64(*receiverSize), *common
+	summary := &Summary{SenderSize: &s, ReceiverSize: &r, Matches: &c}
+	newLogger(cfg).Info("generating", "sender", *senderSize, "receiver", *receiverSize, "common", *common)
+
+	// make the common part, and the sender and receiver files in parallel
+	commons := emails.Common(*common, emails.HashLen)
+	g, ctx := errgroup.WithContext(ctx)
+	g.Go(func() error { return writeGenerated(ctx, *senderOut, commons, *senderSize-*common, *index) })
+	g.Go(func() error { return writeGenerated(ctx, *receiverOut, commons, *receiverSize-*common, *index) })
+	return summary, cfg, g.Wait()
+}
+
+// writeGenerated writes the common identifiers mixed
+// with n fresh ones to the file at path, one per line
+func writeGenerated(ctx context.Context, path string, common []byte, n int, index bool) (err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+
+	identifiers := emails.Mix(common, n, emails.HashLen)
+	// mix has to be read to exhaustion
+	defer func() {
+		for range identifiers {
+		}
+	}()
+	w := bufio.NewWriter(f)
+	var count int64
+	for identifier := range identifiers {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		w.Write(identifier)
+		if err := w.WriteByte('\n'); err != nil {
+			return err
+		}
+		count++
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if index {
+		return input.WriteIndex(path, count)
+	}
+	return nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// identifierWriter writes identifiers in an output format
+type identifierWriter interface {
+	Write(identifier []byte) error
+	Flush() error
+}
+
+type txtWriter struct {
+	w *bufio.Writer
+}
+
+func (t txtWriter) Write(identifier []byte) error {
+	if _, err := t.w.Write(identifier); err != nil {
+		return err
+	}
+	return t.w.WriteByte('\n')
+}
+
+func (t txtWriter) Flush() error {
+	return t.w.Flush()
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+func (c csvWriter) Write(identifier []byte) error {
+	return c.w.Write([]string{string(identifier)})
+}
+
+func (c csvWriter) Flush() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+type ndjsonWriter struct {
+	w *bufio.Writer
+	e *json.Encoder
+}
+
+func (n ndjsonWriter) Write(identifier []byte) error {
+	return n.e.Encode(struct {
+		ID string `json:"id"`
+	}{string(identifier)})
+}
+
+func (n ndjsonWriter) Flush() error {
+	return n.w.Flush()
+}
+
+// newIdentifierWriter returns the writer of identifiers in format
+// to w. The csv format has an id header, as ndjson has an id field.
+func newIdentifierWriter(w io.Writer, format string) (identifierWriter, error) {
+	switch format {
+	case "txt", "":
+		return txtWriter{w: bufio.NewWriter(w)}, nil
+	case "csv":
+		c := csvWriter{w: csv.NewWriter(w)}
+		return c, c.w.Write([]string{"id"})
+	case "ndjson":
+		b := bufio.NewWriter(w)
+		return ndjsonWriter{w: b, e: json.NewEncoder(b)}, nil
+	default:
+		return nil, usageError{fmt.Errorf("unsupported output format %s", format)}
+	}
+}
+
+// checkOutputFormat returns a usage error if format is not supported
+func checkOutputFormat(format string) error {
+	_, err := newIdentifierWriter(io.Discard, format)
+	return err
+}
+
+// createOutput creates the file at path, or returns stdout if path is -.
+// The returned function closes the file.
+func createOutput(path string, stdout io.Writer) (io.Writer, func() error, error) {
+	if path == "-" {
+		return stdout, func() error { return nil }, nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	return f, f.Close, nil
+}
+
+// writeIdentifiers writes identifiers in format to the file at path, - for stdout
+func writeIdentifiers(path, format string, stdout io.Writer, identifiers [][]byte) (err error) {
+	w, closeOutput, err := createOutput(path, stdout)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if cerr := closeOutput(); err == nil {
+			err = cerr
+		}
+	}()
+
+	iw, err := newIdentifierWriter(w, format)
+	if err != nil {
+		return err
+	}
+	for _, identifier := range identifiers {
+		if err := iw.Write(identifier); err != nil {
+			return err
+		}
+	}
+	return iw.Flush()
+}
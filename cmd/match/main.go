@@ -0,0 +1,195 @@
+// Command match runs private set intersections between a sender and a
+// receiver, and the tooling around them:
+//
+//	match send      sends the identifiers of a file to a receiver
+//	match receive   intersects the identifiers of a file with one sender
+//	match serve     intersects the identifiers of a file with many senders
+//	match generate  generates sender and receiver files with common identifiers
+//	match bench     runs the protocols locally on generated identifiers
+//	match pair      manages PAIR keys and encrypts identifiers with them
+//
+// Every command takes a YAML or JSON configuration file with -config, which
+// its flags override, and reports a JSON summary, on stdout by default.
+// The exit code is 0 on success, 1 on failure, 2 on usage errors and 130
+// when interrupted by SIGINT or SIGTERM, which stop the command gracefully.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+)
+
+const (
+	exitOK          = 0
+	exitFailure     = 1
+	exitUsage       = 2
+	exitInterrupted = 130
+)
+
+// usageError is an error of the arguments or the configuration of a command
+type usageError struct {
+	err error
+}
+
+func (e usageError) Error() string { return e.err.Error() }
+func (e usageError) Unwrap() error { return e.err }
+
+// Summary is the machine-readable report of a command
+type Summary struct {
+	Command      string `json:"command"`
+	Peer         string `json:"peer,omitempty"`
+	Protocol     string `json:"protocol,omitempty"`
+	SenderSize   *int64 `json:"sender_size,omitempty"`
+	ReceiverSize *int64 `json:"receiver_size,omitempty"`
+	Matches      *int   `json:"matches,omitempty"`
+	// Identifiers is the number of identifiers written by pair
+	Identifiers *int   `json:"identifiers,omitempty"`
+	Output      string `json:"output,omitempty"`
+	// Duration is in seconds
+	Duration float64 `json:"duration"`
+	// Sessions are the summaries of the sessions of serve or of the runs of bench
+	Sessions []Summary `json:"sessions,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	ExitCode int       `json:"exit_code"`
+}
+
+// a command runs with its arguments, writing any output meant for stdout
+// to stdout, and returns its summary and its configuration, nil if the
+// arguments could not be parsed
+type command func(ctx context.Context, args []string, stdout io.Writer) (*Summary, *Config, error)
+
+var commands = map[string]command{
+	"send":     send,
+	"receive":  receive,
+	"serve":    serve,
+	"generate": generate,
+	"bench":    bench,
+	"pair":     pairCommand,
+}
+
+func usage(w io.Writer) {
+	var names []string
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(w, "Usage: match <command> [-config file] [flags]\n\ncommands: %v\n\nRun match <command> -h for the flags of a command.\n", names)
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	code := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	stop()
+	os.Exit(code)
+}
+
+// run runs the command of args and returns its exit code
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		usage(stderr)
+		return exitUsage
+	}
+	c, ok := commands[args[0]]
+	if !ok {
+		if args[0] != "-h" && args[0] != "help" {
+			fmt.Fprintf(stderr, "unknown command %q\n", args[0])
+		}
+		usage(stderr)
+		return exitUsage
+	}
+
+	start := time.Now()
+	summary, cfg, err := c(ctx, args[1:], stdout)
+	if errors.Is(err, flag.ErrHelp) {
+		return exitOK
+	}
+	if summary == nil {
+		summary = &Summary{}
+	}
+	summary.Command = args[0]
+	summary.Duration = time.Since(start).Seconds()
+
+	var usageErr usageError
+	switch {
+	case err == nil:
+		summary.ExitCode = exitOK
+	case errors.As(err, &usageErr):
+		summary.ExitCode = exitUsage
+	case ctx.Err() != nil:
+		summary.ExitCode = exitInterrupted
+	default:
+		summary.ExitCode = exitFailure
+	}
+	if err != nil {
+		summary.Error = err.Error()
+		fmt.Fprintf(stderr, "match %s: %v\n", args[0], err)
+	}
+
+	if cfg != nil && cfg.Summary != "" {
+		if werr := writeSummary(cfg, summary, stdout, stderr); werr != nil {
+			fmt.Fprintf(stderr, "match %s: writing the summary: %v\n", args[0], werr)
+			if summary.ExitCode == exitOK {
+				return exitFailure
+			}
+		}
+	}
+	return summary.ExitCode
+}
+
+// writeSummary writes s as JSON to the summary file of cfg. The summary on
+// stdout goes to stderr instead when stdout holds the output.
+func writeSummary(cfg *Config, s *Summary, stdout, stderr io.Writer) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+	if cfg.Summary != "-" {
+		return os.WriteFile(cfg.Summary, b, 0644)
+	}
+	if s.Output == "-" {
+		_, err = stderr.Write(b)
+	} else {
+		_, err = stdout.Write(b)
+	}
+	return err
+}
+
+// newLogger returns the stderr logger of cfg, with its own verbosity
+// so that commands running concurrently do not share one
+func newLogger(cfg *Config) logr.Logger {
+	std := log.New(os.Stderr, "", log.LstdFlags)
+	return funcr.New(func(prefix, args string) {
+		if prefix != "" {
+			args = prefix + ": " + args
+		}
+		std.Output(2, args)
+	}, funcr.Options{Verbosity: cfg.Verbosity})
+}
+
+// parse parses args with fs, as a usage error if they are invalid
+func parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return usageError{err}
+	}
+	if fs.NArg() > 0 {
+		return usageError{fmt.Errorf("unexpected arguments %v", fs.Args())}
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// runCommand runs args and returns the exit code, the stdout and the summary
+func runCommand(t *testing.T, ctx context.Context, args ...string) (int, string, Summary) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(ctx, args, &stdout, &stderr)
+	return code, stdout.String(), summary(t, stdout.String(), stderr.String())
+}
+
+// summary returns the summary written by run, the last line of
+// stdout, or of stderr when stdout holds the output
+func summary(t *testing.T, stdout, stderr string) (s Summary) {
+	t.Helper()
+	out := stdout
+	if strings.Contains(stderr, `"exit_code"`) {
+		out = stderr
+	}
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if err := json.Unmarshal([]byte(lines[len(lines)-1]), &s); err != nil {
+		t.Fatalf("no summary: %v\nstdout: %s\nstderr: %s", err, stdout, stderr)
+	}
+	return s
+}
+
+func TestConfig(t *testing.T) {
+	dir := t.TempDir()
+	yml := filepath.Join(dir, "match.yaml")
+	os.WriteFile(yml, []byte("protocol: kkrt\ninput:\n  format: csv\n  column: email\nlimits:\n  stage_timeout: 90s\n"), 0644)
+	cfg, err := loadConfig(yml)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Protocol != "kkrt" || cfg.Input.Column != "email" || cfg.Limits.StageTimeout.Duration != 90*time.Second {
+		t.Errorf("unexpected configuration %+v", cfg)
+	}
+	// the defaults remain
+	if cfg.Address != defaultConfig().Address || cfg.Output.Format != "txt" {
+		t.Errorf("expected the defaults to remain, got %+v", cfg)
+	}
+
+	js := filepath.Join(dir, "match.json")
+	os.WriteFile(js, []byte(`{"protocol": "dhpsi", "server": {"quota_window": "24h"}}`), 0644)
+	if cfg, err = loadConfig(js); err != nil || cfg.Protocol != "dhpsi" || cfg.Server.QuotaWindow.Duration != 24*time.Hour {
+		t.Errorf("unexpected configuration %+v, %v", cfg, err)
+	}
+
+	// unknown fields are errors
+	os.WriteFile(yml, []byte("protocl: kkrt\n"), 0644)
+	if _, err := loadConfig(yml); err == nil {
+		t.Error("expected an error for an unknown field")
+	}
+
+	// flags override the file
+	os.WriteFile(yml, []byte("protocol: kkrt\n"), 0644)
+	fs, c, err := newFlagSet("send", []string{"-config", yml, "-proto", "bpsi"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	protocolFlags(fs, c)
+	if err := parse(fs, []string{"-config", yml, "-proto", "bpsi"}); err != nil || c.Protocol != "bpsi" {
+		t.Errorf("expected the flag to override the file, got %s, %v", c.Protocol, err)
+	}
+}
+
+func TestOutputFormats(t *testing.T) {
+	ids := [][]byte{[]byte("a"), []byte(`b"c`)}
+	for format, want := range map[string]string{
+		"txt":    "a\nb\"c\n",
+		"csv":    "id\na\n\"b\"\"c\"\n",
+		"ndjson": "{\"id\":\"a\"}\n{\"id\":\"b\\\"c\"}\n",
+	} {
+		var b bytes.Buffer
+		if err := writeIdentifiers("-", format, &b, ids); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != want {
+			t.Errorf("%s: expected %q, got %q", format, want, b.String())
+		}
+	}
+	if err := checkOutputFormat("xml"); err == nil {
+		t.Error("expected an error for an unsupported format")
+	}
+}
+
+func TestExitCodes(t *testing.T) {
+	ctx := context.Background()
+	if code := run(ctx, nil, new(bytes.Buffer), new(bytes.Buffer)); code != exitUsage {
+		t.Errorf("expected %d without a command, got %d", exitUsage, code)
+	}
+	if code, _, s := runCommand(t, ctx, "send", "-proto", "psi"); code != exitUsage || s.ExitCode != exitUsage || s.Error == "" {
+		t.Errorf("expected a usage error for an unknown protocol, got %d, %+v", code, s)
+	}
+	if code, _, s := runCommand(t, ctx, "send", "-in", filepath.Join(t.TempDir(), "missing")); code != exitFailure || s.Error == "" {
+		t.Errorf("expected a failure for a missing input, got %d, %+v", code, s)
+	}
+	if code, _, s := runCommand(t, ctx, "serve", "-quota-sessions", "10"); code != exitUsage || s.Error == "" {
+		t.Errorf("expected a usage error for a quota without a window, got %d, %+v", code, s)
+	}
+
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	if code, _, _ := runCommand(t, cancelled, "bench", "-sender-size", "10", "-receiver-size", "10", "-common", "5"); code != exitInterrupted {
+		t.Errorf("expected %d once interrupted, got %d", exitInterrupted, code)
+	}
+}
+
+func TestBench(t *testing.T) {
+	code, _, s := runCommand(t, context.Background(), "bench", "-proto", "npsi,bpsi", "-sender-size", "100", "-receiver-size", "200", "-common", "20")
+	if code != exitOK || len(s.Sessions) != 2 {
+		t.Fatalf("expected 2 runs, got %d, %+v", code, s)
+	}
+	for _, run := range s.Sessions {
+		if run.Matches == nil || *run.Matches < 20 {
+			t.Errorf("expected 20 matches, got %+v", run)
+		}
+	}
+}
+
+func TestSendReceive(t *testing.T) {
+	dir := t.TempDir()
+	sender, receiver := filepath.Join(dir, "sender.txt"), filepath.Join(dir, "receiver.txt")
+	if code, _, _ := runCommand(t, context.Background(), "generate", "-sender-size", "50", "-receiver-size", "80", "-common", "10", "-sender-out", sender, "-receiver-out", receiver); code != exitOK {
+		t.Fatalf("generate failed with %d", code)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := l.Addr().String()
+	l.Close()
+
+	var stdout, stderr bytes.Buffer
+	done := make(chan int)
+	go func() {
+		done <- run(context.Background(), []string{"receive", "-a", address, "-in", receiver, "-out", "-", "-out-format", "ndjson"}, &stdout, &stderr)
+	}()
+
+	var code int
+	var s Summary
+	for i := 0; i < 50; i++ {
+		time.Sleep(20 * time.Millisecond)
+		if code, _, s = runCommand(t, context.Background(), "send", "-a", address, "-in", sender); code == exitOK {
+			break
+		}
+	}
+	if code != exitOK || *s.SenderSize != 50 {
+		t.Fatalf("send failed with %d, %+v", code, s)
+	}
+
+	code = <-done
+	if s = summary(t, stdout.String(), stderr.String()); code != exitOK || s.Matches == nil || *s.Matches != 10 || *s.SenderSize != 50 {
+		t.Fatalf("receive failed with %d, %+v", code, s)
+	}
+	if lines := strings.Count(stdout.String(), "{\"id\":\"e:"); lines != 10 {
+		t.Errorf("expected 10 identifiers on stdout, got %d in %q", lines, stdout.String())
+	}
+}
+
+func TestPair(t *testing.T) {
+	dir := t.TempDir()
+	key, in, enc, dec := filepath.Join(dir, "key.json"), filepath.Join(dir, "in.txt"), filepath.Join(dir, "enc.txt"), filepath.Join(dir, "dec.txt")
+	os.WriteFile(in, []byte("a@example.com\nb@example.com\n"), 0644)
+	ctx := context.Background()
+	if code, _, _ := runCommand(t, ctx, "pair", "keygen", "-key", key); code != exitOK {
+		t.Fatalf("keygen failed with %d", code)
+	}
+	if code, _, _ := runCommand(t, ctx, "pair", "keygen", "-key", key); code != exitFailure {
+		t.Errorf("expected keygen to refuse to overwrite a key, got %d", code)
+	}
+	if code, _, s := runCommand(t, ctx, "pair", "encrypt", "-key", key, "-in", in, "-out", enc); code != exitOK || *s.Identifiers != 2 {
+		t.Fatalf("encrypt failed with %d, %+v", code, s)
+	}
+	if code, _, _ := runCommand(t, ctx, "pair", "reencrypt", "-key", key, "-in", enc, "-out", dec); code != exitOK {
+		t.Fatalf("reencrypt failed with %d", code)
+	}
+	if code, _, _ := runCommand(t, ctx, "pair", "decrypt", "-key", key, "-in", dec, "-out", dec+".out"); code != exitOK {
+		t.Fatalf("decrypt failed with %d", code)
+	}
+
+	// decrypting the re-encrypted identifiers returns the encrypted ones
+	want, _ := os.ReadFile(enc)
+	got, _ := os.ReadFile(dec + ".out")
+	if !bytes.Equal(want, got) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+	if code := run(ctx, []string{"pair", "sign"}, new(bytes.Buffer), new(bytes.Buffer)); code != exitUsage {
+		t.Errorf("expected a usage error for an unknown action, got %d", code)
+	}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+)
+
+// enabled reports whether TLS is configured
+func (c TLSConfig) enabled() bool {
+	return c.Cert != "" || c.CA != ""
+}
+
+// config returns the tls.Config of a client if client is set, of a server otherwise
+func (c TLSConfig) config(client bool) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12, ServerName: c.ServerName}
+	if c.Cert != "" || c.Key != "" {
+		cert, err := tls.LoadX509KeyPair(c.Cert, c.Key)
+		if err != nil {
+			return nil, usageError{fmt.Errorf("tls: %w", err)}
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	if !client && len(cfg.Certificates) == 0 {
+		return nil, usageError{errors.New("tls: the receiver requires -tls-cert and -tls-key")}
+	}
+
+	if c.CA != "" {
+		pem, err := os.ReadFile(c.CA)
+		if err != nil {
+			return nil, usageError{fmt.Errorf("tls: %w", err)}
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, usageError{fmt.Errorf("tls: no certificate in %s", c.CA)}
+		}
+		if client {
+			cfg.RootCAs = pool
+		} else {
+			// senders must present a certificate
+			cfg.ClientCAs = pool
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return cfg, nil
+}
+
+// dial connects to the receiver at address
+func dial(ctx context.Context, address string, c TLSConfig) (net.Conn, error) {
+	if c.enabled() {
+		cfg, err := c.config(true)
+		if err != nil {
+			return nil, err
+		}
+		d := tls.Dialer{Config: cfg}
+		return d.DialContext(ctx, "tcp", address)
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, err
+	}
+	// enable nagle
+	if tcp, ok := conn.(*net.TCPConn); ok {
+		tcp.SetNoDelay(false)
+	}
+	return conn, nil
+}
+
+// listen listens for senders on address
+func listen(address string, c TLSConfig) (net.Listener, error) {
+	if c.enabled() {
+		cfg, err := c.config(false)
+		if err != nil {
+			return nil, err
+		}
+		return tls.Listen("tcp", address, cfg)
+	}
+	return net.Listen("tcp", address)
+}
+
+// peer identifies the sender of conn by the common name of its verified
+// certificate, or else by the host of its address
+func peer(conn net.Conn) string {
+	if t, ok := conn.(*tls.Conn); ok {
+		if err := t.Handshake(); err == nil {
+			if chains := t.ConnectionState().VerifiedChains; len(chains) > 0 && chains[0][0].Subject.CommonName != "" {
+				return chains[0][0].Subject.CommonName
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+	if err != nil {
+		return conn.RemoteAddr().String()
+	}
+	return host
+}
+
+// closeOnDone closes conn once ctx is done, to stop a protocol blocked on
+// it, until the returned function is called
+func closeOnDone(ctx context.Context, conn net.Conn) func() bool {
+	return context.AfterFunc(ctx, func() { conn.Close() })
+}
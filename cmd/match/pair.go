@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/gtank/ristretto255"
+	"github.com/optable/match/pkg/input"
+	"github.com/optable/match/pkg/pair"
+)
+
+// pairKey is the key file of pair, holding a salt and a private key
+type pairKey struct {
+	Mode pair.PAIRMode `json:"mode"`
+	// Salt is shared by the publisher with the advertiser
+	Salt []byte `json:"salt"`
+	// Scalar is the base64 encoded private key
+	Scalar string `json:"scalar"`
+}
+
+// pairActions are the actions of pair on each identifier of the input
+var pairActions = map[string]func(*pair.PrivateKey, []byte) ([]byte, error){
+	"encrypt":   (*pair.PrivateKey).Encrypt,
+	"reencrypt": (*pair.PrivateKey).ReEncrypt,
+	"decrypt":   (*pair.PrivateKey).Decrypt,
+}
+
+// pairCommand generates PAIR keys with its keygen action, and encrypts,
+// re-encrypts or decrypts the identifiers of a file with its other actions
+func pairCommand(ctx context.Context, args []string, stdout io.Writer) (*Summary, *Config, error) {
+	if len(args) == 0 || (args[0] != "keygen" && pairActions[args[0]] == nil) {
+		return nil, nil, usageError{errors.New("usage: match pair keygen|encrypt|reencrypt|decrypt [flags]")}
+	}
+	action, args := args[0], args[1:]
+	fs, cfg, err := newFlagSet("pair "+action, args)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyPath := fs.String("key", "pair-key.json", "The JSON key file")
+	if action == "keygen" {
+		salt := fs.String("salt", "", "The base64 salt shared by the publisher, random if empty")
+		if err := parse(fs, args); err != nil {
+			return nil, nil, err
+		}
+		return &Summary{Output: *keyPath}, cfg, keygen(*keyPath, *salt)
+	}
+	inputFlags(fs, cfg)
+	outputFlags(fs, cfg, "The file of the output identifiers, - for stdout")
+	if err := parse(fs, args); err != nil {
+		return nil, nil, err
+	}
+	if err := checkOutputFormat(cfg.Output.Format); err != nil {
+		return nil, cfg, err
+	}
+	if cfg.Input.Path == "" {
+		return nil, cfg, usageError{errors.New("an input file is required, set -in")}
+	}
+	summary := &Summary{Output: cfg.Output.Path}
+
+	pk, err := readPairKey(*keyPath)
+	if err != nil {
+		return summary, cfg, err
+	}
+	opts, err := cfg.Input.options()
+	if err != nil {
+		return summary, cfg, err
+	}
+	n, err := transform(ctx, cfg, opts, stdout, func(identifier []byte) ([]byte, error) {
+		return pairActions[action](pk, identifier)
+	})
+	summary.Identifiers = &n
+	newLogger(cfg).Info("transformed", "action", action, "identifiers", n, "output", cfg.Output.Path)
+	return summary, cfg, err
+}
+
+// keygen writes a new key to path with salt, a new one if it is empty
+func keygen(path, salt string) error {
+	key := pairKey{Mode: pair.PAIRSHA256Ristretto255, Salt: make([]byte, 32)}
+	if salt != "" {
+		b, err := base64.StdEncoding.DecodeString(salt)
+		if err != nil {
+			return usageError{fmt.Errorf("salt: %w", err)}
+		}
+		key.Salt = b
+	} else if _, err := rand.Read(key.Salt); err != nil {
+		return err
+	}
+
+	var uniform [64]byte
+	if _, err := rand.Read(uniform[:]); err != nil {
+		return err
+	}
+	scalar, err := ristretto255.NewScalar().FromUniformBytes(uniform[:]).MarshalText()
+	if err != nil {
+		return err
+	}
+	key.Scalar = string(scalar)
+	// check the key before writing it
+	if _, err := key.Mode.New(key.Salt, scalar); err != nil {
+		return usageError{err}
+	}
+
+	b, err := json.MarshalIndent(key, "", "  ")
+	if err != nil {
+		return err
+	}
+	// keys are not overwritten
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// readPairKey reads the key file at path
+func readPairKey(path string) (*pair.PrivateKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var key pairKey
+	if err := json.Unmarshal(b, &key); err != nil {
+		return nil, fmt.Errorf("key %s: %w", path, err)
+	}
+	return key.Mode.New(key.Salt, []byte(key.Scalar))
+}
+
+// transform writes each identifier of the input of cfg through f to its
+// output, and returns the number of identifiers written
+func transform(ctx context.Context, cfg *Config, opts input.Options, stdout io.Writer, f func([]byte) ([]byte, error)) (n int, err error) {
+	r, err := input.Open(cfg.Input.Path, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	w, closeOutput, err := createOutput(cfg.Output.Path, stdout)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if cerr := closeOutput(); err == nil {
+			err = cerr
+		}
+	}()
+	iw, err := newIdentifierWriter(w, cfg.Output.Format)
+	if err != nil {
+		return 0, err
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return n, err
+		}
+		identifier, err := r.Read()
+		if err == io.EOF {
+			return n, iw.Flush()
+		} else if err != nil {
+			return n, err
+		}
+		out, err := f(identifier)
+		if err != nil {
+			return n, fmt.Errorf("identifier %d: %w", n+1, err)
+		}
+		if err := iw.Write(out); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
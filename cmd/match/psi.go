@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+
+	"github.com/go-logr/logr"
+	"github.com/optable/match/pkg/input"
+	"github.com/optable/match/pkg/options"
+	"github.com/optable/match/pkg/psi"
+)
+
+// openInput counts the identifiers of the input of cfg and opens it
+func openInput(cfg *Config) (int64, *input.Reader, error) {
+	if cfg.Input.Path == "" {
+		return 0, nil, usageError{errors.New("an input file is required, set -in")}
+	}
+	opts, err := cfg.Input.options()
+	if err != nil {
+		return 0, nil, err
+	}
+	n, err := input.Count(cfg.Input.Path, opts)
+	if err != nil {
+		return 0, nil, fmt.Errorf("counting %s: %w", cfg.Input.Path, err)
+	}
+	r, err := input.Open(cfg.Input.Path, opts)
+	if err != nil {
+		return 0, nil, err
+	}
+	return n, r, nil
+}
+
+// protocolLimits returns the option setting the limits of cfg on a
+// protocol run, which records the first cardinality the peer announces
+func protocolLimits(cfg *Config, announced *atomic.Int64) options.Option {
+	announced.Store(-1)
+	l := cfg.Limits.limits()
+	l.Observer = func(n int64) {
+		announced.CompareAndSwap(-1, n)
+	}
+	return options.WithLimits(l)
+}
+
+// send sends the identifiers of a file to a receiver
+func send(ctx context.Context, args []string, _ io.Writer) (*Summary, *Config, error) {
+	fs, cfg, err := newFlagSet("send", args)
+	if err != nil {
+		return nil, nil, err
+	}
+	fs.StringVar(&cfg.Address, "a", cfg.Address, "The receiver address")
+	protocolFlags(fs, cfg)
+	inputFlags(fs, cfg)
+	tlsFlags(fs, cfg)
+	if err := parse(fs, args); err != nil {
+		return nil, nil, err
+	}
+	p, err := psi.ParseProtocol(cfg.Protocol)
+	if err != nil {
+		return nil, cfg, usageError{err}
+	}
+	summary := &Summary{Protocol: p.String()}
+	logger := newLogger(cfg)
+
+	n, r, err := openInput(cfg)
+	if err != nil {
+		return summary, cfg, err
+	}
+	defer r.Close()
+	summary.SenderSize = &n
+	logger.Info("sending", "identifiers", n, "input", cfg.Input.Path, "protocol", p.String())
+
+	conn, err := dial(ctx, cfg.Address, cfg.TLS)
+	if err != nil {
+		return summary, cfg, err
+	}
+	defer conn.Close()
+	defer closeOnDone(ctx, conn)()
+
+	var announced atomic.Int64
+	s, err := psi.NewSender(p, conn, protocolLimits(cfg, &announced))
+	if err != nil {
+		return summary, cfg, err
+	}
+	err = s.Send(logr.NewContext(ctx, logger), n, r.Identifiers(n))
+	if size := announced.Load(); size >= 0 {
+		summary.ReceiverSize = &size
+	}
+	if ctx.Err() != nil {
+		return summary, cfg, ctx.Err()
+	}
+	if err != nil {
+		return summary, cfg, err
+	}
+	return summary, cfg, r.Err()
+}
+
+// receive intersects the identifiers of a file with those of one sender
+func receive(ctx context.Context, args []string, stdout io.Writer) (*Summary, *Config, error) {
+	fs, cfg, err := newFlagSet("receive", args)
+	if err != nil {
+		return nil, nil, err
+	}
+	fs.StringVar(&cfg.Address, "a", cfg.Address, "The address to listen on")
+	protocolFlags(fs, cfg)
+	inputFlags(fs, cfg)
+	outputFlags(fs, cfg, "The file of the intersection, - for stdout")
+	tlsFlags(fs, cfg)
+	if err := parse(fs, args); err != nil {
+		return nil, nil, err
+	}
+	p, err := psi.ParseProtocol(cfg.Protocol)
+	if err != nil {
+		return nil, cfg, usageError{err}
+	}
+	if err := checkOutputFormat(cfg.Output.Format); err != nil {
+		return nil, cfg, err
+	}
+	summary := &Summary{Protocol: p.String(), Output: cfg.Output.Path}
+	logger := newLogger(cfg)
+
+	n, r, err := openInput(cfg)
+	if err != nil {
+		return summary, cfg, err
+	}
+	defer r.Close()
+	summary.ReceiverSize = &n
+
+	l, err := listen(cfg.Address, cfg.TLS)
+	if err != nil {
+		return summary, cfg, err
+	}
+	logger.Info("receiving", "identifiers", n, "input", cfg.Input.Path, "protocol", p.String(), "address", l.Addr().String())
+	conn, err := accept(ctx, l)
+	if err != nil {
+		return summary, cfg, err
+	}
+	defer conn.Close()
+	defer closeOnDone(ctx, conn)()
+	logger.Info("handling sender", "peer", peer(conn))
+
+	var announced atomic.Int64
+	rcv, err := psi.NewReceiver(p, conn, protocolLimits(cfg, &announced))
+	if err != nil {
+		return summary, cfg, err
+	}
+	intersection, err := rcv.Intersect(logr.NewContext(ctx, logger), n, r.Identifiers(n))
+	if size := announced.Load(); size >= 0 {
+		summary.SenderSize = &size
+	}
+	if ctx.Err() != nil {
+		return summary, cfg, ctx.Err()
+	}
+	if err != nil {
+		return summary, cfg, err
+	}
+	if err := r.Err(); err != nil {
+		return summary, cfg, err
+	}
+
+	matches := len(intersection)
+	summary.Matches = &matches
+	logger.Info("intersected", "matches", matches, "output", cfg.Output.Path)
+	return summary, cfg, writeIdentifiers(cfg.Output.Path, cfg.Output.Format, stdout, intersection)
+}
+
+// accept accepts one connection of l, which it closes, unless ctx is done first
+func accept(ctx context.Context, l net.Listener) (net.Conn, error) {
+	stop := context.AfterFunc(ctx, func() { l.Close() })
+	defer stop()
+	defer l.Close()
+	conn, err := l.Accept()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	return conn, err
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/optable/match/pkg/options"
+	"github.com/optable/match/pkg/psi"
+	"github.com/optable/match/pkg/server"
+)
+
+// serve intersects the identifiers of a file with every sender
+// connecting to it, until it is interrupted
+func serve(ctx context.Context, args []string, _ io.Writer) (*Summary, *Config, error) {
+	fs, cfg, err := newFlagSet("serve", args)
+	if err != nil {
+		return nil, nil, err
+	}
+	// the output of serve is a directory
+	if cfg.Output.Path == defaultConfig().Output.Path {
+		cfg.Output.Path = "."
+	}
+	if cfg.Server.AuditLog == "" {
+		cfg.Server.AuditLog = "audit.ndjson"
+	}
+	fs.StringVar(&cfg.Address, "a", cfg.Address, "The address to listen on")
+	protocolFlags(fs, cfg)
+	inputFlags(fs, cfg)
+	outputFlags(fs, cfg, "The directory of the intersection of each session, named after its peer and start")
+	tlsFlags(fs, cfg)
+	fs.StringVar(&cfg.Server.AuditLog, "audit-log", cfg.Server.AuditLog, "The NDJSON audit log of the sessions, which also restores the quotas")
+	fs.IntVar(&cfg.Server.QuotaSessions, "quota-sessions", cfg.Server.QuotaSessions, "The number of sessions of a peer within -quota-window, unlimited if 0")
+	fs.Var(&cfg.Server.QuotaWindow, "quota-window", "The sliding window of the session quota, such as 24h")
+	fs.Int64Var(&cfg.Server.MinSenderSize, "min-sender-size", cfg.Server.MinSenderSize, "The smallest number of identifiers a sender can announce")
+	fs.Float64Var(&cfg.Server.MaxOverlap, "max-overlap", cfg.Server.MaxOverlap, "The largest similarity, from 0 to 1, of the intersections of two sessions of a peer, unchecked if 0")
+	if err := parse(fs, args); err != nil {
+		return nil, nil, err
+	}
+	p, err := psi.ParseProtocol(cfg.Protocol)
+	if err != nil {
+		return nil, cfg, usageError{err}
+	}
+	if err := checkOutputFormat(cfg.Output.Format); err != nil {
+		return nil, cfg, err
+	}
+	if cfg.Server.QuotaSessions > 0 && cfg.Server.QuotaWindow.Duration <= 0 {
+		return nil, cfg, usageError{errors.New("-quota-sessions requires a -quota-window")}
+	}
+	summary := &Summary{Protocol: p.String(), Output: cfg.Output.Path}
+	logger := newLogger(cfg)
+
+	n, r, err := openInput(cfg)
+	if err != nil {
+		return summary, cfg, err
+	}
+	opts, _ := cfg.Input.options()
+	// every session opens the file again
+	r.Close()
+	summary.ReceiverSize = &n
+	if err := os.MkdirAll(cfg.Output.Path, 0755); err != nil {
+		return summary, cfg, err
+	}
+
+	s, err := server.New(server.Config{
+		Protocol:      p,
+		Options:       []options.Option{options.WithLimits(cfg.Limits.limits())},
+		Source:        server.FileSource(n, cfg.Input.Path, opts),
+		Peer:          peer,
+		Quota:         server.Quota{Sessions: cfg.Server.QuotaSessions, Window: cfg.Server.QuotaWindow.Duration},
+		MinSenderSize: cfg.Server.MinSenderSize,
+		MaxOverlap:    cfg.Server.MaxOverlap,
+		AuditLog:      cfg.Server.AuditLog,
+		Result: func(ctx context.Context, session server.Session, intersection [][]byte) error {
+			path := filepath.Join(cfg.Output.Path, resultName(session, cfg.Output.Format))
+			logger.Info("session finished", "peer", session.Peer, "matches", session.Matches, "output", path)
+			return writeIdentifiers(path, cfg.Output.Format, io.Discard, intersection)
+		},
+	})
+	if err != nil {
+		return summary, cfg, usageError{err}
+	}
+	defer s.Close()
+
+	l, err := listen(cfg.Address, cfg.TLS)
+	if err != nil {
+		return summary, cfg, err
+	}
+	logger.Info("serving", "identifiers", n, "input", cfg.Input.Path, "protocol", p.String(), "address", l.Addr().String())
+
+	start := time.Now()
+	err = s.Serve(logr.NewContext(ctx, logger), l)
+	sessions, rerr := server.ReadAuditLog(cfg.Server.AuditLog, start)
+	for _, session := range sessions {
+		summary.Sessions = append(summary.Sessions, sessionSummary(session))
+	}
+	// an interrupt is the end of serve
+	if ctx.Err() != nil {
+		logger.Info("stopped", "sessions", len(sessions))
+		return summary, cfg, rerr
+	}
+	return summary, cfg, errors.Join(err, rerr)
+}
+
+// resultName returns the file name of the intersection of session
+func resultName(session server.Session, format string) string {
+	if format == "" {
+		format = "txt"
+	}
+	peer := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-':
+			return r
+		default:
+			return '_'
+		}
+	}, session.Peer)
+	return fmt.Sprintf("%s-%s.%s", peer, session.Start.Format("20060102T150405.000000000Z"), format)
+}
+
+// sessionSummary returns the Summary of the audit record of a session
+func sessionSummary(session server.Session) Summary {
+	s := Summary{
+		Command:  "session",
+		Peer:     session.Peer,
+		Protocol: session.Protocol,
+		Duration: session.Duration.Seconds(),
+		Error:    session.Error,
+	}
+	// refused sessions do not open the identifiers
+	if !session.Refused {
+		s.ReceiverSize = &session.ReceiverSize
+	}
+	if session.SenderSize >= 0 {
+		s.SenderSize = &session.SenderSize
+	}
+	if session.Error == "" {
+		s.Matches = &session.Matches
+	} else {
+		s.ExitCode = exitFailure
+	}
+	return s
+}
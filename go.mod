@@ -3,19 +3,24 @@ module github.com/optable/match
 go 1.22
 
 require (
+	filippo.io/nistec v0.0.3
 	github.com/alecthomas/unsafeslice v0.1.0
 	github.com/bits-and-blooms/bloom/v3 v3.0.1
 	github.com/bwesterb/go-ristretto v1.2.0
+	github.com/dchest/siphash v1.2.3
 	github.com/dgryski/go-metro v0.0.0-20211015221634-2661b20a2446
 	github.com/go-logr/logr v1.2.0
-	github.com/go-logr/stdr v1.2.0
 	github.com/gtank/ristretto255 v0.1.2
+	github.com/klauspost/compress v1.18.0
 	github.com/twmb/murmur3 v1.1.6
 	github.com/zeebo/blake3 v0.2.0
+	github.com/zeebo/xxh3 v1.0.2
 	golang.org/x/sync v0.0.0-20210220032951-036812b2e83c
+	golang.org/x/sys v0.19.0
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
 	github.com/bits-and-blooms/bitset v1.2.0 // indirect
-	golang.org/x/sys v0.19.0 // indirect
+	github.com/klauspost/cpuid/v2 v2.0.11 // indirect
 )
@@ -5,8 +5,8 @@ package crypto
 import (
 	"crypto/aes"
 	"crypto/cipher"
+	"encoding/binary"
 
-	"github.com/alecthomas/unsafeslice"
 	"github.com/twmb/murmur3"
 )
 
@@ -32,18 +32,21 @@ func PseudorandomCode(aesBlock cipher.Block, src []byte, hIdx byte) []byte {
 	// hash id and the hash index
 	lo, hi := murmur3.SeedSum128(uint64(hIdx), uint64(hIdx), src)
 
-	// store in scratch slice
-	s := unsafeslice.ByteSliceFromUint64Slice([]uint64{lo, hi})
-	copy(s[1:], s) // shift for prepending
+	// store in scratch slice - shifted for prepending later.
+	// A slice header cast of the uint64s would not keep them alive
+	// across the AES calls, which may move or free the stack under it.
+	var s [1 + aes.BlockSize]byte
+	binary.LittleEndian.PutUint64(s[1:], lo)
+	binary.LittleEndian.PutUint64(s[9:], hi)
 
 	// encrypt
 	s[0] = 1
-	aesBlock.Encrypt(dst[:aes.BlockSize], s)
+	aesBlock.Encrypt(dst[:aes.BlockSize], s[:])
 	s[0] = 2
-	aesBlock.Encrypt(dst[aes.BlockSize:aes.BlockSize*2], s)
+	aesBlock.Encrypt(dst[aes.BlockSize:aes.BlockSize*2], s[:])
 	s[0] = 3
-	aesBlock.Encrypt(dst[aes.BlockSize*2:aes.BlockSize*3], s)
+	aesBlock.Encrypt(dst[aes.BlockSize*2:aes.BlockSize*3], s[:])
 	s[0] = 4
-	aesBlock.Encrypt(dst[aes.BlockSize*3:], s)
+	aesBlock.Encrypt(dst[aes.BlockSize*3:], s[:])
 	return dst
 }
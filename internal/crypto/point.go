@@ -1,97 +1,121 @@
 package crypto
 
 import (
+	"bytes"
+	"crypto/ecdh"
 	"crypto/elliptic"
 	"crypto/rand"
 	"fmt"
 	"io"
 	"math/big"
 
+	"filippo.io/nistec"
 	"github.com/zeebo/blake3"
 )
 
 /*
 High level api for operating on P256 elliptic curve Points.
+The arithmetic is the constant time one of filippo.io/nistec.
 */
 
-var (
-	curve     = elliptic.P256()
-	encodeLen = encodeLenWithCurve(curve)
+const (
+	// p256ElementLength is the length of a coordinate of a point
+	p256ElementLength = 32
+	// encodeLen is the number of bytes needed to encode a point
+	encodeLen = 1 + p256ElementLength
 )
 
-// encodeLenWithCurve returns the number of bytes needed to encode a point
-func encodeLenWithCurve(curve elliptic.Curve) int {
-	return len(elliptic.MarshalCompressed(curve, curve.Params().Gx, curve.Params().Gy))
-}
+// p256Order is the order of the P256 base point
+var p256Order = elliptic.P256().Params().N
 
 // Point represents a point on the P256 elliptic curve
 type Point struct {
-	x *big.Int
-	y *big.Int
+	p *nistec.P256Point
 }
 
-// NewPoint returns a Point
+// NewPoint returns a Point, set to the point at infinity
 func NewPoint() *Point {
-	return &Point{x: new(big.Int), y: new(big.Int)}
+	return &Point{p: nistec.NewP256Point()}
 }
 
-// Marshal converts a Point to a byte slice representation
+// Marshal converts a Point to a byte slice representation,
+// the compressed encoding of SEC 1 of encodeLen bytes.
+// The point at infinity is encoded as zeros, which do not unmarshal.
 func (p *Point) Marshal() []byte {
-	return elliptic.MarshalCompressed(curve, p.x, p.y)
+	b := p.p.BytesCompressed()
+	if len(b) != encodeLen {
+		return make([]byte, encodeLen)
+	}
+	return b
 }
 
 // Unmarshal takes in a marshaledPoint byte slice and extracts the Point object
 func (p *Point) Unmarshal(marshaledPoint []byte) error {
-	x, y := elliptic.UnmarshalCompressed(curve, marshaledPoint)
-
-	// on error of Unmarshal, x is nil
-	if x == nil {
+	if len(marshaledPoint) != encodeLen {
 		return fmt.Errorf("error unmarshalling elliptic curve point")
 	}
 
-	p.x.Set(x)
-	p.y.Set(y)
+	if _, err := p.p.SetBytes(marshaledPoint); err != nil {
+		return fmt.Errorf("error unmarshalling elliptic curve point: %w", err)
+	}
+
 	return nil
 }
 
 // Add adds two points
 func (p *Point) Add(q *Point) *Point {
-	x, y := curve.Add(p.x, p.y, q.x, q.y)
-	return &Point{x: x, y: y}
+	r := NewPoint()
+	r.p.Add(p.p, q.p)
+	return r
 }
 
-// ScalarMult multiplies a point with a scalar
+// ScalarMult multiplies a point with a big endian scalar. Its time
+// depends on the length of the scalar, but not on the value of the
+// scalars of up to 32 bytes, such as the ones of GenerateKey.
 func (p *Point) ScalarMult(scalar []byte) *Point {
-	x, y := curve.ScalarMult(p.x, p.y, scalar)
-	return &Point{x: x, y: y}
+	var s [p256ElementLength]byte
+	if len(scalar) > len(s) {
+		new(big.Int).Mod(new(big.Int).SetBytes(scalar), p256Order).FillBytes(s[:])
+	} else {
+		copy(s[len(s)-len(scalar):], scalar)
+	}
+	r := NewPoint()
+	// a scalar of 32 bytes never fails
+	r.p.ScalarMult(p.p, s[:])
+	return r
 }
 
-// Sub substracts point p from q
+// Sub substracts point q from p
 func (p *Point) Sub(q *Point) *Point {
-	// in order to do point subtraction, we need to make sure
-	// the negative point is still mapped properly in the field elements.
-	negQy := new(big.Int).Neg(q.y)
-	negQy = negQy.Mod(negQy, curve.Params().P) // here P is the order of the curve field
-
-	// p - q = p.x + q.x, p.y - q.y
-	x, y := curve.Add(p.x, p.y, q.x, negQy)
-	return &Point{x: x, y: y}
+	// p - q = p + (-q), where -q = (q.x, -q.y)
+	negQ := NewPoint()
+	negQ.p.Negate(q.p)
+	return p.Add(negQ)
 }
 
-// DeriveKeyFromECPoint returns a key of 32 byte
+// DeriveKeyFromECPoint returns a key of 32 byte, hashing the x coordinate
+// of the point without its leading zeros, as in the math/big encoding
+// used by the first versions of the Naor-Pinkas OT.
 func (p *Point) DeriveKeyFromECPoint() []byte {
-	key := blake3.Sum256(p.x.Bytes())
+	// the point at infinity has no x coordinate, it was encoded as zero
+	x, _ := p.p.BytesX()
+	key := blake3.Sum256(bytes.TrimLeft(x, "\x00"))
 	return key[:]
 }
 
 // GenerateKey returns a secret and public key pair
 func GenerateKey() ([]byte, *Point, error) {
-	secret, x, y, err := elliptic.GenerateKey(curve, rand.Reader)
+	priv, err := ecdh.P256().GenerateKey(rand.Reader)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	return secret, &Point{x: x, y: y}, nil
+	pub := NewPoint()
+	if _, err := pub.p.SetBytes(priv.PublicKey().Bytes()); err != nil {
+		return nil, nil, err
+	}
+
+	return priv.Bytes(), pub, nil
 }
 
 // pointWriter for elliptic curve points
@@ -132,5 +156,5 @@ func (r *pointReader) Read(p *Point) (err error) {
 
 // Equal returns true when 2 points are equal
 func (p *Point) equal(q *Point) bool {
-	return p.x.Cmp(q.x) == 0 && p.y.Cmp(q.y) == 0
+	return bytes.Equal(p.p.Bytes(), q.p.Bytes())
 }
@@ -1,11 +1,28 @@
 package crypto
 
 import (
+	"bytes"
+	"encoding/hex"
 	"fmt"
 	"math/big"
 	"testing"
 )
 
+// testPoint returns the point of affine coordinates x and y in base
+func testPoint(x, y string, base int) *Point {
+	bx, _ := new(big.Int).SetString(x, base)
+	by, _ := new(big.Int).SetString(y, base)
+	uncompressed := make([]byte, 1+2*p256ElementLength)
+	uncompressed[0] = 4
+	bx.FillBytes(uncompressed[1 : 1+p256ElementLength])
+	by.FillBytes(uncompressed[1+p256ElementLength:])
+	p := NewPoint()
+	if _, err := p.p.SetBytes(uncompressed); err != nil {
+		panic(err)
+	}
+	return p
+}
+
 type addTest struct {
 	xLeft, yLeft   string
 	xRight, yRight string
@@ -33,22 +50,17 @@ var addTests = []addTest{
 
 func TestAdd(t *testing.T) {
 	for i, e := range addTests {
-		xL, _ := new(big.Int).SetString(e.xLeft, 10)
-		yL, _ := new(big.Int).SetString(e.yLeft, 10)
-		xR, _ := new(big.Int).SetString(e.xRight, 10)
-		yR, _ := new(big.Int).SetString(e.yRight, 10)
-		pointL := &Point{x: xL, y: yL}
-		pointR := &Point{x: xR, y: yR}
-		expectedX, _ := new(big.Int).SetString(e.xOut, 10)
-		expectedY, _ := new(big.Int).SetString(e.yOut, 10)
+		pointL := testPoint(e.xLeft, e.yLeft, 10)
+		pointR := testPoint(e.xRight, e.yRight, 10)
+		expected := testPoint(e.xOut, e.yOut, 10)
 		sum1 := pointL.Add(pointR)
-		if !sum1.equal(&Point{x: expectedX, y: expectedY}) {
-			t.Errorf("#%d: got (%s, %s), want (%s, %s)", i, sum1.x.String(), sum1.y.String(), expectedX.String(), expectedY.String())
+		if !sum1.equal(expected) {
+			t.Errorf("#%d: got %x, want %x", i, sum1.Marshal(), expected.Marshal())
 		}
 
-		sum2 := pointL.Add(pointR)
-		if !sum2.equal(&Point{x: expectedX, y: expectedY}) {
-			t.Errorf("#%d: got (%s, %s), want (%s, %s)", i, sum2.x.String(), sum2.y.String(), expectedX.String(), expectedY.String())
+		sum2 := pointR.Add(pointL)
+		if !sum2.equal(expected) {
+			t.Errorf("#%d: got %x, want %x", i, sum2.Marshal(), expected.Marshal())
 		}
 	}
 }
@@ -78,34 +90,26 @@ var scalarMultTests = []scalarMultTest{
 
 func TestScalarMult(t *testing.T) {
 	for i, e := range scalarMultTests {
-		x, _ := new(big.Int).SetString(e.xIn, 16)
-		y, _ := new(big.Int).SetString(e.yIn, 16)
 		k, _ := new(big.Int).SetString(e.k, 16)
-		point := &Point{x: x, y: y}
-		expectedX, _ := new(big.Int).SetString(e.xOut, 16)
-		expectedY, _ := new(big.Int).SetString(e.yOut, 16)
+		point := testPoint(e.xIn, e.yIn, 16)
+		expected := testPoint(e.xOut, e.yOut, 16)
 
 		kPoint := point.ScalarMult(k.Bytes())
-		if !kPoint.equal(&Point{x: expectedX, y: expectedY}) {
-			t.Errorf("#%d: got (%x, %x), want (%x, %x)", i, kPoint.x, kPoint.y, expectedX, expectedY)
+		if !kPoint.equal(expected) {
+			t.Errorf("#%d: got %x, want %x", i, kPoint.Marshal(), expected.Marshal())
 		}
 	}
 }
 
 func TestSub(t *testing.T) {
 	for i, e := range addTests {
-		expectedX, _ := new(big.Int).SetString(e.xLeft, 10)
-		expectedY, _ := new(big.Int).SetString(e.yLeft, 10)
-		x, _ := new(big.Int).SetString(e.xRight, 10)
-		y, _ := new(big.Int).SetString(e.yRight, 10)
-		xSum, _ := new(big.Int).SetString(e.xOut, 10)
-		ySum, _ := new(big.Int).SetString(e.yOut, 10)
-		point := &Point{x: x, y: y}
-		sum := &Point{x: xSum, y: ySum}
+		expected := testPoint(e.xLeft, e.yLeft, 10)
+		point := testPoint(e.xRight, e.yRight, 10)
+		sum := testPoint(e.xOut, e.yOut, 10)
 
 		diff := sum.Sub(point)
-		if !diff.equal(&Point{x: expectedX, y: expectedY}) {
-			t.Errorf("#%d: got (%s, %s), want (%s, %s)", i, diff.x.String(), diff.y.String(), expectedX.String(), expectedY.String())
+		if !diff.equal(expected) {
+			t.Errorf("#%d: got %x, want %x", i, diff.Marshal(), expected.Marshal())
 		}
 	}
 }
@@ -133,9 +137,7 @@ var keyMarshalTests = []keyMarshalTest{
 
 func TestDeriveKeyPoint(t *testing.T) {
 	for i, e := range keyMarshalTests {
-		x, _ := new(big.Int).SetString(e.x, 10)
-		y, _ := new(big.Int).SetString(e.y, 10)
-		point := &Point{x: x, y: y}
+		point := testPoint(e.x, e.y, 10)
 		key := point.DeriveKeyFromECPoint()
 
 		if fmt.Sprintf("%x", key) != e.key {
@@ -146,9 +148,7 @@ func TestDeriveKeyPoint(t *testing.T) {
 
 func TestMarshalUnmarshal(t *testing.T) {
 	for i, e := range keyMarshalTests {
-		x, _ := new(big.Int).SetString(e.x, 10)
-		y, _ := new(big.Int).SetString(e.y, 10)
-		point := &Point{x: x, y: y}
+		point := testPoint(e.x, e.y, 10)
 
 		marshaled := point.Marshal()
 		if fmt.Sprintf("%x", marshaled) != e.marshal {
@@ -156,15 +156,122 @@ func TestMarshalUnmarshal(t *testing.T) {
 		}
 
 		unmarshalPoint := NewPoint()
-		unmarshalPoint.Unmarshal(marshaled)
+		if err := unmarshalPoint.Unmarshal(marshaled); err != nil {
+			t.Fatalf("#%d: %v", i, err)
+		}
 		if !point.equal(unmarshalPoint) {
-			t.Errorf("#%d: got (%x, %x), want (%x, %x)", i, unmarshalPoint.x, unmarshalPoint.y, point.x, point.y)
+			t.Errorf("#%d: got %x, want %x", i, unmarshalPoint.Marshal(), point.Marshal())
+		}
+	}
+
+	// the point at infinity and points off the curve do not unmarshal
+	infinity := NewPoint().Marshal()
+	if len(infinity) != encodeLen {
+		t.Errorf("expected %d bytes for the point at infinity, got %d", encodeLen, len(infinity))
+	}
+	for _, b := range [][]byte{infinity, append([]byte{2}, bytes.Repeat([]byte{0xff}, p256ElementLength)...), {2}} {
+		if err := NewPoint().Unmarshal(b); err == nil {
+			t.Errorf("expected an error unmarshalling %x", b)
 		}
 	}
 }
 
+func TestGenerateKey(t *testing.T) {
+	secret, public, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	g := NewPoint()
+	g.p.SetGenerator()
+	if !g.ScalarMult(secret).equal(public) {
+		t.Error("the public key is not the secret times the generator")
+	}
+}
+
+// naorPinkasTests are known answers of the points and keys of the
+// Naor-Pinkas OT, computed with the math/big implementation of P256,
+// for the secrets a of the sender, r of the sender and b of the receiver
+var naorPinkasTests = struct {
+	a, r, b    string
+	pA, pR, pB string
+	aMinusB    string
+	// keys derived from rB and rA - rB
+	keyRB, keyRAMinusRB string
+}{
+	"2a265f8bcbdcaf94d58519141e578124cb40d64a501fba9c11847b28965bc737",
+	"313f72ff9fe811bf573176231b286a3bdb6f1b14e05c40146590727a71c3bccd",
+	"6f612185e1b2d64a0657fc056e156a895f2d0b92a398c22fb9816d0de476db2c",
+	"031c007ceecf215608677a287f8e70ba6ed5c0465844bd88c9e35171312f3468a6",
+	"025a062b0b18921317affbb3d42c3dbfcab296cbf23041a6008204c3b831c6df6e",
+	"02ea9c0f8866bfeb1282ccc749909222d1fd482287cdf5562f49b26e416ccbb4af",
+	"0393b0d1e95f52162919eb562629cd4bb1ee36773af57e57ab901c8dcf6cd62213",
+	"1b972846b9d5099a83f1df9a7e8bb7e766acdcc63a6ee6afc2eadf2e8a339409",
+	"29692c364949d559a370827962cea53f9da8476f8b5cb03a4f7bfaa5dee64dea",
+}
+
+// TestNaorPinkasKAT checks that the transcript of the Naor-Pinkas OT,
+// the marshaled points and the derived keys, did not change
+func TestNaorPinkasKAT(t *testing.T) {
+	e := naorPinkasTests
+	g := NewPoint()
+	g.p.SetGenerator()
+	scalar := func(s string) []byte {
+		b, _ := hex.DecodeString(s)
+		return b
+	}
+	// the sender reads the points written by the receiver
+	point := func(s string) *Point {
+		var buf bytes.Buffer
+		buf.Write(scalar(s))
+		p := NewPoint()
+		if err := NewECPointReader(&buf).Read(p); err != nil {
+			t.Fatalf("reading %s: %v", s, err)
+		}
+		return p
+	}
+	expectPoint := func(name string, p *Point, want string) {
+		var buf bytes.Buffer
+		NewECPointWriter(&buf).Write(p)
+		if got := hex.EncodeToString(buf.Bytes()); got != want {
+			t.Errorf("%s: got %s, want %s", name, got, want)
+		}
+	}
+	expectKey := func(name string, p *Point, want string) {
+		if got := hex.EncodeToString(p.DeriveKeyFromECPoint()); got != want {
+			t.Errorf("%s: got key %s, want %s", name, got, want)
+		}
+	}
+
+	pointA := g.ScalarMult(scalar(e.a))
+	pointR := g.ScalarMult(scalar(e.r))
+	pointB := g.ScalarMult(scalar(e.b))
+	expectPoint("A", pointA, e.pA)
+	expectPoint("R", pointR, e.pR)
+	expectPoint("B", pointB, e.pB)
+	expectPoint("A - B", pointA.Sub(pointB), e.aMinusB)
+
+	// the receiver sends K0 = B for the choice 0 and K0 = A - B for
+	// the choice 1, the sender derives its keys from rK0 and rA - rK0
+	for choice, k0 := range []string{e.pB, e.aMinusB} {
+		k0r := point(k0).ScalarMult(scalar(e.r))
+		k1r := pointA.ScalarMult(scalar(e.r)).Sub(k0r)
+		keys := [2]string{e.keyRB, e.keyRAMinusRB}
+		expectKey(fmt.Sprintf("choice %d: k0", choice), k0r, keys[choice])
+		expectKey(fmt.Sprintf("choice %d: k1", choice), k1r, keys[1-choice])
+	}
+	// the receiver derives the key of its choice from bR
+	expectKey("bR", point(e.pR).ScalarMult(scalar(e.b)), e.keyRB)
+
+	// the x coordinate of 379G starts with a zero byte, which is
+	// not hashed into the key
+	p := g.ScalarMult([]byte{0x01, 0x7b})
+	expectPoint("379G", p, "02005543894af3d00ed7d740abdbd75c96b06877b787db5f70eea78b90a8d7c00a")
+	expectKey("379G", p, "c2d2fbf8263d89173356d37da3f493c06b8002d4addd59048eb9e6949cac244a")
+}
+
 func BenchmarkDeriveKey(b *testing.B) {
-	p := &Point{x: big.NewInt(1), y: big.NewInt(2)}
+	p := NewPoint()
+	p.p.SetGenerator()
 	b.ResetTimer()
 
 	for i := 0; i < b.N; i++ {
@@ -173,7 +280,8 @@ func BenchmarkDeriveKey(b *testing.B) {
 }
 
 func BenchmarkSub(b *testing.B) {
-	p := &Point{x: big.NewInt(1), y: big.NewInt(2)}
+	p := NewPoint()
+	p.p.SetGenerator()
 	b.ResetTimer()
 
 	for i := 0; i < b.N; i++ {
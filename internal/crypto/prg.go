@@ -1,14 +1,221 @@
 package crypto
 
 import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+
 	"github.com/zeebo/blake3"
 )
 
+// PRG identifies a pseudorandom generator expanding a seed into a stream
+type PRG uint8
+
+const (
+	// PRGBlake3 expands the seed with the BLAKE3 XOF, the default
+	PRGBlake3 PRG = iota
+	// PRGAESCTR encrypts zeros with AES-128 in counter mode, keyed with the
+	// first 16 bytes of the seed and starting from the next 16 bytes
+	PRGAESCTR
+	// PRGCTRDRBG is the CTR_DRBG of NIST SP 800-90A Revision 1 with AES-256
+	// and no derivation function, instantiated with the first 48 bytes of the
+	// seed as its entropy input and the rest as its personalization string
+	PRGCTRDRBG
+)
+
+const (
+	// aesCTRSeedLen is the minimum length of the seed of PRGAESCTR
+	aesCTRSeedLen = 16
+	// drbgKeyLen is the length of the AES-256 key of CTR_DRBG
+	drbgKeyLen = 32
+	// drbgSeedLen is the length of the entropy input of CTR_DRBG
+	drbgSeedLen = drbgKeyLen + aes.BlockSize
+	// drbgRequestLen is the number of bytes generated by each request
+	// of CTR_DRBG, below the maximum of 2^19 bits of SP 800-90A
+	drbgRequestLen = 1 << 14
+	// drbgReseedInterval is the maximum number of requests of CTR_DRBG
+	drbgReseedInterval = 1 << 48
+)
+
+var (
+	ErrUnknownPRG     = errors.New("unknown pseudorandom generator")
+	ErrPRGSeedLen     = errors.New("seed length not supported by the pseudorandom generator")
+	ErrReseedRequired = errors.New("CTR_DRBG must be reseeded")
+)
+
+var prgNames = map[PRG]string{
+	PRGBlake3:  "blake3",
+	PRGAESCTR:  "aes-ctr",
+	PRGCTRDRBG: "ctr-drbg",
+}
+
+// Valid returns true if p is a known pseudorandom generator
+func (p PRG) Valid() bool {
+	_, ok := prgNames[p]
+	return ok
+}
+
+// DRBG returns true if p is a deterministic random bit
+// generator specified by NIST SP 800-90A
+func (p PRG) DRBG() bool {
+	return p == PRGCTRDRBG
+}
+
+// String returns the name of p
+func (p PRG) String() string {
+	if name, ok := prgNames[p]; ok {
+		return name
+	}
+	return "unknown"
+}
+
+// NewPRG returns the pseudorandom stream of p expanded from seed.
+// The stream does not depend on the length of the reads.
+func NewPRG(p PRG, seed []byte) (io.Reader, error) {
+	switch p {
+	case PRGBlake3:
+		h := blake3.New()
+		h.Write(seed)
+		return h.Digest(), nil
+	case PRGAESCTR:
+		if len(seed) < aesCTRSeedLen {
+			return nil, fmt.Errorf("%w: %s needs %d bytes, got %d", ErrPRGSeedLen, p, aesCTRSeedLen, len(seed))
+		}
+		block, err := aes.NewCipher(seed[:aesCTRSeedLen])
+		if err != nil {
+			return nil, err
+		}
+		var iv [aes.BlockSize]byte
+		copy(iv[:], seed[aesCTRSeedLen:])
+		return streamReader{cipher.NewCTR(block, iv[:])}, nil
+	case PRGCTRDRBG:
+		if len(seed) < drbgSeedLen || len(seed) > 2*drbgSeedLen {
+			return nil, fmt.Errorf("%w: %s needs %d to %d bytes, got %d", ErrPRGSeedLen, p, drbgSeedLen, 2*drbgSeedLen, len(seed))
+		}
+		return newCTRDRBG(seed[:drbgSeedLen], seed[drbgSeedLen:]), nil
+	}
+	return nil, fmt.Errorf("%w: %d", ErrUnknownPRG, p)
+}
+
+// streamReader reads the key stream of a stream cipher
+type streamReader struct {
+	cipher.Stream
+}
+
+func (s streamReader) Read(p []byte) (int, error) {
+	clear(p)
+	s.XORKeyStream(p, p)
+	return len(p), nil
+}
+
+// ctrDRBG is a CTR_DRBG with AES-256, no derivation function,
+// no prediction resistance and no additional input.
+// Its output is buffered in requests of drbgRequestLen bytes,
+// which reads of whole requests bypass.
+type ctrDRBG struct {
+	// ctr holds the key K and counts from V+1
+	ctr      cipher.Stream
+	requests uint64
+	buf      []byte
+	unread   []byte
+}
+
+// newCTRDRBG returns a CTR_DRBG instantiated with entropy
+// and an optional personalization string, per Section 10.2.1.3.1
+func newCTRDRBG(entropy, personalization []byte) *ctrDRBG {
+	var seed [drbgSeedLen]byte
+	copy(seed[:], personalization)
+	subtle.XORBytes(seed[:], seed[:], entropy)
+
+	// K and V start at zero, V is incremented
+	// before each use, unlike the AES-CTR counter
+	var d = &ctrDRBG{requests: 1}
+	var key [drbgKeyLen]byte
+	var v [aes.BlockSize]byte
+	v[aes.BlockSize-1] = 1
+	block, _ := aes.NewCipher(key[:])
+	d.ctr = cipher.NewCTR(block, v[:])
+	d.update(&seed)
+	return d
+}
+
+// update is CTR_DRBG_Update, per Section 10.2.1.2
+func (d *ctrDRBG) update(provided *[drbgSeedLen]byte) {
+	var temp [drbgSeedLen]byte
+	d.ctr.XORKeyStream(temp[:], provided[:])
+	v := (*[aes.BlockSize]byte)(temp[drbgKeyLen:])
+	increment(v)
+	block, _ := aes.NewCipher(temp[:drbgKeyLen])
+	d.ctr = cipher.NewCTR(block, v[:])
+}
+
+// generate is CTR_DRBG_Generate, per Section 10.2.1.5.1, filling out
+// with a multiple of aes.BlockSize bytes, up to drbgRequestLen.
+// A nil additional input is replaced by zeros after the output.
+func (d *ctrDRBG) generate(out []byte, additional *[drbgSeedLen]byte) error {
+	if d.requests > drbgReseedInterval {
+		return ErrReseedRequired
+	}
+	if additional != nil {
+		d.update(additional)
+	} else {
+		additional = new([drbgSeedLen]byte)
+	}
+	clear(out)
+	d.ctr.XORKeyStream(out, out)
+	d.update(additional)
+	d.requests++
+	return nil
+}
+
+// Read fills p from the output of successive requests
+func (d *ctrDRBG) Read(p []byte) (n int, err error) {
+	for len(p) > 0 {
+		if len(d.unread) == 0 {
+			// generate whole requests in place
+			if len(p) >= drbgRequestLen {
+				if err := d.generate(p[:drbgRequestLen], nil); err != nil {
+					return n, err
+				}
+				p = p[drbgRequestLen:]
+				n += drbgRequestLen
+				continue
+			}
+			if d.buf == nil {
+				d.buf = make([]byte, drbgRequestLen)
+			}
+			if err := d.generate(d.buf, nil); err != nil {
+				return n, err
+			}
+			d.unread = d.buf
+		}
+		c := copy(p, d.unread)
+		d.unread = d.unread[c:]
+		p = p[c:]
+		n += c
+	}
+	return n, nil
+}
+
+// increment adds one to the big endian counter v
+func increment(v *[aes.BlockSize]byte) {
+	for i := len(v) - 1; i >= 0; i-- {
+		v[i]++
+		if v[i] != 0 {
+			return
+		}
+	}
+}
+
 // PseudorandomGenerate is a pseudorandom generator (PRG)
 // using a deterministic random bit generator (DRBG) as
 // specified by NIST - Special Publication 800-90A Revision
 // 1. Blake3 is not normally used as a DRBG but we've applied
-// it here for performance reasons.
+// it here for performance reasons. NewPRG with PRGCTRDRBG
+// returns the CTR_DRBG specified by SP 800-90A instead.
 func PseudorandomGenerate(dst []byte, seed []byte, h *blake3.Hasher) error {
 	if len(dst) < len(seed) {
 		copy(dst, seed)
@@ -0,0 +1,122 @@
+package crypto
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+var prgs = []PRG{PRGBlake3, PRGAESCTR, PRGCTRDRBG}
+
+// seq returns n bytes counting from first
+func seq(first byte, n int) (b []byte) {
+	for i := 0; i < n; i++ {
+		b = append(b, first+byte(i))
+	}
+	return
+}
+
+// TestCTRDRBG checks the known answer test of the CTR_DRBG of
+// the Go FIPS 140-3 module: instantiate, reseed and generate
+// with additional input.
+func TestCTRDRBG(t *testing.T) {
+	var reseed, additional [drbgSeedLen]byte
+	copy(reseed[:], seq(0x31, drbgSeedLen))
+	copy(additional[:], seq(0x61, drbgSeedLen))
+
+	d := newCTRDRBG(seq(0x01, drbgSeedLen), nil)
+	// reseeding is an update with the entropy
+	// input xored with the additional input
+	var seed [drbgSeedLen]byte
+	for i := range seed {
+		seed[i] = reseed[i] ^ additional[i]
+	}
+	d.update(&seed)
+	got := make([]byte, 32)
+	if err := d.generate(got, &additional); err != nil {
+		t.Fatal(err)
+	}
+	want, _ := hex.DecodeString("6e6e479d24f86a3b7787a8f8186d985a53bebeeddeab9228f0f4ac6e10bf0193")
+	if !bytes.Equal(got, want) {
+		t.Errorf("expected %x, got %x", want, got)
+	}
+
+	// the personalization string is xored with the entropy input
+	a, _ := NewPRG(PRGCTRDRBG, append(seq(0x01, drbgSeedLen), 0xff))
+	b, _ := NewPRG(PRGCTRDRBG, seq(0x01, drbgSeedLen))
+	if bytes.Equal(read(a, 64), read(b, 64)) {
+		t.Error("the personalization string is ignored")
+	}
+}
+
+// read returns the next n bytes of r
+func read(r io.Reader, n int) []byte {
+	b := make([]byte, n)
+	io.ReadFull(r, b)
+	return b
+}
+
+func TestPRG(t *testing.T) {
+	seed := make([]byte, 64)
+	rand.Read(seed)
+	for _, p := range prgs {
+		// the stream does not depend on the length of the reads
+		whole, err := NewPRG(p, seed)
+		if err != nil {
+			t.Fatalf("%s: %v", p, err)
+		}
+		want := read(whole, 3*drbgRequestLen+100)
+		chunked, _ := NewPRG(p, seed)
+		var got []byte
+		for _, n := range []int{1, 15, 17, drbgRequestLen, 2*drbgRequestLen + 67} {
+			got = append(got, read(chunked, n)...)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("%s: chunked reads differ from one read", p)
+		}
+
+		// different seeds expand into different streams
+		other, _ := NewPRG(p, append([]byte{seed[0] ^ 1}, seed[1:]...))
+		if bytes.Equal(read(other, 64), want[:64]) {
+			t.Errorf("%s: the first byte of the seed is ignored", p)
+		}
+		if !p.Valid() {
+			t.Errorf("%s is not valid", p)
+		}
+	}
+
+	if !PRGCTRDRBG.DRBG() || PRGAESCTR.DRBG() || PRGBlake3.DRBG() {
+		t.Error("wrong DRBGs")
+	}
+	if _, err := NewPRG(PRGAESCTR, seed[:15]); !errors.Is(err, ErrPRGSeedLen) {
+		t.Errorf("expected ErrPRGSeedLen, got %v", err)
+	}
+	for _, n := range []int{drbgSeedLen - 1, 2*drbgSeedLen + 1} {
+		if _, err := NewPRG(PRGCTRDRBG, make([]byte, n)); !errors.Is(err, ErrPRGSeedLen) {
+			t.Errorf("expected ErrPRGSeedLen for %d bytes, got %v", n, err)
+		}
+	}
+	if _, err := NewPRG(PRG(255), seed); !errors.Is(err, ErrUnknownPRG) || PRG(255).Valid() {
+		t.Errorf("expected ErrUnknownPRG, got %v", err)
+	}
+}
+
+func BenchmarkPRG(b *testing.B) {
+	seed := make([]byte, 64)
+	rand.Read(seed)
+	// a column of the OT extension of 2^18 OTs
+	dst := make([]byte, 1<<15)
+	for _, p := range prgs {
+		b.Run(fmt.Sprint(p), func(b *testing.B) {
+			r, _ := NewPRG(p, seed)
+			b.SetBytes(int64(len(dst)))
+			for i := 0; i < b.N; i++ {
+				r.Read(dst)
+			}
+		})
+	}
+}
@@ -4,48 +4,131 @@ import (
 	"bytes"
 	crand "crypto/rand"
 	"encoding/binary"
+	"errors"
 	"fmt"
-	"math/rand"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"sync/atomic"
 
 	"github.com/optable/match/internal/hash"
+	"golang.org/x/sync/errgroup"
 )
 
 const (
-	// Nhash is the number of hash function used for cuckoo hash
-	Nhash = 3
 	// ReInsertLimit is the maximum number of reinsertions.
 	// Each reinsertion kicks off 1 egg (item) and replace it
 	// with the item being reinserted, and then reinserts the
 	// kicked off egg
 	ReInsertLimit = 200
+	// SecurityParam is the statistical security parameter σ: parameters are
+	// valid when inserting fails with an estimated probability below 2^-σ
+	SecurityParam = 40
+	// MinNhash and MaxNhash bound the number of hash functions
+	MinNhash = 3
+	MaxNhash = 8
+	// MaxFactor bounds the capacity overhead of the hash table
+	MaxFactor = 4
+	// MaxStashSize bounds the number of items in the stash
+	MaxStashSize = 64
+	// SeedLen is the length of the seed of the random number
+	// generator of a Cuckoo hash table
+	SeedLen = 32
+)
+
+// ErrInvalidParams is returned when validating parameters that are out of
+// bounds, or whose estimated failure probability is above 2^-SecurityParam
+var ErrInvalidParams = errors.New("invalid cuckoo hash table parameters")
+
+// Params are the parameters of a cuckoo hash table
+type Params struct {
+	// Nhash is the number of hash functions, the number
+	// of possible buckets of an item
+	Nhash int
 	// Factor is the multiplicative factor of items to be
 	// inserted which represents the capacity overhead of
 	// the hash table to reduce risk of failure on insertion.
-	Factor = 1.4
-)
+	Factor float64
+	// StashSize is the number of items that can be stored in
+	// the stash when they cannot be inserted in the buckets
+	StashSize int
+	// Hasher is the hash function of the buckets, seeded with
+	// one seed per hash function
+	Hasher hash.ID
+}
+
+// DefaultParams are 3-way cuckoo hashing parameters with MetroHash, whose
+// estimated failure probability is below 2^-SecurityParam up to 2^40 items
+var DefaultParams = Params{Nhash: 3, Factor: 1.4, StashSize: 2}
+
+// BucketSize returns the number of buckets of a hash table of n items
+func (p Params) BucketSize(n uint64) uint64 {
+	return max(1, uint64(p.Factor*float64(n)))
+}
+
+// Len returns the number of slots of a hash table of n
+// items: its buckets followed by the slots of its stash
+func (p Params) Len(n uint64) uint64 {
+	return p.BucketSize(n) + uint64(p.StashSize)
+}
+
+// SecurityEstimate returns an estimate of the statistical security of
+// inserting n items, the opposite of the base 2 logarithm of the probability
+// that they cannot all be stored in the buckets. It is not a proven bound:
+// no tight bound is proven for more than 2 hash functions, and the estimate
+// extrapolates the linear fit of the experiments of PSZ18 [2] for 3 hash
+// functions, σ = 240·Factor - 256 - log2(n), to sets far larger than the
+// experiments. More hash functions only lower the failure probability, as the
+// items can still use their first 3 buckets. The stash is not accounted
+// for: it stores the items evicted by the bounded random walk insertion.
+func (p Params) SecurityEstimate(n uint64) float64 {
+	return 240*p.Factor - 256 - math.Log2(float64(max(1, n)))
+}
+
+// Validate returns ErrInvalidParams if the parameters are out of
+// bounds, or whose estimated security for n items is below SecurityParam
+func (p Params) Validate(n uint64) error {
+	switch {
+	case p.Nhash < MinNhash || p.Nhash > MaxNhash:
+		return fmt.Errorf("%w: %d hash functions, want between %d and %d", ErrInvalidParams, p.Nhash, MinNhash, MaxNhash)
+	case !(p.Factor >= 1 && p.Factor <= MaxFactor):
+		return fmt.Errorf("%w: factor %v, want between 1 and %d", ErrInvalidParams, p.Factor, MaxFactor)
+	case p.StashSize < 0 || p.StashSize > MaxStashSize:
+		return fmt.Errorf("%w: stash size %d, want at most %d", ErrInvalidParams, p.StashSize, MaxStashSize)
+	case !p.Hasher.Valid():
+		return fmt.Errorf("%w: %w", ErrInvalidParams, hash.ErrUnknownHasher)
+	case p.SecurityEstimate(n) < SecurityParam:
+		return fmt.Errorf("%w: an estimated %.1f bits of security for %d items, want %d", ErrInvalidParams, p.SecurityEstimate(n), n, SecurityParam)
+	}
+	return nil
+}
 
 // CuckooHasher is the building block of a Cuckoo hash table. It only holds
 // the bucket size and the hashers.
 type CuckooHasher struct {
 	// Total bucket count, len(bucket)
 	bucketSize uint64
-	// 3 hash functions h_0, h_1, h_2
-	hashers [Nhash]hash.Hasher
+	// Params.Nhash hash functions h_0, h_1, ...
+	hashers []hash.Hasher
 }
 
-// NewCuckooHasher instantiates a CuckooHasher struct.
-func NewCuckooHasher(size uint64, seeds [Nhash][]byte) *CuckooHasher {
-	bSize := max(1, uint64(Factor*float64(size)))
-	var hashers [Nhash]hash.Hasher
+// NewCuckooHasher instantiates a CuckooHasher struct for size items with
+// the parameters p, and one seed per hash function.
+func NewCuckooHasher(size uint64, seeds [][]byte, p Params) *CuckooHasher {
+	if len(seeds) != p.Nhash {
+		panic(fmt.Errorf("got %d seeds for %d hash functions", len(seeds), p.Nhash))
+	}
+	var hashers = make([]hash.Hasher, p.Nhash)
 	var err error
 	for i, s := range seeds {
-		if hashers[i], err = hash.NewMetroHasher(s); err != nil {
+		if hashers[i], err = hash.New(p.Hasher, s); err != nil {
 			panic(err)
 		}
 	}
 
 	return &CuckooHasher{
-		bucketSize: bSize,
+		bucketSize: p.BucketSize(size),
 		hashers:    hashers,
 	}
 }
@@ -55,71 +138,111 @@ func (h *CuckooHasher) GetHasher() hash.Hasher {
 	return h.hashers[0]
 }
 
-// BucketIndices returns the 3 possible bucket indices of an item
-func (h *CuckooHasher) BucketIndices(item []byte) (idxs [Nhash]uint64) {
+// Nhash returns the number of hash functions, which is also
+// the hash index of the items stored in the stash
+func (h *CuckooHasher) Nhash() int {
+	return len(h.hashers)
+}
+
+// BucketIndices returns the Nhash possible bucket indices of an item
+func (h *CuckooHasher) BucketIndices(item []byte) []uint64 {
+	var idxs = make([]uint64, len(h.hashers))
 	for i := range idxs {
-		idxs[i] = h.hashers[i].Hash64(item) % h.bucketSize
+		idxs[i] = h.bucketIndex(item, i)
 	}
 
 	return idxs
 }
 
-// Cuckoo represents a 3-way Cuckoo hash table data structure
-// that contains the items, bucket indices of each item and the 3
+// bucketIndex returns the bucket index of an item with the hash function hIdx
+func (h *CuckooHasher) bucketIndex(item []byte, hIdx int) uint64 {
+	return h.hashers[hIdx].Hash64(item) % h.bucketSize
+}
+
+// Stats are statistics on the insertions in a Cuckoo hash table
+type Stats struct {
+	// Inserted is the number of distinct items inserted
+	Inserted uint64
+	// Stashed is the number of items in the stash
+	Stashed int
+	// Evictions is the total number of evictions
+	Evictions uint64
+	// Chains is the number of insertions which evicted an item
+	Chains uint64
+	// MaxChain is the length of the longest eviction chain
+	MaxChain int
+}
+
+// Cuckoo represents a Nhash-way Cuckoo hash table data structure
+// that contains the items, bucket indices of each item and the
 // hash functions. The bucket lookup is a lookup table on items which
 // tells us which item should be in the bucket at that index. Upon
 // construction the items slice has an additional nil value prepended
 // so the index of the Cuckoo.items slice is +1 compared to the index
-// of the input slice you use. The number of inserted items is also
-// tracked.
+// of the input slice you use. The items which cannot be inserted in
+// the buckets are stored in the stash, which follows the buckets.
+// The number of inserted items is also tracked. The evictions are
+// drawn from a random number generator owned by the table.
 type Cuckoo struct {
 	items        [][]byte
 	inserted     uint64
 	hashIndices  []byte
 	bucketLookup []uint64
+	stash        []uint64
+	stats        Stats
+	rng          *rand.Rand
 	*CuckooHasher
 }
 
-// NewCuckoo instantiates a Cuckoo struct with a bucket of size Factor * size,
-// seeds math/rand with a random seed, returns a CuckooHasher for the 3-way
-// cuckoo hashing.
-func NewCuckoo(size uint64, seeds [Nhash][]byte) *Cuckoo {
-	cuckooHasher := NewCuckooHasher(size, seeds)
-
-	// get randombyte from crypto/rand
-	var rb [8]byte
-	if _, err := crand.Read(rb[:]); err != nil {
+// NewCuckoo instantiates a Cuckoo struct of size items with the parameters p,
+// and a random number generator seeded from crypto/rand, returns a CuckooHasher
+// for the Nhash-way cuckoo hashing.
+func NewCuckoo(size uint64, seeds [][]byte, p Params) *Cuckoo {
+	var seed [SeedLen]byte
+	if _, err := crand.Read(seed[:]); err != nil {
 		panic(err)
 	}
 
-	// WARNING: math/rand is not concurrency-safe
-	// replace with crypto/rand if that's what you want
+	return NewCuckooWithSeed(size, seeds, p, seed)
+}
 
-	// seed math/rand with crypto/rand
-	rand.Seed(int64(binary.LittleEndian.Uint64(rb[:])))
+// NewCuckooWithSeed instantiates a Cuckoo struct as NewCuckoo, with a random
+// number generator seeded from seed: the insertions, and the builds with a
+// single worker, replay deterministically from the seed.
+func NewCuckooWithSeed(size uint64, seeds [][]byte, p Params, seed [SeedLen]byte) *Cuckoo {
+	cuckooHasher := NewCuckooHasher(size, seeds, p)
 
 	return &Cuckoo{
 		// extra element is "keeper" to which the bucketLookup can be directed
 		// when there is no element present in the bucket.
-		make([][]byte, size+1),
-		0,
-		make([]byte, size+1),
-		make([]uint64, cuckooHasher.bucketSize),
-		cuckooHasher,
+		items:        make([][]byte, size+1),
+		hashIndices:  make([]byte, size+1),
+		bucketLookup: make([]uint64, cuckooHasher.bucketSize),
+		stash:        make([]uint64, 0, p.StashSize),
+		rng:          rand.New(rand.NewChaCha8(seed)),
+		CuckooHasher: cuckooHasher,
 	}
 }
 
 // GetBucket returns the index in a given bucket which represents the value in
-// the list of identifiers to which it points.
+// the list of identifiers to which it points. The buckets are followed by the
+// slots of the stash.
 func (c *Cuckoo) GetBucket(bIdx uint64) uint64 {
-	if bIdx > c.bucketSize {
+	if bIdx >= c.Len() {
 		panic(fmt.Errorf("failed to retrieve item in bucket #%v", bIdx))
 	}
+	if bIdx >= c.bucketSize {
+		if sIdx := bIdx - c.bucketSize; sIdx < uint64(len(c.stash)) {
+			return c.stash[sIdx]
+		}
+		return 0
+	}
 	return c.bucketLookup[bIdx]
 }
 
 // GetItemWithHash returns the item at a given index along with its
-// hash index. Panic if the index is greater than the number of items.
+// hash index, which is Nhash for the items in the stash. Panic if the
+// index is greater than the number of items.
 func (c *Cuckoo) GetItemWithHash(idx uint64) (item []byte, hIdx uint8) {
 	if idx > uint64(len(c.items)-1) {
 		panic(fmt.Errorf("index greater than number of items"))
@@ -128,25 +251,30 @@ func (c *Cuckoo) GetItemWithHash(idx uint64) (item []byte, hIdx uint8) {
 	return c.items[idx], c.hashIndices[idx]
 }
 
-// Exists returns true if an item is inserted in cuckoo, false otherwise
+// Exists returns true if an item is inserted in cuckoo, false otherwise,
+// along with its hash index
 func (c *Cuckoo) Exists(item []byte) (bool, byte) {
-	bucketIndices := c.BucketIndices(item)
-
-	for hIdx, bIdx := range bucketIndices {
-		if bytes.Equal(c.items[c.bucketLookup[bIdx]], item) {
+	for hIdx := range c.hashers {
+		if bytes.Equal(c.items[c.bucketLookup[c.bucketIndex(item, hIdx)]], item) {
 			return true, byte(hIdx)
 		}
 	}
+	for _, idx := range c.stash {
+		if bytes.Equal(c.items[idx], item) {
+			return true, byte(c.Nhash())
+		}
+	}
 	return false, 0
 }
 
 // Insert tries to insert a given item at the next index to the bucket
 // in available slots, otherwise, it evicts a random occupied slot,
-// and reinserts evicted item.
-// Returns an error msg if all failed.
+// and reinserts evicted item. An item that is left homeless after
+// ReInsertLimit evictions is stored in the stash.
+// Returns an error msg if the stash is full.
 func (c *Cuckoo) Insert(item []byte) error {
-	if int(c.inserted) == len(c.items) {
-		return fmt.Errorf("%v of %v items have already been inserted into the cuckoo hash table. Cannot insert again", c.inserted, len(c.items))
+	if int(c.inserted) == len(c.items)-1 {
+		return fmt.Errorf("%v of %v items have already been inserted into the cuckoo hash table. Cannot insert again", c.inserted, len(c.items)-1)
 	}
 	c.items[c.inserted+1] = item
 	bucketIndices := c.BucketIndices(item)
@@ -159,22 +287,28 @@ func (c *Cuckoo) Insert(item []byte) error {
 	// add to free slots
 	if c.tryAdd(c.inserted+1, bucketIndices, false, 0) {
 		c.inserted++
+		c.stats.Inserted++
 		return nil
 	}
 
 	// force insert by cuckoo (eviction)
 	homelessIdx, added := c.tryGreedyAdd(c.inserted+1, bucketIndices)
-	if added {
-		c.inserted++
-		return nil
+	if !added {
+		if len(c.stash) == cap(c.stash) {
+			return fmt.Errorf("failed to Insert item %v, results in homeless item #%v with a full stash", item, homelessIdx)
+		}
+		c.stash = append(c.stash, homelessIdx)
+		c.hashIndices[homelessIdx] = byte(c.Nhash())
+		c.stats.Stashed++
 	}
-
-	return fmt.Errorf("failed to Insert item %v, results in homeless item #%v", item, homelessIdx)
+	c.inserted++
+	c.stats.Inserted++
+	return nil
 }
 
 // tryAdd finds a free slot and inserts the item (at index, idx)
 // if ignore is true, it will not insert into exceptBIdx
-func (c *Cuckoo) tryAdd(idx uint64, bucketIndices [Nhash]uint64, ignore bool, exceptBIdx uint64) (added bool) {
+func (c *Cuckoo) tryAdd(idx uint64, bucketIndices []uint64, ignore bool, exceptBIdx uint64) (added bool) {
 	for hIdx, bIdx := range bucketIndices {
 		if ignore && exceptBIdx == bIdx {
 			continue
@@ -193,11 +327,14 @@ func (c *Cuckoo) tryAdd(idx uint64, bucketIndices [Nhash]uint64, ignore bool, ex
 // tryGreedyAdd evicts a random occupied slot, inserts the item to the evicted slot
 // and reinserts the evicted item. If reinsertions fail after ReInsertLimit tries
 // return false and the last evicted item.
-func (c *Cuckoo) tryGreedyAdd(idx uint64, bucketIndices [Nhash]uint64) (homeLessItem uint64, added bool) {
+func (c *Cuckoo) tryGreedyAdd(idx uint64, bucketIndices []uint64) (homeLessItem uint64, added bool) {
+	c.stats.Chains++
 	for i := 1; i < ReInsertLimit; i++ {
+		c.stats.Evictions++
+		c.stats.MaxChain = max(c.stats.MaxChain, i)
+
 		// select a random slot to be evicted
-		// replace me with crypto/rand for concurrent safety
-		evictedHIdx := rand.Intn(Nhash)
+		evictedHIdx := c.rng.IntN(len(bucketIndices))
 		evictedBIdx := bucketIndices[evictedHIdx]
 		evictedIdx := c.bucketLookup[evictedBIdx]
 		// insert the item in the evicted slot
@@ -219,6 +356,248 @@ func (c *Cuckoo) tryGreedyAdd(idx uint64, bucketIndices [Nhash]uint64) (homeLess
 	return idx, false
 }
 
+// Build inserts all the items in an empty table with workers concurrent
+// goroutines, and is equivalent to inserting them one by one, except that
+// the copies of an item are dropped: the table holds a single copy of each
+// item, the one of the lowest index, where Insert keeps every copy. The workers
+// insert their items by atomically swapping them in their buckets, and
+// reinsert the items they evict, until no item is homeless. They each draw
+// the evictions from a random number generator seeded from the one of the
+// table: with a single worker, the build replays deterministically from the
+// seed of NewCuckooWithSeed, while the races of concurrent workers for the
+// buckets are not deterministic.
+func (c *Cuckoo) Build(items [][]byte, workers int) error {
+	if c.inserted != 0 {
+		return fmt.Errorf("cannot build a cuckoo hash table with %v items already inserted", c.inserted)
+	}
+	if len(items) > len(c.items)-1 {
+		return fmt.Errorf("cannot build a cuckoo hash table of %v items with %v items", len(c.items)-1, len(items))
+	}
+	workers = max(1, min(workers, len(items)))
+
+	// the items keep their index in the input
+	copy(c.items[1:], items)
+
+	// phase 1: insert the items concurrently, the buckets hold
+	// the index of their item along with its hash index
+	var b = builder{Cuckoo: c}
+	var stats = make([]Stats, workers)
+	var g errgroup.Group
+	for w := 0; w < workers; w++ {
+		var seed [SeedLen]byte
+		for i := 0; i < SeedLen; i += 8 {
+			binary.LittleEndian.PutUint64(seed[i:], c.rng.Uint64())
+		}
+		rng := rand.New(rand.NewChaCha8(seed))
+		g.Go(func() error {
+			var bucketIndices = make([]uint64, c.Nhash())
+			for idx := uint64(w + 1); idx <= uint64(len(items)); idx += uint64(workers) {
+				homeless, ok := b.insert(idx, bucketIndices, rng, &stats[w])
+				if ok {
+					continue
+				}
+				if !b.addToStash(homeless) {
+					return fmt.Errorf("failed to Insert item %v, results in homeless item #%v with a full stash", items[idx-1], homeless)
+				}
+			}
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		return err
+	}
+
+	// phase 2: unpack the hash indices of the settled items
+	var occupied = make([]uint64, workers)
+	parallel(workers, len(c.bucketLookup), func(w, lo, hi int) {
+		for bIdx := lo; bIdx < hi; bIdx++ {
+			if v := c.bucketLookup[bIdx]; v != 0 {
+				c.bucketLookup[bIdx] = v & idxMask
+				c.hashIndices[v&idxMask] = byte(v >> hIdxShift)
+				occupied[w]++
+			}
+		}
+	})
+	for _, idx := range c.stash {
+		c.hashIndices[idx] = byte(c.Nhash())
+	}
+
+	c.inserted = uint64(len(c.stash))
+	for _, o := range occupied {
+		c.inserted += o
+	}
+
+	// a single worker never inserts an item twice, while
+	// concurrent workers can race to insert two copies
+	if workers > 1 {
+		c.inserted -= c.removeDuplicates(workers)
+	}
+
+	for _, s := range stats {
+		c.stats.Evictions += s.Evictions
+		c.stats.Chains += s.Chains
+		c.stats.MaxChain = max(c.stats.MaxChain, s.MaxChain)
+	}
+	c.stats.Stashed = len(c.stash)
+	c.stats.Inserted = c.inserted
+	return nil
+}
+
+const (
+	// hIdxShift is the position of the hash index of an item
+	// in a bucket, above its index, while building a table
+	hIdxShift = 56
+	idxMask   = 1<<hIdxShift - 1
+)
+
+// builder inserts items concurrently in a Cuckoo hash table
+type builder struct {
+	*Cuckoo
+	// stashLen is the length of the stash, which is
+	// only read or appended to with stashMu held
+	stashLen atomic.Int32
+	stashMu  sync.Mutex
+}
+
+// insert inserts the item at index idx in a free slot, otherwise it
+// atomically swaps it with a random occupied slot, and reinserts the evicted
+// item. If reinsertions fail after ReInsertLimit tries, it returns false and
+// the last evicted item. bucketIndices is a buffer of Nhash bucket indices.
+func (b *builder) insert(idx uint64, bucketIndices []uint64, rng *rand.Rand, stats *Stats) (homeLessItem uint64, added bool) {
+	// the bucket the item was evicted from
+	var exceptBIdx = b.bucketSize
+	for i := 0; i < ReInsertLimit; i++ {
+		for hIdx := range bucketIndices {
+			bucketIndices[hIdx] = b.bucketIndex(b.items[idx], hIdx)
+		}
+
+		// drop the item if it is already inserted, the copies
+		// inserted concurrently are removed after the build
+		if b.exists(idx, bucketIndices) {
+			return 0, true
+		}
+
+		// add to free slots
+		for hIdx, bIdx := range bucketIndices {
+			if bIdx != exceptBIdx && atomic.CompareAndSwapUint64(&b.bucketLookup[bIdx], 0, idx|uint64(hIdx)<<hIdxShift) {
+				return 0, true
+			}
+		}
+		if i == ReInsertLimit-1 {
+			break
+		}
+
+		// force insert by cuckoo (eviction)
+		if i == 0 {
+			stats.Chains++
+		}
+		stats.Evictions++
+		stats.MaxChain = max(stats.MaxChain, i+1)
+		evictedHIdx := rng.IntN(len(bucketIndices))
+		exceptBIdx = bucketIndices[evictedHIdx]
+		if idx = atomic.SwapUint64(&b.bucketLookup[exceptBIdx], idx|uint64(evictedHIdx)<<hIdxShift) & idxMask; idx == 0 {
+			// the slot was empty, the item settled there
+			return 0, true
+		}
+	}
+
+	return idx, false
+}
+
+// exists returns true if a copy of the item at index idx
+// is in one of its buckets bucketIndices, or in the stash
+func (b *builder) exists(idx uint64, bucketIndices []uint64) bool {
+	item := b.items[idx]
+	for _, bIdx := range bucketIndices {
+		if other := atomic.LoadUint64(&b.bucketLookup[bIdx]) & idxMask; other != 0 && bytes.Equal(b.items[other], item) {
+			return true
+		}
+	}
+	if b.stashLen.Load() == 0 {
+		return false
+	}
+	b.stashMu.Lock()
+	defer b.stashMu.Unlock()
+	return slices.ContainsFunc(b.stash, func(other uint64) bool {
+		return bytes.Equal(b.items[other], item)
+	})
+}
+
+// addToStash adds the item at index idx to the stash if it is
+// not already in it, and returns false if the stash is full
+func (b *builder) addToStash(idx uint64) bool {
+	b.stashMu.Lock()
+	defer b.stashMu.Unlock()
+	if slices.ContainsFunc(b.stash, func(other uint64) bool {
+		return bytes.Equal(b.items[other], b.items[idx])
+	}) {
+		return true
+	}
+	if len(b.stash) == cap(b.stash) {
+		return false
+	}
+	b.stash = append(b.stash, idx)
+	b.stashLen.Store(int32(len(b.stash)))
+	return true
+}
+
+// removeDuplicates removes from the buckets and the stash the copies
+// of the items which are also stored at a lower index with workers
+// concurrent goroutines, and returns the number of copies removed
+func (c *Cuckoo) removeDuplicates(workers int) uint64 {
+	// hasLowerCopy returns whether a copy of the
+	// item at index idx is stored at a lower index
+	hasLowerCopy := func(idx uint64) bool {
+		item := c.items[idx]
+		for hIdx := range c.hashers {
+			if other := c.bucketLookup[c.bucketIndex(item, hIdx)]; other != 0 && other < idx && bytes.Equal(c.items[other], item) {
+				return true
+			}
+		}
+		for _, other := range c.stash {
+			if other < idx && bytes.Equal(c.items[other], item) {
+				return true
+			}
+		}
+		return false
+	}
+
+	// find all the copies before removing them, the
+	// lowest copy of an item is never removed
+	var removed []int
+	var removedStash []uint64
+	var mu sync.Mutex
+	parallel(workers, len(c.bucketLookup), func(_, lo, hi int) {
+		var local []int
+		for bIdx := lo; bIdx < hi; bIdx++ {
+			if idx := c.bucketLookup[bIdx]; idx != 0 && hasLowerCopy(idx) {
+				local = append(local, bIdx)
+			}
+		}
+		mu.Lock()
+		removed = append(removed, local...)
+		mu.Unlock()
+	})
+	for _, idx := range c.stash {
+		if hasLowerCopy(idx) {
+			removedStash = append(removedStash, idx)
+		}
+	}
+
+	for _, bIdx := range removed {
+		c.bucketLookup[bIdx] = 0
+	}
+	c.stash = slices.DeleteFunc(c.stash, func(idx uint64) bool {
+		return slices.Contains(removedStash, idx)
+	})
+	return uint64(len(removed) + len(removedStash))
+}
+
+// Stats returns the statistics on the insertions
+func (c *Cuckoo) Stats() Stats {
+	return c.stats
+}
+
 // LoadFactor returns the ratio of occupied buckets with the overall bucketSize
 func (c *Cuckoo) LoadFactor() (factor float64) {
 	occupation := 0
@@ -232,9 +611,23 @@ func (c *Cuckoo) LoadFactor() (factor float64) {
 }
 
 // Len returns the total size of the cuckoo struct which is equal
-// to bucketSize
+// to bucketSize plus the size of the stash
 func (c *Cuckoo) Len() uint64 {
-	return c.bucketSize
+	return c.bucketSize + uint64(cap(c.stash))
+}
+
+// parallel splits [0, n) in workers contiguous ranges, and
+// calls fn on each of them in its own goroutine
+func parallel(workers, n int, fn func(w, lo, hi int)) {
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func(w int) {
+			defer wg.Done()
+			fn(w, n*w/workers, n*(w+1)/workers)
+		}(w)
+	}
+	wg.Wait()
 }
 
 // isEmpty returns true if bucket at bidx does not contain the index
@@ -242,11 +635,3 @@ func (c *Cuckoo) Len() uint64 {
 func (c *Cuckoo) isEmpty(bidx uint64) bool {
 	return c.bucketLookup[bidx] == 0
 }
-
-func max(a, b uint64) uint64 {
-	if a > b {
-		return a
-	}
-
-	return b
-}
@@ -3,15 +3,20 @@ package cuckoo
 import (
 	"bytes"
 	"crypto/rand"
+	"errors"
 	"math"
+	"runtime"
+	"slices"
 	"testing"
 	"time"
+
+	"github.com/optable/match/internal/hash"
 )
 
 var testN = uint64(1e6) // 1 Million
 
-func makeSeeds() [Nhash][]byte {
-	var seeds [Nhash][]byte
+func makeSeeds() [][]byte {
+	var seeds = make([][]byte, DefaultParams.Nhash)
 
 	for i := range seeds {
 		seeds[i] = make([]byte, 32)
@@ -27,23 +32,26 @@ func TestNewCuckoo(t *testing.T) {
 		bSize uint64 //bucketSize
 	}{
 		{uint64(0), uint64(1)},
-		{uint64(math.Pow(2, 4)), uint64(Factor * math.Pow(2, 4))},
-		{uint64(math.Pow(2, 8)), uint64(Factor * math.Pow(2, 8))},
-		{uint64(math.Pow(2, 16)), uint64(Factor * math.Pow(2, 16))},
+		{uint64(math.Pow(2, 4)), uint64(DefaultParams.Factor * math.Pow(2, 4))},
+		{uint64(math.Pow(2, 8)), uint64(DefaultParams.Factor * math.Pow(2, 8))},
+		{uint64(math.Pow(2, 16)), uint64(DefaultParams.Factor * math.Pow(2, 16))},
 	}
 
 	seeds := makeSeeds()
 
 	for _, tt := range cuckooTests {
-		c := NewCuckoo(tt.size, seeds)
+		c := NewCuckoo(tt.size, seeds, DefaultParams)
 		if c.CuckooHasher.bucketSize != tt.bSize {
 			t.Errorf("cuckoo bucketsize: want: %d, got: %d", tt.bSize, c.CuckooHasher.bucketSize)
 		}
+		if c.Len() != tt.bSize+uint64(DefaultParams.StashSize) {
+			t.Errorf("cuckoo len: want: %d, got: %d", tt.bSize+uint64(DefaultParams.StashSize), c.Len())
+		}
 	}
 }
 
 func TestInsertAndGetHashIdx(t *testing.T) {
-	cuckoo := NewCuckoo(testN, makeSeeds())
+	cuckoo := NewCuckoo(testN, makeSeeds(), DefaultParams)
 	errCount := 0
 	testData := genBytes(int(testN))
 
@@ -54,8 +62,8 @@ func TestInsertAndGetHashIdx(t *testing.T) {
 		}
 	}
 
-	t.Logf("To be inserted: %d, bucketSize: %d, load factor: %f, failure insertion:  %d, taken %v",
-		testN, cuckoo.bucketSize, cuckoo.LoadFactor(), errCount, time.Since(insertTime))
+	t.Logf("To be inserted: %d, bucketSize: %d, load factor: %f, failure insertion:  %d, stats: %+v, taken %v",
+		testN, cuckoo.bucketSize, cuckoo.LoadFactor(), errCount, cuckoo.Stats(), time.Since(insertTime))
 
 	//test GetHashIdx
 	for i, item := range testData {
@@ -65,7 +73,11 @@ func TestInsertAndGetHashIdx(t *testing.T) {
 			t.Fatalf("Cuckoo GetHashIdx, %dth item: %v not inserted.", i+1, item)
 		}
 
-		checkIndex := cuckoo.GetBucket(bIndices[hIdx])
+		bIdx := cuckoo.bucketSize + uint64(slices.Index(cuckoo.stash, uint64(i+1)))
+		if int(hIdx) < cuckoo.Nhash() {
+			bIdx = bIndices[hIdx]
+		}
+		checkIndex := cuckoo.GetBucket(bIdx)
 		checkItem, _ := cuckoo.GetItemWithHash(checkIndex)
 		if !bytes.Equal(checkItem, item) {
 			t.Fatalf("Cuckoo GetHashIdx, hashIdx not correct for item: %v, with hIdx: %d, item : %v", item, hIdx, checkItem)
@@ -73,9 +85,232 @@ func TestInsertAndGetHashIdx(t *testing.T) {
 	}
 }
 
+func TestHashers(t *testing.T) {
+	n := 1 << 14
+	items := genBytes(n)
+	for _, id := range []hash.ID{hash.Metro, hash.Murmur3, hash.SipHash, hash.Blake3, hash.XXH3} {
+		p := DefaultParams
+		p.Hasher = id
+		c := NewCuckoo(uint64(n), makeSeeds(), p)
+		if err := c.Build(items, runtime.GOMAXPROCS(0)); err != nil {
+			t.Fatalf("%s: %v", id, err)
+		}
+		for _, item := range items {
+			if found, _ := c.Exists(item); !found {
+				t.Fatalf("%s: item %v not inserted", id, item)
+			}
+		}
+	}
+}
+
+func TestStash(t *testing.T) {
+	// a load factor of 1 is above the threshold of 3-way
+	// cuckoo hashing, some items end up in the stash
+	var n = 1000
+	var p = Params{Nhash: 3, Factor: 1, StashSize: 200}
+	cuckoo := NewCuckoo(uint64(n), makeSeeds(), p)
+	testData := genBytes(n)
+	for _, item := range testData {
+		if err := cuckoo.Insert(item); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := cuckoo.Stats()
+	if stats.Inserted != uint64(n) {
+		t.Fatalf("inserted %d items, want %d", stats.Inserted, n)
+	}
+	if stats.Stashed == 0 || stats.Stashed != len(cuckoo.stash) {
+		t.Fatalf("stashed %d items, with %d items in the stash", stats.Stashed, len(cuckoo.stash))
+	}
+	if stats.Chains == 0 || stats.Evictions < uint64(stats.MaxChain) || stats.MaxChain != ReInsertLimit-1 {
+		t.Fatalf("inconsistent eviction statistics %+v", stats)
+	}
+
+	// every item is in a bucket or the stash, and
+	// the empty slots of the stash point to no item
+	var found = make(map[string]bool)
+	for bIdx := uint64(0); bIdx < cuckoo.Len(); bIdx++ {
+		item, hIdx := cuckoo.GetItemWithHash(cuckoo.GetBucket(bIdx))
+		if item == nil {
+			continue
+		}
+		if stashed := bIdx >= cuckoo.bucketSize; stashed != (int(hIdx) == p.Nhash) {
+			t.Fatalf("slot #%d holds an item of hash index %d", bIdx, hIdx)
+		}
+		if found, _ := cuckoo.Exists(item); !found {
+			t.Fatalf("item in slot #%d does not exist", bIdx)
+		}
+		found[string(item)] = true
+	}
+	if len(found) != n {
+		t.Fatalf("found %d items in the slots, want %d", len(found), n)
+	}
+
+	// the stash is full
+	cuckoo = NewCuckoo(uint64(n), makeSeeds(), Params{Nhash: 3, Factor: 1})
+	var err error
+	for _, item := range testData {
+		if err = cuckoo.Insert(item); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		t.Fatal("inserted all items without a stash")
+	}
+}
+
+// checkTable checks that every item is stored exactly once in the
+// buckets or the stash, at a slot that matches its hash index
+func checkTable(t *testing.T, cuckoo *Cuckoo, items [][]byte) {
+	var distinct = make(map[string]bool)
+	for _, item := range items {
+		distinct[string(item)] = true
+	}
+	if cuckoo.inserted != uint64(len(distinct)) || cuckoo.Stats().Inserted != uint64(len(distinct)) {
+		t.Fatalf("inserted %d items, want %d", cuckoo.inserted, len(distinct))
+	}
+
+	var found = make(map[string]bool)
+	for bIdx := uint64(0); bIdx < cuckoo.Len(); bIdx++ {
+		item, hIdx := cuckoo.GetItemWithHash(cuckoo.GetBucket(bIdx))
+		if item == nil {
+			continue
+		}
+		if found[string(item)] {
+			t.Fatalf("item in slot #%d is duplicated", bIdx)
+		}
+		found[string(item)] = true
+		if int(hIdx) == cuckoo.Nhash() {
+			if bIdx < cuckoo.bucketSize {
+				t.Fatalf("item in bucket #%d has the hash index of the stash", bIdx)
+			}
+		} else if cuckoo.bucketIndex(item, int(hIdx)) != bIdx {
+			t.Fatalf("item in bucket #%d has hash index %d", bIdx, hIdx)
+		}
+		if ok, _ := cuckoo.Exists(item); !ok {
+			t.Fatalf("item in slot #%d does not exist", bIdx)
+		}
+	}
+	if len(found) != len(distinct) {
+		t.Fatalf("found %d items in the slots, want %d", len(found), len(distinct))
+	}
+}
+
+func TestBuild(t *testing.T) {
+	var n = 1 << 16
+	// with duplicated items
+	testData := genBytes(n)
+	copy(testData[n-n/8:], testData)
+
+	for _, workers := range []int{1, 4} {
+		cuckoo := NewCuckoo(uint64(n), makeSeeds(), DefaultParams)
+		if err := cuckoo.Build(testData, workers); err != nil {
+			t.Fatal(err)
+		}
+		checkTable(t, cuckoo, testData)
+		if err := cuckoo.Build(testData, workers); err == nil {
+			t.Fatal("built a table twice")
+		}
+	}
+
+	// empty table
+	cuckoo := NewCuckoo(0, makeSeeds(), DefaultParams)
+	if err := cuckoo.Build(nil, 4); err != nil {
+		t.Fatal(err)
+	}
+	checkTable(t, cuckoo, nil)
+}
+
+func TestBuildStash(t *testing.T) {
+	var n = 1000
+	var p = Params{Nhash: 3, Factor: 1, StashSize: 200}
+	testData := genBytes(n)
+	cuckoo := NewCuckoo(uint64(n), makeSeeds(), p)
+	if err := cuckoo.Build(testData, 4); err != nil {
+		t.Fatal(err)
+	}
+	checkTable(t, cuckoo, testData)
+	if stats := cuckoo.Stats(); stats.Stashed == 0 || stats.Chains == 0 || stats.MaxChain != ReInsertLimit-1 {
+		t.Fatalf("inconsistent statistics %+v", stats)
+	}
+
+	// the stash is full
+	cuckoo = NewCuckoo(uint64(n), makeSeeds(), Params{Nhash: 3, Factor: 1})
+	if err := cuckoo.Build(testData, 4); err == nil {
+		t.Fatal("built a table without a stash")
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	var n = 1000
+	var p = Params{Nhash: 3, Factor: 1.05, StashSize: 200}
+	var seed [SeedLen]byte
+	rand.Read(seed[:])
+	seeds := makeSeeds()
+	testData := genBytes(n)
+
+	for name, build := range map[string]func(*Cuckoo) error{
+		"Insert": func(c *Cuckoo) error {
+			for _, item := range testData {
+				if err := c.Insert(item); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		"Build": func(c *Cuckoo) error {
+			return c.Build(testData, 1)
+		},
+	} {
+		var tables [2]*Cuckoo
+		for i := range tables {
+			tables[i] = NewCuckooWithSeed(uint64(n), seeds, p, seed)
+			if err := build(tables[i]); err != nil {
+				t.Fatal(err)
+			}
+			checkTable(t, tables[i], testData)
+		}
+		if tables[0].Stats().Evictions == 0 {
+			t.Fatalf("%s: no evictions", name)
+		}
+		if tables[0].Stats() != tables[1].Stats() || !slices.Equal(tables[0].bucketLookup, tables[1].bucketLookup) || !slices.Equal(tables[0].stash, tables[1].stash) {
+			t.Fatalf("%s: the tables built from the same seed differ", name)
+		}
+	}
+}
+
+func TestParams(t *testing.T) {
+	for _, n := range []uint64{0, 1 << 10, 1 << 20, 1 << 40} {
+		if err := DefaultParams.Validate(n); err != nil {
+			t.Errorf("default parameters for %d items: %v", n, err)
+		}
+	}
+
+	invalid := []struct {
+		p Params
+		n uint64
+	}{
+		{Params{Nhash: 2, Factor: 1.4}, 1 << 20},
+		{Params{Nhash: MaxNhash + 1, Factor: 1.4}, 1 << 20},
+		{Params{Nhash: 3, Factor: math.NaN()}, 1 << 20},
+		{Params{Nhash: 3, Factor: MaxFactor + 1}, 1 << 20},
+		{Params{Nhash: 3, Factor: 1.4, StashSize: -1}, 1 << 20},
+		{Params{Nhash: 3, Factor: 1.4, StashSize: MaxStashSize + 1}, 1 << 20},
+		{Params{Nhash: 3, Factor: 1.2}, 1 << 20},
+		{DefaultParams, 1 << 41},
+		{Params{Nhash: 3, Factor: 1.4, Hasher: 255}, 1 << 20},
+	}
+	for _, tt := range invalid {
+		if err := tt.p.Validate(tt.n); !errors.Is(err, ErrInvalidParams) {
+			t.Errorf("parameters %+v for %d items: got %v, want %v", tt.p, tt.n, err, ErrInvalidParams)
+		}
+	}
+}
+
 func BenchmarkCuckooInsert(b *testing.B) {
 	seeds := makeSeeds()
-	benchCuckoo := NewCuckoo(uint64(b.N), seeds)
+	benchCuckoo := NewCuckoo(uint64(b.N), seeds, DefaultParams)
 	benchData := genBytes(int(b.N))
 	b.ResetTimer()
 
@@ -87,10 +322,23 @@ func BenchmarkCuckooInsert(b *testing.B) {
 	}
 }
 
+func BenchmarkCuckooBuild(b *testing.B) {
+	seeds := makeSeeds()
+	benchData := genBytes(int(testN))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		benchCuckoo := NewCuckoo(uint64(len(benchData)), seeds, DefaultParams)
+		if err := benchCuckoo.Build(benchData, runtime.GOMAXPROCS(0)); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
 // Benchmark finding hash index and checking existance
 func BenchmarkCuckooExists(b *testing.B) {
 	seeds := makeSeeds()
-	benchCuckoo := NewCuckoo(uint64(b.N), seeds)
+	benchCuckoo := NewCuckoo(uint64(b.N), seeds, DefaultParams)
 	benchData := genBytes(int(b.N))
 	b.ResetTimer()
 
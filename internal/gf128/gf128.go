@@ -0,0 +1,104 @@
+// Package gf128 implements the arithmetic of the binary field GF(2^128)
+// needed by vector oblivious linear evaluation (VOLE) and by the consistency
+// check of the OT extension: additions, and multiplications by x or by a
+// fixed element.
+package gf128
+
+import (
+	"encoding/binary"
+)
+
+// Size is the length in bytes of an encoded element
+const Size = 16
+
+// reduction is x^128 reduced modulo the
+// field polynomial x^128 + x^7 + x^2 + x + 1
+const reduction = 0x87
+
+// Element is an element of GF(2^128) in polynomial basis,
+// the coefficient of x^i is bit i%64 of word i/64
+type Element [2]uint64
+
+// FromBytes decodes an element from the first Size bytes of b
+func FromBytes(b []byte) Element {
+	return Element{binary.LittleEndian.Uint64(b), binary.LittleEndian.Uint64(b[8:])}
+}
+
+// PutBytes encodes e into the first Size bytes of b
+func (e Element) PutBytes(b []byte) {
+	binary.LittleEndian.PutUint64(b, e[0])
+	binary.LittleEndian.PutUint64(b[8:], e[1])
+}
+
+// Add returns e + f, which is e - f as well
+func (e Element) Add(f Element) Element {
+	return Element{e[0] ^ f[0], e[1] ^ f[1]}
+}
+
+// IsZero returns whether e is the zero element
+func (e Element) IsZero() bool {
+	return e[0]|e[1] == 0
+}
+
+// MulX returns e times x
+func (e Element) MulX() Element {
+	carry := e[1] >> 63
+	return Element{e[0]<<1 ^ carry*reduction, e[1]<<1 | e[0]>>63}
+}
+
+// Mul returns e times f
+func (e Element) Mul(f Element) Element {
+	var p Element
+	for i := 127; i >= 0; i-- {
+		p = p.MulX()
+		if f[i/64]>>(i%64)&1 == 1 {
+			p = p.Add(e)
+		}
+	}
+	return p
+}
+
+// Multiplier multiplies elements by a fixed element,
+// four bits at a time with precomputed tables
+type Multiplier struct {
+	tables [32][16]Element
+}
+
+// NewMultiplier returns the Multiplier by e
+func NewMultiplier(e Element) *Multiplier {
+	m := new(Multiplier)
+	// e times x^4i
+	for i := range m.tables {
+		for v := 1; v < 16; v++ {
+			// extend the product by the lower bits of v
+			// with the product by its top bit
+			top := 3
+			for v>>top == 0 {
+				top--
+			}
+			p := e
+			for j := 0; j < top; j++ {
+				p = p.MulX()
+			}
+			m.tables[i][v] = m.tables[i][v^(1<<top)].Add(p)
+		}
+		for j := 0; j < 4; j++ {
+			e = e.MulX()
+		}
+	}
+	return m
+}
+
+// Mul returns f times the fixed element of m
+func (m *Multiplier) Mul(f Element) Element {
+	var lo, hi uint64
+	for w, v := range f {
+		tables := m.tables[16*w : 16*w+16]
+		for i := range tables {
+			t := &tables[i][v>>(4*i)&0xf]
+			lo ^= t[0]
+			hi ^= t[1]
+		}
+	}
+	return Element{lo, hi}
+}
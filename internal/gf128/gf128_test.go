@@ -0,0 +1,74 @@
+package gf128
+
+import (
+	"crypto/rand"
+	"testing"
+)
+
+func randomElement() Element {
+	var b [Size]byte
+	rand.Read(b[:])
+	return FromBytes(b[:])
+}
+
+func TestBytes(t *testing.T) {
+	e := randomElement()
+	var b [Size]byte
+	e.PutBytes(b[:])
+	if FromBytes(b[:]) != e {
+		t.Fatal("element did not survive an encoding round trip")
+	}
+}
+
+func TestMul(t *testing.T) {
+	one := Element{1, 0}
+	x := Element{2, 0}
+	for i := 0; i < 100; i++ {
+		a, b, c := randomElement(), randomElement(), randomElement()
+		if a.Mul(one) != a {
+			t.Fatal("one is not the identity")
+		}
+		if a.Mul(x) != a.MulX() {
+			t.Fatal("MulX is not a multiplication by x")
+		}
+		if a.Mul(b) != b.Mul(a) {
+			t.Fatal("multiplication is not commutative")
+		}
+		if a.Mul(b.Add(c)) != a.Mul(b).Add(a.Mul(c)) {
+			t.Fatal("multiplication is not distributive")
+		}
+		if a.Mul(b).Mul(c) != a.Mul(b.Mul(c)) {
+			t.Fatal("multiplication is not associative")
+		}
+	}
+
+	// x^127 * x = x^7 + x^2 + x + 1
+	if (Element{0, 1 << 63}).MulX() != (Element{reduction, 0}) {
+		t.Fatal("MulX does not reduce x^128")
+	}
+}
+
+func TestMultiplier(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		a, b := randomElement(), randomElement()
+		if NewMultiplier(a).Mul(b) != a.Mul(b) {
+			t.Fatal("Multiplier does not multiply")
+		}
+	}
+}
+
+func BenchmarkMul(b *testing.B) {
+	x, y := randomElement(), randomElement()
+	for i := 0; i < b.N; i++ {
+		x = x.Mul(y)
+	}
+}
+
+func BenchmarkMultiplier(b *testing.B) {
+	x, y := randomElement(), randomElement()
+	m := NewMultiplier(y)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		x = m.Mul(x)
+	}
+}
@@ -4,10 +4,14 @@ import (
 	"encoding/binary"
 	"fmt"
 	"log"
+	"sync"
 
+	"github.com/dchest/siphash"
 	metro "github.com/dgryski/go-metro"
 	"github.com/optable/match/internal/util"
 	"github.com/twmb/murmur3"
+	"github.com/zeebo/blake3"
+	"github.com/zeebo/xxh3"
 )
 
 // SaltLength is the number of bytes which should be used as salt in
@@ -29,6 +33,13 @@ type Hasher interface {
 	Hash64([]byte) uint64
 }
 
+// Hasher128 implements non cryptographic hashing
+// functions with 128 bits long digests
+type Hasher128 interface {
+	Hasher
+	Hash128([]byte) (uint64, uint64)
+}
+
 // Murmur3 implementation of Hasher
 type murmur64 struct {
 	salt []byte
@@ -36,7 +47,7 @@ type murmur64 struct {
 
 // NewMurmur3Hasher returns a Murmur3 hasher that uses salt as a prefix to the
 // bytes being summed
-func NewMurmur3Hasher(salt []byte) (Hasher, error) {
+func NewMurmur3Hasher(salt []byte) (Hasher128, error) {
 	if len(salt) != SaltLength {
 		return murmur64{}, ErrSaltLengthMismatch
 	}
@@ -49,14 +60,24 @@ func (t murmur64) Hash64(p []byte) uint64 {
 	return murmur3.Sum64(append(t.salt, p...))
 }
 
+func (t murmur64) Hash128(p []byte) (uint64, uint64) {
+	return murmur3.Sum128(append(t.salt, p...))
+}
+
 // Metro Hash implementation of Hasher
 type metro64 struct {
 	seed uint64
 }
 
-// NewMetroHasher returns a metro hasher that uses salt as a
-// prefix to the bytes being summed
+// NewMetroHasher returns a metro hasher seeded with the
+// 32 byte salt folded into 64 bits
 func NewMetroHasher(salt []byte) (Hasher, error) {
+	return NewMetroHasher128(salt)
+}
+
+// NewMetroHasher128 returns a metro hasher with 128 bits long
+// digests seeded with the 32 byte salt folded into 64 bits
+func NewMetroHasher128(salt []byte) (Hasher128, error) {
 	if len(salt) != SaltLength {
 		return metro64{}, ErrSaltLengthMismatch
 	}
@@ -74,3 +95,96 @@ func NewMetroHasher(salt []byte) (Hasher, error) {
 func (m metro64) Hash64(p []byte) uint64 {
 	return metro.Hash64(p, m.seed)
 }
+
+func (m metro64) Hash128(p []byte) (uint64, uint64) {
+	return metro.Hash128(p, m.seed)
+}
+
+// SipHash-2-4 implementation of Hasher, a keyed PRF
+type sip struct {
+	k0, k1 uint64
+}
+
+// NewSipHasher returns a SipHash-2-4 hasher keyed with
+// 128 bits derived from salt
+func NewSipHasher(salt []byte) (Hasher128, error) {
+	if len(salt) != SaltLength {
+		return sip{}, ErrSaltLengthMismatch
+	}
+
+	var key [16]byte
+	blake3.DeriveKey("optable/match siphash key", salt, key[:])
+	return sip{k0: binary.LittleEndian.Uint64(key[:]), k1: binary.LittleEndian.Uint64(key[8:])}, nil
+}
+
+func (s sip) Hash64(p []byte) uint64 {
+	return siphash.Hash(s.k0, s.k1, p)
+}
+
+func (s sip) Hash128(p []byte) (uint64, uint64) {
+	return siphash.Hash128(s.k0, s.k1, p)
+}
+
+// BLAKE3 implementation of Hasher, a keyed PRF
+type keyedBlake3 struct {
+	// pool of keyed hashers, to be safe for concurrent use
+	pool *sync.Pool
+}
+
+// NewBlake3Hasher returns a BLAKE3 hasher keyed with salt
+func NewBlake3Hasher(salt []byte) (Hasher128, error) {
+	if len(salt) != SaltLength {
+		return keyedBlake3{}, ErrSaltLengthMismatch
+	}
+
+	h, err := blake3.NewKeyed(salt)
+	if err != nil {
+		return keyedBlake3{}, err
+	}
+	return keyedBlake3{pool: &sync.Pool{New: func() any { return h.Clone() }}}, nil
+}
+
+// sum returns the first 16 bytes of the keyed hash of p
+func (b keyedBlake3) sum(p []byte) (s [16]byte) {
+	h := b.pool.Get().(*blake3.Hasher)
+	h.Reset()
+	h.Write(p)
+	h.Digest().Read(s[:])
+	b.pool.Put(h)
+	return s
+}
+
+func (b keyedBlake3) Hash64(p []byte) uint64 {
+	s := b.sum(p)
+	return binary.LittleEndian.Uint64(s[:])
+}
+
+func (b keyedBlake3) Hash128(p []byte) (uint64, uint64) {
+	s := b.sum(p)
+	return binary.LittleEndian.Uint64(s[:]), binary.LittleEndian.Uint64(s[8:])
+}
+
+// XXH3 implementation of Hasher
+type xxh3Hasher struct {
+	seed uint64
+}
+
+// NewXXH3Hasher returns a XXH3 hasher seeded with 64 bits derived from salt
+func NewXXH3Hasher(salt []byte) (Hasher128, error) {
+	if len(salt) != SaltLength {
+		return xxh3Hasher{}, ErrSaltLengthMismatch
+	}
+
+	var seed [8]byte
+	blake3.DeriveKey("optable/match xxh3 seed", salt, seed[:])
+	return xxh3Hasher{seed: binary.LittleEndian.Uint64(seed[:])}, nil
+}
+
+func (x xxh3Hasher) Hash64(p []byte) uint64 {
+	return xxh3.HashSeed(p, x.seed)
+}
+
+func (x xxh3Hasher) Hash128(p []byte) (uint64, uint64) {
+	u := xxh3.Hash128Seed(p, x.seed)
+	return u.Lo, u.Hi
+}
@@ -4,7 +4,9 @@ import (
 	"crypto/aes"
 	"crypto/rand"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"sync"
 	"testing"
 
 	"github.com/twmb/murmur3"
@@ -24,6 +26,80 @@ func makeSalt() ([]byte, error) {
 	}
 }
 
+var ids = []ID{Metro, Murmur3, SipHash, Blake3, XXH3}
+
+func TestRegistry(t *testing.T) {
+	s1, _ := makeSalt()
+	s2, _ := makeSalt()
+	for _, id := range ids {
+		h1, err := New(id, s1)
+		if err != nil {
+			t.Fatalf("%s: %v", id, err)
+		}
+		h2, _ := New(id, s2)
+		again, _ := New(id, s1)
+
+		lo, hi := h1.Hash128(xxx)
+		if lo2, hi2 := again.Hash128(xxx); lo != lo2 || hi != hi2 {
+			t.Errorf("%s: hashes differ with the same salt", id)
+		}
+		if lo2, hi2 := h2.Hash128(xxx); lo == lo2 && hi == hi2 {
+			t.Errorf("%s: hashes match with different salts", id)
+		}
+		if h1.Hash64(xxx) == h2.Hash64(xxx) {
+			t.Errorf("%s: 64 bits hashes match with different salts", id)
+		}
+
+		if _, err := New(id, s1[1:]); !errors.Is(err, ErrSaltLengthMismatch) {
+			t.Errorf("%s: expected ErrSaltLengthMismatch, got %v", id, err)
+		}
+		if !id.Valid() {
+			t.Errorf("%s is not valid", id)
+		}
+	}
+
+	if !SipHash.PRF() || !Blake3.PRF() || Metro.PRF() || XXH3.PRF() {
+		t.Error("wrong PRF hash functions")
+	}
+	if _, err := New(ID(255), s1); !errors.Is(err, ErrUnknownHasher) || ID(255).Valid() {
+		t.Errorf("expected ErrUnknownHasher, got %v", err)
+	}
+}
+
+func TestConcurrentHash(t *testing.T) {
+	s, _ := makeSalt()
+	for _, id := range ids {
+		h, _ := New(id, s)
+		want := h.Hash64(xxx)
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 1000; j++ {
+					if h.Hash64(xxx) != want {
+						t.Errorf("%s: concurrent hashes differ", id)
+						return
+					}
+				}
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+func BenchmarkHashers(b *testing.B) {
+	s, _ := makeSalt()
+	for _, id := range ids {
+		h, _ := New(id, s)
+		b.Run(id.String(), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				h.Hash128(xxx)
+			}
+		})
+	}
+}
+
 func BenchmarkMurmur3(b *testing.B) {
 	s, _ := makeSalt()
 	h, _ := NewMurmur3Hasher(s)
@@ -42,6 +118,15 @@ func BenchmarkMetro(b *testing.B) {
 	}
 }
 
+func BenchmarkMetro128(b *testing.B) {
+	s, _ := makeSalt()
+	h, _ := NewMetroHasher128(s)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		h.Hash128(xxx)
+	}
+}
+
 func BenchmarkMurmur316(b *testing.B) {
 	src := make([]byte, 66)
 	b.ResetTimer()
@@ -0,0 +1,71 @@
+package hash
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ID identifies a hash function, so that the parties of
+// a protocol can negotiate the one they use
+type ID uint8
+
+const (
+	// Metro is MetroHash, seeded with 64 bits of the salt
+	Metro ID = iota
+	// Murmur3 is Murmur3 of the salt prefixed to the bytes being summed
+	Murmur3
+	// SipHash is SipHash-2-4, a keyed PRF
+	SipHash
+	// Blake3 is keyed BLAKE3, a keyed PRF
+	Blake3
+	// XXH3 is XXH3, seeded with 64 bits derived from the salt
+	XXH3
+)
+
+// ErrUnknownHasher is returned for an ID that is not registered
+var ErrUnknownHasher = errors.New("unknown hash function")
+
+// registered is a hash function of the registry
+type registered struct {
+	name string
+	// prf is set for the keyed pseudorandom functions,
+	// whose outputs cannot be predicted without the salt
+	prf bool
+	new func(salt []byte) (Hasher128, error)
+}
+
+// registry holds the hash functions by ID
+var registry = map[ID]registered{
+	Metro:   {name: "metro", new: NewMetroHasher128},
+	Murmur3: {name: "murmur3", new: NewMurmur3Hasher},
+	SipHash: {name: "siphash", prf: true, new: NewSipHasher},
+	Blake3:  {name: "blake3", prf: true, new: NewBlake3Hasher},
+	XXH3:    {name: "xxh3", new: NewXXH3Hasher},
+}
+
+// New returns the hasher of the hash function id keyed with salt
+func New(id ID, salt []byte) (Hasher128, error) {
+	r, ok := registry[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownHasher, id)
+	}
+	return r.new(salt)
+}
+
+// Valid returns whether id is a registered hash function
+func (id ID) Valid() bool {
+	_, ok := registry[id]
+	return ok
+}
+
+// PRF returns whether id is a keyed pseudorandom function
+func (id ID) PRF() bool {
+	return registry[id].prf
+}
+
+func (id ID) String() string {
+	if r, ok := registry[id]; ok {
+		return r.name
+	}
+	return "unknown"
+}
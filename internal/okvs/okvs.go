@@ -0,0 +1,199 @@
+// Package okvs implements a binary oblivious key-value store (OKVS): a table
+// of elements of GF(2^128) which decodes every key it was encoded with to its
+// value, while the decoding of any other key looks random.
+//
+// It is the random band matrix construction (RB-OKVS) from the paper
+// "Near-Optimal Oblivious Key-Value Stores for Efficient PSI, PSU and
+// Volume-Hiding Multi-Maps" by Alexander Bienstock, Sarvar Patranabis,
+// Mingyuan Wang, and Kevin Yeo in 2023 (https://eprint.iacr.org/2023/903.pdf).
+// Every key is hashed to a position in the table and a random band of
+// BandWidth bits starting there, and decodes to the sum of the elements of
+// the table selected by its band. Encoding solves the band linear system,
+// which sorted by position is a band matrix that Gaussian elimination
+// keeps banded.
+package okvs
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"math/bits"
+
+	"github.com/optable/match/internal/gf128"
+	"github.com/zeebo/blake3"
+)
+
+const (
+	// BandWidth is the number of bits of the band of a key
+	BandWidth = 128
+	// bandWords is the number of words of a band
+	bandWords = BandWidth / 64
+	// Expansion is the size of the table relative to the number of keys
+	Expansion = 1.1
+	// SeedLen is the length of the seed of the key hashing
+	SeedLen = 32
+)
+
+var ErrEncode = errors.New("okvs: the band linear system has no solution, retry with another seed")
+
+// Key is a hashed key: the position of its band
+// in the table, and the bits of the band
+type Key struct {
+	start int
+	band  [bandWords]uint64
+}
+
+// Hasher hashes keys for a table of a given size,
+// it is not safe for concurrent use
+type Hasher struct {
+	h    *blake3.Hasher
+	size int
+}
+
+// Size returns the number of elements of the table encoding n keys
+func Size(n int) int {
+	return int(Expansion*float64(n)) + BandWidth
+}
+
+// NewHasher returns the hasher of the keys of a table of size
+// elements, as returned by Size, derived from seed
+func NewHasher(seed [SeedLen]byte, size int) *Hasher {
+	h, _ := blake3.NewKeyed(seed[:])
+	return &Hasher{h: h, size: size}
+}
+
+// Hash returns the hashed key of id, along with the
+// 128 bits long hash of id that can be used as its value
+func (h *Hasher) Hash(id []byte) (Key, gf128.Element) {
+	var b [8 + bandWords*8 + gf128.Size]byte
+	h.h.Reset()
+	h.h.Write(id)
+	h.h.Digest().Read(b[:])
+
+	var k Key
+	hi, _ := bits.Mul64(binary.LittleEndian.Uint64(b[:]), uint64(h.size-BandWidth+1))
+	k.start = int(hi)
+	for i := range k.band {
+		k.band[i] = binary.LittleEndian.Uint64(b[8+8*i:])
+	}
+	// the first bit of the band is always set
+	k.band[0] |= 1
+	return k, gf128.FromBytes(b[8+bandWords*8:])
+}
+
+// Decode returns the sum of the elements of table selected by the band of k
+func Decode(table []gf128.Element, k Key) gf128.Element {
+	var lo, hi uint64
+	for w, word := range k.band {
+		window := table[k.start+64*w:]
+		for ; word != 0; word &= word - 1 {
+			e := &window[bits.TrailingZeros64(word)]
+			lo ^= e[0]
+			hi ^= e[1]
+		}
+	}
+	return gf128.Element{lo, hi}
+}
+
+// row is one equation of the band linear system
+type row struct {
+	Key
+	value gf128.Element
+	// column of the pivot of the row, -1 if the row
+	// is redundant
+	pivot int
+}
+
+// Encode returns a table of size elements, as returned by Size, that
+// decodes keys[i] to values[i]. The elements which are not constrained
+// are random. ErrEncode is returned with a negligible probability, and if
+// two identical keys are given two different values.
+func Encode(keys []Key, values []gf128.Element, size int) ([]gf128.Element, error) {
+	// sort the rows by start with a counting sort
+	var counts = make([]int, size-BandWidth+2)
+	for _, k := range keys {
+		counts[k.start+1]++
+	}
+	for i := 1; i < len(counts); i++ {
+		counts[i] += counts[i-1]
+	}
+	var rows = make([]row, len(keys))
+	for i, k := range keys {
+		rows[counts[k.start]] = row{Key: k, value: values[i]}
+		counts[k.start]++
+	}
+
+	// reduce to an echelon form: the pivot of each row is its first
+	// set bit, which is cleared from all the following rows whose
+	// band covers it. Their band stays within its window since the
+	// pivot row starts before them.
+	for i := range rows {
+		r := &rows[i]
+		offset := firstBit(r.band)
+		if offset < 0 {
+			// duplicated key
+			if !r.value.IsZero() {
+				return nil, ErrEncode
+			}
+			r.pivot = -1
+			continue
+		}
+		r.pivot = r.start + offset
+		for j := i + 1; j < len(rows) && rows[j].start <= r.pivot; j++ {
+			next := &rows[j]
+			if bit(next.band, r.pivot-next.start) {
+				xorShifted(&next.band, r.band, next.start-r.start)
+				next.value = next.value.Add(r.value)
+			}
+		}
+	}
+
+	// fill the table with random elements and set the pivots by back
+	// substitution: a pivot only depends on the pivots of the rows after it
+	var table = make([]gf128.Element, size)
+	var b = make([]byte, size*gf128.Size)
+	if _, err := rand.Read(b); err != nil {
+		return nil, err
+	}
+	for i := range table {
+		table[i] = gf128.FromBytes(b[i*gf128.Size:])
+	}
+	for i := len(rows) - 1; i >= 0; i-- {
+		r := &rows[i]
+		if r.pivot < 0 {
+			continue
+		}
+		table[r.pivot] = gf128.Element{}
+		table[r.pivot] = Decode(table, r.Key).Add(r.value)
+	}
+	return table, nil
+}
+
+// firstBit returns the index of the first set bit of band, -1 if there are none
+func firstBit(band [bandWords]uint64) int {
+	for w, word := range band {
+		if word != 0 {
+			return 64*w + bits.TrailingZeros64(word)
+		}
+	}
+	return -1
+}
+
+// bit returns whether bit i of band is set
+func bit(band [bandWords]uint64, i int) bool {
+	return i < BandWidth && band[i/64]>>(i%64)&1 == 1
+}
+
+// xorShifted adds band, shifted down by n bits, to dst
+func xorShifted(dst *[bandWords]uint64, band [bandWords]uint64, n int) {
+	words, shift := n/64, uint(n%64)
+	for w := range dst {
+		if w+words >= bandWords {
+			break
+		}
+		dst[w] ^= band[w+words] >> shift
+		if shift > 0 && w+words+1 < bandWords {
+			dst[w] ^= band[w+words+1] << (64 - shift)
+		}
+	}
+}
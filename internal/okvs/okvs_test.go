@@ -0,0 +1,111 @@
+package okvs
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"testing"
+
+	"github.com/optable/match/internal/gf128"
+)
+
+// genKeys hashes n distinct identifiers for a table of size elements
+func genKeys(n, size int) ([]Key, []gf128.Element) {
+	var seed [SeedLen]byte
+	rand.Read(seed[:])
+	h := NewHasher(seed, size)
+	keys := make([]Key, n)
+	values := make([]gf128.Element, n)
+	for i := range keys {
+		var id [8]byte
+		binary.BigEndian.PutUint64(id[:], uint64(i))
+		keys[i], values[i] = h.Hash(id[:])
+	}
+	return keys, values
+}
+
+func testEncode(t *testing.T, n int) {
+	size := Size(n)
+	keys, values := genKeys(n, size)
+	table, err := Encode(keys, values, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(table) != size {
+		t.Fatalf("expected a table of %d elements, got %d", size, len(table))
+	}
+	for i := range keys {
+		if Decode(table, keys[i]) != values[i] {
+			t.Fatalf("key %d does not decode to its value", i)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 10, 1000, 100000} {
+		testEncode(t, n)
+	}
+}
+
+func TestEncodeFailureRate(t *testing.T) {
+	for i := 0; i < 2000; i++ {
+		testEncode(t, 300)
+	}
+}
+
+func TestEncodeDuplicates(t *testing.T) {
+	size := Size(10)
+	keys, values := genKeys(10, size)
+	// the same key with the same value is fine
+	keys, values = append(keys, keys[3]), append(values, values[3])
+	table, err := Encode(keys, values, size)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Decode(table, keys[3]) != values[3] {
+		t.Fatal("duplicated key does not decode to its value")
+	}
+	// but not with two different values
+	values[len(values)-1] = values[len(values)-1].Add(gf128.Element{1})
+	if _, err := Encode(keys, values, size); err != ErrEncode {
+		t.Fatalf("expected ErrEncode, got %v", err)
+	}
+}
+
+func TestXorShifted(t *testing.T) {
+	band := [bandWords]uint64{0xf0f0f0f0f0f0f0f1, 1<<63 | 0x5}
+	for _, n := range []int{0, 1, 4, 63, 64, 65, 127} {
+		var dst [bandWords]uint64
+		xorShifted(&dst, band, n)
+		for i := 0; i < BandWidth; i++ {
+			if bit(dst, i) != bit(band, i+n) {
+				t.Fatalf("shift by %d: bit %d is wrong", n, i)
+			}
+		}
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	const n = 1 << 20
+	size := Size(n)
+	keys, values := genKeys(n, size)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := Encode(keys, values, size); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	const n = 1 << 20
+	size := Size(n)
+	keys, values := genKeys(n, size)
+	table, err := Encode(keys, values, size)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Decode(table, keys[i%n])
+	}
+}
@@ -16,11 +16,25 @@ References:
 - https://www.iacr.org/archive/crypto2003/27290145/27290145.pdf (IKNP)
 - https://dl.acm.org/doi/10.1007/s00145-016-9236-6 (ALSZ)
 
+The OT extension itself is provided by ot.ExtensionSender and
+ot.ExtensionReceiver, the OPRF keys and encodings are the rows
+of 512 bits wide correlated OTs.
+
+The OPRF is secure against a semi-honest receiver. NewKOSOPRF
+returns an OPRF secure against a malicious receiver, following
+the paper "Actively Secure 1-out-of-N OT Extension with Application
+to Private Set Intersection" by Michele Orrù, Emmanuela Orsini, and
+Peter Scholl in 2017: the pseudorandom codes are codewords of a
+linear code of minimum distance at least 128, whose consistency is
+checked by the sender.
+
+Reference:
+- https://eprint.iacr.org/2016/933.pdf (OOS)
 */
 
 import (
 	"crypto/aes"
-	"crypto/rand"
+	"crypto/cipher"
 	"io"
 	"runtime"
 	"sync"
@@ -29,15 +43,13 @@ import (
 	"github.com/optable/match/internal/cuckoo"
 	"github.com/optable/match/internal/ot"
 	"github.com/optable/match/internal/util"
-	"github.com/zeebo/blake3"
 )
 
-const (
-	// width of base OT binary matrix as well as the output
-	// length of PseudorandomCode (in bits)
-	baseOTCount            = aes.BlockSize * 4 * 8
-	baseOTCountBitmapWidth = aes.BlockSize * 4
-)
+// linearCode is the public BCH code of the pseudorandom codes of the
+// OPRF secure against a malicious receiver. Its words are 85 bits long,
+// so that two inputs of a match between n1 and n2 inputs get the same
+// pseudorandom code with a probability of about n1 * n2 * 2^-85.
+var linearCode = sync.OnceValue(ot.BCHCode)
 
 // Key contains the relaxed OPRF keys: (C, s), (j, q_j)
 // oprfKeys is the received OT extension matrix oprfKeys
@@ -50,70 +62,100 @@ type Key struct {
 // OPRF implements the oprf struct containing the base OT
 // as well as the number of message tuples.
 type OPRF struct {
-	baseOT ot.OT // base OT under the hood
-	m      int   // number of message tuples
+	baseOT ot.OT      // base OT under the hood
+	m      int        // number of message tuples
+	kos    bool       // check the consistency of the receiver
+	prg    crypto.PRG // pseudorandom generator of the OT extension
 }
 
 // NewOPRF returns an OPRF where m specifies the number
-// of message tuples being exchanged.
+// of message tuples being exchanged, using Naor-Pinkas as its base OT.
 func NewOPRF(m int) *OPRF {
+	oprf, _ := NewOPRFWithBaseOT(m, ot.NaorPinkas)
+	return oprf
+}
+
+// NewOPRFWithBaseOT returns an OPRF where m specifies the number
+// of message tuples being exchanged and baseOT the type of base OT
+// (ot.NaorPinkas, ot.Simplest or ot.MasnyRindal) used under the hood.
+// Both parties must use the same base OT.
+func NewOPRFWithBaseOT(m, baseOT int) (*OPRF, error) {
 	// send k columns of messages of length k/8 (64 bytes)
-	baseMsgLens := make([]int, baseOTCount)
-	for i := range baseMsgLens {
-		baseMsgLens[i] = baseOTCountBitmapWidth // 64 bytes
+	b, err := ot.NewBaseOT(baseOT, ot.ExtensionBaseMsgLens())
+	if err != nil {
+		return nil, err
 	}
-
-	return &OPRF{baseOT: ot.NewNaorPinkas(baseMsgLens), m: m}
+	return &OPRF{baseOT: b, m: m}, nil
 }
 
-// Send returns the OPRF keys
-func (ext *OPRF) Send(rw io.ReadWriter) (*Key, error) {
-	// sample choice bits for baseOT
-	choices := make([]byte, baseOTCountBitmapWidth)
-	if _, err := rand.Read(choices); err != nil {
+// NewKOSOPRF returns an OPRF secure against a malicious receiver where m
+// specifies the number of message tuples being exchanged and baseOT
+// the type of base OT used under the hood. Both parties must use it,
+// and the pseudorandom codes of the sender inputs are then computed
+// with LinearPseudorandomCode instead of crypto.PseudorandomCode.
+func NewKOSOPRF(m, baseOT int) (*OPRF, error) {
+	oprf, err := NewOPRFWithBaseOT(m, baseOT)
+	if err != nil {
 		return nil, err
 	}
+	oprf.kos = true
+	return oprf, nil
+}
+
+// SetPRG sets the pseudorandom generator expanding the seeds of the
+// OT extension, crypto.PRGBlake3 by default. Both parties must use the same.
+func (ext *OPRF) SetPRG(p crypto.PRG) {
+	ext.prg = p
+}
+
+// LinearPseudorandomCode returns the pseudorandom code of src,
+// a codeword of the linear code of the OPRF secure against a malicious
+// receiver. It is ot.ExtensionRowLen bytes long, as crypto.PseudorandomCode.
+func LinearPseudorandomCode(aesBlock cipher.Block, src []byte, hIdx byte) []byte {
+	codeword := make([]byte, ot.ExtensionRowLen)
+	linearCode().Encode(codeword, pseudorandomWord(aesBlock, src, hIdx))
+	return codeword
+}
+
+// pseudorandomWord returns the word of the linear code
+// encoding to the pseudorandom code of src
+func pseudorandomWord(aesBlock cipher.Block, src []byte, hIdx byte) []byte {
+	return crypto.PseudorandomCode(aesBlock, src, hIdx)[:linearCode().WordLen()]
+}
 
+// Send returns the OPRF keys
+func (ext *OPRF) Send(rw io.ReadWriter) (*Key, error) {
 	// act as receiver in baseOT to receive k x k seeds for the pseudorandom generator
-	seeds := make([][]byte, baseOTCount)
-	if err := ext.baseOT.Receive(choices, seeds, rw); err != nil {
+	sender := ot.NewExtensionSender(ext.baseOT)
+	if ext.kos {
+		sender = ot.NewKOSExtensionSender(ext.baseOT)
+	}
+	sender.SetPRG(ext.prg)
+	if err := sender.Setup(rw); err != nil {
 		return nil, err
 	}
 
-	// receive masked columns oprfMask
-	paddedLen := util.PadBitMap(ext.m, baseOTCount)
-	oprfMask := make([]byte, paddedLen)
-	oprfKeys := make([][]byte, baseOTCount)
-	prg := blake3.New()
-	for col := range oprfKeys {
-		if _, err := io.ReadFull(rw, oprfMask); err != nil {
-			return nil, err
-		}
-
-		oprfKeys[col] = make([]byte, paddedLen)
-		if err := crypto.PseudorandomGenerate(oprfKeys[col], seeds[col], prg); err != nil {
-			return nil, err
-		}
-
-		// Binary AND of each byte in oprfMask with the test bit
-		// if bit is 1, we get whole row oprfMask to XOR with
-		// oprfKeys[row] if bit is 0, we get a row of 0s which when
-		// XORed with oprfKeys[row] just returns the same row, so
-		// no need to do an operation
-		if util.IsBitSet(choices, col) {
-			util.ConcurrentBitOp(util.Xor, oprfKeys[col], oprfMask)
-		}
+	// the correlated OT rows are the oprf keys
+	var oprfKeys [][]byte
+	var err error
+	if ext.kos {
+		oprfKeys, err = sender.ExtendCode(ext.m, linearCode(), rw)
+	} else {
+		oprfKeys, err = sender.ExtendCorrelated(ext.m, rw)
+	}
+	if err != nil {
+		return nil, err
 	}
-	runtime.GC()
-	oprfKeys = util.ConcurrentTransposeWide(oprfKeys)[:ext.m]
 
 	// store oprf keys
-	return &Key{secret: choices, oprfKeys: oprfKeys}, nil
+	return &Key{secret: sender.Secret(), oprfKeys: oprfKeys}, nil
 }
 
-// Receive returns the hashes of OPRF encodings of choice strings embedded
-// in the cuckoo hash table using OPRF keys
-func (ext *OPRF) Receive(choices *cuckoo.Cuckoo, secretKey []byte, rw io.ReadWriter) ([]map[uint64]uint64, error) {
+// Receive returns the OPRF encodings of choice strings embedded in the
+// cuckoo hash table using OPRF keys, one per slot of the table: the
+// buckets followed by the stash. The encodings of the empty slots are
+// those of an empty choice string.
+func (ext *OPRF) Receive(choices *cuckoo.Cuckoo, secretKey []byte, rw io.ReadWriter) ([][]byte, error) {
 	if int(choices.Len()) != ext.m {
 		return nil, ot.ErrBaseCountMissMatch
 	}
@@ -124,15 +166,21 @@ func (ext *OPRF) Receive(choices *cuckoo.Cuckoo, secretKey []byte, rw io.ReadWri
 		return nil, err
 	}
 
-	var pseudorandomChan = make(chan [][]byte)
+	// with the consistency check, the words of the
+	// pseudorandom codes are extended instead
+	var encode = crypto.PseudorandomCode
+	if ext.kos {
+		encode = pseudorandomWord
+	}
+
+	var pseudorandomChan = make(chan [][]byte, 1)
 	go func() {
 		defer close(pseudorandomChan)
 
 		var maxProcs = runtime.GOMAXPROCS(0)
 		var stepSize = ext.m / maxProcs
 
-		bitMapLen := util.Pad(ext.m, baseOTCount)
-		pseudorandomEncoding := make([][]byte, bitMapLen)
+		pseudorandomEncoding := make([][]byte, ext.m)
 
 		var wg sync.WaitGroup
 		wg.Add(maxProcs)
@@ -143,7 +191,7 @@ func (ext *OPRF) Receive(choices *cuckoo.Cuckoo, secretKey []byte, rw io.ReadWri
 					step := stepSize*j + offset
 					idx := choices.GetBucket(uint64(step))
 					item, hIdx := choices.GetItemWithHash(idx)
-					pseudorandomEncoding[step] = crypto.PseudorandomCode(aesBlock, item, hIdx)
+					pseudorandomEncoding[step] = encode(aesBlock, item, hIdx)
 				}
 			}(j)
 		}
@@ -152,100 +200,38 @@ func (ext *OPRF) Receive(choices *cuckoo.Cuckoo, secretKey []byte, rw io.ReadWri
 		for remaining := stepSize * maxProcs; remaining < ext.m; remaining++ {
 			idx := choices.GetBucket(uint64(remaining))
 			item, hIdx := choices.GetItemWithHash(idx)
-			pseudorandomEncoding[remaining] = crypto.PseudorandomCode(aesBlock, item, hIdx)
+			pseudorandomEncoding[remaining] = encode(aesBlock, item, hIdx)
 		}
 
-		// pad matrix to ensure the number of rows is divisible by baseOTCount for transposition
-		for i := ext.m; i < len(pseudorandomEncoding); i++ {
-			pseudorandomEncoding[i] = make([]byte, baseOTCountBitmapWidth)
-		}
-		pseudorandomChan <- util.ConcurrentTransposeTall(pseudorandomEncoding)
+		pseudorandomChan <- pseudorandomEncoding
 	}()
 
-	// sample random OT messages
-	baseMsgs, err := sampleRandomOTMessages()
-	if err != nil {
-		return nil, err
-	}
-
 	// act as sender in baseOT to send k columns
-	if err = ext.baseOT.Send(baseMsgs, rw); err != nil {
-		return nil, err
+	receiver := ot.NewExtensionReceiver(ext.baseOT)
+	if ext.kos {
+		receiver = ot.NewKOSExtensionReceiver(ext.baseOT)
 	}
-
-	// read pseudorandomEncodings
-	pseudorandomEncoding := <-pseudorandomChan
-
-	oprfEncodings := make([][]byte, baseOTCount)
-	paddedLen := util.PadBitMap(ext.m, baseOTCount)
-	oprfMask := make([]byte, paddedLen)
-	// oprfMask = G(seeds[1])
-	// oprfEncoding = G(seeds[0]) ^ oprfMask ^ pseudorandomEncoding
-	prg := blake3.New()
-	for col := range pseudorandomEncoding {
-		oprfEncodings[col] = make([]byte, paddedLen)
-		err = crypto.PseudorandomGenerate(oprfEncodings[col], baseMsgs[col][0], prg)
-		if err != nil {
-			return nil, err
-		}
-
-		err = crypto.PseudorandomGenerate(oprfMask, baseMsgs[col][1], prg)
-		if err != nil {
-			return nil, err
-		}
-
-		util.ConcurrentDoubleBitOp(util.DoubleXor, oprfMask, oprfEncodings[col], pseudorandomEncoding[col])
-
-		// send oprfMask
-		if _, err = rw.Write(oprfMask); err != nil {
-			return nil, err
-		}
+	receiver.SetPRG(ext.prg)
+	if err = receiver.Setup(rw); err != nil {
+		return nil, err
 	}
 
-	runtime.GC()
-	oprfEncodings = util.ConcurrentTransposeWide(oprfEncodings)[:ext.m]
-
-	// Hash and index all local encodings
-	// the hash value of the oprfEncodings is the key
-	// the index of the corresponding ID in the cuckoo hash table is the value
-	encodings := make([]map[uint64]uint64, cuckoo.Nhash)
-	for i := range encodings {
-		encodings[i] = make(map[uint64]uint64, ext.m)
+	// the correlated OT rows chosen with the
+	// pseudorandom encodings are the oprf encodings
+	var oprfEncodings [][]byte
+	if ext.kos {
+		oprfEncodings, err = receiver.ExtendCode(<-pseudorandomChan, linearCode(), rw)
+	} else {
+		oprfEncodings, err = receiver.ExtendCorrelated(<-pseudorandomChan, rw)
 	}
-	hasher := choices.GetHasher()
-	// hash local oprf output
-	for bIdx := uint64(0); bIdx < uint64(len(oprfEncodings)); bIdx++ {
-		// check if it was an empty input
-		if idx := choices.GetBucket(bIdx); idx != 0 {
-			// insert into proper map
-			_, hIdx := choices.GetItemWithHash(idx)
-			encodings[hIdx][hasher.Hash64(oprfEncodings[bIdx])] = idx
-		}
+	if err != nil {
+		return nil, err
 	}
 
-	return encodings, nil
+	return oprfEncodings, nil
 }
 
 // Encode computes and returns the OPRF encoding of a byte slice using an OPRF Key
 func (k Key) Encode(rowIdx uint64, pseudorandomEncoding []byte) {
 	util.ConcurrentDoubleBitOp(util.AndXor, pseudorandomEncoding, k.secret, k.oprfKeys[rowIdx])
 }
-
-// sampleRandomOTMessage allocates a slice of OTMessage, each OTMessage contains a pair of messages.
-// Extra elements are added to each column to be a multiple of 512. Every slice is filled with pseudorandom bytes
-// values from a rand reader.
-func sampleRandomOTMessages() ([]ot.OTMessage, error) {
-	// instantiate matrix
-	matrix := make([]ot.OTMessage, baseOTCount)
-	for row := range matrix {
-		for col := range matrix[row] {
-			matrix[row][col] = make([]byte, baseOTCountBitmapWidth)
-			// fill
-			if _, err := rand.Read(matrix[row][col]); err != nil {
-				return nil, err
-			}
-		}
-	}
-
-	return matrix, nil
-}
@@ -12,12 +12,13 @@ import (
 	"github.com/optable/match/internal/crypto"
 	"github.com/optable/match/internal/cuckoo"
 	"github.com/optable/match/internal/hash"
+	"github.com/optable/match/internal/ot"
 )
 
 const msgCount = 1 << 16
 
-func genChoiceString() [][]byte {
-	choices := make([][]byte, msgCount)
+func genChoiceString(n int) [][]byte {
+	choices := make([][]byte, n)
 	for i := range choices {
 		choices[i] = make([]byte, 66)
 		rand.Read(choices[i])
@@ -25,8 +26,8 @@ func genChoiceString() [][]byte {
 	return choices
 }
 
-func makeCuckoo(choices [][]byte, seeds [cuckoo.Nhash][]byte) (*cuckoo.Cuckoo, error) {
-	c := cuckoo.NewCuckoo(uint64(msgCount), seeds)
+func makeCuckoo(choices [][]byte, seeds [][]byte, p cuckoo.Params) (*cuckoo.Cuckoo, error) {
+	c := cuckoo.NewCuckoo(uint64(len(choices)), seeds, p)
 	for _, id := range choices {
 		if err := c.Insert(id); err != nil {
 			return nil, err
@@ -35,65 +36,124 @@ func makeCuckoo(choices [][]byte, seeds [cuckoo.Nhash][]byte) (*cuckoo.Cuckoo, e
 	return c, nil
 }
 
-func testEncodings(encodedHashMap []map[uint64]uint64, key *Key, sk []byte, seeds [cuckoo.Nhash][]byte, choicesCuckoo *cuckoo.Cuckoo, choices [][]byte) error {
-	senderCuckoo := cuckoo.NewCuckooHasher(uint64(msgCount), seeds)
-	hasher := senderCuckoo.GetHasher()
-	var hashes [cuckoo.Nhash]uint64
+func testEncodings(encodings [][]byte, key *Key, sk []byte, seeds [][]byte, p cuckoo.Params, choicesCuckoo *cuckoo.Cuckoo, choices [][]byte, kos bool) error {
+	senderCuckoo := cuckoo.NewCuckooHasher(uint64(len(choices)), seeds, p)
+	var bucketSize = p.BucketSize(uint64(len(choices)))
+	if len(encodings) != int(p.Len(uint64(len(choices)))) {
+		return fmt.Errorf("got %d encodings, want %d", len(encodings), p.Len(uint64(len(choices))))
+	}
 
 	aesBlock, err := aes.NewCipher(sk)
 	if err != nil {
 		return err
 	}
-	for i, id := range choices {
-		// compute encoding and hash
-		for hIdx, bIdx := range senderCuckoo.BucketIndices(id) {
-			pseudorandId := crypto.PseudorandomCode(aesBlock, id, byte(hIdx))
-			key.Encode(bIdx, pseudorandId)
-			hashes[hIdx] = hasher.Hash64(pseudorandId)
-		}
-
-		// test hashes
-		var found bool
-		for hIdx, hashed := range hashes {
-			if idx, ok := encodedHashMap[hIdx][hashed]; ok {
-				found = true
-				id, _ := choicesCuckoo.GetItemWithHash(idx)
-				if id == nil {
-					return fmt.Errorf("failed to retrieve item #%v", idx)
-				}
 
-				if !bytes.Equal(id, choices[i]) {
-					return fmt.Errorf("oprf failed, got: %v, want %v", id, choices[i])
-				}
+	// the sender computes the encoding of each slot
+	// from the pseudorandom code of the item in it
+	var found int
+	for bIdx := range encodings {
+		idx := choicesCuckoo.GetBucket(uint64(bIdx))
+		if idx == 0 {
+			continue
+		}
+		id, hIdx := choicesCuckoo.GetItemWithHash(idx)
+		if int(hIdx) < p.Nhash {
+			if senderCuckoo.BucketIndices(id)[hIdx] != uint64(bIdx) {
+				return fmt.Errorf("item in bucket #%d has hash index %d", bIdx, hIdx)
 			}
+		} else if uint64(bIdx) < bucketSize {
+			return fmt.Errorf("item in bucket #%d has the hash index of the stash", bIdx)
 		}
 
-		if !found {
-			return fmt.Errorf("failed to find proper encoding.")
+		pseudorandId := crypto.PseudorandomCode(aesBlock, id, hIdx)
+		if kos {
+			pseudorandId = LinearPseudorandomCode(aesBlock, id, hIdx)
 		}
+		key.Encode(uint64(bIdx), pseudorandId)
+		if !bytes.Equal(pseudorandId, encodings[bIdx]) {
+			return fmt.Errorf("oprf failed for item in slot #%d, got: %v, want %v", bIdx, encodings[bIdx], pseudorandId)
+		}
+		found++
+	}
+
+	if found != len(choices) {
+		return fmt.Errorf("found %d encodings of %d choices", found, len(choices))
 	}
 
 	return nil
 }
 
 func TestOPRF(t *testing.T) {
-	outBus := make(chan []map[uint64]uint64, cuckoo.Nhash)
+	testOPRF(t, msgCount, cuckoo.DefaultParams, ot.NaorPinkas, false)
+}
+
+func TestOPRFSimplest(t *testing.T) {
+	testOPRF(t, msgCount, cuckoo.DefaultParams, ot.Simplest, false)
+}
+
+func TestOPRFMasnyRindal(t *testing.T) {
+	testOPRF(t, msgCount, cuckoo.DefaultParams, ot.MasnyRindal, false)
+}
+
+func TestKOSOPRF(t *testing.T) {
+	testOPRF(t, msgCount, cuckoo.DefaultParams, ot.Simplest, true)
+}
+
+// a load factor of 1 forces items in the stash
+var stashParams = cuckoo.Params{Nhash: 3, Factor: 1, StashSize: 200}
+
+func TestOPRFStash(t *testing.T) {
+	testOPRF(t, 1<<10, stashParams, ot.Simplest, false)
+}
+
+func TestKOSOPRFStash(t *testing.T) {
+	testOPRF(t, 1<<10, stashParams, ot.Simplest, true)
+}
+
+func TestOPRFPRG(t *testing.T) {
+	for _, prg := range []crypto.PRG{crypto.PRGAESCTR, crypto.PRGCTRDRBG} {
+		for _, kos := range []bool{false, true} {
+			testOPRFWithPRG(t, 1<<12, cuckoo.DefaultParams, ot.Simplest, kos, prg)
+		}
+	}
+}
+
+// newOPRF returns the OPRF of baseOT expanding its seeds with prg,
+// with the consistency check if kos is set
+func newOPRF(m, baseOT int, kos bool, prg crypto.PRG) (o *OPRF, err error) {
+	if kos {
+		o, err = NewKOSOPRF(m, baseOT)
+	} else {
+		o, err = NewOPRFWithBaseOT(m, baseOT)
+	}
+	if err == nil {
+		o.SetPRG(prg)
+	}
+	return o, err
+}
+
+func testOPRF(t *testing.T, n int, p cuckoo.Params, baseOT int, kos bool) {
+	testOPRFWithPRG(t, n, p, baseOT, kos, crypto.PRGBlake3)
+}
+
+func testOPRFWithPRG(t *testing.T, n int, p cuckoo.Params, baseOT int, kos bool, prg crypto.PRG) {
+	outBus := make(chan [][]byte, 1)
 	keyBus := make(chan *Key)
 	errs := make(chan error, 1)
 	sk := make([]byte, 16)
-	choices := genChoiceString()
+	choices := genChoiceString(n)
 
 	// start timer
 	start := time.Now()
 	// sample seeds
-	var seeds [cuckoo.Nhash][]byte
+	var seeds = make([][]byte, p.Nhash)
 	for i := range seeds {
 		seeds[i] = make([]byte, hash.SaltLength)
 		rand.Read(seeds[i])
 	}
 
 	// generate oprf Input
-	choicesCuckoo, err := makeCuckoo(choices, seeds)
+	choicesCuckoo, err := makeCuckoo(choices, seeds, p)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -111,7 +171,8 @@ func TestOPRF(t *testing.T) {
 	go func() {
 		defer close(errs)
 		defer close(keyBus)
-		keys, err := NewOPRF(oprfInputSize).Send(senderConn)
+		sender, _ := newOPRF(oprfInputSize, baseOT, kos, prg)
+		keys, err := sender.Send(senderConn)
 		if err != nil {
 			errs <- fmt.Errorf("Send encountered error: %s", err)
 			close(outBus)
@@ -123,7 +184,8 @@ func TestOPRF(t *testing.T) {
 	// receiver
 	go func() {
 		defer close(outBus)
-		out, err := NewOPRF(oprfInputSize).Receive(choicesCuckoo, sk, receiverConn)
+		receiver, _ := newOPRF(oprfInputSize, baseOT, kos, prg)
+		out, err := receiver.Receive(choicesCuckoo, sk, receiverConn)
 		if err != nil {
 			errs <- err
 		}
@@ -141,14 +203,14 @@ func TestOPRF(t *testing.T) {
 	keys := <-keyBus
 
 	// Receive msg
-	encodedHashMap := <-outBus
+	encodings := <-outBus
 
 	// stop timer
 	end := time.Now()
-	t.Logf("Time taken for %d OPRF is: %v\n", msgCount, end.Sub(start))
+	t.Logf("Time taken for %d OPRF is: %v\n", n, end.Sub(start))
 
 	// Testing encodings
-	err = testEncodings(encodedHashMap, keys, sk, seeds, choicesCuckoo, choices)
+	err = testEncodings(encodings, keys, sk, seeds, p, choicesCuckoo, choices, kos)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -174,3 +236,43 @@ func BenchmarkEncode(b *testing.B) {
 		key.Encode(0, bytes)
 	}
 }
+
+// BenchmarkOPRFPRG runs the OPRF of 2^18 inputs with each pseudorandom
+// generator, from the base OTs to the transposed encodings
+func BenchmarkOPRFPRG(b *testing.B) {
+	const n = 1 << 18
+	var seeds = make([][]byte, cuckoo.DefaultParams.Nhash)
+	for i := range seeds {
+		seeds[i] = make([]byte, hash.SaltLength)
+		rand.Read(seeds[i])
+	}
+	choicesCuckoo, err := makeCuckoo(genChoiceString(n), seeds, cuckoo.DefaultParams)
+	if err != nil {
+		b.Fatal(err)
+	}
+	m := int(choicesCuckoo.Len())
+	sk := make([]byte, 16)
+	rand.Read(sk)
+
+	for _, prg := range []crypto.PRG{crypto.PRGBlake3, crypto.PRGAESCTR, crypto.PRGCTRDRBG} {
+		b.Run(prg.String(), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				senderConn, receiverConn := net.Pipe()
+				errs := make(chan error, 1)
+				go func() {
+					defer senderConn.Close()
+					sender, _ := newOPRF(m, ot.Simplest, false, prg)
+					_, err := sender.Send(senderConn)
+					errs <- err
+				}()
+				receiver, _ := newOPRF(m, ot.Simplest, false, prg)
+				if _, err := receiver.Receive(choicesCuckoo, sk, receiverConn); err != nil {
+					b.Fatal(err)
+				}
+				if err := <-errs; err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,422 @@
+package ot
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+
+	"github.com/optable/match/internal/crypto"
+	"github.com/optable/match/internal/util"
+	"github.com/zeebo/blake3"
+)
+
+/*
+1 out of 2 OT extension
+from the paper: "Extending oblivious transfers efficiently"
+by Yuval Ishai, Joe Kilian, Kobbi Nissim, and Erez Petrank in 2003,
+with the optimizations from the paper "More Efficient Oblivious Transfer Extensions"
+by Gilad Asharov, Yehuda Lindell, Thomas Schneider, and Michael Zohner in 2017.
+
+references:
+- https://www.iacr.org/archive/crypto2003/27290145/27290145.pdf (IKNP)
+- https://dl.acm.org/doi/10.1007/s00145-016-9236-6 (ALSZ)
+
+ExtensionWidth base OTs are run once with the roles reversed, the extension
+receiver acting as the base OT sender of pairs of PRG seeds. Every extension
+then costs one column of ExtensionWidth bits per OT on the wire: the receiver
+sends u_i = G(k0_i) ^ G(k1_i) ^ r_i for every column i of its choice matrix r,
+and the sender, who learned k(s_i)_i, computes q_i = G(k(s_i)_i) ^ s_i*u_i.
+The rows then satisfy q_j = t_j ^ (r_j & s), a correlated OT from which
+random and chosen message OTs are derived with a correlation robust hash.
+*/
+
+const (
+	// ExtensionWidth is the number of base OTs run by an OT extension
+	// and the width in bits of the rows of correlated OTs
+	ExtensionWidth = 512
+	// ExtensionRowLen is the length in bytes of the rows of correlated OTs
+	ExtensionRowLen = ExtensionWidth / 8
+	// RandomOTLen is the length of the messages of random OTs
+	RandomOTLen = keyLen
+)
+
+var (
+	ErrExtensionSetup  = errors.New("OT extension used before its setup")
+	ErrExtensionRowLen = errors.New("rows of the OT extension choice matrix must be ExtensionRowLen bytes long")
+)
+
+// ExtensionBaseMsgLens returns the message lengths the
+// base OT consumed by an OT extension must be created with
+func ExtensionBaseMsgLens() []int {
+	msgLens := make([]int, ExtensionWidth)
+	for i := range msgLens {
+		msgLens[i] = ExtensionRowLen
+	}
+	return msgLens
+}
+
+// ExtensionSender is the sender side of an OT extension,
+// it acts as the receiver of the base OTs
+type ExtensionSender struct {
+	baseOT OT
+	// secret choice bits of the base OTs
+	secret []byte
+	// pseudorandom generator expanding the seeds
+	prg crypto.PRG
+	// one PRG stream for each received seed
+	prgs []io.Reader
+	// sequence number of the next OT
+	seq uint64
+	// check the consistency of the receiver
+	check bool
+}
+
+// ExtensionReceiver is the receiver side of an OT extension,
+// it acts as the sender of the base OTs
+type ExtensionReceiver struct {
+	baseOT OT
+	// pseudorandom generator expanding the seeds
+	prg crypto.PRG
+	// two PRG streams for each pair of sent seeds
+	prgs [][2]io.Reader
+	// sequence number of the next OT
+	seq uint64
+	// prove the consistency of the choice rows
+	check bool
+}
+
+// NewExtensionSender returns an OT extension sender running
+// its base OTs with baseOT, which must be created with ExtensionBaseMsgLens.
+func NewExtensionSender(baseOT OT) *ExtensionSender {
+	return &ExtensionSender{baseOT: baseOT}
+}
+
+// NewExtensionReceiver returns an OT extension receiver running
+// its base OTs with baseOT, which must be created with ExtensionBaseMsgLens.
+func NewExtensionReceiver(baseOT OT) *ExtensionReceiver {
+	return &ExtensionReceiver{baseOT: baseOT}
+}
+
+// SetPRG sets the pseudorandom generator expanding the seeds
+// of the base OTs, crypto.PRGBlake3 by default. It must be
+// called before Setup, and both parties must use the same.
+func (e *ExtensionSender) SetPRG(p crypto.PRG) {
+	e.prg = p
+}
+
+// SetPRG sets the pseudorandom generator expanding the seeds
+// of the base OTs, crypto.PRGBlake3 by default. It must be
+// called before Setup, and both parties must use the same.
+func (e *ExtensionReceiver) SetPRG(p crypto.PRG) {
+	e.prg = p
+}
+
+// Setup runs the base OTs, acting as their receiver
+// with random choice bits
+func (e *ExtensionSender) Setup(rw io.ReadWriter) error {
+	// sample choice bits for baseOT
+	e.secret = make([]byte, ExtensionRowLen)
+	if _, err := rand.Read(e.secret); err != nil {
+		return err
+	}
+
+	// act as receiver in baseOT to receive k x k seeds for the pseudorandom generator
+	seeds := make([][]byte, ExtensionWidth)
+	if err := e.baseOT.Receive(e.secret, seeds, rw); err != nil {
+		return err
+	}
+
+	prgs := make([]io.Reader, ExtensionWidth)
+	for i := range seeds {
+		var err error
+		if prgs[i], err = crypto.NewPRG(e.prg, seeds[i]); err != nil {
+			return err
+		}
+	}
+	e.prgs = prgs
+	return nil
+}
+
+// Setup runs the base OTs, acting as their sender
+// of pairs of random seeds
+func (e *ExtensionReceiver) Setup(rw io.ReadWriter) error {
+	// sample random OT messages
+	seeds, err := sampleRandomOTMessages(ExtensionWidth, ExtensionRowLen)
+	if err != nil {
+		return err
+	}
+
+	// act as sender in baseOT to send k columns
+	if err := e.baseOT.Send(seeds, rw); err != nil {
+		return err
+	}
+
+	prgs := make([][2]io.Reader, ExtensionWidth)
+	for i := range seeds {
+		for b := range prgs[i] {
+			if prgs[i][b], err = crypto.NewPRG(e.prg, seeds[i][b]); err != nil {
+				return err
+			}
+		}
+	}
+	e.prgs = prgs
+	return nil
+}
+
+// Secret returns the secret choice bits s of the base OTs,
+// so that the rows of correlated OTs satisfy q_j = t_j ^ (r_j & s)
+func (e *ExtensionSender) Secret() []byte {
+	return e.secret
+}
+
+// ExtendCorrelated runs m correlated OTs and returns
+// the m rows q_j = t_j ^ (r_j & s) of ExtensionRowLen bytes
+func (e *ExtensionSender) ExtendCorrelated(m int, rw io.ReadWriter) ([][]byte, error) {
+	if e.prgs == nil {
+		return nil, ErrExtensionSetup
+	}
+	if m == 0 {
+		return nil, nil
+	}
+
+	// receive masked columns
+	columns, err := util.NewBitMatrix(ExtensionWidth, m)
+	if err != nil {
+		return nil, err
+	}
+	mask := make([]byte, (m+7)/8)
+	for col, column := range columns.RowSlice() {
+		if _, err := io.ReadFull(rw, mask); err != nil {
+			return nil, err
+		}
+
+		if _, err := e.prgs[col].Read(column); err != nil {
+			return nil, err
+		}
+
+		// Binary AND of each byte in mask with the test bit
+		// if bit is 1, we get whole row mask to XOR with
+		// columns[col] if bit is 0, we get a row of 0s which when
+		// XORed with columns[col] just returns the same row, so
+		// no need to do an operation
+		if util.IsBitSet(e.secret, col) {
+			util.ConcurrentBitOp(util.Xor, column, mask)
+		}
+	}
+	runtime.GC()
+	e.seq += uint64(m)
+	q, err := columns.Transpose()
+	if err != nil {
+		return nil, err
+	}
+	return q.RowSlice(), nil
+}
+
+// ExtendCorrelated runs len(choices) correlated OTs where each row of choices
+// is ExtensionRowLen bytes long and returns the rows t_j of ExtensionRowLen bytes
+func (e *ExtensionReceiver) ExtendCorrelated(choices [][]byte, rw io.ReadWriter) ([][]byte, error) {
+	if e.prgs == nil {
+		return nil, ErrExtensionSetup
+	}
+	if len(choices) == 0 {
+		return nil, nil
+	}
+
+	// the rows of choices must be ExtensionRowLen bytes long
+	rows, err := util.NewBitMatrixFromRows(choices, ExtensionWidth)
+	if err != nil {
+		return nil, ErrExtensionRowLen
+	}
+	columns, err := rows.Transpose()
+	if err != nil {
+		return nil, err
+	}
+
+	// mask = G(seeds[1])
+	// t = G(seeds[0]) ^ mask ^ choices
+	m := len(choices)
+	mask := make([]byte, (m+7)/8)
+	t, err := util.NewBitMatrix(ExtensionWidth, m)
+	if err != nil {
+		return nil, err
+	}
+	tCols := t.RowSlice()
+	for col, column := range columns.RowSlice() {
+		tCol := tCols[col]
+		if _, err := e.prgs[col][0].Read(tCol); err != nil {
+			return nil, err
+		}
+		if _, err := e.prgs[col][1].Read(mask); err != nil {
+			return nil, err
+		}
+
+		util.ConcurrentDoubleBitOp(util.DoubleXor, mask, tCol, column)
+
+		// send mask
+		if _, err := rw.Write(mask); err != nil {
+			return nil, err
+		}
+	}
+	runtime.GC()
+	e.seq += uint64(m)
+	t, err = t.Transpose()
+	if err != nil {
+		return nil, err
+	}
+	return t.RowSlice(), nil
+}
+
+// ExtendRandom runs m random OTs and returns
+// the m pairs of messages of RandomOTLen bytes
+func (e *ExtensionSender) ExtendRandom(m int, rw io.ReadWriter) ([]OTMessage, error) {
+	seq := e.seq
+	var q [][]byte
+	var err error
+	if e.check {
+		q, err = e.ExtendCode(m, RepetitionCode(), rw)
+	} else {
+		q, err = e.ExtendCorrelated(m, rw)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// x0 = H(j, q_j), x1 = H(j, q_j ^ s)
+	messages := make([]OTMessage, m)
+	h := blake3.New()
+	for j := range q {
+		messages[j][0] = correlationRobustHash(h, seq+uint64(j), q[j])
+		util.Xor(q[j], e.secret)
+		messages[j][1] = correlationRobustHash(h, seq+uint64(j), q[j])
+	}
+	return messages, nil
+}
+
+// ExtendRandom runs m random OTs with the choice bits packed in choices
+// and returns the m chosen messages of RandomOTLen bytes
+func (e *ExtensionReceiver) ExtendRandom(choices []uint8, m int, rw io.ReadWriter) ([][]byte, error) {
+	if len(choices)*8 < m {
+		return nil, ErrBaseCountMissMatch
+	}
+	seq := e.seq
+
+	// each choice bit is repeated over a whole row,
+	// the codeword of the bit in the repetition code
+	var t [][]byte
+	var err error
+	if e.check {
+		words := make([][]byte, m)
+		for j := range words {
+			words[j] = []byte{util.BitExtract(choices, j)}
+		}
+		t, err = e.ExtendCode(words, RepetitionCode(), rw)
+	} else {
+		zeros, ones := make([]byte, ExtensionRowLen), make([]byte, ExtensionRowLen)
+		for i := range ones {
+			ones[i] = 0xff
+		}
+		rows := make([][]byte, m)
+		for j := range rows {
+			rows[j] = zeros
+			if util.IsBitSet(choices, j) {
+				rows[j] = ones
+			}
+		}
+		t, err = e.ExtendCorrelated(rows, rw)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// xc = H(j, t_j)
+	messages := make([][]byte, m)
+	h := blake3.New()
+	for j := range t {
+		messages[j] = correlationRobustHash(h, seq+uint64(j), t[j])
+	}
+	return messages, nil
+}
+
+// ExtendChosen runs len(messages) OTs of the given pairs of messages
+func (e *ExtensionSender) ExtendChosen(messages []OTMessage, rw io.ReadWriter) error {
+	keys, err := e.ExtendRandom(len(messages), rw)
+	if err != nil {
+		return err
+	}
+
+	// encrypt every message with its random
+	// OT message and send them in one flight
+	var out []byte
+	for j := range messages {
+		if len(messages[j][0]) != len(messages[j][1]) {
+			return fmt.Errorf("messages of OT %d are not the same length", j)
+		}
+		for choice, plaintext := range messages[j] {
+			out = append(out, crypto.XorCipherWithBlake3(keys[j][choice], uint8(choice), plaintext)...)
+		}
+	}
+	_, err = rw.Write(out)
+	return err
+}
+
+// ExtendChosen runs len(msgLens) OTs with the choice bits packed in choices
+// and returns the chosen messages, the i-th pair of messages being msgLens[i] bytes long
+func (e *ExtensionReceiver) ExtendChosen(choices []uint8, msgLens []int, rw io.ReadWriter) ([][]byte, error) {
+	keys, err := e.ExtendRandom(choices, len(msgLens), rw)
+	if err != nil {
+		return nil, err
+	}
+
+	flight, err := readFlight(rw, sumLens(msgLens))
+	if err != nil {
+		return nil, err
+	}
+	messages := make([][]byte, len(msgLens))
+	var offset int
+	for j, l := range msgLens {
+		choiceBit := util.BitExtract(choices, j)
+		ciphertext := flight[offset+int(choiceBit)*l : offset+int(choiceBit+1)*l]
+		messages[j] = crypto.XorCipherWithBlake3(keys[j], choiceBit, ciphertext)
+		offset += 2 * l
+	}
+	return messages, nil
+}
+
+// prg returns the BLAKE3 pseudorandom stream expanded from seed,
+// its first bytes are the output of crypto.PseudorandomGenerate
+func prg(seed []byte) *blake3.Digest {
+	h := blake3.New()
+	h.Write(seed)
+	return h.Digest()
+}
+
+// correlationRobustHash hashes the j-th row
+func correlationRobustHash(h *blake3.Hasher, j uint64, row []byte) []byte {
+	var idx [8]byte
+	binary.BigEndian.PutUint64(idx[:], j)
+	h.Reset()
+	h.Write(idx[:])
+	h.Write(row)
+	return h.Sum(make([]byte, 0, RandomOTLen))
+}
+
+// sampleRandomOTMessages allocates a slice of n OTMessage, each OTMessage contains
+// a pair of messages of msgLen bytes filled with pseudorandom bytes from a rand reader.
+func sampleRandomOTMessages(n, msgLen int) ([]OTMessage, error) {
+	// instantiate matrix
+	matrix := make([]OTMessage, n)
+	for row := range matrix {
+		for col := range matrix[row] {
+			matrix[row][col] = make([]byte, msgLen)
+			// fill
+			if _, err := rand.Read(matrix[row][col]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return matrix, nil
+}
@@ -0,0 +1,190 @@
+package ot
+
+import (
+	"bytes"
+	"crypto/rand"
+	"net"
+	"testing"
+
+	"github.com/optable/match/internal/util"
+)
+
+// runExtension sets up both sides of an OT extension on a pipe
+// and runs send and receive on them concurrently
+func runExtension(send func(*ExtensionSender, net.Conn) error, receive func(*ExtensionReceiver, net.Conn) error) error {
+	return runExtensionWith(NewExtensionSender(NewSimplest(ExtensionBaseMsgLens())), NewExtensionReceiver(NewSimplest(ExtensionBaseMsgLens())), send, receive)
+}
+
+// runExtensionWith sets up sender and receiver on a pipe
+// and runs send and receive on them concurrently
+func runExtensionWith(sender *ExtensionSender, receiver *ExtensionReceiver, send func(*ExtensionSender, net.Conn) error, receive func(*ExtensionReceiver, net.Conn) error) error {
+	senderConn, receiverConn := net.Pipe()
+	errs := make(chan error, 1)
+	go func() {
+		defer senderConn.Close()
+		if err := sender.Setup(senderConn); err != nil {
+			errs <- err
+			return
+		}
+		errs <- send(sender, senderConn)
+	}()
+
+	if err := receiver.Setup(receiverConn); err != nil {
+		receiverConn.Close()
+		return err
+	}
+	if err := receive(receiver, receiverConn); err != nil {
+		receiverConn.Close()
+		return err
+	}
+	return <-errs
+}
+
+// genChoiceRows samples m random rows of a choice matrix
+func genChoiceRows(m int) [][]byte {
+	rows := make([][]byte, m)
+	for i := range rows {
+		rows[i] = make([]byte, ExtensionRowLen)
+		rand.Read(rows[i])
+	}
+	return rows
+}
+
+func TestExtensionCorrelated(t *testing.T) {
+	const m = 1000
+	choices := genChoiceRows(m)
+	var q, r [][]byte
+	var secret []byte
+	err := runExtension(func(s *ExtensionSender, c net.Conn) (err error) {
+		q, err = s.ExtendCorrelated(m, c)
+		secret = s.Secret()
+		return
+	}, func(e *ExtensionReceiver, c net.Conn) (err error) {
+		r, err = e.ExtendCorrelated(choices, c)
+		return
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(q) != m || len(r) != m {
+		t.Fatalf("expected %d rows, got %d and %d", m, len(q), len(r))
+	}
+	// q_j = t_j ^ (r_j & s)
+	for j := range q {
+		want := append([]byte{}, choices[j]...)
+		util.AndXor(want, secret, r[j])
+		if !bytes.Equal(q[j], want) {
+			t.Fatalf("row %d is not correlated", j)
+		}
+	}
+}
+
+func TestExtensionRandom(t *testing.T) {
+	const m = 700
+	choices := genChoiceBits(m/8 + 1)
+	var sent [2][]OTMessage
+	var received [2][][]byte
+	// two extensions on the same setup
+	err := runExtension(func(s *ExtensionSender, c net.Conn) (err error) {
+		for i := range sent {
+			if sent[i], err = s.ExtendRandom(m, c); err != nil {
+				return
+			}
+		}
+		return
+	}, func(e *ExtensionReceiver, c net.Conn) (err error) {
+		for i := range received {
+			if received[i], err = e.ExtendRandom(choices, m, c); err != nil {
+				return
+			}
+		}
+		return
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range sent {
+		for j := range sent[i] {
+			bit := util.BitExtract(choices, j)
+			if !bytes.Equal(received[i][j], sent[i][j][bit]) {
+				t.Fatalf("extension %d: OT %d failed", i, j)
+			}
+			if bytes.Equal(received[i][j], sent[i][j][1-bit]) {
+				t.Fatalf("extension %d: learned both messages of OT %d", i, j)
+			}
+		}
+	}
+	// the second extension is independent from the first
+	if bytes.Equal(sent[0][0][0], sent[1][0][0]) {
+		t.Fatal("random OTs repeated across extensions")
+	}
+}
+
+func TestExtensionChosen(t *testing.T) {
+	messages := genMsg(1000, 2)
+	choices := genChoiceBits(len(messages) / 8)
+	msgLens := make([]int, len(messages))
+	for i := range messages {
+		msgLens[i] = len(messages[i][0])
+	}
+	var received [][]byte
+	err := runExtension(func(s *ExtensionSender, c net.Conn) error {
+		return s.ExtendChosen(messages, c)
+	}, func(e *ExtensionReceiver, c net.Conn) (err error) {
+		received, err = e.ExtendChosen(choices, msgLens, c)
+		return
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for j := range messages {
+		bit := util.BitExtract(choices, j)
+		if !bytes.Equal(received[j], messages[j][bit]) {
+			t.Fatalf("OT %d failed", j)
+		}
+	}
+}
+
+func TestExtensionSetup(t *testing.T) {
+	if _, err := NewExtensionSender(nil).ExtendRandom(1, nil); err != ErrExtensionSetup {
+		t.Errorf("expected ErrExtensionSetup, got %v", err)
+	}
+	if _, err := NewExtensionReceiver(nil).ExtendRandom([]byte{0}, 1, nil); err != ErrExtensionSetup {
+		t.Errorf("expected ErrExtensionSetup, got %v", err)
+	}
+}
+
+func BenchmarkExtensionRandom(b *testing.B) {
+	const m = 1 << 16
+	choices := make([]byte, m/8)
+	rand.Read(choices)
+	for i := 0; i < b.N; i++ {
+		err := runExtension(func(s *ExtensionSender, c net.Conn) error {
+			_, err := s.ExtendRandom(m, c)
+			return err
+		}, func(e *ExtensionReceiver, c net.Conn) error {
+			_, err := e.ExtendRandom(choices, m, c)
+			return err
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkExtensionCorrelated(b *testing.B) {
+	const m = 1 << 16
+	choices := genChoiceRows(m)
+	for i := 0; i < b.N; i++ {
+		err := runExtension(func(s *ExtensionSender, c net.Conn) error {
+			_, err := s.ExtendCorrelated(m, c)
+			return err
+		}, func(e *ExtensionReceiver, c net.Conn) error {
+			_, err := e.ExtendCorrelated(choices, c)
+			return err
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
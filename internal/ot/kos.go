@@ -0,0 +1,230 @@
+package ot
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+
+	"github.com/optable/match/internal/gf128"
+	"github.com/optable/match/internal/util"
+)
+
+/*
+Consistency check of the OT extension against a malicious receiver
+from the paper: "Actively Secure OT Extension with Optimal Overhead"
+by Marcel Keller, Emmanuela Orsini, and Peter Scholl in 2015,
+generalized to the choice rows of a linear code as in the paper
+"Actively Secure 1-out-of-N OT Extension with Application to Private Set Intersection"
+by Michele Orrù, Emmanuela Orsini, and Peter Scholl in 2017.
+
+references:
+- https://eprint.iacr.org/2015/546.pdf (KOS)
+- https://eprint.iacr.org/2016/933.pdf (OOS)
+
+The receiver extends its choice rows, which must be codewords C(w_j), followed
+by ExtensionWidth codewords of random words that mask the check. The sender then
+samples a seed from which both parties expand a random element chi_j of GF(2^128)
+for every row. The receiver sends the sums x = sum chi_j w_j and t = sum chi_j t_j,
+the bits of the words and of the rows being lifted to GF(2^128): x holds one
+element for each of the k bits of the words, and t one for each of the
+ExtensionWidth bits of the rows. The sender checks that the same sum q of its
+rows is t_i + s_i C(x)_i at every bit i, C(x)_i being the sum of the x_l whose
+generator row l has its bit i set. A receiver whose rows are not the codewords
+of the words it claims fails the check but with a probability of about 2^-128
+over chi, unless it guesses the bits of s where they differ, which the minimum
+distance of the code, at least 128, makes as hard as guessing 128 bits of s.
+*/
+
+// checkSeedLen is the length of the seed of the check
+const checkSeedLen = 16
+
+var ErrConsistencyCheck = errors.New("OT extension consistency check failed: the receiver is cheating")
+
+// NewKOSExtensionSender returns an OT extension sender that checks the
+// consistency of the receiver choice rows in every extension, except
+// ExtendCorrelated which cannot be checked, as in NewExtensionSender.
+func NewKOSExtensionSender(baseOT OT) *ExtensionSender {
+	return &ExtensionSender{baseOT: baseOT, check: true}
+}
+
+// NewKOSExtensionReceiver returns an OT extension receiver that proves the
+// consistency of its choice rows in every extension, except
+// ExtendCorrelated which cannot be checked, as in NewExtensionReceiver.
+func NewKOSExtensionReceiver(baseOT OT) *ExtensionReceiver {
+	return &ExtensionReceiver{baseOT: baseOT, check: true}
+}
+
+// ExtendCode runs m correlated OTs whose choice rows are codewords of code,
+// checks their consistency and returns the m rows q_j = t_j ^ (C(w_j) & s).
+// ErrConsistencyCheck is returned if the receiver cheated.
+func (e *ExtensionSender) ExtendCode(m int, code *LinearCode, rw io.ReadWriter) ([][]byte, error) {
+	if m == 0 {
+		return nil, nil
+	}
+
+	// extend the rows masking the check along with the m rows
+	q, err := e.ExtendCorrelated(checkedLen(m), rw)
+	if err != nil {
+		return nil, err
+	}
+
+	// send the seed of the check once the receiver is committed to its rows
+	seed := make([]byte, checkSeedLen)
+	if _, err := rand.Read(seed); err != nil {
+		return nil, err
+	}
+	if _, err := rw.Write(seed); err != nil {
+		return nil, err
+	}
+
+	// receive the sums x and t
+	k := code.K()
+	flight, err := readFlight(rw, (k+ExtensionWidth)*gf128.Size)
+	if err != nil {
+		return nil, fmt.Errorf("error reading consistency check: %w", err)
+	}
+	x, t := decodeElements(flight[:k*gf128.Size]), decodeElements(flight[k*gf128.Size:])
+
+	// check q_i = t_i + s_i C(x)_i without branching on s
+	qs := liftedSums(q, challenges(seed, len(q)), ExtensionWidth)
+	cx := code.encodeLifted(x)
+	var diff uint64
+	for i := range qs {
+		mask := -uint64(util.BitExtract(e.secret, i))
+		want := t[i].Add(gf128.Element{cx[i][0] & mask, cx[i][1] & mask})
+		diff |= want[0] ^ qs[i][0] | want[1] ^ qs[i][1]
+	}
+	if diff != 0 {
+		return nil, ErrConsistencyCheck
+	}
+	return q[:m], nil
+}
+
+// ExtendCode runs len(words) correlated OTs whose choice rows are the codewords
+// of words in code, proves their consistency and returns the rows t_j
+func (e *ExtensionReceiver) ExtendCode(words [][]byte, code *LinearCode, rw io.ReadWriter) ([][]byte, error) {
+	rows := make([][]byte, len(words))
+	for j := range rows {
+		rows[j] = make([]byte, ExtensionRowLen)
+		code.Encode(rows[j], words[j])
+	}
+	return e.extendChecked(rows, words, code, rw)
+}
+
+// extendChecked runs the correlated OTs of rows, which are expected to be
+// the codewords of words, and answers the consistency check of the sender.
+// Rows are only taken apart from words to simulate a cheating receiver.
+func (e *ExtensionReceiver) extendChecked(rows, words [][]byte, code *LinearCode, rw io.ReadWriter) ([][]byte, error) {
+	m := len(rows)
+	if m == 0 {
+		return nil, nil
+	}
+
+	// append the random codewords masking the check
+	wordLen := code.WordLen()
+	rows = append(rows[:m:m], make([][]byte, checkedLen(m)-m)...)
+	words = append(words[:m:m], make([][]byte, checkedLen(m)-m)...)
+	for j := m; j < len(rows); j++ {
+		words[j], rows[j] = make([]byte, wordLen), make([]byte, ExtensionRowLen)
+		if _, err := rand.Read(words[j]); err != nil {
+			return nil, err
+		}
+		code.Encode(rows[j], words[j])
+	}
+
+	t, err := e.ExtendCorrelated(rows, rw)
+	if err != nil {
+		return nil, err
+	}
+
+	// receive the seed of the check and send
+	// the sums x and t in one flight
+	seed, err := readFlight(rw, checkSeedLen)
+	if err != nil {
+		return nil, fmt.Errorf("error reading consistency check seed: %w", err)
+	}
+	chi := challenges(seed, len(t))
+	out := make([]byte, 0, (code.K()+ExtensionWidth)*gf128.Size)
+	out = appendElements(out, liftedSums(words, chi, code.K()))
+	out = appendElements(out, liftedSums(t, chi, ExtensionWidth))
+	if _, err := rw.Write(out); err != nil {
+		return nil, fmt.Errorf("error writing consistency check: %w", err)
+	}
+	return t[:m], nil
+}
+
+// checkedLen returns the number of rows extended
+// to run m checked correlated OTs
+func checkedLen(m int) int {
+	return m + ExtensionWidth
+}
+
+// challenges expands seed into a random
+// element of GF(2^128) for each of the n rows
+func challenges(seed []byte, n int) []gf128.Element {
+	b := make([]byte, n*gf128.Size)
+	prg(seed).Read(b)
+	return decodeElements(b)
+}
+
+// liftedSums returns, for each of the first width bits i of the rows,
+// the sum of the chi_j of the rows j whose bit i is set
+func liftedSums(rows [][]byte, chi []gf128.Element, width int) []gf128.Element {
+	var procs = runtime.GOMAXPROCS(0)
+	var n = (width + 7) / 8
+	var partials = make([][][256]gf128.Element, procs)
+	var wg sync.WaitGroup
+	wg.Add(procs)
+	for p := range partials {
+		go func(p int) {
+			defer wg.Done()
+			// acc[i][v] is the sum of the chi_j of the
+			// rows j whose i-th byte has the value v
+			acc := make([][256]gf128.Element, n)
+			for j := p * len(rows) / procs; j < (p+1)*len(rows)/procs; j++ {
+				for i := range acc {
+					v := rows[j][i]
+					acc[i][v] = acc[i][v].Add(chi[j])
+				}
+			}
+			partials[p] = acc
+		}(p)
+	}
+	wg.Wait()
+
+	sums := make([]gf128.Element, width)
+	for _, acc := range partials {
+		for i := range acc {
+			for v := 1; v < 256; v++ {
+				for b := 0; b < 8 && i*8+b < width; b++ {
+					if v>>b&1 == 1 {
+						sums[i*8+b] = sums[i*8+b].Add(acc[i][v])
+					}
+				}
+			}
+		}
+	}
+	return sums
+}
+
+// decodeElements decodes the elements of GF(2^128) packed in b
+func decodeElements(b []byte) []gf128.Element {
+	elements := make([]gf128.Element, len(b)/gf128.Size)
+	for i := range elements {
+		elements[i] = gf128.FromBytes(b[i*gf128.Size:])
+	}
+	return elements
+}
+
+// appendElements appends the encodings of elements to b
+func appendElements(b []byte, elements []gf128.Element) []byte {
+	var buf [gf128.Size]byte
+	for _, e := range elements {
+		e.PutBytes(buf[:])
+		b = append(b, buf[:]...)
+	}
+	return b
+}
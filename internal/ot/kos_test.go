@@ -0,0 +1,224 @@
+package ot
+
+import (
+	"bytes"
+	"crypto/rand"
+	"net"
+	"testing"
+
+	"github.com/optable/match/internal/util"
+)
+
+// runKOSExtension sets up both sides of a checked OT extension
+// on a pipe and runs send and receive on them concurrently
+func runKOSExtension(send func(*ExtensionSender, net.Conn) error, receive func(*ExtensionReceiver, net.Conn) error) error {
+	return runExtensionWith(NewKOSExtensionSender(NewSimplest(ExtensionBaseMsgLens())), NewKOSExtensionReceiver(NewSimplest(ExtensionBaseMsgLens())), send, receive)
+}
+
+// genWords samples m random words of code
+func genWords(m int, code *LinearCode) [][]byte {
+	words := make([][]byte, m)
+	for i := range words {
+		words[i] = make([]byte, code.WordLen())
+		rand.Read(words[i])
+	}
+	return words
+}
+
+func TestLinearCode(t *testing.T) {
+	code := BCHCode()
+	if code.K() != 85 || code.WordLen() != 11 {
+		t.Fatalf("expected a code of dimension 85 with 11 bytes words, got %d and %d", code.K(), code.WordLen())
+	}
+	words := genWords(2, code)
+	var c [3][ExtensionRowLen]byte
+	code.Encode(c[0][:], words[0])
+	code.Encode(c[1][:], words[1])
+	util.Xor(words[0], words[1])
+	code.Encode(c[2][:], words[0])
+	// C(a ^ b) = C(a) ^ C(b)
+	util.Xor(c[0][:], c[1][:])
+	if c[0] != c[2] {
+		t.Fatal("code is not linear")
+	}
+
+	// the codewords are the multiples of the generator polynomial,
+	// which vanish on α^1 to α^126, with an even number of bits set
+	f := newGF512()
+	for _, word := range genWords(100, code) {
+		code.Encode(c[0][:], word)
+		var weight int
+		for i := 0; i < ExtensionWidth; i++ {
+			weight += int(util.BitExtract(c[0][:], i))
+		}
+		if weight%2 != 0 || weight < 128 {
+			t.Fatalf("codeword of weight %d", weight)
+		}
+		for r := 1; r < bchDistance; r++ {
+			var v uint16
+			for i := 0; i < ExtensionWidth-1; i++ {
+				if util.IsBitSet(c[0][:], i) {
+					v ^= f.exp[r*i%(ExtensionWidth-1)]
+				}
+			}
+			if v != 0 {
+				t.Fatalf("codeword does not vanish on α^%d", r)
+			}
+		}
+	}
+
+	var ones [ExtensionRowLen]byte
+	for i := range ones {
+		ones[i] = 0xff
+	}
+	RepetitionCode().Encode(c[0][:], []byte{1})
+	if c[0] != ones {
+		t.Fatal("repetition code does not repeat the bit")
+	}
+}
+
+func TestExtensionCode(t *testing.T) {
+	const m = 1000
+	code := BCHCode()
+	words := genWords(m, code)
+	var q, r [][]byte
+	var secret []byte
+	err := runKOSExtension(func(s *ExtensionSender, c net.Conn) (err error) {
+		q, err = s.ExtendCode(m, code, c)
+		secret = s.Secret()
+		return
+	}, func(e *ExtensionReceiver, c net.Conn) (err error) {
+		r, err = e.ExtendCode(words, code, c)
+		return
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(q) != m || len(r) != m {
+		t.Fatalf("expected %d rows, got %d and %d", m, len(q), len(r))
+	}
+	// q_j = t_j ^ (C(w_j) & s)
+	want := make([]byte, ExtensionRowLen)
+	for j := range q {
+		code.Encode(want, words[j])
+		util.AndXor(want, secret, r[j])
+		if !bytes.Equal(q[j], want) {
+			t.Fatalf("row %d is not correlated", j)
+		}
+	}
+}
+
+func TestKOSExtensionRandom(t *testing.T) {
+	const m = 700
+	choices := genChoiceBits(m/8 + 1)
+	var sent []OTMessage
+	var received [][]byte
+	err := runKOSExtension(func(s *ExtensionSender, c net.Conn) (err error) {
+		sent, err = s.ExtendRandom(m, c)
+		return
+	}, func(e *ExtensionReceiver, c net.Conn) (err error) {
+		received, err = e.ExtendRandom(choices, m, c)
+		return
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for j := range sent {
+		bit := util.BitExtract(choices, j)
+		if !bytes.Equal(received[j], sent[j][bit]) {
+			t.Fatalf("OT %d failed", j)
+		}
+	}
+}
+
+// cheat runs a checked extension where the receiver uses rows instead
+// of the codewords of words, and returns the error of the sender
+func cheat(t *testing.T, rows, words [][]byte, code *LinearCode) error {
+	t.Helper()
+	return runKOSExtension(func(s *ExtensionSender, c net.Conn) error {
+		_, err := s.ExtendCode(len(rows), code, c)
+		return err
+	}, func(e *ExtensionReceiver, c net.Conn) error {
+		_, err := e.extendChecked(rows, words, code, c)
+		return err
+	})
+}
+
+func TestExtensionCodeCheatingReceiver(t *testing.T) {
+	const m = 1000
+	code := BCHCode()
+
+	t.Run("tampered row", func(t *testing.T) {
+		words := genWords(m, code)
+		rows := make([][]byte, m)
+		for j := range rows {
+			rows[j] = make([]byte, ExtensionRowLen)
+			code.Encode(rows[j], words[j])
+		}
+		// flip 128 bits of a single row, which probes 128 bits
+		// of the sender secret
+		for i := 0; i < 16; i++ {
+			rows[m/2][i] ^= 0xff
+		}
+		if err := cheat(t, rows, words, code); err != ErrConsistencyCheck {
+			t.Fatalf("expected ErrConsistencyCheck, got %v", err)
+		}
+	})
+
+	t.Run("rows outside of the code", func(t *testing.T) {
+		// the choice rows of the semi-honest OPRF
+		if err := cheat(t, genChoiceRows(m), genWords(m, code), code); err != ErrConsistencyCheck {
+			t.Fatalf("expected ErrConsistencyCheck, got %v", err)
+		}
+	})
+
+	t.Run("lying about the words", func(t *testing.T) {
+		words := genWords(m, code)
+		rows := make([][]byte, m)
+		for j := range rows {
+			rows[j] = make([]byte, ExtensionRowLen)
+			code.Encode(rows[j], words[j])
+		}
+		// rows are codewords, but not of the words sent in the check
+		words[0][0] ^= 1
+		if err := cheat(t, rows, words, code); err != ErrConsistencyCheck {
+			t.Fatalf("expected ErrConsistencyCheck, got %v", err)
+		}
+	})
+
+	t.Run("repetition code", func(t *testing.T) {
+		// a receiver asking for both messages of
+		// 128 random OTs out of m
+		code := RepetitionCode()
+		words := make([][]byte, m)
+		rows := make([][]byte, m)
+		for j := range rows {
+			words[j] = []byte{0}
+			rows[j] = make([]byte, ExtensionRowLen)
+		}
+		for i := 0; i < 16; i++ {
+			rows[m/2][i] = 0xff
+		}
+		if err := cheat(t, rows, words, code); err != ErrConsistencyCheck {
+			t.Fatalf("expected ErrConsistencyCheck, got %v", err)
+		}
+	})
+}
+
+func BenchmarkExtensionCode(b *testing.B) {
+	const m = 1 << 16
+	code := BCHCode()
+	words := genWords(m, code)
+	for i := 0; i < b.N; i++ {
+		err := runKOSExtension(func(s *ExtensionSender, c net.Conn) error {
+			_, err := s.ExtendCode(m, code, c)
+			return err
+		}, func(e *ExtensionReceiver, c net.Conn) error {
+			_, err := e.ExtendCode(words, code, c)
+			return err
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package ot
+
+import (
+	"github.com/optable/match/internal/gf128"
+	"github.com/optable/match/internal/util"
+)
+
+/*
+Binary linear codes of length ExtensionWidth,
+the choice rows of an OT extension whose consistency
+is checked must be codewords of such a code.
+*/
+
+// bchDistance is the designed distance of BCHCode
+const bchDistance = 127
+
+// LinearCode is a binary linear code of dimension k and length
+// ExtensionWidth, defined by its k generator rows. Words are packed
+// k bits long byte slices, with bit l selecting generator row l.
+type LinearCode struct {
+	k         int
+	generator [][]byte
+	// tables[i][v] is the sum of the generator rows selected
+	// by the value v of the i-th byte of a word
+	tables [][256][ExtensionRowLen]byte
+}
+
+// BCHCode returns the narrow-sense binary BCH code of length 511 and
+// designed distance 127, extended with a parity bit to ExtensionWidth bits.
+// Its generator polynomial has the roots α^1 to α^126 in GF(2^9), α being a
+// root of x^9 + x^4 + 1, so that its non zero codewords have at least 127
+// bits set by the BCH bound, and at least 128 with the parity bit. Its
+// dimension is 85.
+func BCHCode() *LinearCode {
+	const n = ExtensionWidth - 1
+	f := newGF512()
+
+	// multiply the x - α^i of the cyclotomic cosets of 1 to
+	// bchDistance-1, whose product has its coefficients in GF(2)
+	var roots [n]bool
+	g := []uint16{1}
+	for i := 1; i < bchDistance; i++ {
+		for r := i; !roots[r]; r = r * 2 % n {
+			roots[r] = true
+			next := make([]uint16, len(g)+1)
+			for d := range next {
+				if d > 0 {
+					next[d] ^= g[d-1]
+				}
+				if d < len(g) {
+					next[d] ^= f.mul(f.exp[r], g[d])
+				}
+			}
+			g = next
+		}
+	}
+
+	// the generator rows are the x^l g(x)
+	// with their parity bit
+	generator := make([][]byte, n-len(g)+1)
+	for l := range generator {
+		generator[l] = make([]byte, ExtensionRowLen)
+		var parity int
+		for d, c := range g {
+			if c == 1 {
+				generator[l][(l+d)/8] |= 1 << ((l + d) % 8)
+				parity ^= 1
+			}
+		}
+		generator[l][n/8] |= byte(parity) << (n % 8)
+	}
+	return newLinearCode(generator)
+}
+
+// RepetitionCode returns the code of dimension 1 whose
+// only non zero codeword is the all ones row. These are the
+// choice rows of 1 out of 2 OTs.
+func RepetitionCode() *LinearCode {
+	ones := make([]byte, ExtensionRowLen)
+	for i := range ones {
+		ones[i] = 0xff
+	}
+	return newLinearCode([][]byte{ones})
+}
+
+// newLinearCode precomputes the encoding tables of generator
+func newLinearCode(generator [][]byte) *LinearCode {
+	c := &LinearCode{k: len(generator), generator: generator, tables: make([][256][ExtensionRowLen]byte, (len(generator)+7)/8)}
+	for i := range c.tables {
+		for v := 1; v < 256; v++ {
+			// extend the sum of the lower bits of v
+			// with the generator row of its top bit
+			var top int
+			for top = 7; v>>top == 0; top-- {
+			}
+			c.tables[i][v] = c.tables[i][v^(1<<top)]
+			if l := i*8 + top; l < c.k {
+				util.Xor(c.tables[i][v][:], generator[l])
+			}
+		}
+	}
+	return c
+}
+
+// K returns the dimension of the code
+func (c *LinearCode) K() int {
+	return c.k
+}
+
+// WordLen returns the length in bytes of the words of the code,
+// whose bits beyond the dimension of the code are ignored
+func (c *LinearCode) WordLen() int {
+	return len(c.tables)
+}
+
+// Encode writes the codeword of word into dst, which must be ExtensionRowLen bytes long
+func (c *LinearCode) Encode(dst, word []byte) {
+	for i := range dst {
+		dst[i] = 0
+	}
+	for i := range c.tables {
+		util.Xor(dst, c.tables[i][word[i]][:])
+	}
+}
+
+// encodeLifted returns the codeword of the word of k elements of GF(2^128)
+// x: for each bit i, the sum of the x_l whose generator row l has its bit i set
+func (c *LinearCode) encodeLifted(x []gf128.Element) []gf128.Element {
+	codeword := make([]gf128.Element, ExtensionWidth)
+	for l, row := range c.generator {
+		for i := range codeword {
+			if util.IsBitSet(row, i) {
+				codeword[i] = codeword[i].Add(x[l])
+			}
+		}
+	}
+	return codeword
+}
+
+// gf512 holds the powers and the logarithms of the primitive
+// element α of GF(2^9), defined by the polynomial x^9 + x^4 + 1
+type gf512 struct {
+	exp [ExtensionWidth - 1]uint16
+	log [ExtensionWidth]uint16
+}
+
+// newGF512 returns the tables of GF(2^9)
+func newGF512() *gf512 {
+	f := new(gf512)
+	v := uint16(1)
+	for i := range f.exp {
+		f.exp[i], f.log[v] = v, uint16(i)
+		if v <<= 1; v&(1<<9) != 0 {
+			v ^= 1<<9 | 1<<4 | 1
+		}
+	}
+	return f
+}
+
+// mul returns a times b
+func (f *gf512) mul(a, b uint16) uint16 {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return f.exp[(int(f.log[a])+int(f.log[b]))%len(f.exp)]
+}
@@ -0,0 +1,152 @@
+package ot
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+
+	r255 "github.com/gtank/ristretto255"
+	"github.com/optable/match/internal/crypto"
+	"github.com/optable/match/internal/util"
+)
+
+/*
+1 out of 2 base OT
+from the paper: Endemic Oblivious Transfer
+by Daniel Masny and Peter Rindal in 2019.
+reference: https://eprint.iacr.org/2019/706.pdf
+
+Implemented with Diffie-Hellman key agreement on ristretto255
+and all the OTs batched in two flights: the receiver samples
+r_1-c at random, sets r_c = bG - H(r_1-c) and sends every
+pair (r_0, r_1). The sender recovers B_j = r_j + H(r_1-j),
+and replies with A = aG followed by every pair of ciphertexts
+encrypted under the keys derived from aB_0 and aB_1.
+*/
+
+type masnyRindal struct {
+	// msgLen holds the length of each pair of OT message
+	// it serves to inform the receiver, how many bytes it is
+	// expected to read
+	msgLens []int
+}
+
+func NewMasnyRindal(msgLens []int) OT {
+	return masnyRindal{msgLens: msgLens}
+}
+
+func (m masnyRindal) Send(otMessages []OTMessage, rw io.ReadWriter) (err error) {
+	if len(m.msgLens) != len(otMessages) {
+		return ErrBaseCountMissMatch
+	}
+
+	// read all the (r_0, r_1) pairs at once
+	flight, err := readFlight(rw, len(otMessages)*2*pointLen)
+	if err != nil {
+		return fmt.Errorf("error reading points: %w", err)
+	}
+
+	// generate sender secret a and point A = aG
+	secretA, err := randomScalar()
+	if err != nil {
+		return fmt.Errorf("error generating keys: %w", err)
+	}
+	encodedA := r255.NewElement().ScalarBaseMult(secretA).Encode(nil)
+
+	// send point A followed by the encrypted
+	// messages in one flight
+	out := make([]byte, pointLen+sumLens(m.msgLens))
+	copy(out, encodedA)
+	offsets := offsets(m.msgLens)
+	err = parallel(len(otMessages), func(i int) (err error) {
+		l := m.msgLens[i]
+		if len(otMessages[i][0]) != l || len(otMessages[i][1]) != l {
+			return ErrBaseCountMissMatch
+		}
+		transcript := flight[i*2*pointLen : (i+1)*2*pointLen]
+		var r [2]*r255.Element
+		for j := range r {
+			if r[j], err = decodePoint(transcript[j*pointLen:(j+1)*pointLen], false); err != nil {
+				return err
+			}
+		}
+
+		// encrypt plaintext message with keys
+		// derived from a(r_j + H(r_1-j))
+		for choice, plaintext := range otMessages[i] {
+			other := transcript[(1-choice)*pointLen : (2-choice)*pointLen]
+			pointB := r255.NewElement().Add(r[choice], hashToPoint(other))
+			pointK := r255.NewElement().ScalarMult(secretA, pointB)
+			key := deriveKey(i, pointK, encodedA, transcript)
+			copy(out[pointLen+offsets[i]+choice*l:], crypto.XorCipherWithBlake3(key, uint8(choice), plaintext))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err = rw.Write(out); err != nil {
+		return fmt.Errorf("error writing bytes: %w", err)
+	}
+	return
+}
+
+func (m masnyRindal) Receive(choices []uint8, messages [][]byte, rw io.ReadWriter) (err error) {
+	if len(choices)*8 != len(messages) || len(choices)*8 != len(m.msgLens) {
+		return ErrBaseCountMissMatch
+	}
+
+	var secretB = make([]*r255.Scalar, len(messages))
+	var transcripts = make([]byte, len(messages)*2*pointLen)
+	err = parallel(len(messages), func(i int) (err error) {
+		if secretB[i], err = randomScalar(); err != nil {
+			return fmt.Errorf("error generating keys: %w", err)
+		}
+		choiceBit := int(util.BitExtract(choices, i))
+		transcript := transcripts[i*2*pointLen : (i+1)*2*pointLen]
+		// r_1-c is a random point
+		var seed [64]byte
+		if _, err := rand.Read(seed[:]); err != nil {
+			return fmt.Errorf("error generating keys: %w", err)
+		}
+		other := r255.NewElement().FromUniformBytes(seed[:]).Encode(nil)
+		copy(transcript[(1-choiceBit)*pointLen:], other)
+		// r_c = bG - H(r_1-c)
+		pointB := r255.NewElement().ScalarBaseMult(secretB[i])
+		copy(transcript[choiceBit*pointLen:], pointB.Subtract(pointB, hashToPoint(other)).Encode(nil))
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// send all the (r_0, r_1) pairs at once
+	if _, err := rw.Write(transcripts); err != nil {
+		return fmt.Errorf("error writing points: %w", err)
+	}
+
+	// receive point A and all the encrypted messages at once
+	flight, err := readFlight(rw, pointLen+sumLens(m.msgLens))
+	if err != nil {
+		return fmt.Errorf("error reading bytes: %w", err)
+	}
+	encodedA := flight[:pointLen]
+	pointA, err := decodePoint(encodedA, true)
+	if err != nil {
+		return err
+	}
+
+	offsets := offsets(m.msgLens)
+	return parallel(len(messages), func(i int) error {
+		l := m.msgLens[i]
+		choiceBit := util.BitExtract(choices, i)
+		// K = bA
+		pointK := r255.NewElement().ScalarMult(secretB[i], pointA)
+		key := deriveKey(i, pointK, encodedA, transcripts[i*2*pointLen:(i+1)*2*pointLen])
+		// decrypt the message indexed by choice bit
+		offset := pointLen + offsets[i] + int(choiceBit)*l
+		messages[i] = crypto.XorCipherWithBlake3(key, choiceBit, flight[offset:offset+l])
+		return nil
+	})
+}
@@ -9,7 +9,14 @@ import (
 OT interface
 */
 
+const (
+	NaorPinkas = iota
+	Simplest
+	MasnyRindal
+)
+
 var (
+	ErrUnknownOT          = errors.New("cannot create an OT that follows an unknown protocol")
 	ErrBaseCountMissMatch = errors.New("provided slices is not the same length as the number of base OT")
 	ErrEmptyMessage       = errors.New("attempt to perform OT on empty messages")
 )
@@ -26,3 +33,18 @@ type OT interface {
 // and an OT receiver with choice bit 1 will
 // correctly decode the second message
 type OTMessage [2][]byte
+
+// NewBaseOT returns an OT of type t
+// exchanging messages of lengths msgLens
+func NewBaseOT(t int, msgLens []int) (OT, error) {
+	switch t {
+	case NaorPinkas:
+		return NewNaorPinkas(msgLens), nil
+	case Simplest:
+		return NewSimplest(msgLens), nil
+	case MasnyRindal:
+		return NewMasnyRindal(msgLens), nil
+	default:
+		return nil, ErrUnknownOT
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"crypto/rand"
 	"fmt"
+	"io"
 	"net"
 	"testing"
 	"time"
@@ -104,3 +105,130 @@ func TestNaorPinkas(t *testing.T) {
 		}
 	}
 }
+
+// delayed adds a delay to every write
+// to simulate the latency of a network
+type delayed struct {
+	net.Conn
+	latency time.Duration
+}
+
+func (d delayed) Write(b []byte) (int, error) {
+	time.Sleep(d.latency)
+	return d.Conn.Write(b)
+}
+
+// runOT runs newOT on both ends of a pipe with the given
+// latency and returns the messages learned by the receiver
+func runOT(newOT func([]int) OT, messages []OTMessage, choices []uint8, latency time.Duration) ([][]byte, error) {
+	msgLen := make([]int, len(messages))
+	for i, m := range messages {
+		msgLen[i] = len(m[0])
+	}
+
+	senderConn, receiverConn := net.Pipe()
+	errs := make(chan error, 1)
+	go func() {
+		defer senderConn.Close()
+		errs <- newOT(msgLen).Send(messages, delayed{senderConn, latency})
+	}()
+
+	msg := make([][]byte, len(messages))
+	if err := newOT(msgLen).Receive(choices, msg, delayed{receiverConn, latency}); err != nil {
+		receiverConn.Close()
+		return nil, err
+	}
+	if err := <-errs; err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+func testOT(t *testing.T, newOT func([]int) OT) {
+	messages := genMsg(baseCount, 2)
+	choices := genChoiceBits(baseCount / 8)
+
+	msg, err := runOT(newOT, messages, choices, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range msg {
+		bit := util.BitExtract(choices, i)
+		if !bytes.Equal(m, messages[i][bit]) {
+			t.Fatalf("OT failed got: %s, want %s", m, messages[i][bit])
+		}
+		if bytes.Equal(m, messages[i][1-bit]) {
+			t.Fatalf("OT failed, learned both messages of OT %d", i)
+		}
+	}
+}
+
+func TestSimplest(t *testing.T) {
+	testOT(t, NewSimplest)
+}
+
+func TestMasnyRindal(t *testing.T) {
+	testOT(t, NewMasnyRindal)
+}
+
+func TestNewBaseOT(t *testing.T) {
+	for _, typ := range []int{NaorPinkas, Simplest, MasnyRindal} {
+		if _, err := NewBaseOT(typ, nil); err != nil {
+			t.Errorf("base OT type %d: %v", typ, err)
+		}
+	}
+	if _, err := NewBaseOT(-1, nil); err != ErrUnknownOT {
+		t.Errorf("expected ErrUnknownOT, got %v", err)
+	}
+}
+
+func TestRistrettoOTRejectsIdentity(t *testing.T) {
+	msgLen := []int{16, 16, 16, 16, 16, 16, 16, 16}
+	// a sender that answers with the identity point
+	// in place of A for both protocols
+	var identity = make([]byte, pointLen+sumLens(msgLen))
+	for _, newOT := range []func([]int) OT{NewSimplest, NewMasnyRindal} {
+		rw := struct {
+			io.Reader
+			io.Writer
+		}{bytes.NewReader(identity), io.Discard}
+		err := newOT(msgLen).Receive([]uint8{0xaa}, make([][]byte, 8), rw)
+		if err != ErrIdentityPoint {
+			t.Errorf("expected ErrIdentityPoint, got %v", err)
+		}
+	}
+}
+
+// the base OTs run by the OPRF: 512 OTs of 64 bytes,
+// on a local pipe and with 1ms of latency per flight
+func benchmarkOT(b *testing.B, newOT func([]int) OT) {
+	messages := make([]OTMessage, baseCount)
+	for i := range messages {
+		for j := range messages[i] {
+			messages[i][j] = make([]byte, 64)
+			rand.Read(messages[i][j])
+		}
+	}
+	choices := genChoiceBits(baseCount / 8)
+	for _, latency := range []time.Duration{0, time.Millisecond} {
+		b.Run(fmt.Sprintf("latency=%v", latency), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := runOT(newOT, messages, choices, latency); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkNaorPinkas(b *testing.B) {
+	benchmarkOT(b, NewNaorPinkas)
+}
+
+func BenchmarkSimplest(b *testing.B) {
+	benchmarkOT(b, NewSimplest)
+}
+
+func BenchmarkMasnyRindal(b *testing.B) {
+	benchmarkOT(b, NewMasnyRindal)
+}
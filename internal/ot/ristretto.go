@@ -0,0 +1,130 @@
+package ot
+
+import (
+	"crypto/rand"
+	"crypto/sha512"
+	"encoding/binary"
+	"errors"
+	"io"
+	"runtime"
+	"sync"
+
+	r255 "github.com/gtank/ristretto255"
+	"github.com/zeebo/blake3"
+)
+
+/*
+ristretto255 helpers shared by the
+Simplest and Masny-Rindal base OTs
+*/
+
+const (
+	// pointLen is the length of an encoded ristretto255 point
+	pointLen = 32
+	// keyLen is the length of the keys derived
+	// from the shared points
+	keyLen = 32
+)
+
+var (
+	ErrInvalidPoint  = errors.New("received an invalid ristretto255 point")
+	ErrIdentityPoint = errors.New("received the ristretto255 identity point")
+)
+
+// randomScalar samples a uniformly random scalar
+func randomScalar() (*r255.Scalar, error) {
+	var b [64]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return nil, err
+	}
+	return r255.NewScalar().FromUniformBytes(b[:]), nil
+}
+
+// hashToPoint maps b to a ristretto255 point
+// with unknown discrete logarithm
+func hashToPoint(b []byte) *r255.Element {
+	h := sha512.Sum512(b)
+	return r255.NewElement().FromUniformBytes(h[:])
+}
+
+// decodePoint decodes an encoded point from b,
+// refusing the identity if nonIdentity is set
+func decodePoint(b []byte, nonIdentity bool) (*r255.Element, error) {
+	p := r255.NewElement()
+	if err := p.Decode(b); err != nil {
+		return nil, ErrInvalidPoint
+	}
+	if nonIdentity && p.Equal(r255.NewElement().Zero()) == 1 {
+		return nil, ErrIdentityPoint
+	}
+	return p, nil
+}
+
+// deriveKey derives the key of the i-th OT
+// from the shared point and the transcript of that OT
+func deriveKey(i int, shared *r255.Element, transcript ...[]byte) []byte {
+	h := blake3.New()
+	var idx [8]byte
+	binary.BigEndian.PutUint64(idx[:], uint64(i))
+	h.Write(idx[:])
+	for _, t := range transcript {
+		h.Write(t)
+	}
+	h.Write(shared.Encode(nil))
+	return h.Sum(make([]byte, 0, keyLen))
+}
+
+// sumLens returns the total length of the
+// pairs of messages described by msgLens
+func sumLens(msgLens []int) (n int) {
+	for _, l := range msgLens {
+		n += 2 * l
+	}
+	return
+}
+
+// offsets returns the offset of each pair of
+// messages described by msgLens in a flight
+func offsets(msgLens []int) []int {
+	offsets := make([]int, len(msgLens))
+	for i := 1; i < len(msgLens); i++ {
+		offsets[i] = offsets[i-1] + 2*msgLens[i-1]
+	}
+	return offsets
+}
+
+// parallel runs f on [0, n) split across all the cores
+// and returns the error of the lowest failing index
+func parallel(n int, f func(i int) error) error {
+	var procs = runtime.GOMAXPROCS(0)
+	var errs = make([]error, procs)
+	var wg sync.WaitGroup
+	wg.Add(procs)
+	for p := 0; p < procs; p++ {
+		go func(p int) {
+			defer wg.Done()
+			for i := p * n / procs; i < (p+1)*n/procs; i++ {
+				if err := f(i); err != nil {
+					errs[p] = err
+					return
+				}
+			}
+		}(p)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readFlight reads exactly n bytes from r
+func readFlight(r io.Reader, n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
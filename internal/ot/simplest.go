@@ -0,0 +1,154 @@
+package ot
+
+import (
+	"fmt"
+	"io"
+
+	r255 "github.com/gtank/ristretto255"
+	"github.com/optable/match/internal/crypto"
+	"github.com/optable/match/internal/util"
+)
+
+/*
+1 out of 2 base OT
+from the paper: The Simplest Protocol for Oblivious Transfer
+by Tung Chou and Claudio Orlandi in 2015.
+reference: https://eprint.iacr.org/2015/267.pdf
+
+Implemented on ristretto255 with all the OTs batched:
+the sender sends A = aG, the receiver replies with every
+B_i = b_iG + c_iA in one flight and the sender replies with
+every pair of ciphertexts in one flight.
+*/
+
+type simplest struct {
+	// msgLen holds the length of each pair of OT message
+	// it serves to inform the receiver, how many bytes it is
+	// expected to read
+	msgLens []int
+}
+
+func NewSimplest(msgLens []int) OT {
+	return simplest{msgLens: msgLens}
+}
+
+func (s simplest) Send(otMessages []OTMessage, rw io.ReadWriter) (err error) {
+	if len(s.msgLens) != len(otMessages) {
+		return ErrBaseCountMissMatch
+	}
+
+	// generate sender secret a and point A = aG
+	secretA, err := randomScalar()
+	if err != nil {
+		return fmt.Errorf("error generating keys: %w", err)
+	}
+	pointA := r255.NewElement().ScalarBaseMult(secretA)
+	encodedA := pointA.Encode(nil)
+
+	// send point A to receiver
+	if _, err := rw.Write(encodedA); err != nil {
+		return fmt.Errorf("error writing point: %w", err)
+	}
+
+	// read all the B points at once
+	flight, err := readFlight(rw, len(otMessages)*pointLen)
+	if err != nil {
+		return fmt.Errorf("error reading points: %w", err)
+	}
+
+	// precompute aA
+	pointAA := r255.NewElement().ScalarMult(secretA, pointA)
+
+	// encrypt plaintext messages and send them in one flight
+	out := make([]byte, sumLens(s.msgLens))
+	offsets := offsets(s.msgLens)
+	err = parallel(len(otMessages), func(i int) error {
+		l := s.msgLens[i]
+		if len(otMessages[i][0]) != l || len(otMessages[i][1]) != l {
+			return ErrBaseCountMissMatch
+		}
+		encodedB := flight[i*pointLen : (i+1)*pointLen]
+		pointB, err := decodePoint(encodedB, false)
+		if err != nil {
+			return err
+		}
+
+		// K0 = aB, K1 = a(B - A) = aB - aA
+		var keys [2][]byte
+		pointK := r255.NewElement().ScalarMult(secretA, pointB)
+		keys[0] = deriveKey(i, pointK, encodedA, encodedB)
+		keys[1] = deriveKey(i, pointK.Subtract(pointK, pointAA), encodedA, encodedB)
+
+		// encrypt plaintext message with keys
+		for choice, plaintext := range otMessages[i] {
+			copy(out[offsets[i]+choice*l:], crypto.XorCipherWithBlake3(keys[choice], uint8(choice), plaintext))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if _, err = rw.Write(out); err != nil {
+		return fmt.Errorf("error writing bytes: %w", err)
+	}
+	return
+}
+
+func (s simplest) Receive(choices []uint8, messages [][]byte, rw io.ReadWriter) (err error) {
+	if len(choices)*8 != len(messages) || len(choices)*8 != len(s.msgLens) {
+		return ErrBaseCountMissMatch
+	}
+
+	// receive point A from sender
+	encodedA, err := readFlight(rw, pointLen)
+	if err != nil {
+		return fmt.Errorf("error reading point: %w", err)
+	}
+	pointA, err := decodePoint(encodedA, true)
+	if err != nil {
+		return err
+	}
+
+	// B = bG if the choice bit is 0, B = A + bG otherwise
+	var secretB = make([]*r255.Scalar, len(messages))
+	var encodedB = make([]byte, len(messages)*pointLen)
+	err = parallel(len(messages), func(i int) (err error) {
+		if secretB[i], err = randomScalar(); err != nil {
+			return fmt.Errorf("error generating keys: %w", err)
+		}
+		pointB := r255.NewElement().ScalarBaseMult(secretB[i])
+		if util.IsBitSet(choices, i) {
+			pointB.Add(pointB, pointA)
+		}
+		pointB.Encode(encodedB[i*pointLen : i*pointLen])
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	// send all the B points at once
+	if _, err := rw.Write(encodedB); err != nil {
+		return fmt.Errorf("error writing points: %w", err)
+	}
+
+	// receive all the encrypted messages at once
+	flight, err := readFlight(rw, sumLens(s.msgLens))
+	if err != nil {
+		return fmt.Errorf("error reading bytes: %w", err)
+	}
+
+	offsets := offsets(s.msgLens)
+	return parallel(len(messages), func(i int) error {
+		l := s.msgLens[i]
+		choiceBit := util.BitExtract(choices, i)
+		// K = bA
+		pointK := r255.NewElement().ScalarMult(secretB[i], pointA)
+		key := deriveKey(i, pointK, encodedA, encodedB[i*pointLen:(i+1)*pointLen])
+		// decrypt the message indexed by choice bit
+		offset := offsets[i] + int(choiceBit)*l
+		messages[i] = crypto.XorCipherWithBlake3(key, choiceBit, flight[offset:offset+l])
+		return nil
+	})
+}
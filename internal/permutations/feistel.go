@@ -0,0 +1,116 @@
+package permutations
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"math/bits"
+)
+
+const (
+	// FeistelKeyLen is the length in bytes of a feistel key
+	FeistelKeyLen = 16
+	// feistelRounds is the number of rounds of the network,
+	// well above the 4 rounds needed for a strong PRP so that
+	// small domains keep a comfortable margin
+	feistelRounds = 10
+)
+
+// feistel shuffler, a keyed pseudorandom permutation of [0, l)
+// built from a balanced feistel network on the smallest even number
+// of bits covering l, with AES-128 as the round function.
+// Values falling outside of [0, l) are encrypted again
+// (cycle-walking) until they land in the domain, which takes
+// less than 4 iterations on average.
+//
+// l The desired size of the permutation vector
+// half The number of bits in each half of the network
+// block The keyed round function
+type feistel struct {
+	l     int64
+	half  uint
+	mask  uint64
+	block cipher.Block
+}
+
+// NewFeistel with l the desired size of the permutation vector,
+// keyed with a random 128-bit key
+func NewFeistel(l int64) (feistel, error) {
+	var key [FeistelKeyLen]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return feistel{}, err
+	}
+	return NewFeistelWithKey(l, key)
+}
+
+// NewFeistelWithKey with l the desired size of the permutation vector
+// and key the 128-bit key of the permutation
+func NewFeistelWithKey(l int64, key [FeistelKeyLen]byte) (feistel, error) {
+	if l < 0 {
+		return feistel{}, fmt.Errorf("value %d is not a valid size for feistel", l)
+	}
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return feistel{}, err
+	}
+	// make sure l is at least 1 and split the bits of
+	// l-1 in two equal halves of at least 1 bit each,
+	// half is at most 32 bits since l-1 fits in 63 bits
+	l = max(l, 1)
+	half := uint(bits.Len64(uint64(max(l, 2)-1))+1) / 2
+
+	return feistel{l: l, half: half, mask: 1<<half - 1, block: block}, nil
+}
+
+// round computes the round function r on the right half x
+func (f feistel) round(r int, x uint64) uint64 {
+	var b [aes.BlockSize]byte
+	// the domain size is part of the input so that
+	// permutations of different sizes under the same
+	// key are not related
+	binary.BigEndian.PutUint64(b[:8], uint64(f.l))
+	b[8] = byte(r)
+	binary.BigEndian.PutUint32(b[12:], uint32(x))
+	f.block.Encrypt(b[:], b[:])
+	return binary.BigEndian.Uint64(b[:8]) & f.mask
+}
+
+// encrypt runs the network forward on the 2*half bits of x
+func (f feistel) encrypt(x uint64) uint64 {
+	left, right := x>>f.half, x&f.mask
+	for r := 0; r < feistelRounds; r++ {
+		left, right = right, left^f.round(r, right)
+	}
+	return left<<f.half | right
+}
+
+// decrypt runs the network backward on the 2*half bits of x
+func (f feistel) decrypt(x uint64) uint64 {
+	left, right := x>>f.half, x&f.mask
+	for r := feistelRounds - 1; r >= 0; r-- {
+		left, right = right^f.round(r, left), left
+	}
+	return left<<f.half | right
+}
+
+// Shuffle uses a feistel network with cycle-walking
+// with n the number to permute/the index of the permutation vector.
+func (f feistel) Shuffle(n int64) int64 {
+	var i = f.encrypt(uint64(n))
+	for i >= uint64(f.l) {
+		i = f.encrypt(i)
+	}
+	return int64(i)
+}
+
+// Unshuffle is the inverse of Shuffle,
+// Unshuffle(Shuffle(n)) == n for any n in [0, l).
+func (f feistel) Unshuffle(n int64) int64 {
+	var i = f.decrypt(uint64(n))
+	for i >= uint64(f.l) {
+		i = f.decrypt(i)
+	}
+	return int64(i)
+}
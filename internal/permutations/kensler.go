@@ -4,6 +4,9 @@
 // reference:             https://graphics.pixar.com/library/MultiJitteredSampling/paper.pdf
 // further comments from: https://afnan.io/posts/2019-04-05-explaining-the-hashed-permutation/
 //
+// Kensler is limited to 2^32 elements and is not a cryptographically strong permutation,
+// NewFeistel provides a keyed pseudorandom permutation on any int64 domain.
+//
 package permutations
 
 import (
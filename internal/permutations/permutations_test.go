@@ -63,3 +63,106 @@ func genSequence(p Permutations) (data []int64) {
 	}
 	return
 }
+
+func TestFeistelRoundTrip(t *testing.T) {
+	for _, l := range []int64{0, 1, 2, 3, xxx, 1000, 1 << 16, 1<<16 + 1} {
+		p, err := NewFeistel(l)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var seen = make(map[int64]bool, l)
+		for i := int64(0); i < l; i++ {
+			next := p.Shuffle(i)
+			if next < 0 || next >= l {
+				t.Fatalf("l=%d: %d shuffled out of range to %d", l, i, next)
+			}
+			if seen[next] {
+				t.Fatalf("l=%d: %d shuffled twice", l, next)
+			}
+			seen[next] = true
+			if back := p.Unshuffle(next); back != i {
+				t.Fatalf("l=%d: expected %d to round trip, got %d", l, i, back)
+			}
+		}
+	}
+}
+
+func TestFeistelLargeDomain(t *testing.T) {
+	// past the kensler limit
+	var l int64 = 1<<40 + 7
+	if _, err := NewKensler(l); err == nil {
+		t.Fatalf("expected kensler to refuse %d elements", l)
+	}
+	p, err := NewFeistel(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range []int64{0, 1, 1 << 32, 1<<32 + 1, l / 2, l - 1} {
+		next := p.Shuffle(i)
+		if next < 0 || next >= l {
+			t.Fatalf("%d shuffled out of range to %d", i, next)
+		}
+		if back := p.Unshuffle(next); back != i {
+			t.Fatalf("expected %d to round trip, got %d", i, back)
+		}
+	}
+}
+
+func TestFeistelKey(t *testing.T) {
+	var k1, k2 [FeistelKeyLen]byte
+	k2[0] = 1
+	p1, _ := NewFeistelWithKey(1000, k1)
+	p2, _ := NewFeistelWithKey(1000, k1)
+	p3, _ := NewFeistelWithKey(1000, k2)
+	var same int
+	for i := int64(0); i < 1000; i++ {
+		if p1.Shuffle(i) != p2.Shuffle(i) {
+			t.Fatalf("same key produced different permutations at %d", i)
+		}
+		if p1.Shuffle(i) == p3.Shuffle(i) {
+			same++
+		}
+	}
+	// about 1 fixed point is expected between two random permutations
+	if same > 10 {
+		t.Errorf("different keys agree on %d out of 1000 positions", same)
+	}
+}
+
+func TestFeistelDistribution(t *testing.T) {
+	// over many keys, every input should land in every
+	// output position about as often
+	const l, keys = 8, 8000
+	var counts [l][l]int
+	for k := 0; k < keys; k++ {
+		p, _ := NewFeistel(l)
+		for i := int64(0); i < l; i++ {
+			counts[i][p.Shuffle(i)]++
+		}
+	}
+	// expected keys/l = 1000 per cell, the standard deviation is
+	// about 30 so anything outside of +/- 150 is a clear bias
+	for i := range counts {
+		for j, c := range counts[i] {
+			if c < keys/l-150 || c > keys/l+150 {
+				t.Errorf("%d shuffled to %d %d times out of %d", i, j, c, keys)
+			}
+		}
+	}
+}
+
+func BenchmarkFeistelShuffle(b *testing.B) {
+	p, _ := NewFeistel(1 << 34)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Shuffle(int64(i))
+	}
+}
+
+func BenchmarkKenslerShuffle(b *testing.B) {
+	p, _ := NewKensler(1 << 31)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		p.Shuffle(int64(i))
+	}
+}
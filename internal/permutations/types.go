@@ -10,6 +10,7 @@ const (
 	Kensler = iota
 	Naive
 	Nil
+	Feistel
 )
 
 func max(a, b int64) int64 {
@@ -0,0 +1,250 @@
+package util
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+)
+
+var (
+	ErrBitMatrixDimensions = errors.New("invalid bit matrix dimensions")
+	ErrBitMatrixShape      = errors.New("bit matrices do not have the same shape")
+	ErrBitMatrixIndex      = errors.New("bit matrix index out of range")
+)
+
+// A BitMatrix is a matrix of bits of any dimensions. Each row is held in
+// (cols+7)/8 bytes of a contiguous slice, with column c at bit c%8 of byte
+// c/8, from the least significant bit as in IsBitSet. The bits of the last
+// byte of a row past the last column are ignored by Column and Transpose.
+type BitMatrix struct {
+	rows, cols int
+	// stride is the number of bytes of a row
+	stride int
+	data   []byte
+}
+
+// NewBitMatrix returns a BitMatrix of rows by cols bits set to 0
+func NewBitMatrix(rows, cols int) (*BitMatrix, error) {
+	if rows < 0 || cols < 0 {
+		return nil, fmt.Errorf("%w: %d by %d", ErrBitMatrixDimensions, rows, cols)
+	}
+
+	stride := (cols + 7) / 8
+	return &BitMatrix{rows: rows, cols: cols, stride: stride, data: make([]byte, rows*stride)}, nil
+}
+
+// NewBitMatrixFromRows returns a BitMatrix of len(rows) by cols bits holding
+// a copy of rows, which must each be (cols+7)/8 bytes long
+func NewBitMatrixFromRows(rows [][]byte, cols int) (*BitMatrix, error) {
+	m, err := NewBitMatrix(len(rows), cols)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, row := range rows {
+		if len(row) != m.stride {
+			return nil, fmt.Errorf("%w: row %d has %d bytes, expected %d", ErrBitMatrixDimensions, i, len(row), m.stride)
+		}
+		copy(m.data[i*m.stride:], row)
+	}
+
+	return m, nil
+}
+
+// Rows returns the number of rows of m
+func (m *BitMatrix) Rows() int {
+	return m.rows
+}
+
+// Cols returns the number of columns of m
+func (m *BitMatrix) Cols() int {
+	return m.cols
+}
+
+// Row returns row i of m, which shares the memory of m
+func (m *BitMatrix) Row(i int) ([]byte, error) {
+	if i < 0 || i >= m.rows {
+		return nil, fmt.Errorf("%w: row %d of %d", ErrBitMatrixIndex, i, m.rows)
+	}
+
+	return m.row(i), nil
+}
+
+func (m *BitMatrix) row(i int) []byte {
+	return m.data[i*m.stride : (i+1)*m.stride : (i+1)*m.stride]
+}
+
+// RowSlice returns the rows of m, which share the memory of m
+func (m *BitMatrix) RowSlice() [][]byte {
+	rows := make([][]byte, m.rows)
+	for i := range rows {
+		rows[i] = m.row(i)
+	}
+
+	return rows
+}
+
+// Column returns a copy of column j of m, packed into (rows+7)/8 bytes
+func (m *BitMatrix) Column(j int) ([]byte, error) {
+	if j < 0 || j >= m.cols {
+		return nil, fmt.Errorf("%w: column %d of %d", ErrBitMatrixIndex, j, m.cols)
+	}
+
+	col := make([]byte, (m.rows+7)/8)
+	for i := 0; i < m.rows; i++ {
+		col[i/8] |= BitExtract(m.row(i), j) << (i % 8)
+	}
+
+	return col, nil
+}
+
+// sameShape returns an error if the matrices do not have the shape of m
+func (m *BitMatrix) sameShape(others ...*BitMatrix) error {
+	for _, o := range others {
+		if o.rows != m.rows || o.cols != m.cols {
+			return fmt.Errorf("%w: %d by %d and %d by %d", ErrBitMatrixShape, m.rows, m.cols, o.rows, o.cols)
+		}
+	}
+
+	return nil
+}
+
+// Xor sets m to m ^ a
+func (m *BitMatrix) Xor(a *BitMatrix) error {
+	if err := m.sameShape(a); err != nil {
+		return err
+	}
+
+	ConcurrentBitOp(Xor, m.data, a.data)
+	return nil
+}
+
+// And sets m to m & a
+func (m *BitMatrix) And(a *BitMatrix) error {
+	if err := m.sameShape(a); err != nil {
+		return err
+	}
+
+	ConcurrentBitOp(And, m.data, a.data)
+	return nil
+}
+
+// DoubleXor sets m to m ^ a ^ b
+func (m *BitMatrix) DoubleXor(a, b *BitMatrix) error {
+	if err := m.sameShape(a, b); err != nil {
+		return err
+	}
+
+	ConcurrentDoubleBitOp(DoubleXor, m.data, a.data, b.data)
+	return nil
+}
+
+// AndXor sets m to (m & a) ^ b
+func (m *BitMatrix) AndXor(a, b *BitMatrix) error {
+	if err := m.sameShape(a, b); err != nil {
+		return err
+	}
+
+	ConcurrentDoubleBitOp(AndXor, m.data, a.data, b.data)
+	return nil
+}
+
+// Transpose returns the transpose of m, a new BitMatrix of Cols() by Rows()
+// bits. The matrix is cut into 512x512 bit blocks, padded with zeros at its
+// edges, which are divided among the workers. Each worker copies its blocks
+// into a BitVect, transposes it in place and copies it to the transpose.
+func (m *BitMatrix) Transpose() (*BitMatrix, error) {
+	trans, err := NewBitMatrix(m.cols, m.rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// number of blocks along the rows and the columns
+	blkRows := (m.rows + bitVectWidth - 1) / bitVectWidth
+	blkCols := (m.cols + bitVectWidth - 1) / bitVectWidth
+	nblks := blkRows * blkCols
+	if nblks == 0 {
+		return trans, nil
+	}
+
+	nworkers := runtime.GOMAXPROCS(0)
+	if nworkers > nblks {
+		nworkers = nblks
+	}
+
+	// how many blocks each worker is responsible for
+	workerResp := nblks / nworkers
+
+	// Run a worker pool
+	var wg sync.WaitGroup
+	wg.Add(nworkers)
+	for w := 0; w < nworkers; w++ {
+		w := w
+		go func() {
+			defer wg.Done()
+			end := workerResp * (w + 1)
+			if w == nworkers-1 { // last worker has extra work
+				end = nblks
+			}
+			var b BitVect
+			for i := workerResp * w; i < end; i++ {
+				b.unravelBlock(m, i/blkCols, i%blkCols)
+				b.transpose()
+				b.ravelBlock(trans, i%blkCols, i/blkCols)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	return trans, nil
+}
+
+// unravelBlock populates a BitVect from the 512x512 bit block of m at block
+// row bi and block column bj, padded with zeros past the edges of m.
+func (b *BitVect) unravelBlock(m *BitMatrix, bi, bj int) {
+	var buf [bitVectWidth / 8]byte
+	off := bj * len(buf)
+	for i := 0; i < bitVectWidth; i++ {
+		src := buf[:]
+		if r := bi*bitVectWidth + i; r < m.rows {
+			if row := m.row(r)[off:]; len(row) >= len(buf) {
+				src = row
+			} else {
+				copy(buf[:], row)
+				clear(buf[len(row):])
+			}
+		} else {
+			clear(buf[:])
+		}
+		for j := 0; j < 8; j++ {
+			b.set[(i*8)+j] = binary.LittleEndian.Uint64(src[j*8:])
+		}
+	}
+}
+
+// ravelBlock writes a BitVect into the 512x512 bit block of m at block row
+// bi and block column bj, dropping the bits past the edges of m.
+func (b *BitVect) ravelBlock(m *BitMatrix, bi, bj int) {
+	var buf [bitVectWidth / 8]byte
+	off := bj * len(buf)
+	for i := 0; i < bitVectWidth; i++ {
+		r := bi*bitVectWidth + i
+		if r >= m.rows {
+			return
+		}
+		row := m.row(r)[off:]
+		dst := buf[:]
+		if len(row) >= len(buf) {
+			dst = row
+		}
+		for j := 0; j < 8; j++ {
+			binary.LittleEndian.PutUint64(dst[j*8:], b.set[(i*8)+j])
+		}
+		if len(row) < len(buf) {
+			copy(row, buf[:])
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package util
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+)
+
+type anyMatrix struct {
+	m *BitMatrix
+}
+
+// Generate creates a struct containing a pseudorandom
+// BitMatrix of any dimensions, up to 3 blocks in each.
+func (anyMatrix) Generate(r *rand.Rand, sizeHint int) reflect.Value {
+	rows, cols := r.Intn(3*bitVectWidth), r.Intn(3*bitVectWidth)
+	m, _ := NewBitMatrix(rows, cols)
+	r.Read(m.data)
+	return reflect.ValueOf(anyMatrix{m})
+}
+
+func TestBitMatrixTranspose(t *testing.T) {
+	correct := func(a anyMatrix) bool {
+		m := a.m
+		tr, err := m.Transpose()
+		if err != nil || tr.Rows() != m.Cols() || tr.Cols() != m.Rows() {
+			return false
+		}
+		for r := 0; r < m.Rows(); r++ {
+			row, _ := m.Row(r)
+			for c := 0; c < m.Cols(); c++ {
+				trRow, _ := tr.Row(c)
+				if IsBitSet(row, c) != IsBitSet(trRow, r) {
+					return false
+				}
+			}
+		}
+		// the bits past the last column are not set
+		for c := 0; c < tr.Rows() && tr.Cols()%8 != 0; c++ {
+			trRow, _ := tr.Row(c)
+			if trRow[len(trRow)-1]>>(tr.Cols()%8) != 0 {
+				return false
+			}
+		}
+		return true
+	}
+
+	if err := quick.Check(correct, &quick.Config{MaxCount: 20}); err != nil {
+		t.Errorf("transpose of a bit matrix was incorrect: %v", err)
+	}
+
+	// the tall matrices of the OT extension are transposed
+	// block by block, as a BitVect
+	tall := sampleRandomTall(2*bitVectWidth, rand.New(rand.NewSource(1)))
+	m, err := NewBitMatrixFromRows(tall, bitVectWidth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, _ := m.Transpose()
+	want := make([][]byte, bitVectWidth)
+	for r := range want {
+		want[r] = make([]byte, len(tall)/8)
+	}
+	var b BitVect
+	for i := 0; i < len(tall)/bitVectWidth; i++ {
+		b.unravelTall(tall, i)
+		b.transpose()
+		b.ravelToWide(want, i)
+	}
+	if !reflect.DeepEqual(tr.RowSlice(), want) {
+		t.Error("transpose differs from the transpose of the blocks")
+	}
+}
+
+func TestBitMatrixColumn(t *testing.T) {
+	m, _ := NewBitMatrix(10, 13)
+	rand.Read(m.data)
+	tr, _ := m.Transpose()
+	for c := 0; c < m.Cols(); c++ {
+		col, err := m.Column(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, _ := tr.Row(c); !bytes.Equal(col, want) {
+			t.Errorf("column %d: expected %x, got %x", c, want, col)
+		}
+	}
+
+	if _, err := m.Column(13); !errors.Is(err, ErrBitMatrixIndex) {
+		t.Errorf("expected ErrBitMatrixIndex, got %v", err)
+	}
+	if _, err := m.Row(-1); !errors.Is(err, ErrBitMatrixIndex) {
+		t.Errorf("expected ErrBitMatrixIndex, got %v", err)
+	}
+	if _, err := NewBitMatrix(-1, 2); !errors.Is(err, ErrBitMatrixDimensions) {
+		t.Errorf("expected ErrBitMatrixDimensions, got %v", err)
+	}
+	if _, err := NewBitMatrixFromRows([][]byte{{1, 2}}, 17); !errors.Is(err, ErrBitMatrixDimensions) {
+		t.Errorf("expected ErrBitMatrixDimensions, got %v", err)
+	}
+}
+
+func TestBitMatrixOps(t *testing.T) {
+	a, _ := NewBitMatrixFromRows([][]byte{{0b1100}, {0b1010}}, 4)
+	b, _ := NewBitMatrixFromRows([][]byte{{0b1010}, {0b0110}}, 4)
+	c, _ := NewBitMatrixFromRows([][]byte{{0b0001}, {0b1000}}, 4)
+
+	for _, test := range []struct {
+		name string
+		op   func(m *BitMatrix) error
+		want [][]byte
+	}{
+		{"xor", func(m *BitMatrix) error { return m.Xor(b) }, [][]byte{{0b0110}, {0b1100}}},
+		{"and", func(m *BitMatrix) error { return m.And(b) }, [][]byte{{0b1000}, {0b0010}}},
+		{"doublexor", func(m *BitMatrix) error { return m.DoubleXor(b, c) }, [][]byte{{0b0111}, {0b0100}}},
+		{"andxor", func(m *BitMatrix) error { return m.AndXor(b, c) }, [][]byte{{0b1001}, {0b1010}}},
+	} {
+		m, _ := NewBitMatrixFromRows(a.RowSlice(), 4)
+		if err := test.op(m); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if !reflect.DeepEqual(m.RowSlice(), test.want) {
+			t.Errorf("%s: expected %b, got %b", test.name, test.want, m.RowSlice())
+		}
+	}
+
+	other, _ := NewBitMatrix(2, 9)
+	if err := a.Xor(other); !errors.Is(err, ErrBitMatrixShape) {
+		t.Errorf("expected ErrBitMatrixShape, got %v", err)
+	}
+	if err := a.AndXor(b, other); !errors.Is(err, ErrBitMatrixShape) {
+		t.Errorf("expected ErrBitMatrixShape, got %v", err)
+	}
+}
+
+func BenchmarkBitMatrixTranspose(b *testing.B) {
+	m, _ := NewBitMatrix(benchmarkMatrixLength, bitVectWidth)
+	rand.Read(m.data)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Transpose()
+	}
+}
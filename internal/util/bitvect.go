@@ -1,9 +1,6 @@
 package util
 
-import (
-	"runtime"
-	"sync"
-)
+import "fmt"
 
 const bitVectWidth = 512
 
@@ -13,130 +10,34 @@ type BitVect struct {
 	set [bitVectWidth * 8]uint64
 }
 
-// ConcurrentTransposeTall tranposes a tall (64 column) matrix. If the input
-// matrix does not have a multiple of 512 rows (tall), panic. First it
-// determines how many 512x512 bit blocks are necessary to contain the matrix.
-// The blocks are divided among the number of workers. If there are fewer blocks
-// than workers, this function operates as though it were single-threaded. For
-// those small sets, performance could be improved by limiting the number of
-// workers to the number of blocks but this incurs a performance penalty and it
-// is much more likely that there will be more blocks than workers/cpu cores.
-// Each goroutine, iterates over the blocks for which it is responsible. For
-// each block it generates a BitVect from the matrix at the appropriate index,
-// performs a cache-oblivious, in-place, contiguous transpose on the BitVect,
-// and finally writes the result to a shared final output matrix. The last
-// worker is responsible for any excess blocks which were not evenly divisible
-// into the number of workers.
-func ConcurrentTransposeTall(matrix [][]byte) [][]byte {
-	if len(matrix)%bitVectWidth != 0 {
-		panic("rows of input matrix not a multiple of 512")
-	}
-
-	nworkers := runtime.GOMAXPROCS(0)
-
-	// number of blocks to split original matrix
-	nblks := len(matrix) / bitVectWidth
-
-	// how many blocks each worker is responsible for
-	workerResp := nblks / nworkers
-
-	// build output matrix
-	trans := make([][]byte, bitVectWidth)
-	for r := range trans {
-		trans[r] = make([]byte, len(matrix)/8)
-	}
-
-	// Run a worker pool
-	var wg sync.WaitGroup
-	wg.Add(nworkers)
-	for w := 0; w < nworkers; w++ {
-		w := w
-		go func() {
-			defer wg.Done()
-			step := workerResp * w
-			var b BitVect
-			if w == nworkers-1 { // last worker has extra work
-				for i := step; i < nblks; i++ {
-					b.unravelTall(matrix, i)
-					b.transpose()
-					b.ravelToWide(trans, i)
-				}
-			} else {
-				for i := step; i < step+workerResp; i++ {
-					b.unravelTall(matrix, i)
-					b.transpose()
-					b.ravelToWide(trans, i)
-				}
-			}
-		}()
-	}
-
-	wg.Wait()
-
-	return trans
+// ConcurrentTransposeTall transposes a tall matrix of 512 columns, whose
+// rows are 64 bytes long, into a wide matrix of 512 rows. It returns
+// ErrBitMatrixDimensions for a row of another length. See BitMatrix.Transpose.
+func ConcurrentTransposeTall(matrix [][]byte) ([][]byte, error) {
+	return transposeRows(matrix, bitVectWidth)
 }
 
-// ConcurrentTransposeWide tranposes a wide (512 row) matrix. If the input
-// matrix does not have a multiple of 64 columns (wide), panic. First it
-// determines how many 512x512 bit blocks are necessary to contain the matrix.
-// The blocks are divided among the number of workers. If there are fewer blocks
-// than workers, this function operates as though it were single-threaded. For
-// those small sets, performance could be improved by limiting the number of
-// workers to the number of blocks but this incurs a performance penalty and it
-// is much more likely that there will be more blocks than workers/cpu cores.
-// Each goroutine iterates over the blocks for which it is responsible. For
-// each block it generates a BitVect from the matrix at the appropriate index,
-// performs a cache-oblivious, in-place, contiguous transpose on the BitVect,
-// and finally writes the result to a shared final output matrix. The last
-// worker is responsible for any excess blocks which were not evenly divisible
-// into the number of workers.
-func ConcurrentTransposeWide(matrix [][]byte) [][]byte {
-	if len(matrix[0])%64 != 0 {
-		panic("columns of input matrix not a multiple of 64")
+// ConcurrentTransposeWide transposes a wide matrix of 512 rows into a tall
+// matrix of 512 columns. It returns ErrBitMatrixDimensions if the matrix does
+// not have 512 rows of the same length. See BitMatrix.Transpose.
+func ConcurrentTransposeWide(matrix [][]byte) ([][]byte, error) {
+	if len(matrix) != bitVectWidth {
+		return nil, fmt.Errorf("%w: %d rows, expected %d", ErrBitMatrixDimensions, len(matrix), bitVectWidth)
 	}
+	return transposeRows(matrix, len(matrix[0])*8)
+}
 
-	nworkers := runtime.GOMAXPROCS(0)
-
-	// determine number of blocks to split original matrix
-	nblks := len(matrix[0]) / 64
-
-	// how many blocks each worker is responsible for
-	workerResp := nblks / nworkers
-
-	// build output matrix
-	trans := make([][]byte, len(matrix[0])*8)
-	for r := range trans {
-		trans[r] = make([]byte, 64)
+// transposeRows transposes the matrix of cols columns held in rows
+func transposeRows(rows [][]byte, cols int) ([][]byte, error) {
+	m, err := NewBitMatrixFromRows(rows, cols)
+	if err != nil {
+		return nil, err
 	}
-
-	// Run a worker pool
-	var wg sync.WaitGroup
-	wg.Add(nworkers)
-	for w := 0; w < nworkers; w++ {
-		w := w
-		go func() {
-			defer wg.Done()
-			step := workerResp * w
-			var b BitVect
-			if w == nworkers-1 { // last worker has extra work
-				for i := step; i < nblks; i++ {
-					b.unravelWide(matrix, i)
-					b.transpose()
-					b.ravelToTall(trans, i)
-				}
-			} else {
-				for i := step; i < step+workerResp; i++ {
-					b.unravelWide(matrix, i)
-					b.transpose()
-					b.ravelToTall(trans, i)
-				}
-			}
-		}()
+	tr, err := m.Transpose()
+	if err != nil {
+		return nil, err
 	}
-
-	wg.Wait()
-
-	return trans
+	return tr.RowSlice(), nil
 }
 
 // transpose performs a cache-oblivious, in-place, contiguous transpose.
@@ -247,6 +148,12 @@ func (b *BitVect) transpose() {
 	}
 
 	// Bitwise transposition
+	b.transposeBits()
+}
+
+// transposeBitsGeneric performs the bitwise transpose of
+// each of the 64x64 bit matrices of a BitVect in pure Go.
+func (b *BitVect) transposeBitsGeneric() {
 	for blk := 0; blk < 8; blk++ {
 		for col := 0; col < 8; col++ {
 			transpose64(b, blk, col)
@@ -4,8 +4,32 @@ package util
 
 import (
 	"github.com/alecthomas/unsafeslice"
+	"golang.org/x/sys/cpu"
 )
 
+// hasAVX2 selects the AVX2 kernel of transposeBits,
+// it is detected at runtime
+var hasAVX2 = cpu.X86.HasAVX2
+
+// transposeBandAVX2 performs the bitwise transpose of the 8 64x64 bit
+// matrices of a band of 64 rows of a BitVect, implemented in assembly.
+//
+//go:noescape
+func transposeBandAVX2(band *[bitVectWidth]uint64)
+
+// transposeBits performs the bitwise transpose of each of the 64x64 bit
+// matrices of a BitVect, with the AVX2 kernel if the CPU supports it.
+func (b *BitVect) transposeBits() {
+	if !hasAVX2 {
+		b.transposeBitsGeneric()
+		return
+	}
+
+	for blk := 0; blk < 8; blk++ {
+		transposeBandAVX2((*[bitVectWidth]uint64)(b.set[blk*bitVectWidth:]))
+	}
+}
+
 // unravelTall populates a BitVect from a 2D matrix of bytes. The matrix
 // must have 64 columns and a multiple of 512 rows. idx is the block target.
 // Only tested on x86-64.
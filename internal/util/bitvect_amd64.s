@@ -0,0 +1,114 @@
+//go:build amd64 && !generic
+// +build amd64,!generic
+
+#include "textflag.h"
+
+// masks of the bits swapped at each step of the transpose,
+// for the widths 32, 16, 8, 4, 2 and 1
+DATA masks<>+0x00(SB)/8, $0xFFFFFFFF00000000
+DATA masks<>+0x08(SB)/8, $0xFFFF0000FFFF0000
+DATA masks<>+0x10(SB)/8, $0xFF00FF00FF00FF00
+DATA masks<>+0x18(SB)/8, $0xF0F0F0F0F0F0F0F0
+DATA masks<>+0x20(SB)/8, $0xCCCCCCCCCCCCCCCC
+DATA masks<>+0x28(SB)/8, $0xAAAAAAAAAAAAAAAA
+GLOBL masks<>(SB), RODATA|NOPTR, $48
+
+// SWAP swaps the masked bits of rows a and b, as swap does:
+// t = (a ^ (b << w)) & mask, a ^= t, b ^= t >> w.
+#define SWAP(a, b, w, mask) \
+	VPSLLQ $w, b, Y12   \
+	VPXOR  a, Y12, Y12  \
+	VPAND  mask, Y12, Y12 \
+	VPXOR  Y12, a, a    \
+	VPSRLQ $w, Y12, Y12 \
+	VPXOR  Y12, b, b
+
+// LOAD loads 8 rows, stride bytes apart from SI, into Y0 to Y7
+#define LOAD(stride) \
+	VMOVDQU 0(SI), Y0        \
+	VMOVDQU stride*1(SI), Y1 \
+	VMOVDQU stride*2(SI), Y2 \
+	VMOVDQU stride*3(SI), Y3 \
+	VMOVDQU stride*4(SI), Y4 \
+	VMOVDQU stride*5(SI), Y5 \
+	VMOVDQU stride*6(SI), Y6 \
+	VMOVDQU stride*7(SI), Y7
+
+// STORE stores Y0 to Y7 back into the rows loaded by LOAD
+#define STORE(stride) \
+	VMOVDQU Y0, 0(SI)        \
+	VMOVDQU Y1, stride*1(SI) \
+	VMOVDQU Y2, stride*2(SI) \
+	VMOVDQU Y3, stride*3(SI) \
+	VMOVDQU Y4, stride*4(SI) \
+	VMOVDQU Y5, stride*5(SI) \
+	VMOVDQU Y6, stride*6(SI) \
+	VMOVDQU Y7, stride*7(SI)
+
+// STEPS performs three steps of the transpose on the rows in
+// Y0 to Y7, with the widths w, w/2 and w/4 and the masks
+// in Y13, Y14 and Y15.
+#define STEPS(w1, w2, w3) \
+	SWAP(Y0, Y4, w1, Y13) \
+	SWAP(Y1, Y5, w1, Y13) \
+	SWAP(Y2, Y6, w1, Y13) \
+	SWAP(Y3, Y7, w1, Y13) \
+	SWAP(Y0, Y2, w2, Y14) \
+	SWAP(Y1, Y3, w2, Y14) \
+	SWAP(Y4, Y6, w2, Y14) \
+	SWAP(Y5, Y7, w2, Y14) \
+	SWAP(Y0, Y1, w3, Y15) \
+	SWAP(Y2, Y3, w3, Y15) \
+	SWAP(Y4, Y5, w3, Y15) \
+	SWAP(Y6, Y7, w3, Y15)
+
+// func transposeBandAVX2(band *[bitVectWidth]uint64)
+// transposeBandAVX2 performs the bitwise transpose of the 8 64x64 bit
+// matrices of a band of 64 rows of a BitVect at once. Row r of the
+// matrix of column c is the uint64 at 8*r+c, so the rows r of the 8
+// matrices are contiguous and are held in two 256 bits registers.
+// The steps of widths 32, 16 and 8 swap rows 8 apart and are applied
+// to the rows congruent modulo 8 in registers, then the steps of
+// widths 4, 2 and 1 to each group of 8 consecutive rows.
+TEXT ·transposeBandAVX2(SB), NOSPLIT, $0-8
+	MOVQ band+0(FP), R8
+	LEAQ masks<>(SB), R9
+
+	VPBROADCASTQ 0x00(R9), Y13
+	VPBROADCASTQ 0x08(R9), Y14
+	VPBROADCASTQ 0x10(R9), Y15
+
+	// rows r, r+8, ..., r+56 for r from 0 to 7, in two halves
+	MOVQ R8, SI
+	MOVQ $16, CX
+
+wide:
+	LOAD(512)
+	STEPS(32, 16, 8)
+	STORE(512)
+	ADDQ $32, SI
+	DECQ CX
+	JNZ  wide
+
+	VPBROADCASTQ 0x18(R9), Y13
+	VPBROADCASTQ 0x20(R9), Y14
+	VPBROADCASTQ 0x28(R9), Y15
+
+	// rows 8g to 8g+7 for g from 0 to 7, in two halves
+	MOVQ R8, SI
+	MOVQ $8, CX
+
+narrow:
+	LOAD(64)
+	STEPS(4, 2, 1)
+	STORE(64)
+	ADDQ $32, SI
+	LOAD(64)
+	STEPS(4, 2, 1)
+	STORE(64)
+	ADDQ $480, SI
+	DECQ CX
+	JNZ  narrow
+
+	VZEROUPPER
+	RET
@@ -0,0 +1,61 @@
+//go:build amd64 && !generic
+// +build amd64,!generic
+
+package util
+
+import (
+	"testing"
+	"testing/quick"
+)
+
+// TestTransposeAVX2 checks that the AVX2 kernel transposes the blocks
+// as the generic one, then runs the quickcheck tests of the transpose
+// with the generic kernel.
+func TestTransposeAVX2(t *testing.T) {
+	if !hasAVX2 {
+		t.Skip("AVX2 is not supported")
+	}
+
+	same := func(m tallMatrix) bool {
+		var b, g BitVect
+		for i := 0; i < len(m.matrix)/bitVectWidth; i++ {
+			b.unravelTall(m.matrix, i)
+			g = b
+			b.transposeBits()
+			g.transposeBitsGeneric()
+			if b != g {
+				return false
+			}
+		}
+		return true
+	}
+
+	if err := quick.Check(same, nil); err != nil {
+		t.Errorf("AVX2 transpose differs from the generic one: %v", err)
+	}
+
+	hasAVX2 = false
+	defer func() { hasAVX2 = true }()
+	t.Run("generic", func(t *testing.T) {
+		TestTransposeTall(t)
+		TestTransposeWide(t)
+		TestIfLittleEndianTranspose(t)
+	})
+}
+
+func BenchmarkTransposeBits(b *testing.B) {
+	var v BitVect
+	b.Run("avx2", func(b *testing.B) {
+		if !hasAVX2 {
+			b.Skip("AVX2 is not supported")
+		}
+		for i := 0; i < b.N; i++ {
+			v.transposeBits()
+		}
+	})
+	b.Run("generic", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			v.transposeBitsGeneric()
+		}
+	})
+}
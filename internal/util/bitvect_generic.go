@@ -41,3 +41,9 @@ func (b *BitVect) ravelToWide(matrix [][]byte, idx int) {
 		}
 	}
 }
+
+// transposeBits performs the bitwise transpose of
+// each of the 64x64 bit matrices of a BitVect.
+func (b *BitVect) transposeBits() {
+	b.transposeBitsGeneric()
+}
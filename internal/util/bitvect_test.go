@@ -1,6 +1,7 @@
 package util
 
 import (
+	"errors"
 	"math/rand"
 	"reflect"
 	"testing"
@@ -132,7 +133,10 @@ func TestUnReRavelTall(t *testing.T) {
 func TestTransposeTall(t *testing.T) {
 
 	correct := func(m tallMatrix) bool {
-		tr := ConcurrentTransposeTall(m.matrix)
+		tr, err := ConcurrentTransposeTall(m.matrix)
+		if err != nil {
+			return false
+		}
 		for r := range m.matrix {
 			for i := 0; i < bitVectWidth; i++ {
 				if IsBitSet(m.matrix[r], i) != IsBitSet(tr[i], r) {
@@ -148,8 +152,14 @@ func TestTransposeTall(t *testing.T) {
 	}
 
 	involutory := func(m tallMatrix) bool {
-		tr := ConcurrentTransposeTall(m.matrix)
-		dtr := ConcurrentTransposeWide(tr)
+		tr, err := ConcurrentTransposeTall(m.matrix)
+		if err != nil {
+			return false
+		}
+		dtr, err := ConcurrentTransposeWide(tr)
+		if err != nil {
+			return false
+		}
 		for r := range m.matrix {
 			for i := 0; i < bitVectWidth; i++ {
 				if IsBitSet(m.matrix[r], i) != IsBitSet(dtr[r], i) {
@@ -236,7 +246,10 @@ func TestUnReRavelWide(t *testing.T) {
 
 func TestTransposeWide(t *testing.T) {
 	correct := func(m wideMatrix) bool {
-		tr := ConcurrentTransposeWide(m.matrix)
+		tr, err := ConcurrentTransposeWide(m.matrix)
+		if err != nil {
+			return false
+		}
 		for r, row := range m.matrix {
 			for i := 0; i < len(row); i++ {
 				if IsBitSet(row, i) != IsBitSet(tr[i], r) {
@@ -252,8 +265,14 @@ func TestTransposeWide(t *testing.T) {
 	}
 
 	involutory := func(m wideMatrix) bool {
-		tr := ConcurrentTransposeWide(m.matrix)
-		dtr := ConcurrentTransposeTall(tr)
+		tr, err := ConcurrentTransposeWide(m.matrix)
+		if err != nil {
+			return false
+		}
+		dtr, err := ConcurrentTransposeTall(tr)
+		if err != nil {
+			return false
+		}
 		for r := 0; r < bitVectWidth; r++ {
 			for i := range m.matrix[r] {
 				if IsBitSet(m.matrix[r], i) != IsBitSet(dtr[r], i) {
@@ -269,6 +288,23 @@ func TestTransposeWide(t *testing.T) {
 	}
 }
 
+func TestTransposeShape(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	tall := sampleRandomTall(bitVectWidth, r)
+	tall[1] = tall[1][1:]
+	if _, err := ConcurrentTransposeTall(tall); !errors.Is(err, ErrBitMatrixDimensions) {
+		t.Errorf("expected ErrBitMatrixDimensions for a ragged tall matrix, got %v", err)
+	}
+	wide := sampleRandomWide(bitVectWidth, r)
+	if _, err := ConcurrentTransposeWide(wide[1:]); !errors.Is(err, ErrBitMatrixDimensions) {
+		t.Errorf("expected ErrBitMatrixDimensions for a wide matrix of %d rows, got %v", len(wide)-1, err)
+	}
+	wide[1] = wide[1][1:]
+	if _, err := ConcurrentTransposeWide(wide); !errors.Is(err, ErrBitMatrixDimensions) {
+		t.Errorf("expected ErrBitMatrixDimensions for a ragged wide matrix, got %v", err)
+	}
+}
+
 func TestIfLittleEndianTranspose(t *testing.T) {
 	tr := sampleZebraBlock()
 	// 0101....
@@ -299,7 +335,9 @@ func BenchmarkConcurrentTransposeTall(b *testing.B) {
 	matrix := sampleRandomTall(benchmarkMatrixLength, r)
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		ConcurrentTransposeTall(matrix)
+		if _, err := ConcurrentTransposeTall(matrix); err != nil {
+			b.Fatal(err)
+		}
 	}
 }
 
@@ -308,6 +346,8 @@ func BenchmarkConcurrentTransposeWide(b *testing.B) {
 	matrix := sampleRandomWide(benchmarkMatrixLength, r)
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		ConcurrentTransposeWide(matrix)
+		if _, err := ConcurrentTransposeWide(matrix); err != nil {
+			b.Fatal(err)
+		}
 	}
 }
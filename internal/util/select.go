@@ -2,18 +2,31 @@ package util
 
 import (
 	"context"
+	"errors"
+	"time"
 )
 
-// Sel runs a single stage for protocol
-func Sel(ctx context.Context, f func() error) error {
-	var d = make(chan error)
+// ErrStageTimeout is returned when a protocol stage runs longer than its timeout
+var ErrStageTimeout = errors.New("protocol stage timed out")
+
+// Sel runs a single stage for protocol. The stage is
+// bounded by timeout, unless it is 0 or less.
+func Sel(ctx context.Context, timeout time.Duration, f func() error) error {
+	// buffered so that f does not leak
+	// if we return before it does
+	var d = make(chan error, 1)
 	go func() {
 		d <- f()
 	}()
 
+	expired, stop := StageTimer(timeout)
+	defer stop()
+
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
+	case <-expired:
+		return ErrStageTimeout
 	case err := <-d:
 		return err
 	}
@@ -30,3 +43,14 @@ func Sels(fs ...func() error) chan error {
 	}
 	return d
 }
+
+// StageTimer returns a channel that fires once timeout has elapsed,
+// and a function to release the underlying timer. The channel
+// never fires if timeout is 0 or less.
+func StageTimer(timeout time.Duration) (<-chan time.Time, func()) {
+	if timeout <= 0 {
+		return nil, func() {}
+	}
+	t := time.NewTimer(timeout)
+	return t.C, func() { t.Stop() }
+}
@@ -0,0 +1,485 @@
+// Package vole implements a vector oblivious linear evaluation (VOLE) over
+// GF(2^128): the sender learns a random delta and a vector b, the receiver
+// learns random vectors a and c such that b[i] = c[i] + a[i]*delta.
+//
+// It is a silent VOLE from the dual learning parity with noise (LPN)
+// assumption, as in the paper "Efficient Two-Round OT Extension and Silent
+// Non-Interactive Secure Computation" by Elette Boyle, Geoffroy Couteau,
+// Niv Gilboa, Yuval Ishai, Lisa Kohl, Peter Rindal, and Peter Scholl in 2019
+// (https://eprint.iacr.org/2019/1159.pdf), with the expand-accumulate code
+// from the paper "Correlated Pseudorandomness from Expand-Accumulate Codes"
+// by Elette Boyle, Geoffroy Couteau, Niv Gilboa, Yuval Ishai, Lisa Kohl,
+// Nicolas Resch, and Peter Scholl in 2022 (https://eprint.iacr.org/2022/1014.pdf).
+//
+// The receiver samples a sparse noise vector e of scaler*m elements, with one
+// random non zero element in each of t blocks. The parties first run t VOLEs
+// of the noise values, from the subfield VOLE of the correlated OTs of the
+// ot package: the correlated OT rows whose choice rows repeat the bits of a
+// value are a VOLE of each bit with the sender secret. They then expand them
+// into a VOLE of the whole noise vector with one GGM puncturable PRF tree per
+// block, the receiver learning every leaf but the one of its noise with
+// OTs. Both compress the result into m elements with the expand-accumulate
+// code, and a is pseudorandom under dual LPN. The communication is
+// logarithmic in m.
+package vole
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	crand "crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"math/rand/v2"
+	"runtime"
+	"sync"
+
+	"github.com/optable/match/internal/gf128"
+	"github.com/optable/match/internal/ot"
+	"github.com/zeebo/blake3"
+)
+
+const (
+	// scaler is the length of the noise vector relative to the output
+	scaler = 2
+	// expanderWeight is the number of elements of the accumulated
+	// noise vector summed into each element of the output
+	expanderWeight = 11
+	// minDistance is the relative minimum distance of the
+	// expand-accumulate code with expanderWeight
+	minDistance = 0.1
+	// secParam is the computational security parameter
+	secParam = 128
+	// seedLen is the length of the seed of the expander
+	seedLen = 32
+	// chunkLen is the number of elements of the output
+	// whose expander indices derive from the same PRG
+	chunkLen = 1 << 12
+	// minSize is the smallest VOLE generated, shorter
+	// vectors being truncated from it, so that the
+	// noise is long enough for LPN to be hard
+	minSize = 1 << 14
+)
+
+// ggmKeys are the fixed public AES keys of
+// the left and right children of a GGM tree
+var ggmKeys = [2][]byte{[]byte("vole ggm left  0"), []byte("vole ggm right 1")}
+
+// Sender is the side of the VOLE that learns delta
+type Sender struct {
+	baseOT ot.OT
+}
+
+// Receiver is the side of the VOLE that learns a
+type Receiver struct {
+	baseOT ot.OT
+}
+
+// NewSender returns a VOLE sender running the base OTs of its OT extension
+// with baseOT, which must be created with ot.ExtensionBaseMsgLens.
+func NewSender(baseOT ot.OT) *Sender {
+	return &Sender{baseOT: baseOT}
+}
+
+// NewReceiver returns a VOLE receiver running the base OTs of its OT extension
+// with baseOT, which must be created with ot.ExtensionBaseMsgLens.
+func NewReceiver(baseOT ot.OT) *Receiver {
+	return &Receiver{baseOT: baseOT}
+}
+
+// params are the parameters of the noise
+// of a VOLE of m elements
+type params struct {
+	// number of elements generated
+	m int
+	// number of noisy blocks
+	t int
+	// length of a block and depth of its GGM tree
+	blockLen, depth int
+}
+
+// newParams returns the parameters of a VOLE of m elements, with a regular
+// noise weight t high enough for the minimum distance of the code
+func newParams(m int) params {
+	m = max(m, minSize)
+	n := scaler * m
+	t := int(math.Ceil(-secParam / math.Log2(1-2*minDistance)))
+	t = (max(t, 128) + 7) / 8 * 8
+	blockLen := (n + t - 1) / t
+	return params{m: m, t: t, blockLen: blockLen, depth: bits.Len(uint(blockLen - 1))}
+}
+
+// noiseLen returns the length of the noise vector
+func (p params) noiseLen() int {
+	return p.t * p.blockLen
+}
+
+// Send runs a VOLE of m elements and returns delta and b
+func (s *Sender) Send(m int, rw io.ReadWriter) (delta gf128.Element, b []gf128.Element, err error) {
+	if m == 0 {
+		return
+	}
+	p := newParams(m)
+
+	ext := ot.NewExtensionSender(s.baseOT)
+	if err = ext.Setup(rw); err != nil {
+		return
+	}
+
+	// sample the seed of the expander
+	seed := make([]byte, seedLen)
+	if _, err = crand.Read(seed); err != nil {
+		return
+	}
+	if _, err = rw.Write(seed); err != nil {
+		return
+	}
+
+	// VOLEs of the noise values, delta is
+	// the first 128 bits of the extension secret
+	q, err := ext.ExtendCorrelated(p.t*128, rw)
+	if err != nil {
+		return
+	}
+	delta = gf128.FromBytes(ext.Secret())
+	baseB := make([]gf128.Element, p.t)
+	for i := range baseB {
+		baseB[i] = compose(q[i*128 : (i+1)*128])
+	}
+
+	// expand one GGM tree per block
+	trees := make([]*tree, p.t)
+	err = parallel(p.t, func(i int) error {
+		var err error
+		trees[i], err = newTree(p.depth)
+		return err
+	})
+	if err != nil {
+		return
+	}
+	messages := make([]ot.OTMessage, 0, p.t*p.depth)
+	for _, tr := range trees {
+		for l := 1; l <= p.depth; l++ {
+			var msg ot.OTMessage
+			for side := range msg {
+				msg[side] = make([]byte, gf128.Size)
+				tr.sums[l][side].PutBytes(msg[side])
+			}
+			messages = append(messages, msg)
+		}
+	}
+	if err = ext.ExtendChosen(messages, rw); err != nil {
+		return
+	}
+
+	// the noise vector of the sender is the leaves,
+	// send gamma = sum(leaves) + b so that the receiver
+	// can recover its noise at the punctured leaf
+	w := make([]gf128.Element, 0, p.noiseLen())
+	gamma := make([]byte, p.t*gf128.Size)
+	for i, tr := range trees {
+		leaves := tr.leaves()[:p.blockLen]
+		sum := baseB[i]
+		for _, leaf := range leaves {
+			sum = sum.Add(leaf)
+		}
+		sum.PutBytes(gamma[i*gf128.Size:])
+		w = append(w, leaves...)
+	}
+	if _, err = rw.Write(gamma); err != nil {
+		return
+	}
+
+	out, err := compress(seed, p.m, w)
+	if err != nil {
+		return
+	}
+	return delta, out[0][:m], nil
+}
+
+// Receive runs a VOLE of m elements and returns a and c
+func (r *Receiver) Receive(m int, rw io.ReadWriter) (a, c []gf128.Element, err error) {
+	if m == 0 {
+		return
+	}
+	p := newParams(m)
+
+	ext := ot.NewExtensionReceiver(r.baseOT)
+	if err = ext.Setup(rw); err != nil {
+		return
+	}
+
+	seed := make([]byte, seedLen)
+	if _, err = io.ReadFull(rw, seed); err != nil {
+		return nil, nil, fmt.Errorf("error reading expander seed: %w", err)
+	}
+
+	// sample the regular noise: a non zero
+	// value beta at position alpha of each block
+	var rngSeed [32]byte
+	if _, err = crand.Read(rngSeed[:]); err != nil {
+		return
+	}
+	rng := rand.New(rand.NewChaCha8(rngSeed))
+	alpha := make([]int, p.t)
+	beta := make([]gf128.Element, p.t)
+	for i := range beta {
+		alpha[i] = rng.IntN(p.blockLen)
+		for beta[i].IsZero() {
+			beta[i] = gf128.Element{rng.Uint64(), rng.Uint64()}
+		}
+	}
+
+	// VOLEs of the noise values, with the choice
+	// rows repeating each bit of the values
+	zeros, ones := make([]byte, ot.ExtensionRowLen), make([]byte, ot.ExtensionRowLen)
+	for i := range ones {
+		ones[i] = 0xff
+	}
+	rows := make([][]byte, p.t*128)
+	for i := range beta {
+		for k := 0; k < 128; k++ {
+			rows[i*128+k] = zeros
+			if beta[i][k/64]>>(k%64)&1 == 1 {
+				rows[i*128+k] = ones
+			}
+		}
+	}
+	t, err := ext.ExtendCorrelated(rows, rw)
+	if err != nil {
+		return
+	}
+	baseC := make([]gf128.Element, p.t)
+	for i := range baseC {
+		baseC[i] = compose(t[i*128 : (i+1)*128])
+	}
+
+	// learn the sums of the siblings of the path
+	// to alpha at every level of every tree
+	choices := make([]uint8, (p.t*p.depth+7)/8)
+	msgLens := make([]int, p.t*p.depth)
+	for i := range alpha {
+		for l := 1; l <= p.depth; l++ {
+			j := i*p.depth + l - 1
+			msgLens[j] = gf128.Size
+			if pathBit(alpha[i], p.depth, l) == 0 {
+				choices[j/8] |= 1 << (j % 8)
+			}
+		}
+	}
+	siblings, err := ext.ExtendChosen(choices, msgLens, rw)
+	if err != nil {
+		return
+	}
+
+	gamma := make([]byte, p.t*gf128.Size)
+	if _, err = io.ReadFull(rw, gamma); err != nil {
+		return nil, nil, fmt.Errorf("error reading noise corrections: %w", err)
+	}
+
+	// the receiver noise vectors are the punctured leaves,
+	// with beta*delta + leaf at the punctured leaf
+	e := make([]gf128.Element, p.noiseLen())
+	v := make([]gf128.Element, p.noiseLen())
+	err = parallel(p.t, func(i int) error {
+		sums := make([]gf128.Element, p.depth+1)
+		for l := 1; l <= p.depth; l++ {
+			sums[l] = gf128.FromBytes(siblings[i*p.depth+l-1])
+		}
+		tr, err := puncturedTree(p.depth, alpha[i], sums)
+		if err != nil {
+			return err
+		}
+		block := v[i*p.blockLen : (i+1)*p.blockLen]
+		copy(block, tr.leaves())
+		sum := gf128.FromBytes(gamma[i*gf128.Size:]).Add(baseC[i])
+		for j := range block {
+			sum = sum.Add(block[j])
+		}
+		block[alpha[i]] = sum
+		e[i*p.blockLen+alpha[i]] = beta[i]
+		return nil
+	})
+	if err != nil {
+		return
+	}
+
+	out, err := compress(seed, p.m, e, v)
+	if err != nil {
+		return
+	}
+	return out[0][:m], out[1][:m], nil
+}
+
+// compose returns the sum of x^k times the first
+// 128 bits of rows[k], with the Horner method
+func compose(rows [][]byte) gf128.Element {
+	var e gf128.Element
+	for k := len(rows) - 1; k >= 0; k-- {
+		e = e.MulX().Add(gf128.FromBytes(rows[k]))
+	}
+	return e
+}
+
+// compress accumulates the noise vectors vs in place and
+// expands them into vectors of m elements with the expander
+// indices derived from seed
+func compress(seed []byte, m int, vs ...[]gf128.Element) ([][]gf128.Element, error) {
+	n := len(vs[0])
+	out := make([][]gf128.Element, len(vs))
+	for i, v := range vs {
+		for j := 1; j < n; j++ {
+			v[j] = v[j].Add(v[j-1])
+		}
+		out[i] = make([]gf128.Element, m)
+	}
+
+	chunks := (m + chunkLen - 1) / chunkLen
+	err := parallel(chunks, func(chunk int) error {
+		h, err := blake3.NewKeyed(seed)
+		if err != nil {
+			return err
+		}
+		var idx [8]byte
+		binary.BigEndian.PutUint64(idx[:], uint64(chunk))
+		h.Write(idx[:])
+		var chunkSeed [32]byte
+		h.Digest().Read(chunkSeed[:])
+		prg := rand.NewChaCha8(chunkSeed)
+
+		var indices [expanderWeight]int
+		for j := chunk * chunkLen; j < min(m, (chunk+1)*chunkLen); j++ {
+			for k := range indices {
+				hi, _ := bits.Mul64(prg.Uint64(), uint64(n))
+				indices[k] = int(hi)
+			}
+			for i, v := range vs {
+				var sum gf128.Element
+				for _, k := range indices {
+					sum = sum.Add(v[k])
+				}
+				out[i][j] = sum
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// pathBit returns the bit of the path to leaf at level l of a tree of depth
+func pathBit(leaf, depth, l int) int {
+	return leaf >> (depth - l) & 1
+}
+
+// tree is a GGM tree of the given depth, whose nodes are
+// the left and right children of their parent by a PRG
+type tree struct {
+	depth int
+	nodes []gf128.Element
+	// sums[l] are the sums of the left and right nodes at level l
+	sums [][2]gf128.Element
+}
+
+// newTree expands a GGM tree from a random root
+func newTree(depth int) (*tree, error) {
+	var root [gf128.Size]byte
+	if _, err := crand.Read(root[:]); err != nil {
+		return nil, err
+	}
+	tr := &tree{depth: depth, nodes: make([]gf128.Element, 1<<depth), sums: make([][2]gf128.Element, depth+1)}
+	tr.nodes[0] = gf128.FromBytes(root[:])
+	return tr, tr.expand(-1)
+}
+
+// puncturedTree reconstructs every leaf of a GGM tree but the leaf punctured,
+// from the sums of the siblings of the path to punctured at every level
+func puncturedTree(depth, punctured int, siblings []gf128.Element) (*tree, error) {
+	tr := &tree{depth: depth, nodes: make([]gf128.Element, 1<<depth), sums: make([][2]gf128.Element, depth+1)}
+	for l := 1; l <= depth; l++ {
+		tr.sums[l][1-pathBit(punctured, depth, l)] = siblings[l]
+	}
+	return tr, tr.expand(punctured)
+}
+
+// expand expands the nodes level by level from the root, in place since
+// the children of node i are 2i and 2i+1. If punctured is a leaf, the
+// nodes on its path are unknown and the siblings of the path are
+// recovered from the sums instead of being summed.
+func (tr *tree) expand(punctured int) error {
+	var prgs [2]cipher.Block
+	for side := range prgs {
+		var err error
+		if prgs[side], err = aes.NewCipher(ggmKeys[side]); err != nil {
+			return err
+		}
+	}
+
+	var in, out [gf128.Size]byte
+	for l := 1; l <= tr.depth; l++ {
+		path := -1
+		if punctured >= 0 {
+			path = punctured >> (tr.depth - l + 1)
+		}
+		var sums [2]gf128.Element
+		for i := 1<<(l-1) - 1; i >= 0; i-- {
+			parent := tr.nodes[i]
+			for side := range prgs {
+				child := gf128.Element{}
+				if i != path {
+					// child = AES_k(parent) + parent
+					parent.PutBytes(in[:])
+					prgs[side].Encrypt(out[:], in[:])
+					child = gf128.FromBytes(out[:]).Add(parent)
+					sums[side] = sums[side].Add(child)
+				}
+				tr.nodes[2*i+side] = child
+			}
+		}
+		if punctured < 0 {
+			tr.sums[l] = sums
+			continue
+		}
+		// the sibling of the path is the sum of its side
+		// minus all the other nodes of its side
+		side := 1 - pathBit(punctured, tr.depth, l)
+		tr.nodes[2*path+side] = tr.sums[l][side].Add(sums[side])
+	}
+	return nil
+}
+
+// leaves returns the leaves of the tree
+func (tr *tree) leaves() []gf128.Element {
+	return tr.nodes
+}
+
+// parallel runs f on [0, n) split across all the cores
+// and returns the error of the lowest failing index
+func parallel(n int, f func(i int) error) error {
+	var procs = runtime.GOMAXPROCS(0)
+	var errs = make([]error, procs)
+	var wg sync.WaitGroup
+	wg.Add(procs)
+	for p := 0; p < procs; p++ {
+		go func(p int) {
+			defer wg.Done()
+			for i := p * n / procs; i < (p+1)*n/procs; i++ {
+				if err := f(i); err != nil {
+					errs[p] = err
+					return
+				}
+			}
+		}(p)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,116 @@
+package vole
+
+import (
+	"net"
+	"testing"
+
+	"github.com/optable/match/internal/gf128"
+	"github.com/optable/match/internal/ot"
+)
+
+// runVOLE runs a VOLE of m elements on a pipe
+func runVOLE(m int) (delta gf128.Element, a, b, c []gf128.Element, err error) {
+	senderConn, receiverConn := net.Pipe()
+	errs := make(chan error, 1)
+	go func() {
+		defer senderConn.Close()
+		var err error
+		delta, b, err = NewSender(ot.NewSimplest(ot.ExtensionBaseMsgLens())).Send(m, senderConn)
+		errs <- err
+	}()
+
+	a, c, err = NewReceiver(ot.NewSimplest(ot.ExtensionBaseMsgLens())).Receive(m, receiverConn)
+	if err != nil {
+		receiverConn.Close()
+		return
+	}
+	err = <-errs
+	return
+}
+
+func TestVOLE(t *testing.T) {
+	for _, m := range []int{1, 2, 100, 1000, 100000} {
+		delta, a, b, c, err := runVOLE(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(a) != m || len(b) != m || len(c) != m {
+			t.Fatalf("expected %d elements, got %d, %d and %d", m, len(a), len(b), len(c))
+		}
+		// b = c + a*delta
+		mul := gf128.NewMultiplier(delta)
+		var zeros int
+		for i := range a {
+			if b[i] != c[i].Add(mul.Mul(a[i])) {
+				t.Fatalf("m=%d: element %d is not correlated", m, i)
+			}
+			if a[i].IsZero() {
+				zeros++
+			}
+		}
+		if zeros > 0 {
+			t.Fatalf("m=%d: %d elements of a are zero", m, zeros)
+		}
+	}
+}
+
+func TestVOLEEmpty(t *testing.T) {
+	_, a, b, c, err := runVOLE(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a)+len(b)+len(c) != 0 {
+		t.Fatal("expected empty vectors")
+	}
+}
+
+func TestPuncturedTree(t *testing.T) {
+	for _, depth := range []int{0, 1, 5} {
+		tr, err := newTree(depth)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for punctured := 0; punctured < 1<<depth; punctured++ {
+			siblings := make([]gf128.Element, depth+1)
+			for l := 1; l <= depth; l++ {
+				siblings[l] = tr.sums[l][1-pathBit(punctured, depth, l)]
+			}
+			pt, err := puncturedTree(depth, punctured, siblings)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for j, leaf := range pt.leaves() {
+				if j == punctured {
+					if !leaf.IsZero() {
+						t.Fatalf("depth %d: punctured leaf %d is known", depth, j)
+					}
+				} else if leaf != tr.leaves()[j] {
+					t.Fatalf("depth %d: leaf %d is not recovered when %d is punctured", depth, j, punctured)
+				}
+			}
+		}
+	}
+}
+
+func TestParams(t *testing.T) {
+	for _, m := range []int{1, 7, 1000, 1 << 20} {
+		p := newParams(m)
+		if p.noiseLen() < scaler*m {
+			t.Fatalf("m=%d: noise vector of %d elements is too short", m, p.noiseLen())
+		}
+		if p.blockLen > 1<<p.depth {
+			t.Fatalf("m=%d: blocks of %d elements do not fit trees of depth %d", m, p.blockLen, p.depth)
+		}
+	}
+	if p := newParams(1 << 20); p.t < 128 {
+		t.Fatalf("noise weight %d is too low", p.t)
+	}
+}
+
+func BenchmarkVOLE(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		if _, _, _, _, err := runVOLE(1 << 20); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -1,10 +1,13 @@
 package bpsi
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
 	"io"
 
 	bloom "github.com/bits-and-blooms/bloom/v3"
+	"github.com/optable/match/pkg/limits"
 )
 
 const (
@@ -38,7 +41,9 @@ type bitsAndBloom struct {
 func NewBloomfilter(t Bloomfilter, n int64) (bloomfilter, error) {
 	switch t {
 	case BloomfilterTypeBitsAndBloom:
-		return bitsAndBloom{bf: bloom.NewWithEstimates(uint(n), FalsePositive)}, nil
+		// an empty set still gets a well formed
+		// bloomfilter: estimates at 0 yield a huge k
+		return bitsAndBloom{bf: bloom.NewWithEstimates(uint(max(n, 1)), FalsePositive)}, nil
 	default:
 		return nil, fmt.Errorf("unsupported bloomfilter type %d", t)
 	}
@@ -59,10 +64,52 @@ func (bf bitsAndBloom) WriteTo(rw io.Writer) (int64, error) {
 	return bf.bf.WriteTo(rw)
 }
 
+// ErrInvalidBloomfilter is returned when the header of a remote
+// bloomfilter structure is inconsistent
+var ErrInvalidBloomfilter = fmt.Errorf("invalid bloomfilter header")
+
 // ReadFrom r into a new bitsAndBloom bloomfilter
 func ReadFrom(r io.Reader) (bloomfilter, int64, error) {
+	return ReadFromWithLimits(r, limits.Default())
+}
+
+// ReadFromWithLimits reads r into a new bitsAndBloom bloomfilter,
+// refusing any bloomfilter larger than the one the sender would build
+// for l.MaxCardinality identifiers, before it is allocated.
+func ReadFromWithLimits(r io.Reader, l limits.Limits) (bloomfilter, int64, error) {
+	// the bits-and-bloom wire format is
+	// m (bits), k (hashes), and then the bitset
+	// length (bits) followed by its words
+	var header [3]uint64
+	if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+		return nil, 0, err
+	}
+	m, k, length := header[0], header[1], header[2]
+	if m != length || m == 0 || k == 0 {
+		return nil, 0, fmt.Errorf("%w: m=%d k=%d length=%d", ErrInvalidBloomfilter, m, k, length)
+	}
+	// k only shrinks as the cardinality grows
+	if _, maxK := bloom.EstimateParameters(1, FalsePositive); k > uint64(maxK) {
+		return nil, 0, fmt.Errorf("%w: bloomfilter with %d hashes", ErrInvalidBloomfilter, k)
+	}
+	if l.MaxCardinality > 0 {
+		maxM, _ := bloom.EstimateParameters(uint(l.MaxCardinality), FalsePositive)
+		if m > uint64(maxM) {
+			return nil, 0, fmt.Errorf("%w: bloomfilter of %d bits", limits.ErrCardinalityExceeded, m)
+		}
+	}
+	if l.MinCardinality > 0 {
+		minM, _ := bloom.EstimateParameters(uint(l.MinCardinality), FalsePositive)
+		if m < uint64(minM) {
+			return nil, 0, fmt.Errorf("%w: bloomfilter of %d bits", limits.ErrCardinalityTooSmall, m)
+		}
+	}
+
+	// hand the validated header back to bits-and-bloom
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, header)
 	var bf = &bloom.BloomFilter{}
-	n, err := bf.ReadFrom(r)
+	n, err := bf.ReadFrom(io.MultiReader(&b, r))
 	return bitsAndBloom{bf: bf}, n, err
 }
 
@@ -0,0 +1,56 @@
+package bpsi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	bloom "github.com/bits-and-blooms/bloom/v3"
+	"github.com/optable/match/pkg/limits"
+)
+
+// fuzzLimits are small enough that an adversarial
+// header can never make the fuzzer allocate much
+var fuzzLimits = limits.Limits{MaxCardinality: 1 << 12, MinCardinality: 4, MaxBytes: 1 << 20}
+
+// header returns the wire encoding of a bloomfilter header
+// followed by words worth of bitset
+func header(m, k, length uint64, words int) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, [3]uint64{m, k, length})
+	b.Write(make([]byte, words*8))
+	return b.Bytes()
+}
+
+func FuzzReadFromWithLimits(f *testing.F) {
+	for _, n := range []uint{1, 4, 100, 1 << 12, 1 << 13} {
+		m, k := bloom.EstimateParameters(n, FalsePositive)
+		f.Add(header(uint64(m), uint64(k), uint64(m), 0))
+		f.Add(header(uint64(m), uint64(k), uint64(m), (int(m)+63)/64))
+	}
+	for _, v := range []uint64{0, 1, 64, math.MaxUint64, math.MaxInt64} {
+		f.Add(header(v, 1, v, 1))
+		f.Add(header(v, v, v, 1))
+	}
+	f.Add([]byte{})
+	f.Add([]byte{0, 0, 0})
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		bf, _, err := ReadFromWithLimits(bytes.NewReader(b), fuzzLimits)
+		if err != nil {
+			return
+		}
+		// an accepted bloomfilter fits in the limits and was read in full
+		var header [3]uint64
+		binary.Read(bytes.NewReader(b), binary.BigEndian, &header)
+		maxM, _ := bloom.EstimateParameters(uint(fuzzLimits.MaxCardinality), FalsePositive)
+		if header[0] > uint64(maxM) {
+			t.Fatalf("accepted a bloomfilter of %d bits, over %d", header[0], maxM)
+		}
+		if words := (header[0] + 63) / 64; uint64(len(b)-24) < words*8 {
+			t.Fatalf("accepted %d words out of %d bytes", words, len(b)-24)
+		}
+		bf.Check([]byte("identifier"))
+	})
+}
@@ -7,6 +7,7 @@ import (
 
 	"github.com/go-logr/logr"
 	"github.com/optable/match/internal/util"
+	"github.com/optable/match/pkg/options"
 )
 
 // ErrReadingBloomfilter is triggered if there's an IO problem reading the remote side bloomfilter structure
@@ -18,13 +19,14 @@ var ErrReadingBloomfilter = fmt.Errorf("could not read a bloomfilter structure f
 
 // Receiver side of the BPSI protocol
 type Receiver struct {
-	rw io.ReadWriter
+	rw   io.ReadWriter
+	opts options.Options
 }
 
 // NewReceiver returns a bloomfilter receiver initialized to
 // use rw as the communication layer
-func NewReceiver(rw io.ReadWriter) *Receiver {
-	return &Receiver{rw: rw}
+func NewReceiver(rw io.ReadWriter, opts ...options.Option) *Receiver {
+	return &Receiver{rw: rw, opts: options.New(opts...)}
 }
 
 // Intersect on matchables read from the identifiers channel,
@@ -35,13 +37,15 @@ func (r *Receiver) Intersect(ctx context.Context, n int64, identifiers <-chan []
 	// fetch and set up logger
 	logger := logr.FromContextOrDiscard(ctx)
 	logger = logger.WithValues("protocol", "bpsi")
+	// fetch the limits enforced on the sender
+	l := r.opts.Limits
 	var bf bloomfilter
 
 	// stage 1: read the bloomfilter from the remote side
 	stage1 := func() error {
 		logger.V(1).Info("Starting stage 1")
 
-		_bf, _, err := ReadFrom(r.rw)
+		_bf, _, err := ReadFromWithLimits(l.Reader(r.rw), l)
 		if err != nil {
 			return err
 		}
@@ -66,12 +70,12 @@ func (r *Receiver) Intersect(ctx context.Context, n int64, identifiers <-chan []
 	}
 
 	// run stage1
-	if err := util.Sel(ctx, stage1); err != nil {
+	if err := util.Sel(ctx, l.StageTimeout, stage1); err != nil {
 		return intersection, err
 	}
 
 	// run stage2
-	if err := util.Sel(ctx, stage2); err != nil {
+	if err := util.Sel(ctx, l.StageTimeout, stage2); err != nil {
 		return intersection, err
 	}
 
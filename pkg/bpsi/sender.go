@@ -6,6 +6,7 @@ import (
 
 	"github.com/go-logr/logr"
 	"github.com/optable/match/internal/util"
+	"github.com/optable/match/pkg/options"
 )
 
 // stage 1: load all local IDs into a bloom filter
@@ -13,14 +14,15 @@ import (
 
 // Sender side of the BPSI protocol
 type Sender struct {
-	rw io.ReadWriter
-	bf bloomfilter
+	rw   io.ReadWriter
+	bf   bloomfilter
+	opts options.Options
 }
 
 // NewSender returns a bloomfilter sender initialized to
 // use rw as the communication layer
-func NewSender(rw io.ReadWriter) *Sender {
-	return &Sender{rw: rw}
+func NewSender(rw io.ReadWriter, opts ...options.Option) *Sender {
+	return &Sender{rw: rw, opts: options.New(opts...)}
 }
 
 // Send initiates a BPSI exchange
@@ -57,12 +59,12 @@ func (s *Sender) Send(ctx context.Context, n int64, identifiers <-chan []byte) e
 	}
 
 	// run stage1
-	if err := util.Sel(ctx, stage1); err != nil {
+	if err := util.Sel(ctx, s.opts.Limits.StageTimeout, stage1); err != nil {
 		return err
 	}
 
 	// run stage2
-	if err := util.Sel(ctx, stage2); err != nil {
+	if err := util.Sel(ctx, s.opts.Limits.StageTimeout, stage2); err != nil {
 		return err
 	}
 
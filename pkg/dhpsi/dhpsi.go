@@ -6,6 +6,7 @@ import (
 	"io"
 
 	"github.com/optable/match/internal/permutations"
+	"github.com/optable/match/pkg/limits"
 )
 
 const (
@@ -17,6 +18,9 @@ const (
 
 var (
 	ErrUnexpectedPoint = fmt.Errorf("received a point to encode past the configured encoder size")
+	// ErrMissingIdentifiers is returned when the identifiers
+	// close before the announced number of them is read
+	ErrMissingIdentifiers = fmt.Errorf("identifiers closed before the announced number was read")
 )
 
 //
@@ -47,11 +51,14 @@ type Writer struct {
 // by the precomputed permutation table.
 // This is the first stage of doing a DH exchange.
 func NewDeriveMultiplyShuffler(w io.Writer, n int64, gr Ristretto) (*DeriveMultiplyShuffler, error) {
+	// create the permutations
+	p, err := permutations.NewFeistel(n)
+	if err != nil {
+		return nil, err
+	}
 	if err := binary.Write(w, binary.BigEndian, &n); err != nil {
 		return nil, err
 	}
-	// create the permutations
-	p, _ := permutations.NewKensler(n)
 	// and create the buffer map & encoder
 	b := make(map[int64][EncodedLen]byte, int(float64(n)*0.75))
 	return &DeriveMultiplyShuffler{w: w, max: n, gr: gr, p: p, b: b}, nil
@@ -147,13 +154,22 @@ type MultiplyReader struct {
 type Reader struct {
 	r        io.Reader
 	seq, max int64
+	// validate the points as they are read, readers
+	// that multiply points leave it to Ristretto.Multiply
+	validate bool
 }
 
 // NewMultiplyReader makes a ristretto multiplier reader that sits on the other end
 // of the DeriveMultiplyShuffler or the Writer and reads encoded ristretto hashes and
 // multiplies them using gr.
 func NewMultiplyReader(r io.Reader, gr Ristretto) (*MultiplyReader, error) {
-	rr, err := NewReader(r)
+	return NewLimitedMultiplyReader(r, gr, limits.Default())
+}
+
+// NewLimitedMultiplyReader is NewMultiplyReader with the announced
+// number of points validated against l.
+func NewLimitedMultiplyReader(r io.Reader, gr Ristretto, l limits.Limits) (*MultiplyReader, error) {
+	rr, err := newReader(r, l, false)
 	if err != nil {
 		return nil, err
 	}
@@ -162,13 +178,16 @@ func NewMultiplyReader(r io.Reader, gr Ristretto) (*MultiplyReader, error) {
 
 // Read reads a point from the underlying reader, multiplies it with ristretto
 // and writes it into point. Returns io.EOF when
-// the sequence has been completely read.
+// the sequence has been completely read, and a *PointError
+// if the point read is invalid.
 func (r *MultiplyReader) Read(point *[EncodedLen]byte) (err error) {
 	var b [EncodedLen]byte
 	if err := r.r.Read(&b); err != nil {
 		return err
 	}
-	r.gr.Multiply(point, b)
+	if err := r.gr.Multiply(point, b); err != nil {
+		return &PointError{Seq: r.r.seq - 1, Err: err}
+	}
 	return nil
 }
 
@@ -181,17 +200,32 @@ func (r *MultiplyReader) Max() int64 {
 // NewReader makes a simple reader that sits on the other end
 // of the DeriveMultiplyShuffler or the Writer and reads encoded ristretto points
 func NewReader(r io.Reader) (*Reader, error) {
+	return NewLimitedReader(r, limits.Default())
+}
+
+// NewLimitedReader is NewReader with the announced
+// number of points validated against l.
+func NewLimitedReader(r io.Reader, l limits.Limits) (*Reader, error) {
+	return newReader(r, l, true)
+}
+
+func newReader(r io.Reader, l limits.Limits, validate bool) (*Reader, error) {
 	var max int64
 	// extract the max value
 	if err := binary.Read(r, binary.BigEndian, &max); err != nil {
 		return nil, err
 	}
-	return &Reader{r: r, max: max}, nil
+	if err := l.CheckCardinality(max); err != nil {
+		return nil, err
+	}
+	return &Reader{r: r, max: max, validate: validate}, nil
 }
 
 // Read reads a point from the underlying reader and
 // writes it into p. Returns io.EOF when
-// the sequence has been completely read.
+// the sequence has been completely read,
+// io.ErrUnexpectedEOF if the sequence is cut short
+// and a *PointError if the point read is invalid.
 func (r *Reader) Read(point *[EncodedLen]byte) (err error) {
 	// ignore any read past the max size
 	// we're configured for
@@ -199,9 +233,17 @@ func (r *Reader) Read(point *[EncodedLen]byte) (err error) {
 		return io.EOF
 	}
 	// read one
-	if _, err = r.r.Read(point[:]); err != nil {
+	if _, err = io.ReadFull(r.r, point[:]); err != nil {
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
 		return
 	}
+	if r.validate {
+		if err := validatePoint(*point); err != nil {
+			return &PointError{Seq: r.seq, Err: err}
+		}
+	}
 	r.seq++
 	return nil
 }
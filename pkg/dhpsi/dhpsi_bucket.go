@@ -0,0 +1,260 @@
+package dhpsi
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"hash/maphash"
+	"io"
+	mrand "math/rand/v2"
+	"os"
+	"sync"
+)
+
+// DefaultBucketWindow is the average number of identifiers
+// held in memory at once by a DeriveMultiplyBucketShuffler
+const DefaultBucketWindow = 1 << 20
+
+// ErrIdentifierTooLong is returned when an identifier spilled
+// to a bucket is larger than what the bucket can read back
+var ErrIdentifierTooLong = errors.New("identifier too long to be spilled to a bucket")
+
+const (
+	// maxIdentifierLen bounds the identifiers read back from the buckets
+	maxIdentifierLen = 1 << 16
+	// spillChunkLen is the number of bytes a bucket
+	// buffers before it spills them to the temporary file
+	spillChunkLen = 1 << 14
+)
+
+// DeriveMultiplyBucketShuffler derives, multiplies and permutes identifiers
+// like DeriveMultiplyParallelShuffler, but without keeping all of the points in memory.
+//
+// It is a two pass shuffle: identifiers are first spilled to buckets picked by
+// a randomly seeded hash of the identifier, encrypted with an ephemeral key so that no
+// identifier is ever written to disk in the clear. The buckets share a single temporary
+// file: each bucket buffers up to spillChunkLen bytes in memory, and appends them to the
+// file as a chunk whose offset it records, so that only one file descriptor is used
+// whatever the number of buckets. Once all the identifiers are
+// spilled, each bucket is read back, permuted in memory, derived/multiplied
+// in parallel and streamed out. The resulting order is a uniformly random
+// permutation of the input, memory is bounded by the size of a bucket plus
+// spillChunkLen bytes per bucket, and the first point reaches the writer
+// after the first bucket is processed.
+//
+// Unlike the other shufflers, the permutation is not kept and
+// cannot be retrieved, this shuffler is meant for the sender.
+type DeriveMultiplyBucketShuffler struct {
+	w        io.Writer
+	seq, max int64
+	gr       Ristretto
+	// the bucket assignments, which keep the
+	// copies of an identifier in the same bucket
+	seed maphash.Seed
+	// source of the in-bucket permutations
+	rng *mrand.Rand
+	// temporary storage
+	block    cipher.Block
+	f        *os.File
+	size     int64
+	chunkLen int
+	buckets  []*bucket
+}
+
+// bucket holds encrypted, length prefixed identifiers: the
+// chunks spilled to the temporary file, followed by buf
+type bucket struct {
+	iv     [aes.BlockSize]byte
+	w      io.Writer
+	buf    bytes.Buffer
+	chunks []chunk
+	n      int64
+}
+
+// chunk is a section of the temporary file
+type chunk struct {
+	off, len int64
+}
+
+// NewDeriveMultiplyBucketShuffler returns a dhpsi encoder that hashes, encrypts
+// and shuffles matchable values on n sequences of bytes to be sent out, spilling
+// them to buckets of about window identifiers each in a temporary file created in dir.
+// If dir is the empty string, the default directory for temporary files is used.
+// Close must be called to remove the temporary file if the shuffle does not complete.
+// This is the first stage of doing a DH exchange.
+func NewDeriveMultiplyBucketShuffler(w io.Writer, n int64, gr Ristretto, window int64, dir string) (*DeriveMultiplyBucketShuffler, error) {
+	if window <= 0 {
+		window = DefaultBucketWindow
+	}
+	// ephemeral key for the buckets
+	var key [16]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key[:])
+	if err != nil {
+		return nil, err
+	}
+	// and a seed for the permutation
+	var seed [32]byte
+	if _, err := rand.Read(seed[:]); err != nil {
+		return nil, err
+	}
+	// send the max value first
+	if err := binary.Write(w, binary.BigEndian, &n); err != nil {
+		return nil, err
+	}
+	f, err := os.CreateTemp(dir, "dhpsi-buckets-")
+	if err != nil {
+		return nil, err
+	}
+
+	enc := &DeriveMultiplyBucketShuffler{w: w, max: n, gr: gr, seed: maphash.MakeSeed(), rng: mrand.New(mrand.NewChaCha8(seed)), block: block, f: f, chunkLen: spillChunkLen}
+	// one bucket for every window identifiers
+	enc.buckets = make([]*bucket, (n+window-1)/window)
+	return enc, nil
+}
+
+// Shuffle spills one identifier to a random bucket. Once the whole expected
+// sequence is spilled, the buckets are permuted, derived, multiplied by the
+// precomputed scalar and written out to the underlying writer.
+// Returns ErrUnexpectedPoint when the whole expected sequence has been sent.
+func (enc *DeriveMultiplyBucketShuffler) Shuffle(identifier []byte) (err error) {
+	// ignore any encode past the max encodes
+	// we're configured for
+	if enc.seq == enc.max {
+		return ErrUnexpectedPoint
+	}
+	if len(identifier) > maxIdentifierLen {
+		return ErrIdentifierTooLong
+	}
+
+	// spill
+	b, err := enc.bucket(int(maphash.Bytes(enc.seed, identifier) % uint64(len(enc.buckets))))
+	if err != nil {
+		return err
+	}
+	var l [binary.MaxVarintLen64]byte
+	if _, err = b.w.Write(l[:binary.PutUvarint(l[:], uint64(len(identifier)))]); err != nil {
+		return err
+	}
+	if _, err = b.w.Write(identifier); err != nil {
+		return err
+	}
+	b.n++
+	enc.seq++
+	if b.buf.Len() >= enc.chunkLen {
+		if err = enc.spill(b); err != nil {
+			return err
+		}
+	}
+
+	// after everything is spilled, flush
+	// the buckets one after the other
+	if enc.seq == enc.max {
+		defer enc.Close()
+		for _, b := range enc.buckets {
+			if b == nil {
+				continue
+			}
+			if err = enc.flush(b); err != nil {
+				return
+			}
+		}
+	}
+	return
+}
+
+// bucket returns the i-th bucket, creating it on first use
+func (enc *DeriveMultiplyBucketShuffler) bucket(i int) (*bucket, error) {
+	if b := enc.buckets[i]; b != nil {
+		return b, nil
+	}
+	var b = &bucket{}
+	if _, err := rand.Read(b.iv[:]); err != nil {
+		return nil, err
+	}
+	b.w = cipher.StreamWriter{S: cipher.NewCTR(enc.block, b.iv[:]), W: &b.buf}
+	enc.buckets[i] = b
+	return b, nil
+}
+
+// spill appends the buffered bytes of b to the temporary file
+func (enc *DeriveMultiplyBucketShuffler) spill(b *bucket) error {
+	if _, err := enc.f.Write(b.buf.Bytes()); err != nil {
+		return err
+	}
+	b.chunks = append(b.chunks, chunk{off: enc.size, len: int64(b.buf.Len())})
+	enc.size += int64(b.buf.Len())
+	b.buf.Reset()
+	return nil
+}
+
+// flush reads back the identifiers of b, permutes them,
+// derives/multiplies them in parallel and writes them out
+func (enc *DeriveMultiplyBucketShuffler) flush(b *bucket) error {
+	var chunks = make([]io.Reader, 0, len(b.chunks)+1)
+	for _, c := range b.chunks {
+		chunks = append(chunks, io.NewSectionReader(enc.f, c.off, c.len))
+	}
+	chunks = append(chunks, &b.buf)
+	r := bufio.NewReader(cipher.StreamReader{S: cipher.NewCTR(enc.block, b.iv[:]), R: io.MultiReader(chunks...)})
+	var identifiers = make([][]byte, b.n)
+	for i := range identifiers {
+		l, err := binary.ReadUvarint(r)
+		if err != nil {
+			return err
+		}
+		if l > maxIdentifierLen {
+			return ErrIdentifierTooLong
+		}
+		identifiers[i] = make([]byte, l)
+		if _, err := io.ReadFull(r, identifiers[i]); err != nil {
+			return err
+		}
+	}
+	// permute in memory
+	enc.rng.Shuffle(len(identifiers), func(i, j int) {
+		identifiers[i], identifiers[j] = identifiers[j], identifiers[i]
+	})
+
+	// derive/multiply in parallel
+	var wg sync.WaitGroup
+	var points = make([][EncodedLen]byte, b.n)
+	f := func(b dmBatch) {
+		copy(points[b.seq:], b.points)
+		wg.Done()
+	}
+	for seq := int64(0); seq < b.n; seq += batchSize {
+		batch := makeDMBatch(seq, min(batchSize, b.n-seq))
+		copy(batch.batch, identifiers[seq:])
+		wg.Add(1)
+		dmBus <- dmOp{gr: enc.gr, b: batch, f: f}
+	}
+	wg.Wait()
+	if err := unique(enc.gr, points); err != nil {
+		return err
+	}
+
+	// and write out in the permuted order
+	for _, p := range points {
+		if _, err := enc.w.Write(p[:]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close removes the temporary file backing the buckets
+func (enc *DeriveMultiplyBucketShuffler) Close() error {
+	if enc.f == nil {
+		return nil
+	}
+	err := errors.Join(enc.f.Close(), os.Remove(enc.f.Name()))
+	enc.f, enc.buckets = nil, nil
+	return err
+}
@@ -0,0 +1,125 @@
+package dhpsi
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"testing"
+)
+
+func TestDeriveMultiplyBucketShuffler(t *testing.T) {
+	const n, window = 3000, 500
+	var gr = NilRistretto(0)
+	var dir = t.TempDir()
+	var b bytes.Buffer
+
+	e, err := NewDeriveMultiplyBucketShuffler(&b, n, gr, window, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// spill the buckets in many chunks
+	e.chunkLen = 64
+	// index the expected points by input position
+	var sent = make(map[[EncodedLen]byte]int, n)
+	for i := 0; i < n; i++ {
+		identifier := []byte(fmt.Sprint(i))
+		var p [EncodedLen]byte
+		gr.DeriveMultiply(&p, identifier)
+		sent[p] = i
+		if err := e.Shuffle(identifier); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Shuffle([]byte("one too many")); err != ErrUnexpectedPoint {
+		t.Fatalf("expected ErrUnexpectedPoint, got %v", err)
+	}
+	// temporary files are removed once flushed
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Fatalf("expected the buckets to be removed, found %d files", len(files))
+	}
+
+	r, err := NewReader(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Max() != n {
+		t.Fatalf("expected %d points announced, got %d", n, r.Max())
+	}
+	var inPlace int
+	for i := 0; i < n; i++ {
+		var p [EncodedLen]byte
+		if err := r.Read(&p); err != nil {
+			t.Fatal(err)
+		}
+		pos, ok := sent[p]
+		if !ok {
+			t.Fatalf("point %d was not sent or was received twice", i)
+		}
+		delete(sent, p)
+		if pos == i {
+			inPlace++
+		}
+	}
+	// about 1 fixed point is expected from a random permutation
+	if inPlace > 10 {
+		t.Errorf("%d points out of %d were not moved", inPlace, n)
+	}
+}
+
+func TestDeriveMultiplyBucketShufflerClose(t *testing.T) {
+	var dir = t.TempDir()
+	var b bytes.Buffer
+	e, err := NewDeriveMultiplyBucketShuffler(&b, 100, NilRistretto(0), 10, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.chunkLen = 16
+	// shuffle part of the sequence and give up
+	for i := 0; i < 50; i++ {
+		if err := e.Shuffle([]byte(fmt.Sprint(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 1 || e.size == 0 {
+		t.Fatal("expected buckets to be spilled to a single file")
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Fatalf("expected the buckets to be removed, found %d files", len(files))
+	}
+}
+
+func TestBucketSender(t *testing.T) {
+	const n = 1000
+	identifiers := func(from, to int) <-chan []byte {
+		c := make(chan []byte)
+		go func() {
+			defer close(c)
+			for i := from; i < to; i++ {
+				c <- []byte(fmt.Sprintf("e:%d@organization.tld", i))
+			}
+		}()
+		return c
+	}
+
+	snd, rcv := net.Pipe()
+	errs := make(chan error, 1)
+	go func() {
+		defer snd.Close()
+		errs <- NewBucketSender(snd, 64, t.TempDir()).Send(context.Background(), n, identifiers(0, n))
+	}()
+	intersection, err := NewReceiver(rcv).Intersect(context.Background(), n, identifiers(n/2, n+n/2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+	if len(intersection) != n/2 {
+		t.Fatalf("expected %d matches, got %d", n/2, len(intersection))
+	}
+}
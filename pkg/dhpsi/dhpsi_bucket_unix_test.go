@@ -0,0 +1,50 @@
+//go:build unix
+
+package dhpsi
+
+import (
+	"bytes"
+	"fmt"
+	"syscall"
+	"testing"
+)
+
+func TestDeriveMultiplyBucketShufflerOpenFiles(t *testing.T) {
+	const limit = 64
+	var rlimit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_NOFILE, &rlimit); err != nil {
+		t.Skip(err)
+	}
+	lowered := rlimit
+	lowered.Cur = limit
+	if err := syscall.Setrlimit(syscall.RLIMIT_NOFILE, &lowered); err != nil {
+		t.Skip(err)
+	}
+	defer syscall.Setrlimit(syscall.RLIMIT_NOFILE, &rlimit)
+
+	// many more buckets than open files
+	const n = 16 * limit
+	var b bytes.Buffer
+	e, err := NewDeriveMultiplyBucketShuffler(&b, n, NilRistretto(0), 1, t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer e.Close()
+	e.chunkLen = 1
+	for i := 0; i < n; i++ {
+		if err := e.Shuffle([]byte(fmt.Sprint(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := NewReader(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		var p [EncodedLen]byte
+		if err := r.Read(&p); err != nil {
+			t.Fatalf("point %d: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package dhpsi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"testing"
+
+	"github.com/optable/match/pkg/limits"
+)
+
+// fuzzLimits are small enough that an adversarial
+// header can never make the fuzzer allocate much
+var fuzzLimits = limits.Limits{MaxCardinality: 1 << 12, MaxBytes: 1 << 20}
+
+// header returns the wire encoding of a sequence of n points
+// followed by points worth of payload
+func header(n int64, points int) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, n)
+	b.Write(make([]byte, points*EncodedLen))
+	return b.Bytes()
+}
+
+func addSizeHeaders(f *testing.F) {
+	for _, n := range []int64{0, 1, -1, 3, batchSize, batchSize + 1, 2 * batchSize, math.MaxInt64, math.MinInt64} {
+		f.Add(header(n, 0))
+		f.Add(header(n, 1))
+		f.Add(header(n, batchSize+3))
+	}
+	f.Add([]byte{})
+	f.Add([]byte{0, 0, 0})
+	// zero payloads are identity points, seed
+	// a sequence of valid points as well
+	valid := header(3, 0)
+	for i := 0; i < 3; i++ {
+		var p [EncodedLen]byte
+		NilRistretto(0).DeriveMultiply(&p, []byte{byte(i)})
+		valid = append(valid, p[:]...)
+	}
+	f.Add(valid)
+}
+
+// drain reads r until it errors out and checks that it never returns
+// more points than announced nor silently accepts a truncated stream
+func drain(t *testing.T, max int64, read func(*[EncodedLen]byte) error, payload int) {
+	var n int64
+	for {
+		var p [EncodedLen]byte
+		err := read(&p)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return
+		}
+		n++
+	}
+	if n != max {
+		t.Fatalf("read %d points and announced %d", n, max)
+	}
+	if int64(payload) < max*EncodedLen {
+		t.Fatalf("accepted %d points out of %d bytes", max, payload)
+	}
+}
+
+func FuzzReader(f *testing.F) {
+	addSizeHeaders(f)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		r, err := NewLimitedReader(bytes.NewReader(b), fuzzLimits)
+		if err != nil {
+			if len(b) >= 8 && !errors.Is(err, limits.ErrInvalidCardinality) && !errors.Is(err, limits.ErrCardinalityExceeded) {
+				t.Fatalf("unexpected error on a complete header: %v", err)
+			}
+			return
+		}
+		if r.Max() < 0 || r.Max() > fuzzLimits.MaxCardinality {
+			t.Fatalf("accepted an announced size of %d", r.Max())
+		}
+		drain(t, r.Max(), r.Read, len(b)-8)
+	})
+}
+
+func FuzzMultiplyParallelReader(f *testing.F) {
+	addSizeHeaders(f)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		r, err := NewLimitedMultiplyParallelReader(bytes.NewReader(b), NilRistretto(0), fuzzLimits)
+		if err != nil {
+			return
+		}
+		drain(t, r.Max(), r.Read, len(b)-8)
+	})
+}
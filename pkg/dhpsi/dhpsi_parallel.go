@@ -1,11 +1,13 @@
 package dhpsi
 
 import (
+	"crypto/rand"
 	"encoding/binary"
 	"io"
 	"sync"
 
 	"github.com/optable/match/internal/permutations"
+	"github.com/optable/match/pkg/limits"
 )
 
 //
@@ -38,14 +40,17 @@ type DeriveMultiplyParallelShuffler struct {
 //
 // This version operates on multiple cores in parallel
 func NewDeriveMultiplyParallelShuffler(w io.Writer, n int64, gr Ristretto) (*DeriveMultiplyParallelShuffler, error) {
+	// create the permutations
+	p, err := permutations.NewFeistel(n)
+	if err != nil {
+		return nil, err
+	}
 	// send the max value first
 	if err := binary.Write(w, binary.BigEndian, &n); err != nil {
 		return nil, err
 	}
 	// create the first batch
 	b := makeDMBatch(0, min(batchSize, n))
-	// create the permutations
-	p, _ := permutations.NewKensler(n)
 	// and create the encoder
 	enc := &DeriveMultiplyParallelShuffler{w: w, max: n, gr: gr, p: p, b: b, points: make([][EncodedLen]byte, n)}
 	enc.wg.Add(1)
@@ -94,6 +99,9 @@ func (enc *DeriveMultiplyParallelShuffler) Shuffle(identifier []byte) (err error
 	if enc.seq == enc.max {
 		// wait for all batches to finish
 		enc.wg.Wait()
+		if err = unique(enc.gr, enc.points); err != nil {
+			return
+		}
 		for i := int64(0); i < enc.max; i++ {
 			pos := enc.p.Shuffle(i)
 			if _, err = enc.w.Write(enc.points[pos][:]); err != nil {
@@ -110,6 +118,26 @@ func (enc *DeriveMultiplyParallelShuffler) Permutations() permutations.Permutati
 	return enc.p
 }
 
+// unique replaces the repeated points with the points of random
+// identifiers, so that a set read from a file with duplicate lines
+// still reaches the peer as a set, which is what it checks for,
+// without changing the number of points announced to it.
+func unique(gr Ristretto, points [][EncodedLen]byte) error {
+	var seen = make(map[[EncodedLen]byte]struct{}, len(points))
+	for i, p := range points {
+		if _, ok := seen[p]; !ok {
+			seen[p] = struct{}{}
+			continue
+		}
+		var dummy [EncodedLen]byte
+		if _, err := rand.Read(dummy[:]); err != nil {
+			return err
+		}
+		gr.DeriveMultiply(&points[i], dummy[:])
+	}
+	return nil
+}
+
 //
 // READERS
 //
@@ -125,6 +153,9 @@ type MultiplyParallelReader struct {
 	r   *Reader
 	seq int64
 	bus <-chan [EncodedLen]byte
+	// err is the error that stopped fill, it is
+	// only safe to read once bus is closed
+	err error
 }
 
 // NewMultiplyParallelReader makes a ristretto multiplier reader that sits on the other end
@@ -133,95 +164,85 @@ type MultiplyParallelReader struct {
 //
 // This version operates on multiple cores in parallel
 func NewMultiplyParallelReader(r io.Reader, gr Ristretto) (*MultiplyParallelReader, error) {
-	// setup the underlying reader
-	rr, err := NewReader(r)
+	return NewLimitedMultiplyParallelReader(r, gr, limits.Default())
+}
+
+// NewLimitedMultiplyParallelReader is NewMultiplyParallelReader with the
+// announced number of points validated against l before anything is allocated.
+func NewLimitedMultiplyParallelReader(r io.Reader, gr Ristretto, l limits.Limits) (*MultiplyParallelReader, error) {
+	// setup the underlying reader, points
+	// are validated by gr.Multiply
+	rr, err := newReader(r, l, false)
 	if err != nil {
 		return nil, err
 	}
-	// start filling
-	c := fill(rr, gr)
 	// make a new decoder
-	dec := &MultiplyParallelReader{r: rr, bus: c}
+	dec := &MultiplyParallelReader{r: rr}
+	// start filling
+	dec.bus = dec.fill(gr)
 	return dec, nil
 }
 
 // fill workers with jobs to process
 // and block on processing the jobs until
 // there is nothing left to read
-func fill(r *Reader, gr Ristretto) <-chan [EncodedLen]byte {
+func (dec *MultiplyParallelReader) fill(gr Ristretto) <-chan [EncodedLen]byte {
+	var r = dec.r
+	// closed signals that reading stopped on an error
 	var closed = make(chan bool)
 	var batches = make(chan mBatch)
-	// calculate the total batch size
-	var totalBatches = r.max / batchSize
-	if r.max%batchSize != 0 {
-		totalBatches++
+	// one per batch in flight in the workers
+	var wg sync.WaitGroup
+	// stop records the first error and cancels everything
+	var once sync.Once
+	stop := func(err error) {
+		once.Do(func() {
+			dec.err = err
+			close(closed)
+		})
 	}
 
-	// left batches counter
-	var lb = make(chan int64)
-	go func() {
-		// TODO: catch the cancel
-		// signal here and close LB,
-		// that will return 0 in the batch closure
-		// and actually close "closed"
-		// as it stands a cancelled context
-		// on Read wont stop anything until the sockets are closed
-		defer close(lb)
-		left := totalBatches - 1
-		for {
-			select {
-			case lb <- left:
-				left--
-				if left == 0 {
-					return
-				}
-			case <-closed:
-				return
-			}
-		}
-	}()
-
-	// closure to process finishes
+	// closure to process finished
 	// batches while also blocking
 	// the worker
 	f := func(m mBatch) {
-		select {
-		case batches <- m:
-			// one sent out
-		}
-
-		// if this is the last batch,
-		// close batches
-		left := <-lb
-		if left == 0 {
-			close(batches)
-		}
+		batches <- m
+		wg.Done()
 	}
 
 	// poll r and make batches to process
 	// until there's nothing left to read
 	go func() {
-		totalBatches := int(totalBatches)
-		for i := 0; i < totalBatches; i++ {
+		// batches can only be closed once
+		// every worker has handed off its batch
+		defer func() {
+			wg.Wait()
+			close(batches)
+		}()
+		for i := 0; r.seq < r.max; i++ {
+			// stop reading once a batch was rejected
+			select {
+			case <-closed:
+				return
+			default:
+			}
 			b := makeMBatch(i, min(batchSize, r.max-r.seq))
 			for j := int64(0); j < b.s; j++ {
 				// if there's an error here
 				// we can't continue
 				// otherwise we'll read exactly
 				// r.Max()
-				err := r.Read(&b.batch[j])
-				if err != nil {
+				if err := r.Read(&b.batch[j]); err != nil {
 					// cancel everything
-					close(batches)
-					close(closed)
+					stop(err)
 					return
 				}
 			}
 			// this will block if the processing queue
 			// is full
+			wg.Add(1)
 			mBus <- mOp{gr: gr, b: b, f: f}
 		}
-		return
 	}()
 
 	// signal downstream errors or EOF
@@ -233,28 +254,22 @@ func fill(r *Reader, gr Ristretto) <-chan [EncodedLen]byte {
 		var sent int
 		// process batches until batches closes
 		for b := range batches {
-			// if this is the current batch, write it out
-			if sent == b.n {
-				copyOut(b, c, closed)
-				sent++
-			} else {
-				// buffer it
-				ring[b.n] = b
-			}
-			// check if buffered
-			if b, ok := ring[sent]; ok {
-				// do we have it buffered?
+			ring[b.n] = b
+			// write out every batch that is now in sequence
+			for {
+				b, ok := ring[sent]
+				if !ok {
+					break
+				}
+				// errors are reported in sequence
+				if b.err != nil {
+					stop(b.err)
+				}
 				copyOut(b, c, closed)
 				delete(ring, sent)
 				sent++
 			}
 		}
-
-		// flush out the rest of the buffer
-		for i := 0; i < len(ring); i++ {
-			b := ring[sent+i]
-			copyOut(b, c, closed)
-		}
 	}()
 
 	return c
@@ -281,16 +296,16 @@ func (dec *MultiplyParallelReader) Read(point *[EncodedLen]byte) (err error) {
 	if dec.seq == dec.r.max {
 		return io.EOF
 	}
-	// do we have data buffered?
 
-	select {
-	case p, open := <-dec.bus:
-		if !open {
-			return io.ErrUnexpectedEOF
+	p, open := <-dec.bus
+	if !open {
+		if dec.err != nil {
+			return dec.err
 		}
-		*point = p
-		dec.seq++
+		return io.ErrUnexpectedEOF
 	}
+	*point = p
+	dec.seq++
 	return nil
 }
 
@@ -1,6 +1,9 @@
 package dhpsi
 
 import (
+	"bytes"
+	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
 	"sync"
@@ -76,8 +79,9 @@ func TestDeriveMultiplyParallelShuffler(t *testing.T) {
 
 	// check that sequences are permutated as expected
 	for k, v := range received {
-		trimmed := sent[permutations.Shuffle(int64(k))][:32]
-		if !compare(v, trimmed) {
+		var derived [EncodedLen]byte
+		gr.DeriveMultiply(&derived, sent[permutations.Shuffle(int64(k))])
+		if !compare(v, derived[:]) {
 			t.Fatalf("shuffle sequence is broken")
 		}
 	}
@@ -161,3 +165,42 @@ func TestMultiplyParallelReader(t *testing.T) {
 		}
 	}
 }
+
+func TestMultiplyParallelReaderInvalidPoint(t *testing.T) {
+	// a stream of valid points with an identity
+	// point hidden past the first batch
+	const n, bad = 2*batchSize + 7, batchSize + 3
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, int64(n))
+	for i := 0; i < n; i++ {
+		var p [EncodedLen]byte
+		if i != bad {
+			NilRistretto(0).DeriveMultiply(&p, []byte(fmt.Sprint(i)))
+		}
+		b.Write(p[:])
+	}
+
+	r, err := NewMultiplyParallelReader(&b, NilRistretto(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var read int
+	for {
+		var p [EncodedLen]byte
+		err = r.Read(&p)
+		if err != nil {
+			break
+		}
+		read++
+	}
+	var perr *PointError
+	if !errors.As(err, &perr) || !errors.Is(err, ErrIdentityPoint) {
+		t.Fatalf("expected a PointError wrapping ErrIdentityPoint, got %v", err)
+	}
+	if perr.Seq != bad {
+		t.Errorf("expected the error on point %d, got %d", bad, perr.Seq)
+	}
+	if read > bad {
+		t.Errorf("read %d points past the invalid one", read-bad)
+	}
+}
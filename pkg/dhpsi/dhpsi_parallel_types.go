@@ -48,6 +48,9 @@ type mBatch struct {
 	batch [][EncodedLen]byte
 	// buffer points out
 	points [][EncodedLen]byte
+	// err is set if a point
+	// in the batch was rejected
+	err error
 }
 
 func init() {
@@ -75,8 +78,12 @@ func parallelH(dm chan dmOp, m chan mOp) {
 			// extract the batch
 			b := op.b
 			// multiply the points into points
+			// and stop at the first invalid one
 			for k, v := range b.batch {
-				op.gr.Multiply(&b.points[k], v)
+				if err := op.gr.Multiply(&b.points[k], v); err != nil {
+					b.err = &PointError{Seq: int64(b.n)*batchSize + int64(k), Err: err}
+					break
+				}
 			}
 			// closure
 			op.f(b)
@@ -3,6 +3,7 @@ package dhpsi
 import (
 	"crypto/rand"
 	"crypto/sha512"
+	"errors"
 	"fmt"
 	"log"
 
@@ -16,15 +17,42 @@ const (
 	RistrettoNil
 )
 
+var (
+	// ErrInvalidPoint is returned when a peer sends bytes that are
+	// not the canonical encoding of a ristretto point
+	ErrInvalidPoint = errors.New("received an invalid ristretto point encoding")
+	// ErrIdentityPoint is returned when a peer sends the identity element
+	ErrIdentityPoint = errors.New("received the ristretto identity point")
+	// ErrDuplicatePoint is returned when a peer sends the same point twice,
+	// revealing a set that contains duplicates or that was replayed
+	ErrDuplicatePoint = errors.New("received a duplicate ristretto point")
+)
+
+// PointError records a point rejected at
+// position Seq of a received sequence
+type PointError struct {
+	Seq int64
+	Err error
+}
+
+func (e *PointError) Error() string {
+	return fmt.Sprintf("point #%d: %v", e.Seq, e.Err)
+}
+
+func (e *PointError) Unwrap() error {
+	return e.Err
+}
+
 // Ristretto represents a ristretto point on an edward2559 curve.
 //
 // The method DeriveMultiply converts an identifier to a ristretto point
 // and multiply it with the secret key.
 // Multiply operates on ristretto point directly and multiply it with
-// the secret key.
+// the secret key. It returns ErrInvalidPoint or ErrIdentityPoint
+// if src can't be multiplied.
 type Ristretto interface {
 	DeriveMultiply(dst *[EncodedLen]byte, src []byte)
-	Multiply(dst *[EncodedLen]byte, src [EncodedLen]byte)
+	Multiply(dst *[EncodedLen]byte, src [EncodedLen]byte) error
 }
 
 // GR uses ristretto implementation from
@@ -77,12 +105,18 @@ func (g GR) DeriveMultiply(dst *[EncodedLen]byte, src []byte) {
 }
 
 // Multiply multiplies src with private key and stores it into dst.
-func (g GR) Multiply(dst *[EncodedLen]byte, src [EncodedLen]byte) {
+func (g GR) Multiply(dst *[EncodedLen]byte, src [EncodedLen]byte) error {
+	if src == identity {
+		return ErrIdentityPoint
+	}
 	// multiply
 	var p gr.Point
-	p.SetBytes(&src)
+	if !p.SetBytes(&src) {
+		return ErrInvalidPoint
+	}
 	p.ScalarMult(&p, g.key)
 	p.BytesInto(dst)
+	return nil
 }
 
 // DeriveMultiply derives src to a ristretto point
@@ -102,13 +136,34 @@ func (r R255) DeriveMultiply(dst *[EncodedLen]byte, src []byte) {
 }
 
 // Multiply multiplies src with private key and stores it into dst.
-func (r R255) Multiply(dst *[EncodedLen]byte, src [EncodedLen]byte) {
+func (r R255) Multiply(dst *[EncodedLen]byte, src [EncodedLen]byte) error {
+	if src == identity {
+		return ErrIdentityPoint
+	}
 	// multiply
 	var p = r255.NewElement()
-	p.Decode(src[:])
+	if err := p.Decode(src[:]); err != nil {
+		return ErrInvalidPoint
+	}
 	p.ScalarMult(r.key, p)
 	// return.
 	var tmp []byte
 	tmp = p.Encode(tmp)
 	copy(dst[:], tmp)
+	return nil
+}
+
+// identity is the canonical encoding of the ristretto identity element
+var identity [EncodedLen]byte
+
+// validatePoint returns ErrIdentityPoint or ErrInvalidPoint if
+// p is not the canonical encoding of a non identity ristretto point
+func validatePoint(p [EncodedLen]byte) error {
+	if p == identity {
+		return ErrIdentityPoint
+	}
+	if err := r255.NewElement().Decode(p[:]); err != nil {
+		return ErrInvalidPoint
+	}
+	return nil
 }
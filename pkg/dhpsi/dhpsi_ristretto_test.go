@@ -2,6 +2,7 @@ package dhpsi
 
 import (
 	"crypto/sha512"
+	"errors"
 	"testing"
 
 	"github.com/bwesterb/go-ristretto"
@@ -12,15 +13,19 @@ var xxx = []byte("e:person@organization.tld")
 
 type NilRistretto int
 
-// test loopback ristretto just copies data out
-// and does no treatment
+// test loopback ristretto only derives points
+// and does no multiplication
 func (g NilRistretto) DeriveMultiply(dst *[EncodedLen]byte, src []byte) {
-	// return first 32 bytes of matchable
-	copy(dst[:], src[:32])
+	// derive without multiplying
+	hash := sha512.Sum512(src)
+	var tmp []byte
+	tmp = r255.NewElement().FromUniformBytes(hash[:]).Encode(tmp)
+	copy(dst[:], tmp)
 }
-func (g NilRistretto) Multiply(dst *[EncodedLen]byte, src [EncodedLen]byte) {
+func (g NilRistretto) Multiply(dst *[EncodedLen]byte, src [EncodedLen]byte) error {
 	// passthrought
 	copy(dst[:], src[:])
+	return validatePoint(src)
 }
 
 func TestInterOperability(t *testing.T) {
@@ -80,6 +85,30 @@ func TestInterInterfaceOperability(t *testing.T) {
 
 }
 
+func TestMultiplyRejectsInvalidPoints(t *testing.T) {
+	var valid [EncodedLen]byte
+	NilRistretto(0).DeriveMultiply(&valid, xxx)
+	// a non canonical encoding: all bits set
+	var invalid [EncodedLen]byte
+	for i := range invalid {
+		invalid[i] = 0xff
+	}
+
+	for _, typ := range []int{RistrettoTypeGR, RistrettoTypeR255} {
+		gr, _ := NewRistretto(typ)
+		var dst [EncodedLen]byte
+		if err := gr.Multiply(&dst, valid); err != nil {
+			t.Errorf("ristretto type %d rejected a valid point: %v", typ, err)
+		}
+		if err := gr.Multiply(&dst, identity); !errors.Is(err, ErrIdentityPoint) {
+			t.Errorf("ristretto type %d: expected ErrIdentityPoint, got %v", typ, err)
+		}
+		if err := gr.Multiply(&dst, invalid); !errors.Is(err, ErrInvalidPoint) {
+			t.Errorf("ristretto type %d: expected ErrInvalidPoint, got %v", typ, err)
+		}
+	}
+}
+
 func BenchmarkGRDeriveMultiply(b *testing.B) {
 	// get a gr
 	gr, _ := NewRistretto(RistrettoTypeGR)
@@ -1,8 +1,11 @@
 package dhpsi
 
 import (
+	"bytes"
+	"context"
 	"fmt"
 	"io"
+	"net"
 	"sync"
 	"testing"
 
@@ -154,9 +157,44 @@ func TestDeriveMultiplyShuffler(t *testing.T) {
 
 	// check that sequences are permutated as expected
 	for k, v := range received {
-		trimmed := sent[permutations.Shuffle(int64(k))][:32]
-		if !compare(v, trimmed) {
+		var derived [EncodedLen]byte
+		gr.DeriveMultiply(&derived, sent[permutations.Shuffle(int64(k))])
+		if !compare(v, derived[:]) {
 			t.Fatalf("shuffle sequence is broken")
 		}
 	}
 }
+
+func TestSendDuplicates(t *testing.T) {
+	var senders = map[string]func(io.ReadWriter) *Sender{
+		"parallel": func(rw io.ReadWriter) *Sender { return NewSender(rw) },
+		"bucket":   func(rw io.ReadWriter) *Sender { return NewBucketSender(rw, 1, t.TempDir()) },
+	}
+	// a file with a duplicate line
+	var identifiers = [][]byte{[]byte("a"), []byte("b"), []byte("a")}
+	for name, newSender := range senders {
+		t.Run(name, func(t *testing.T) {
+			snd, rcv := net.Pipe()
+			errs := make(chan error, 1)
+			go func() {
+				defer snd.Close()
+				c := make(chan []byte, len(identifiers))
+				for _, id := range identifiers {
+					c <- id
+				}
+				close(c)
+				errs <- newSender(snd).Send(context.Background(), int64(len(identifiers)), c)
+			}()
+			intersection, err := NewReceiver(rcv).IntersectFromReader(context.Background(), 2, bytes.NewBufferString("a\nc\n"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := <-errs; err != nil {
+				t.Fatal(err)
+			}
+			if len(intersection) != 1 || string(intersection[0]) != "a" {
+				t.Fatalf("expected to match a, got %q", intersection)
+			}
+		})
+	}
+}
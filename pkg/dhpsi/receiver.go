@@ -8,6 +8,8 @@ import (
 	"github.com/go-logr/logr"
 	"github.com/optable/match/internal/permutations"
 	"github.com/optable/match/internal/util"
+	"github.com/optable/match/pkg/limits"
+	"github.com/optable/match/pkg/options"
 )
 
 // (receiver, publisher: high cardinality) stage1: reads the identifiers from the sender, encrypt them and index them in a map
@@ -18,13 +20,14 @@ import (
 // The receiver learns the intersection of matchable between its set and the set
 // of the sender
 type Receiver struct {
-	rw io.ReadWriter
+	rw   io.ReadWriter
+	opts options.Options
 }
 
 // NewReceiver returns a receiver initialized to
 // use rw as the communication layer
-func NewReceiver(rw io.ReadWriter) *Receiver {
-	return &Receiver{rw: rw}
+func NewReceiver(rw io.ReadWriter, opts ...options.Option) *Receiver {
+	return &Receiver{rw: rw, opts: options.New(opts...)}
 }
 
 type permuted struct {
@@ -49,6 +52,9 @@ func (s *Receiver) Intersect(ctx context.Context, n int64, identifiers <-chan []
 	// fetch and set up logger
 	logger := logr.FromContextOrDiscard(ctx)
 	logger = logger.WithValues("protocol", "dhpsi")
+	// fetch the limits enforced on the sender
+	l := s.opts.Limits
+	rw := l.ReadWriter(s.rw)
 
 	// state
 	var remoteIDs = make(map[[EncodedLen]byte]bool) // single write goroutine access from stage1
@@ -69,10 +75,10 @@ func (s *Receiver) Intersect(ctx context.Context, n int64, identifiers <-chan []
 	stage1 := func() error {
 		logger.V(1).Info("Starting stage 1")
 
-		if reader, err := NewMultiplyParallelReader(s.rw, gr); err != nil {
+		if reader, err := NewLimitedMultiplyParallelReader(rw, gr, l); err != nil {
 			return err
 		} else {
-			for {
+			for i := int64(0); ; i++ {
 				// read
 				var p [EncodedLen]byte
 				if err := reader.Read(&p); err != nil {
@@ -80,7 +86,12 @@ func (s *Receiver) Intersect(ctx context.Context, n int64, identifiers <-chan []
 						logger.V(1).Info("Finished stage 1")
 						return nil
 					}
-					return err
+					return fmt.Errorf("stage1: %w", err)
+				}
+				// a point seen twice means the sender set
+				// has duplicates or is being replayed
+				if remoteIDs[p] {
+					return fmt.Errorf("stage1: %w", &PointError{Seq: i, Err: ErrDuplicatePoint})
 				}
 				// index
 				remoteIDs[p] = true
@@ -91,7 +102,7 @@ func (s *Receiver) Intersect(ctx context.Context, n int64, identifiers <-chan []
 	stage21 := func() error {
 		logger.V(1).Info("Starting stage 2.1")
 
-		writer, err := NewDeriveMultiplyParallelShuffler(s.rw, n, gr)
+		writer, err := NewDeriveMultiplyParallelShuffler(rw, n, gr)
 		if err != nil {
 			return err
 		}
@@ -103,6 +114,9 @@ func (s *Receiver) Intersect(ctx context.Context, n int64, identifiers <-chan []
 		//  2. write them to the sender
 		var i int64
 		for identifier := range identifiers {
+			if i == n {
+				return fmt.Errorf("stage2.1: %w", ErrUnexpectedPoint)
+			}
 			// save this input
 			receiverIDs <- permuted{i, identifier} // {0, "0"}
 			if err := writer.Shuffle(identifier); err != nil {
@@ -110,6 +124,9 @@ func (s *Receiver) Intersect(ctx context.Context, n int64, identifiers <-chan []
 			}
 			i++
 		}
+		if i != n {
+			return fmt.Errorf("stage2.1: %w: read %d of %d", ErrMissingIdentifiers, i, n)
+		}
 
 		logger.V(1).Info("Finished stage 2.1")
 		return nil
@@ -117,15 +134,22 @@ func (s *Receiver) Intersect(ctx context.Context, n int64, identifiers <-chan []
 	// step3: reads back the identifiers from the sender and learns the intersection
 	stage22 := func() error {
 		logger.V(1).Info("Starting stage 2.2")
-		reader, err := NewReader(s.rw)
+		// the sender echoes our own cardinality, which is
+		// neither bound by a minimum nor observed
+		reader, err := NewLimitedReader(rw, limits.Limits{MaxCardinality: l.MaxCardinality})
 		if err != nil {
 			return err
 		}
+		// the sender multiplies back exactly
+		// what we sent it, nothing more
+		if reader.Max() != n {
+			return fmt.Errorf("stage2.2: %w: expected %d points, peer announced %d", limits.ErrInvalidCardinality, n, reader.Max())
+		}
 		for i := int64(0); i < reader.Max(); i++ {
 			// read
 			var p [EncodedLen]byte
 			if err := reader.Read(&p); err != nil {
-				return fmt.Errorf("stage2.2: %v", err)
+				return fmt.Errorf("stage2.2: %w", err)
 			}
 			if remoteIDs[p] {
 				// we can match this local identifier with one received
@@ -140,14 +164,19 @@ func (s *Receiver) Intersect(ctx context.Context, n int64, identifiers <-chan []
 	}
 
 	// run stage1
-	if err := util.Sel(ctx, stage1); err != nil {
+	if err := util.Sel(ctx, l.StageTimeout, stage1); err != nil {
 		return nil, err
 	}
 	// run stage2.1/2.2
 	var done = 2
 	var errs = util.Sels(stage21, stage22)
+	timeout, stop := util.StageTimer(l.StageTimeout)
+	defer stop()
 	for done != 0 {
 		select {
+		case <-timeout:
+			return intersection, limits.ErrStageTimeout
+
 		case err := <-errs:
 			if err == nil {
 				done--
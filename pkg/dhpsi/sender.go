@@ -7,6 +7,7 @@ import (
 
 	"github.com/go-logr/logr"
 	"github.com/optable/match/internal/util"
+	"github.com/optable/match/pkg/options"
 )
 
 // operations
@@ -17,12 +18,48 @@ import (
 // The sender initiates the transfer and in the case of DHPSI, it learns nothing.
 type Sender struct {
 	rw io.ReadWriter
+	// bucket shuffle configuration,
+	// disabled if window is 0
+	window int64
+	dir    string
+	opts   options.Options
 }
 
 // NewSender returns a sender initialized to
 // use rw as the communication layer
-func NewSender(rw io.ReadWriter) *Sender {
-	return &Sender{rw: rw}
+func NewSender(rw io.ReadWriter, opts ...options.Option) *Sender {
+	return &Sender{rw: rw, opts: options.New(opts...)}
+}
+
+// NewBucketSender returns a sender initialized to use rw as the
+// communication layer, that shuffles its identifiers in buckets of
+// about window identifiers spilled to temporary files in dir instead
+// of holding all of them in memory. See DeriveMultiplyBucketShuffler.
+// A window of 0 or less uses DefaultBucketWindow.
+func NewBucketSender(rw io.ReadWriter, window int64, dir string, opts ...options.Option) *Sender {
+	if window <= 0 {
+		window = DefaultBucketWindow
+	}
+	return &Sender{rw: rw, window: window, dir: dir, opts: options.New(opts...)}
+}
+
+// shuffler is satisfied by the shufflers
+// the sender can write its identifiers with
+type shuffler interface {
+	Shuffle(identifier []byte) error
+}
+
+// newShuffler returns the shuffler configured on s
+func (s *Sender) newShuffler(w io.Writer, n int64, gr Ristretto) (shuffler, func() error, error) {
+	if s.window == 0 {
+		enc, err := NewDeriveMultiplyParallelShuffler(w, n, gr)
+		return enc, func() error { return nil }, err
+	}
+	enc, err := NewDeriveMultiplyBucketShuffler(w, n, gr, s.window, s.dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	return enc, enc.Close, nil
 }
 
 // SendFromReader initiates a DHPSI exchange with n identifiers
@@ -45,6 +82,9 @@ func (s *Sender) Send(ctx context.Context, n int64, identifiers <-chan []byte) e
 	// fetch and set up logger
 	logger := logr.FromContextOrDiscard(ctx)
 	logger = logger.WithValues("protocol", "dhpsi")
+	// fetch the limits enforced on the receiver
+	l := s.opts.Limits
+	rw := l.ReadWriter(s.rw)
 
 	// pick a ristretto implementation
 	gr, _ := NewRistretto(RistrettoTypeR255)
@@ -52,18 +92,25 @@ func (s *Sender) Send(ctx context.Context, n int64, identifiers <-chan []byte) e
 	stage1 := func() error {
 		logger.V(1).Info("Starting stage 1")
 
-		writer, err := NewDeriveMultiplyParallelShuffler(s.rw, n, gr)
+		writer, cleanup, err := s.newShuffler(rw, n, gr)
 		if err != nil {
 			return err
 		}
+		defer cleanup()
 		// read N matchables from r
 		// and write them to stage1
 		// shuffle will error out if more than N
 		// are read from identifiers
+		var i int64
 		for identifier := range identifiers {
 			if err := writer.Shuffle(identifier); err != nil {
 				return err
 			}
+			i++
+		}
+		// and the shuffler never flushes if fewer are
+		if i != n {
+			return fmt.Errorf("stage1: %w: read %d of %d", ErrMissingIdentifiers, i, n)
 		}
 
 		logger.V(1).Info("Finished stage 1")
@@ -74,20 +121,18 @@ func (s *Sender) Send(ctx context.Context, n int64, identifiers <-chan []byte) e
 	stage2 := func() error {
 		logger.V(1).Info("Starting stage 2")
 
-		reader, err := NewMultiplyParallelReader(s.rw, gr)
+		reader, err := NewLimitedMultiplyParallelReader(rw, gr, l)
 		if err != nil {
 			return err
 		}
-		writer, err := NewWriter(s.rw, reader.Max())
+		writer, err := NewWriter(rw, reader.Max())
 		if err != nil {
 			return err
 		}
 		for i := int64(0); i < reader.Max(); i++ {
 			var p [EncodedLen]byte
 			if err := reader.Read(&p); err != nil {
-				if err != io.EOF {
-					return err
-				}
+				return fmt.Errorf("stage2: %w", err)
 			}
 			if err := writer.Write(p); err != nil {
 				return fmt.Errorf("stage2: %v", err)
@@ -99,11 +144,11 @@ func (s *Sender) Send(ctx context.Context, n int64, identifiers <-chan []byte) e
 	}
 
 	// run stage1
-	if err := util.Sel(ctx, stage1); err != nil {
+	if err := util.Sel(ctx, l.StageTimeout, stage1); err != nil {
 		return err
 	}
 	// run stage2
-	if err := util.Sel(ctx, stage2); err != nil {
+	if err := util.Sel(ctx, l.StageTimeout, stage2); err != nil {
 		return err
 	}
 
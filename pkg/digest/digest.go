@@ -0,0 +1,128 @@
+// Package digest selects the length of the digests compared by the kkrtpsi,
+// npsi and volepsi protocols, and bounds the false positives they cause. Two
+// different identifiers whose digests collide are reported as a match, a
+// match between n1 and n2 identifiers with digests of l bytes is expected
+// to report n1 * n2 * 2^(-8l) false positives.
+//
+// The sender picks the length from the cardinalities of both sets, so that
+// at most 2^-StatisticalSecurity false positives are expected, and announces
+// it to the receiver. A length can be set with options.WithDigestLen
+// instead: on the sender, it replaces the automatic length, and on the
+// receiver, it is the minimum length accepted from the sender.
+package digest
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+
+	"github.com/go-logr/logr"
+)
+
+const (
+	// StatisticalSecurity is the statistical security parameter, in bits,
+	// of the automatic length: a match is expected to report at most
+	// 2^-StatisticalSecurity false positives
+	StatisticalSecurity = 40
+	// MaxLen is the maximum length in bytes of digests
+	MaxLen = 16
+	// MaxClass is the size class of the largest sets, see Class
+	MaxClass = 63
+)
+
+var (
+	// ErrInvalidLen is returned for a length outside of [1, MaxLen]
+	ErrInvalidLen = errors.New("digest length is out of range")
+	// ErrLenTooShort is returned by a receiver when the sender
+	// announces digests shorter than the configured length
+	ErrLenTooShort = errors.New("peer announced digests shorter than the configured length")
+)
+
+// required returns the length in bytes of the digests of
+// a match between n1 and n2 identifiers, regardless of MaxLen
+func required(n1, n2 int64) int {
+	return (StatisticalSecurity + log2(n1) + log2(n2) + 7) / 8
+}
+
+// log2 returns the base 2 logarithm of n rounded up, 0 for n <= 1
+func log2(n int64) int {
+	if n <= 1 {
+		return 0
+	}
+	return bits.Len64(uint64(n - 1))
+}
+
+// Class returns the size class of a set of n identifiers: the base 2
+// logarithm of n rounded up, at most MaxClass. The automatic length only
+// depends on the size class of the sets, so a party can announce its
+// size class instead of its size: Len(ClassSize(Class(n1)), n2) is
+// Len(n1, n2).
+func Class(n int64) int {
+	return log2(n)
+}
+
+// ClassSize returns the largest size of the size class c, 2^c,
+// capped to math.MaxInt64, and 0 for a negative class
+func ClassSize(c int) int64 {
+	switch {
+	case c < 0:
+		return 0
+	case c >= MaxClass:
+		return math.MaxInt64
+	}
+	return 1 << c
+}
+
+// Len returns the automatic length in bytes of the digests of a match between
+// n1 and n2 identifiers: StatisticalSecurity + log2(n1) + log2(n2) bits
+// rounded up, capped to MaxLen.
+func Len(n1, n2 int64) int {
+	return min(required(n1, n2), MaxLen)
+}
+
+// FalsePositives returns the expected number of false positives
+// of a match between n1 and n2 identifiers with digests of l bytes
+func FalsePositives(n1, n2 int64, l int) float64 {
+	return float64(n1) * float64(n2) * math.Exp2(-8*float64(l))
+}
+
+// Select returns the length of the digests sent by a sender of n2
+// identifiers to a receiver of n1 identifiers: l if it is set, or Len(n1, n2)
+func Select(l int, n1, n2 int64) (int, error) {
+	if l == 0 {
+		return Len(n1, n2), nil
+	}
+	return l, check(l)
+}
+
+// Check validates the length l of the digests announced by
+// a sender, against the minimum length want if it is set
+func Check(want, l int) error {
+	if err := check(l); err != nil {
+		return err
+	}
+	if l < want {
+		return fmt.Errorf("%w: %d < %d", ErrLenTooShort, l, want)
+	}
+	return nil
+}
+
+// check returns ErrInvalidLen if l is out of range
+func check(l int) error {
+	if l < 1 || l > MaxLen {
+		return fmt.Errorf("%w: %d", ErrInvalidLen, l)
+	}
+	return nil
+}
+
+// Log logs the length of the digests of a match between n1 and n2 identifiers
+// along with the expected number of false positives, and warns if it is above
+// 2^-StatisticalSecurity
+func Log(logger logr.Logger, n1, n2 int64, l int) {
+	fp := FalsePositives(n1, n2, l)
+	logger.V(1).Info("digests", "length", l, "expected false positives", fp)
+	if l < required(n1, n2) {
+		logger.Info("warning: digests are too short for the set sizes", "length", l, "required length", required(n1, n2), "expected false positives", fp)
+	}
+}
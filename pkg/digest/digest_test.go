@@ -0,0 +1,98 @@
+package digest
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestLen(t *testing.T) {
+	for _, c := range []struct {
+		n1, n2 int64
+		l      int
+	}{
+		{0, 0, 5},
+		{1, 1, 5},
+		{1 << 12, 1 << 12, 8},
+		{1 << 20, 1 << 20, 10},
+		{500_000_000, 500_000_000, 13},
+		{math.MaxInt64, math.MaxInt64, MaxLen},
+	} {
+		if l := Len(c.n1, c.n2); l != c.l {
+			t.Errorf("expected a length of %d bytes for %d x %d, got %d", c.l, c.n1, c.n2, l)
+		}
+		// the automatic length meets the statistical security
+		if c.l < MaxLen && FalsePositives(c.n1, c.n2, c.l) > math.Exp2(-StatisticalSecurity) {
+			t.Errorf("expected at most 2^-%d false positives for %d x %d, got %g", StatisticalSecurity, c.n1, c.n2, FalsePositives(c.n1, c.n2, c.l))
+		}
+	}
+}
+
+func TestFalsePositives(t *testing.T) {
+	// 64 bits digests at 500M x 500M
+	if fp := FalsePositives(500_000_000, 500_000_000, 8); math.Abs(fp-0.01355) > 1e-4 {
+		t.Errorf("expected about 0.01355 false positives, got %g", fp)
+	}
+	if fp := FalsePositives(1<<20, 1<<20, 16); fp != math.Exp2(-88) {
+		t.Errorf("expected 2^-88 false positives, got %g", fp)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	if l, err := Select(0, 1<<20, 1<<20); err != nil || l != 10 {
+		t.Errorf("expected the automatic length, got %d, %v", l, err)
+	}
+	if l, err := Select(MaxLen, 1<<20, 1<<20); err != nil || l != MaxLen {
+		t.Errorf("expected the configured length, got %d, %v", l, err)
+	}
+	for _, l := range []int{-1, MaxLen + 1} {
+		if _, err := Select(l, 1, 1); !errors.Is(err, ErrInvalidLen) {
+			t.Errorf("expected ErrInvalidLen for %d, got %v", l, err)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	for _, l := range []int{0, -1, MaxLen + 1} {
+		if err := Check(0, l); !errors.Is(err, ErrInvalidLen) {
+			t.Errorf("expected ErrInvalidLen for %d, got %v", l, err)
+		}
+	}
+	if err := Check(0, 1); err != nil {
+		t.Errorf("expected no error without a configured length, got %v", err)
+	}
+	if err := Check(12, 11); !errors.Is(err, ErrLenTooShort) {
+		t.Errorf("expected ErrLenTooShort, got %v", err)
+	}
+	if err := Check(12, 12); err != nil {
+		t.Errorf("expected no error at the configured length, got %v", err)
+	}
+}
+
+func TestClass(t *testing.T) {
+	for _, c := range []struct {
+		n int64
+		c int
+	}{
+		{0, 0},
+		{1, 0},
+		{2, 1},
+		{3, 2},
+		{1 << 20, 20},
+		{1<<20 + 1, 21},
+		{math.MaxInt64, MaxClass},
+	} {
+		if class := Class(c.n); class != c.c {
+			t.Errorf("expected the size class %d for %d, got %d", c.c, c.n, class)
+		}
+		// the size class is all the automatic length needs
+		for _, n2 := range []int64{1, 1 << 12, 500_000_000, math.MaxInt64} {
+			if l, want := Len(ClassSize(Class(c.n)), n2), Len(c.n, n2); l != want {
+				t.Errorf("expected a length of %d bytes for the size class of %d x %d, got %d", want, c.n, n2, l)
+			}
+		}
+	}
+	if n := ClassSize(-1); n != 0 {
+		t.Errorf("expected 0 for a negative class, got %d", n)
+	}
+}
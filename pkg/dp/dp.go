@@ -0,0 +1,134 @@
+// Package dp reports the size of intersections with differential privacy,
+// so that repeated matches with crafted sets cannot reveal whether someone
+// is in the set of the receiver. A Counter runs a psi.Receiver, discards the
+// intersection and reports its size with noise calibrated to a privacy loss
+// of Epsilon and Delta, spent from the budget of the partner in a Ledger:
+//
+//	ledger, err := dp.OpenLedger("budgets.json", dp.Params{Epsilon: 1, Delta: 1e-6})
+//	c := dp.Counter{Receiver: receiver, Ledger: ledger, Partner: "acme", Params: dp.Params{Epsilon: 0.1}}
+//	count, err := c.Count(ctx, n, identifiers)
+//	if errors.Is(err, dp.ErrBudgetExhausted) {
+//		...
+//	}
+package dp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/optable/match/pkg/psi"
+)
+
+// A Mechanism is the distribution of the noise
+type Mechanism int
+
+const (
+	// Laplace adds discrete Laplace noise of scale 1/Epsilon, Delta is 0
+	Laplace Mechanism = iota
+	// Gaussian adds discrete Gaussian noise of the smallest scale
+	// that is (Epsilon, Delta) differentially private
+	Gaussian
+)
+
+var (
+	ErrInvalidParams = errors.New("invalid differential privacy parameters")
+	// ErrBudgetExhausted is returned when a query would spend more
+	// than what is left of the privacy budget of a partner
+	ErrBudgetExhausted = errors.New("privacy budget exhausted")
+)
+
+// Params is the privacy loss of a query, or of a budget of queries
+type Params struct {
+	Mechanism Mechanism
+	Epsilon   float64
+	Delta     float64
+}
+
+// Check returns an error if p is not valid for a query
+func (p Params) Check() error {
+	switch {
+	case !(p.Epsilon > 0) || math.IsInf(p.Epsilon, 1):
+		return fmt.Errorf("%w: epsilon %v", ErrInvalidParams, p.Epsilon)
+	case p.Mechanism == Laplace && p.Delta != 0:
+		return fmt.Errorf("%w: delta %v of the Laplace mechanism", ErrInvalidParams, p.Delta)
+	case p.Mechanism == Gaussian && (!(p.Delta > 0) || p.Delta >= 1):
+		return fmt.Errorf("%w: delta %v of the Gaussian mechanism", ErrInvalidParams, p.Delta)
+	case p.Mechanism != Laplace && p.Mechanism != Gaussian:
+		return fmt.Errorf("%w: mechanism %d", ErrInvalidParams, p.Mechanism)
+	}
+	return nil
+}
+
+// sigma is the scale of the discrete Gaussian noise of p, for a
+// sensitivity of 1: the smallest that is (Epsilon, Delta) differentially
+// private by the exact bound of the discrete Gaussian, which is tighter
+// than the calibration of the continuous Gaussian and holds for any Epsilon
+func (p Params) sigma() float64 {
+	return gaussianSigma(p.Epsilon, p.Delta)
+}
+
+// Noise returns count with noise of p, for a sensitivity of 1:
+// adding or removing one identifier changes count by at most 1
+func (p Params) Noise(count int64) (int64, error) {
+	if err := p.Check(); err != nil {
+		return 0, err
+	}
+
+	var noise int64
+	var err error
+	if p.Mechanism == Laplace {
+		scale := new(big.Rat).SetFloat64(p.Epsilon)
+		noise, err = discreteLaplace(scale.Inv(scale))
+	} else {
+		sigma := p.sigma()
+		noise, err = discreteGaussian(new(big.Rat).SetFloat64(sigma * sigma))
+	}
+	return count + noise, err
+}
+
+// A Counter reports the size of the intersections of a psi.Receiver with noise
+type Counter struct {
+	Receiver psi.Receiver
+	// Ledger holds the budget of Partner, which each query spends Params of
+	Ledger  *Ledger
+	Partner string
+	Params  Params
+}
+
+// Count spends the privacy loss of c from the budget of its partner,
+// intersects the n identifiers and returns the size of the intersection
+// with noise, clamped to [0, n]. The budget is spent before the intersection
+// runs, and is not refunded if it fails. The intersection is discarded.
+func (c Counter) Count(ctx context.Context, n int64, identifiers <-chan []byte) (int64, error) {
+	if err := c.Params.Check(); err != nil {
+		return 0, err
+	}
+	if err := c.Ledger.Spend(c.Partner, c.Params); err != nil {
+		return 0, err
+	}
+
+	intersection, err := c.Receiver.Intersect(ctx, n, identifiers)
+	if err != nil {
+		return 0, err
+	}
+	count, err := c.Params.Noise(int64(len(intersection)))
+	if err != nil {
+		return 0, err
+	}
+	if n >= 0 {
+		count = min(count, n)
+	}
+	return max(count, 0), nil
+}
+
+// MatchRate returns the rate of the n identifiers of the receiver
+// matched by the sender, from the noisy count of a Counter
+func MatchRate(count, n int64) float64 {
+	if n <= 0 {
+		return 0
+	}
+	return float64(count) / float64(n)
+}
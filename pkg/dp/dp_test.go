@@ -0,0 +1,142 @@
+package dp
+
+import (
+	"context"
+	"errors"
+	"math"
+	"path/filepath"
+	"testing"
+)
+
+// moments returns the mean and the variance of samples of p
+func moments(t *testing.T, p Params, samples int) (mean, variance float64) {
+	var sum, sum2 float64
+	for i := 0; i < samples; i++ {
+		y, err := p.Noise(0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sum += float64(y)
+		sum2 += float64(y) * float64(y)
+	}
+	mean = sum / float64(samples)
+	return mean, sum2/float64(samples) - mean*mean
+}
+
+func TestNoise(t *testing.T) {
+	const samples = 100000
+	// the variance of the discrete Laplace of scale t is 2e^(-1/t)/(1-e^(-1/t))²
+	p := Params{Epsilon: 0.5}
+	q := math.Exp(-p.Epsilon)
+	want := 2 * q / ((1 - q) * (1 - q))
+	if mean, variance := moments(t, p, samples); math.Abs(mean) > 0.1 || math.Abs(variance-want) > 0.05*want {
+		t.Errorf("laplace: expected a mean of 0 and a variance of %.2f, got %.2f and %.2f", want, mean, variance)
+	}
+
+	// and that of the discrete Gaussian is about σ²
+	p = Params{Mechanism: Gaussian, Epsilon: 1, Delta: 1e-5}
+	want = p.sigma() * p.sigma()
+	if mean, variance := moments(t, p, samples); math.Abs(mean) > 0.1 || math.Abs(variance-want) > 0.05*want {
+		t.Errorf("gaussian: expected a mean of 0 and a variance of %.2f, got %.2f and %.2f", want, mean, variance)
+	}
+
+	for _, p := range []Params{{}, {Epsilon: 1, Delta: 1e-6}, {Mechanism: Gaussian, Epsilon: 1}, {Mechanism: Gaussian, Epsilon: 2, Delta: 1}, {Mechanism: 2, Epsilon: 1}} {
+		if _, err := p.Noise(0); !errors.Is(err, ErrInvalidParams) {
+			t.Errorf("%+v: expected ErrInvalidParams, got %v", p, err)
+		}
+	}
+}
+
+func TestGaussianSigma(t *testing.T) {
+	for _, p := range []Params{{Epsilon: 0.1, Delta: 1e-6}, {Epsilon: 1, Delta: 1e-5}, {Epsilon: 4, Delta: 1e-9}} {
+		sigma := p.sigma()
+		// the scale is the smallest that meets delta
+		if delta := gaussianDelta(p.Epsilon, sigma); delta > p.Delta {
+			t.Errorf("%+v: sigma %v gives delta %v", p, sigma, delta)
+		}
+		if delta := gaussianDelta(p.Epsilon, 0.99*sigma); delta <= p.Delta {
+			t.Errorf("%+v: sigma %v is not the smallest, delta %v at 0.99σ", p, sigma, delta)
+		}
+		// and it is below the calibration of the continuous Gaussian
+		if continuous := math.Sqrt(2*math.Log(1.25/p.Delta)) / p.Epsilon; p.Epsilon <= 1 && sigma > continuous {
+			t.Errorf("%+v: sigma %v is above the continuous %v", p, sigma, continuous)
+		}
+	}
+}
+
+func TestLedger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "budgets.json")
+	budget := Params{Epsilon: 1, Delta: 1e-5}
+	l, err := OpenLedger(path, budget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if err := l.Spend("acme", Params{Epsilon: 0.1}); err != nil {
+			t.Fatalf("query %d: %v", i, err)
+		}
+	}
+	if err := l.Spend("acme", Params{Epsilon: 0.1}); !errors.Is(err, ErrBudgetExhausted) {
+		t.Errorf("expected ErrBudgetExhausted, got %v", err)
+	}
+	// the budgets are per partner
+	if err := l.Spend("other", Params{Mechanism: Gaussian, Epsilon: 0.5, Delta: 1e-5}); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Spend("other", Params{Mechanism: Gaussian, Epsilon: 0.1, Delta: 1e-6}); !errors.Is(err, ErrBudgetExhausted) {
+		t.Errorf("expected ErrBudgetExhausted on delta, got %v", err)
+	}
+
+	// and survive a restart
+	l, err = OpenLedger(path, budget)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := l.Spent("acme"); s.Queries != 10 || math.Abs(s.Epsilon-1) > 1e-9 {
+		t.Errorf("expected 10 queries spending epsilon 1, got %+v", s)
+	}
+	if err := l.Spend("acme", Params{Epsilon: 0.1}); !errors.Is(err, ErrBudgetExhausted) {
+		t.Errorf("expected ErrBudgetExhausted after a restart, got %v", err)
+	}
+}
+
+// intersector is a psi.Receiver intersecting with a fixed set
+type intersector map[string]bool
+
+func (s intersector) Intersect(ctx context.Context, n int64, identifiers <-chan []byte) (intersection [][]byte, err error) {
+	for identifier := range identifiers {
+		if s[string(identifier)] {
+			intersection = append(intersection, identifier)
+		}
+	}
+	return intersection, nil
+}
+
+func feed(identifiers ...string) <-chan []byte {
+	c := make(chan []byte, len(identifiers))
+	for _, identifier := range identifiers {
+		c <- []byte(identifier)
+	}
+	close(c)
+	return c
+}
+
+func TestCounter(t *testing.T) {
+	l, err := OpenLedger(filepath.Join(t.TempDir(), "budgets.json"), Params{Epsilon: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := Counter{Receiver: intersector{"a": true, "b": true}, Ledger: l, Partner: "acme", Params: Params{Epsilon: 0.5}}
+	for i := 0; i < 2; i++ {
+		count, err := c.Count(context.Background(), 3, feed("a", "b", "c"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if count < 0 || count > 3 {
+			t.Errorf("expected a count clamped to [0, 3], got %d", count)
+		}
+	}
+	if _, err := c.Count(context.Background(), 3, feed("a", "b", "c")); !errors.Is(err, ErrBudgetExhausted) {
+		t.Errorf("expected ErrBudgetExhausted, got %v", err)
+	}
+}
@@ -0,0 +1,121 @@
+package dp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// tolerance absorbs the rounding errors of the sums of privacy losses
+const tolerance = 1e-9
+
+// Spent is the privacy loss spent by the queries of a partner,
+// summed by basic composition
+type Spent struct {
+	Epsilon float64   `json:"epsilon"`
+	Delta   float64   `json:"delta"`
+	Queries int64     `json:"queries"`
+	Last    time.Time `json:"last"`
+}
+
+// A Ledger tracks the privacy budget spent by each partner in a JSON file,
+// which is rewritten atomically on each query so that the budget survives
+// restarts. A Ledger is safe for concurrent use, but a file must not be
+// opened by more than one Ledger at a time.
+type Ledger struct {
+	path   string
+	budget Params
+
+	mu    sync.Mutex
+	spent map[string]Spent
+}
+
+// OpenLedger opens the ledger in the file at path, which is created on the
+// first query if it does not exist. budget is the privacy loss each partner
+// may spend, its Mechanism is ignored.
+func OpenLedger(path string, budget Params) (*Ledger, error) {
+	if !(budget.Epsilon > 0) || budget.Delta < 0 || budget.Delta >= 1 {
+		return nil, fmt.Errorf("%w: budget of epsilon %v and delta %v", ErrInvalidParams, budget.Epsilon, budget.Delta)
+	}
+
+	l := &Ledger{path: path, budget: budget, spent: make(map[string]Spent)}
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return l, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &l.spent); err != nil {
+		return nil, fmt.Errorf("ledger %s: %w", path, err)
+	}
+	return l, nil
+}
+
+// Spent returns the privacy loss spent by partner
+func (l *Ledger) Spent(partner string) Spent {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.spent[partner]
+}
+
+// Spend records the privacy loss of a query of partner, or returns
+// ErrBudgetExhausted if it would exceed the budget of partner
+func (l *Ledger) Spend(partner string, p Params) error {
+	if err := p.Check(); err != nil {
+		return err
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	s := l.spent[partner]
+	if s.Epsilon+p.Epsilon > l.budget.Epsilon*(1+tolerance) || s.Delta+p.Delta > l.budget.Delta*(1+tolerance) {
+		return fmt.Errorf("%w: partner %s spent epsilon %v and delta %v of %v and %v", ErrBudgetExhausted, partner, s.Epsilon, s.Delta, l.budget.Epsilon, l.budget.Delta)
+	}
+
+	s.Epsilon += p.Epsilon
+	s.Delta += p.Delta
+	s.Queries++
+	s.Last = time.Now().UTC()
+	previous, ok := l.spent[partner]
+	l.spent[partner] = s
+	if err := l.save(); err != nil {
+		// the query is refused if it cannot be recorded
+		if ok {
+			l.spent[partner] = previous
+		} else {
+			delete(l.spent, partner)
+		}
+		return err
+	}
+	return nil
+}
+
+// save writes the ledger to a temporary file renamed over its file
+func (l *Ledger) save() error {
+	b, err := json.MarshalIndent(l.spent, "", "  ")
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(l.path), filepath.Base(l.path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), l.path)
+}
@@ -0,0 +1,173 @@
+package dp
+
+import (
+	"crypto/rand"
+	"errors"
+	"math"
+	"math/big"
+)
+
+// The samplers follow "The Discrete Gaussian for Differential Privacy",
+// Canonne, Kamath and Steinke, 2020: they only draw uniform integers from
+// crypto/rand and compare rationals, so that the distributions are exact,
+// unlike sampling through floating point logarithms.
+
+var one = big.NewRat(1, 1)
+
+// errNoiseOverflow is returned for a sample beyond the range of int64,
+// which only happens with a negligible probability for any epsilon
+var errNoiseOverflow = errors.New("noise sample overflows int64")
+
+// bernoulli samples true with probability p, in [0, 1]
+func bernoulli(p *big.Rat) (bool, error) {
+	u, err := rand.Int(rand.Reader, p.Denom())
+	if err != nil {
+		return false, err
+	}
+	return u.Cmp(p.Num()) < 0, nil
+}
+
+// bernoulliExp samples true with probability exp(-gamma), gamma >= 0
+func bernoulliExp(gamma *big.Rat) (bool, error) {
+	if gamma.Cmp(one) <= 0 {
+		// the parity of the index of the first failure
+		// of Bernoulli trials of probability gamma/k
+		k := int64(1)
+		for ; ; k++ {
+			a, err := bernoulli(new(big.Rat).Quo(gamma, big.NewRat(k, 1)))
+			if err != nil || !a {
+				return k%2 == 1, err
+			}
+		}
+	}
+
+	// exp(-gamma) = exp(-1)^floor(gamma) * exp(-(gamma - floor(gamma)))
+	floor := new(big.Int).Quo(gamma.Num(), gamma.Denom())
+	for i := new(big.Int); i.Cmp(floor) < 0; i.Add(i, big.NewInt(1)) {
+		b, err := bernoulliExp(one)
+		if err != nil || !b {
+			return false, err
+		}
+	}
+	return bernoulliExp(new(big.Rat).Sub(gamma, new(big.Rat).SetInt(floor)))
+}
+
+// discreteLaplace samples the discrete Laplace distribution of scale t/s,
+// of probability proportional to exp(-|y|s/t) at each integer y
+func discreteLaplace(scale *big.Rat) (int64, error) {
+	t, s := scale.Num(), scale.Denom()
+	for {
+		// X = U + tV is geometric of parameter 1-exp(-1/t), sampled
+		// as its remainder U modulo t and its quotient V by t
+		u, err := rand.Int(rand.Reader, t)
+		if err != nil {
+			return 0, err
+		}
+		d, err := bernoulliExp(new(big.Rat).SetFrac(u, t))
+		if err != nil {
+			return 0, err
+		}
+		if !d {
+			continue
+		}
+		v := new(big.Int)
+		for {
+			a, err := bernoulliExp(one)
+			if err != nil {
+				return 0, err
+			}
+			if !a {
+				break
+			}
+			v.Add(v, big.NewInt(1))
+		}
+		x := v.Mul(v, t).Add(v, u)
+
+		// Y = floor(X/s) is geometric of parameter 1-exp(-s/t),
+		// and given a random sign, -0 is rejected
+		y := x.Quo(x, s)
+		negative, err := bernoulli(big.NewRat(1, 2))
+		if err != nil {
+			return 0, err
+		}
+		if negative && y.Sign() == 0 {
+			continue
+		}
+		if !y.IsInt64() {
+			return 0, errNoiseOverflow
+		}
+		if negative {
+			return -y.Int64(), nil
+		}
+		return y.Int64(), nil
+	}
+}
+
+// discreteGaussian samples the discrete Gaussian distribution of variance
+// parameter sigma2, of probability proportional to exp(-y²/2σ²) at each
+// integer y, by rejection from a discrete Laplace of scale floor(σ) + 1
+func discreteGaussian(sigma2 *big.Rat) (int64, error) {
+	floor := new(big.Int).Quo(sigma2.Num(), sigma2.Denom())
+	t := new(big.Rat).SetInt(floor.Sqrt(floor).Add(floor, big.NewInt(1)))
+	// the mode of the rejected |y|: σ²/t
+	mode := new(big.Rat).Quo(sigma2, t)
+	twoSigma2 := new(big.Rat).Add(sigma2, sigma2)
+	for {
+		y, err := discreteLaplace(t)
+		if err != nil {
+			return 0, err
+		}
+		// accept with probability exp(-(|y| - σ²/t)²/2σ²)
+		d := new(big.Rat).SetInt64(y)
+		d.Abs(d).Sub(d, mode)
+		gamma := d.Mul(d, d).Quo(d, twoSigma2)
+		c, err := bernoulliExp(gamma)
+		if err != nil {
+			return 0, err
+		}
+		if c {
+			return y, nil
+		}
+	}
+}
+
+// gaussianDelta returns the smallest delta for which adding discrete Gaussian
+// noise of scale sigma to a count of sensitivity 1 is (epsilon, delta)
+// differentially private, from Theorem 7 of Canonne, Kamath and Steinke:
+// P[Y > εσ² - 1/2] - e^ε P[Y > εσ² + 1/2] for Y of the discrete Gaussian
+func gaussianDelta(epsilon, sigma float64) float64 {
+	// the probabilities are summed up to 40σ past
+	// the thresholds, where they are negligible
+	var mass, above, farAbove float64
+	lo, hi := epsilon*sigma*sigma-0.5, epsilon*sigma*sigma+0.5
+	bound := math.Ceil(hi + 40*sigma)
+	for y := -bound; y <= bound; y++ {
+		p := math.Exp(-y * y / (2 * sigma * sigma))
+		mass += p
+		if y > lo {
+			above += p
+		}
+		if y > hi {
+			farAbove += p
+		}
+	}
+	return (above - math.Exp(epsilon)*farAbove) / mass
+}
+
+// gaussianSigma returns the smallest scale, within 10^-9, of the discrete
+// Gaussian noise of a count of sensitivity 1 that is (epsilon, delta)
+// differentially private
+func gaussianSigma(epsilon, delta float64) float64 {
+	lo, hi := 0.0, 1.0
+	for gaussianDelta(epsilon, hi) > delta {
+		lo, hi = hi, 2*hi
+	}
+	for hi-lo > 1e-9*hi {
+		if mid := (lo + hi) / 2; gaussianDelta(epsilon, mid) > delta {
+			lo = mid
+		} else {
+			hi = mid
+		}
+	}
+	return hi
+}
@@ -0,0 +1,108 @@
+package input
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+const (
+	// IndexSuffix is appended to the path of a file to name its sidecar
+	// index, which holds the number of identifiers of the file in decimal
+	IndexSuffix = ".count"
+	// ManifestName is the name of the manifest of a directory, a JSON
+	// object mapping the names of its files to their number of identifiers:
+	//
+	//	{"drop.csv.gz": {"count": 1000000}}
+	ManifestName = "manifest.json"
+)
+
+var ErrInvalidIndex = errors.New("invalid count index")
+
+type manifestEntry struct {
+	Count *int64 `json:"count"`
+}
+
+// Count returns the number of identifiers of the file at path, read from its
+// sidecar index, or else from the manifest of its directory, or else counted
+// with a full pass over the file
+func Count(path string, opts Options) (int64, error) {
+	if n, ok, err := indexCount(path); ok || err != nil {
+		return n, err
+	}
+	if n, ok, err := manifestCount(path); ok || err != nil {
+		return n, err
+	}
+
+	r, err := Open(path, opts)
+	if err != nil {
+		return 0, err
+	}
+	defer r.Close()
+	return r.Count()
+}
+
+// Count counts the remaining identifiers of r, reading it to exhaustion
+func (r *Reader) Count() (int64, error) {
+	var n int64
+	for {
+		if _, err := r.Read(); err == io.EOF {
+			return n, nil
+		} else if err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+// WriteIndex writes the sidecar index of the file at path holding n identifiers
+func WriteIndex(path string, n int64) error {
+	return os.WriteFile(path+IndexSuffix, []byte(strconv.FormatInt(n, 10)+"\n"), 0644)
+}
+
+// indexCount reads the sidecar index of the file at path, if it exists
+func indexCount(path string) (int64, bool, error) {
+	b, err := os.ReadFile(path + IndexSuffix)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+
+	n, err := strconv.ParseInt(strings.TrimSpace(string(b)), 10, 64)
+	if err != nil || n < 0 {
+		return 0, false, fmt.Errorf("%w: %s%s", ErrInvalidIndex, path, IndexSuffix)
+	}
+	return n, true, nil
+}
+
+// manifestCount reads the count of the file at path from the
+// manifest of its directory, if it exists and lists the file
+func manifestCount(path string) (int64, bool, error) {
+	manifest := filepath.Join(filepath.Dir(path), ManifestName)
+	b, err := os.ReadFile(manifest)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+
+	var entries map[string]manifestEntry
+	if err := json.Unmarshal(b, &entries); err != nil {
+		return 0, false, fmt.Errorf("%w: %s: %v", ErrInvalidIndex, manifest, err)
+	}
+	entry, ok := entries[filepath.Base(path)]
+	if !ok || entry.Count == nil {
+		return 0, false, nil
+	}
+	if *entry.Count < 0 {
+		return 0, false, fmt.Errorf("%w: %s", ErrInvalidIndex, manifest)
+	}
+	return *entry.Count, true, nil
+}
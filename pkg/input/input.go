@@ -0,0 +1,327 @@
+// Package input reads the identifiers of a party from newline-separated,
+// CSV or NDJSON files, optionally compressed with gzip or zstd, without
+// decompressing them to disk first:
+//
+//	opts := input.Options{Format: input.CSV, Header: true, Column: "email"}
+//	n, err := input.Count("drop.csv.gz", opts)
+//	r, err := input.Open("drop.csv.gz", opts)
+//	defer r.Close()
+//	err = sender.Send(ctx, n, r.Identifiers(n))
+//
+// Count reads the number of identifiers of a file from its sidecar index or
+// from the manifest of its directory when there is one, and counts them with
+// a full pass otherwise.
+package input
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// A Format is the layout of the identifiers of a file
+type Format int
+
+const (
+	// Lines holds one identifier per \n terminated line
+	Lines Format = iota
+	// CSV holds the identifiers in a column of comma-separated values
+	CSV
+	// NDJSON holds the identifiers in a field of newline-delimited JSON objects
+	NDJSON
+)
+
+// A Compression is the compression of a file
+type Compression int
+
+const (
+	// Detect detects gzip and zstd from the magic number of the file
+	Detect Compression = iota
+	// None reads the file as is
+	None
+	Gzip
+	Zstd
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+var (
+	ErrUnsupportedFormat = errors.New("unsupported input format")
+	ErrColumn            = errors.New("csv column not found")
+	ErrField             = errors.New("ndjson field is not a string")
+	// ErrCount is returned when the input does not hold
+	// the number of identifiers it was announced to hold
+	ErrCount = errors.New("number of identifiers does not match the count")
+)
+
+// Options configures the reading of a file
+type Options struct {
+	Format      Format
+	Compression Compression
+	// Comma is the CSV field delimiter, ',' if zero
+	Comma rune
+	// Header skips the first CSV row, which names the columns
+	Header bool
+	// Column is the name of the CSV column of the identifiers, which
+	// requires Header. ColumnIndex, zero-based, is used when it is empty.
+	Column      string
+	ColumnIndex int
+	// Field is the dot-separated path of the NDJSON field
+	// of the identifiers, such as "user.email"
+	Field string
+}
+
+// A Reader reads the identifiers of a file. Empty identifiers, such as
+// blank lines, empty CSV cells and missing or null NDJSON fields, are
+// skipped, and are not counted.
+type Reader struct {
+	next    func() ([]byte, error)
+	closers []io.Closer
+	// done is closed when Identifiers returns
+	done chan struct{}
+	err  error
+}
+
+// Open opens the file at path for reading its identifiers
+func Open(path string, opts Options) (*Reader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := NewReader(f, opts)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	r.closers = append(r.closers, f)
+	return r, nil
+}
+
+// NewReader returns a Reader of the identifiers of src
+func NewReader(src io.Reader, opts Options) (*Reader, error) {
+	r := &Reader{}
+	in, err := r.decompress(bufio.NewReader(src), opts.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	switch opts.Format {
+	case Lines:
+		r.next = lines(in)
+	case CSV:
+		r.next, err = column(in, opts)
+	case NDJSON:
+		r.next = field(in, opts.Field)
+	default:
+		err = ErrUnsupportedFormat
+	}
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// decompress wraps src in the decompressor of c
+func (r *Reader) decompress(src *bufio.Reader, c Compression) (*bufio.Reader, error) {
+	if c == Detect {
+		c = None
+		// a short or empty file is not compressed
+		if magic, _ := src.Peek(len(zstdMagic)); bytes.HasPrefix(magic, gzipMagic) {
+			c = Gzip
+		} else if bytes.Equal(magic, zstdMagic) {
+			c = Zstd
+		}
+	}
+
+	switch c {
+	case None:
+		return src, nil
+	case Gzip:
+		z, err := gzip.NewReader(src)
+		if err != nil {
+			return nil, err
+		}
+		r.closers = append(r.closers, z)
+		return bufio.NewReader(z), nil
+	case Zstd:
+		z, err := zstd.NewReader(src)
+		if err != nil {
+			return nil, err
+		}
+		r.closers = append(r.closers, z.IOReadCloser())
+		return bufio.NewReader(z), nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %d", c)
+	}
+}
+
+// lines reads \n terminated lines, dropping a trailing \r
+func lines(in *bufio.Reader) func() ([]byte, error) {
+	return func() ([]byte, error) {
+		line, err := in.ReadBytes('\n')
+		line = bytes.TrimSuffix(bytes.TrimSuffix(line, []byte("\n")), []byte("\r"))
+		if err == io.EOF && len(line) > 0 {
+			// the last line is not terminated
+			err = nil
+		}
+		return line, err
+	}
+}
+
+// column reads the selected column of CSV rows
+func column(in *bufio.Reader, opts Options) (func() ([]byte, error), error) {
+	c := csv.NewReader(in)
+	if opts.Comma != 0 {
+		c.Comma = opts.Comma
+	}
+	c.FieldsPerRecord = -1
+	c.ReuseRecord = true
+
+	i := opts.ColumnIndex
+	if opts.Header {
+		header, err := c.Read()
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if opts.Column != "" {
+			i = -1
+			for j, name := range header {
+				if strings.TrimSpace(name) == opts.Column {
+					i = j
+					break
+				}
+			}
+			if i < 0 {
+				return nil, fmt.Errorf("%w: %q", ErrColumn, opts.Column)
+			}
+		}
+	} else if opts.Column != "" {
+		return nil, fmt.Errorf("%w: column %q requires a header", ErrColumn, opts.Column)
+	}
+	if i < 0 {
+		return nil, fmt.Errorf("%w: index %d", ErrColumn, i)
+	}
+
+	return func() ([]byte, error) {
+		row, err := c.Read()
+		if err != nil {
+			return nil, err
+		}
+		if i >= len(row) {
+			line, _ := c.FieldPos(0)
+			return nil, fmt.Errorf("%w: line %d has %d columns", ErrColumn, line, len(row))
+		}
+		return []byte(row[i]), nil
+	}, nil
+}
+
+// field reads the field at path of NDJSON objects
+func field(in *bufio.Reader, path string) func() ([]byte, error) {
+	d := json.NewDecoder(in)
+	d.UseNumber()
+	keys := strings.Split(path, ".")
+	var record int64
+	return func() ([]byte, error) {
+		var v any
+		if err := d.Decode(&v); err != nil {
+			return nil, err
+		}
+		record++
+		for _, key := range keys {
+			object, ok := v.(map[string]any)
+			if !ok {
+				return nil, nil
+			}
+			v = object[key]
+		}
+
+		switch v := v.(type) {
+		case nil:
+			return nil, nil
+		case string:
+			return []byte(v), nil
+		case json.Number:
+			return []byte(v), nil
+		default:
+			return nil, fmt.Errorf("%w: %q of record %d", ErrField, path, record)
+		}
+	}
+}
+
+// Read returns the next identifier, or io.EOF after the last one
+func (r *Reader) Read() ([]byte, error) {
+	for {
+		identifier, err := r.next()
+		if err != nil {
+			return nil, err
+		}
+		if len(identifier) != 0 {
+			return identifier, nil
+		}
+	}
+}
+
+// Identifiers reads the n identifiers of r in the returned channel, which
+// is closed after the last one or on error. An input holding more or fewer
+// than n identifiers is an error, which is then returned by Err.
+func (r *Reader) Identifiers(n int64) <-chan []byte {
+	var identifiers = make(chan []byte)
+	r.done = make(chan struct{})
+	go func() {
+		defer close(r.done)
+		defer close(identifiers)
+		for i := int64(0); i < n; i++ {
+			identifier, err := r.Read()
+			if err == io.EOF {
+				r.err = fmt.Errorf("%w: read %d of %d identifiers", ErrCount, i, n)
+				return
+			} else if err != nil {
+				r.err = err
+				return
+			}
+			identifiers <- identifier
+		}
+		if _, err := r.Read(); err == nil {
+			r.err = fmt.Errorf("%w: more than %d identifiers", ErrCount, n)
+		} else if err != io.EOF {
+			r.err = err
+		}
+	}()
+
+	return identifiers
+}
+
+// Err returns the error of Identifiers, waiting for it to check that the
+// input holds no more than n identifiers. It must only be called once the
+// n identifiers were received or the channel of Identifiers was closed.
+func (r *Reader) Err() error {
+	if r.done != nil {
+		<-r.done
+	}
+	return r.err
+}
+
+// Close closes the decompressors and the file of r
+func (r *Reader) Close() error {
+	var err error
+	for i := len(r.closers) - 1; i >= 0; i-- {
+		if cerr := r.closers[i].Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
@@ -0,0 +1,147 @@
+package input
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func readAll(t *testing.T, src []byte, opts Options) ([]string, error) {
+	t.Helper()
+	r, err := NewReader(bytes.NewReader(src), opts)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	n, err := NewReader(bytes.NewReader(src), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := n.Count()
+	if err != nil {
+		return nil, err
+	}
+
+	var got []string
+	for identifier := range r.Identifiers(count) {
+		got = append(got, string(identifier))
+	}
+	return got, r.Err()
+}
+
+func gzipped(b []byte) []byte {
+	var buf bytes.Buffer
+	z := gzip.NewWriter(&buf)
+	z.Write(b)
+	z.Close()
+	return buf.Bytes()
+}
+
+func zstded(b []byte) []byte {
+	z, _ := zstd.NewWriter(nil)
+	defer z.Close()
+	return z.EncodeAll(b, nil)
+}
+
+func TestFormats(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		src  string
+		opts Options
+		want []string
+	}{
+		{"lines", "a\r\nb\n\nc", Options{}, []string{"a", "b", "c"}},
+		{"csv", "id,email\n1,a@b.c\n2,\n3,\"d@e.f\"\n", Options{Format: CSV, Header: true, Column: "email"}, []string{"a@b.c", "d@e.f"}},
+		{"csv index", "1;a@b.c\n2;d@e.f\n", Options{Format: CSV, Comma: ';', ColumnIndex: 1}, []string{"a@b.c", "d@e.f"}},
+		{"ndjson", `{"user":{"email":"a@b.c"}}
+{"user":{}}
+{"user":null}
+{"user":{"email":"d@e.f"}}`, Options{Format: NDJSON, Field: "user.email"}, []string{"a@b.c", "d@e.f"}},
+	} {
+		for _, c := range []struct {
+			name     string
+			compress func([]byte) []byte
+		}{
+			{"plain", func(b []byte) []byte { return b }},
+			{"gzip", gzipped},
+			{"zstd", zstded},
+		} {
+			got, err := readAll(t, c.compress([]byte(test.src)), test.opts)
+			if err != nil {
+				t.Errorf("%s %s: %v", c.name, test.name, err)
+			} else if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("%s %s: expected %q, got %q", c.name, test.name, test.want, got)
+			}
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	if _, err := readAll(t, []byte("id\n"), Options{Format: CSV, Header: true, Column: "email"}); !errors.Is(err, ErrColumn) {
+		t.Errorf("expected ErrColumn, got %v", err)
+	}
+	if _, err := readAll(t, []byte("a,b\nc\n"), Options{Format: CSV, ColumnIndex: 1}); !errors.Is(err, ErrColumn) {
+		t.Errorf("expected ErrColumn, got %v", err)
+	}
+	if _, err := readAll(t, []byte(`{"email":["a@b.c"]}`), Options{Format: NDJSON, Field: "email"}); !errors.Is(err, ErrField) {
+		t.Errorf("expected ErrField, got %v", err)
+	}
+
+	// the reader holds fewer identifiers than announced
+	r, _ := NewReader(bytes.NewReader([]byte("a\nb\n")), Options{})
+	for range r.Identifiers(3) {
+	}
+	if !errors.Is(r.Err(), ErrCount) {
+		t.Errorf("expected ErrCount, got %v", r.Err())
+	}
+	// or more
+	r, _ = NewReader(bytes.NewReader([]byte("a\nb\n")), Options{})
+	for range r.Identifiers(1) {
+	}
+	if !errors.Is(r.Err(), ErrCount) {
+		t.Errorf("expected ErrCount, got %v", r.Err())
+	}
+}
+
+func TestCount(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "drop.csv.gz")
+	if err := os.WriteFile(path, gzipped([]byte("email\na@b.c\nd@e.f\n")), 0644); err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{Format: CSV, Header: true, Column: "email"}
+
+	// counted with a full pass
+	if n, err := Count(path, opts); err != nil || n != 2 {
+		t.Errorf("expected 2 identifiers, got %d, %v", n, err)
+	}
+
+	// read from the manifest
+	if err := os.WriteFile(filepath.Join(dir, ManifestName), []byte(`{"drop.csv.gz": {"count": 3}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := Count(path, opts); err != nil || n != 3 {
+		t.Errorf("expected 3 identifiers from the manifest, got %d, %v", n, err)
+	}
+
+	// the sidecar index has precedence
+	if err := WriteIndex(path, 4); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := Count(path, opts); err != nil || n != 4 {
+		t.Errorf("expected 4 identifiers from the index, got %d, %v", n, err)
+	}
+
+	if err := os.WriteFile(path+IndexSuffix, []byte("four"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Count(path, opts); !errors.Is(err, ErrInvalidIndex) {
+		t.Errorf("expected ErrInvalidIndex, got %v", err)
+	}
+}
@@ -1,36 +1,212 @@
 package kkrtpsi
 
 import (
+	"bytes"
+	"crypto/rand"
 	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
 	"math"
+	mrand "math/rand/v2"
 	"runtime"
+	"sync"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/optable/match/internal/cuckoo"
 	"github.com/optable/match/internal/hash"
 	"github.com/optable/match/internal/oprf"
+	"github.com/optable/match/internal/ot"
+	"github.com/optable/match/pkg/digest"
+	"github.com/optable/match/pkg/limits"
+	"github.com/optable/match/pkg/options"
+	"github.com/zeebo/blake3"
 )
 
-// HashRead reads one hash
-func EncodingsRead(r io.Reader, u *[cuckoo.Nhash]uint64) error {
-	return binary.Read(r, binary.BigEndian, u)
+// encoding is the hash of an OPRF encoding truncated to the
+// digest length, and zero padded to digest.MaxLen
+type encoding [digest.MaxLen]byte
+
+// ErrInvalidStash is returned when the receiver announces
+// more stashed items than the slots of its stash
+var ErrInvalidStash = errors.New("invalid number of stashed items")
+
+// ErrConsistencyCheck is returned by a sender created with NewKOSSender
+// when the receiver did not run the OPRF with consistent inputs
+var ErrConsistencyCheck = ot.ErrConsistencyCheck
+
+// newOPRF returns the OPRF of m inputs running baseOT and expanding its
+// seeds with generator, secure against a malicious receiver if kos is set
+func newOPRF(m int, kos bool, generator options.PRG, baseOT options.BaseOT) (o *oprf.OPRF, err error) {
+	if kos {
+		o, err = oprf.NewKOSOPRF(m, int(baseOT))
+	} else {
+		o, err = oprf.NewOPRFWithBaseOT(m, int(baseOT))
+	}
+	if err != nil {
+		return nil, err
+	}
+	o.SetPRG(generator)
+	return o, nil
+}
+
+// cuckooParams returns the cuckoo hash table parameters selected
+// by c, the hash function is selected separately
+func cuckooParams(c options.Cuckoo) cuckoo.Params {
+	var params = cuckoo.DefaultParams
+	if c.Nhash != 0 {
+		params.Nhash = c.Nhash
+	}
+	if c.Factor != 0 {
+		params.Factor = c.Factor
+	}
+	switch {
+	case c.StashSize < 0:
+		params.StashSize = 0
+	case c.StashSize > 0:
+		params.StashSize = c.StashSize
+	}
+	return params
+}
+
+// paramsWrite writes cuckoo hash table parameters out
+func paramsWrite(w io.Writer, p cuckoo.Params) error {
+	return binary.Write(w, binary.BigEndian, struct {
+		Nhash, StashSize int64
+		Factor           float64
+		Hasher           uint8
+	}{int64(p.Nhash), int64(p.StashSize), p.Factor, uint8(p.Hasher)})
+}
+
+// paramsRead reads cuckoo hash table parameters
+func paramsRead(r io.Reader, p *cuckoo.Params) error {
+	var params struct {
+		Nhash, StashSize int64
+		Factor           float64
+		Hasher           uint8
+	}
+	if err := binary.Read(r, binary.BigEndian, &params); err != nil {
+		return err
+	}
+	*p = cuckoo.Params{Nhash: int(params.Nhash), StashSize: int(params.StashSize), Factor: params.Factor, Hasher: hash.ID(params.Hasher)}
+	return nil
+}
+
+// sizeRead reads the number of items of the remote
+// party, and validates it against l
+func sizeRead(r io.Reader, l limits.Limits, n *int64) error {
+	if err := binary.Read(r, binary.BigEndian, n); err != nil {
+		return err
+	}
+	return l.CheckCardinality(*n)
+}
+
+// oprfWrite writes the pseudorandom generator and the base OT of the OPRF out
+func oprfWrite(w io.Writer, generator options.PRG, baseOT options.BaseOT) error {
+	return binary.Write(w, binary.BigEndian, [2]uint8{uint8(generator), uint8(baseOT)})
+}
+
+// oprfRead reads the pseudorandom generator and the base OT of the OPRF
+func oprfRead(r io.Reader, generator *options.PRG, baseOT *options.BaseOT) error {
+	var u [2]uint8
+	if err := binary.Read(r, binary.BigEndian, &u); err != nil {
+		return err
+	}
+	*generator, *baseOT = options.PRG(u[0]), options.BaseOT(u[1])
+	return nil
+}
+
+// stashWrite writes the number of items in the stash out
+func stashWrite(w io.Writer, stashed int) error {
+	return binary.Write(w, binary.BigEndian, uint8(stashed))
+}
+
+// stashRead reads the number of items in the stash, and
+// validates it against the size of the stash of p
+func stashRead(r io.Reader, p cuckoo.Params, stashed *int) error {
+	var u uint8
+	if err := binary.Read(r, binary.BigEndian, &u); err != nil {
+		return err
+	}
+	if int(u) > p.StashSize {
+		return fmt.Errorf("%w: %d stashed items in a stash of %d slots", ErrInvalidStash, u, p.StashSize)
+	}
+	*stashed = int(u)
+	return nil
 }
 
-// HashWrite writes one hash out
-func EncodingsWrite(w io.Writer, u [cuckoo.Nhash]uint64) error {
-	return binary.Write(w, binary.BigEndian, u)
+// lenWrite writes the length of the encodings out
+func lenWrite(w io.Writer, l int) error {
+	return binary.Write(w, binary.BigEndian, uint8(l))
 }
 
-func (input *inputToOprfEncode) encodeAndHash(oprfKeys *oprf.Key, hasher hash.Hasher) (hashes [cuckoo.Nhash]uint64) {
-	// oprfInput is instantiated at the required size
-	for hIdx, bucketIdx := range input.bucketIdx {
-		oprfKeys.Encode(bucketIdx, input.prcEncoded[hIdx])
-		hashes[hIdx] = hasher.Hash64(input.prcEncoded[hIdx])
+// lenRead reads the length of the encodings
+func lenRead(r io.Reader, l *int) error {
+	var u uint8
+	if err := binary.Read(r, binary.BigEndian, &u); err != nil {
+		return err
 	}
+	*l = int(u)
+	return nil
+}
+
+// truncate returns the first l bytes of the hash of an OPRF encoding
+func truncate(oprfEncoding []byte, l int) (e encoding) {
+	h := blake3.Sum256(oprfEncoding)
+	copy(e[:l], h[:])
+	return e
+}
+
+// encode writes to dst the truncated encoding of the input in group g: the
+// one in its bucket of hash function g, or for the groups following the hash
+// functions, the one in the slot g - Nhash of the stash, which starts at bucket
+// index stashIdx. The pseudorandom codes are encoded in place: the one of the
+// stash is shared by the stashed slots, and only the last one encodes it in place.
+func (input *inputToOprfEncode) encode(oprfKeys *oprf.Key, stashIdx uint64, g, stashed, l int, dst []byte) {
+	var nhash = len(input.bucketIdx)
+	var prcEncoded []byte
+	var bucketIdx uint64
+	if g < nhash {
+		prcEncoded, bucketIdx = input.prcEncoded[g], input.bucketIdx[g]
+	} else {
+		prcEncoded, bucketIdx = input.prcEncoded[nhash], stashIdx+uint64(g-nhash)
+		if g < nhash+stashed-1 {
+			prcEncoded = bytes.Clone(prcEncoded)
+		}
+	}
+	oprfKeys.Encode(bucketIdx, prcEncoded)
+	e := truncate(prcEncoded, l)
+	copy(dst, e[:l])
+}
 
-	return hashes
+// shuffle randomly permutes the encodings of l bytes of group
+func shuffle(group []byte, l int) error {
+	var seed [32]byte
+	if _, err := rand.Read(seed[:]); err != nil {
+		return err
+	}
+	var tmp encoding
+	mrand.New(mrand.NewChaCha8(seed)).Shuffle(len(group)/l, func(i, j int) {
+		copy(tmp[:l], group[i*l:])
+		copy(group[i*l:(i+1)*l], group[j*l:(j+1)*l])
+		copy(group[j*l:], tmp[:l])
+	})
+	return nil
+}
+
+// parallel runs fn over the ranges [lo, hi) splitting [0, n) between workers
+func parallel(n int, fn func(lo, hi int)) {
+	var workers = runtime.GOMAXPROCS(0)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func(w int) {
+			defer wg.Done()
+			fn(w*n/workers, (w+1)*n/workers)
+		}(w)
+	}
+	wg.Wait()
 }
 
 func printStageStats(log logr.Logger, stage int, prevTime, startTime time.Time, prevMem uint64) (time.Time, uint64) {
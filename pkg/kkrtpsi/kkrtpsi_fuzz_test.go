@@ -0,0 +1,101 @@
+package kkrtpsi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/optable/match/internal/cuckoo"
+	"github.com/optable/match/internal/hash"
+	"github.com/optable/match/pkg/limits"
+)
+
+// fuzzLimits are small enough that an adversarial
+// header can never make the fuzzer allocate much
+var fuzzLimits = limits.Limits{MaxCardinality: 1 << 12, MaxBytes: 1 << 20}
+
+func FuzzSizeRead(f *testing.F) {
+	for _, n := range []int64{0, 1, -1, 1 << 12, 1<<12 + 1, math.MaxInt64, math.MinInt64} {
+		var b bytes.Buffer
+		binary.Write(&b, binary.BigEndian, n)
+		f.Add(b.Bytes())
+	}
+	f.Add([]byte{})
+	f.Add([]byte{0, 0, 0})
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var n int64
+		err := sizeRead(bytes.NewReader(b), fuzzLimits, &n)
+		if err != nil {
+			if len(b) >= 8 && !errors.Is(err, limits.ErrInvalidCardinality) && !errors.Is(err, limits.ErrCardinalityExceeded) {
+				t.Fatalf("unexpected error on a complete header: %v", err)
+			}
+			return
+		}
+		if n < 0 || n > fuzzLimits.MaxCardinality {
+			t.Fatalf("accepted an announced size of %d", n)
+		}
+	})
+}
+
+func FuzzParamsRead(f *testing.F) {
+	for _, p := range []cuckoo.Params{
+		cuckoo.DefaultParams,
+		{Nhash: 3, Factor: 1.4, StashSize: 2, Hasher: hash.SipHash},
+		{Nhash: 0, Factor: 1.4},
+		{Nhash: math.MaxInt32, Factor: 1.4},
+		{Nhash: 3, Factor: math.Inf(1)},
+		{Nhash: 3, Factor: math.NaN()},
+		{Nhash: 3, Factor: 1e300, StashSize: math.MaxInt32},
+		{Nhash: 3, Factor: 1.4, StashSize: -1},
+		{Nhash: 3, Factor: 1.4, Hasher: 255},
+	} {
+		var b bytes.Buffer
+		paramsWrite(&b, p)
+		f.Add(b.Bytes(), uint16(1000))
+	}
+	f.Add([]byte{}, uint16(0))
+
+	f.Fuzz(func(t *testing.T, b []byte, n uint16) {
+		var p cuckoo.Params
+		if err := paramsRead(bytes.NewReader(b), &p); err != nil {
+			return
+		}
+		if err := p.Validate(uint64(n)); err != nil {
+			if !errors.Is(err, cuckoo.ErrInvalidParams) {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			return
+		}
+		// accepted parameters only drive bounded allocations
+		if p.Nhash < cuckoo.MinNhash || p.Nhash > cuckoo.MaxNhash || p.StashSize < 0 || p.StashSize > cuckoo.MaxStashSize {
+			t.Fatalf("accepted parameters %+v", p)
+		}
+		if size := p.Len(uint64(n)); size > uint64(cuckoo.MaxFactor)*uint64(n)+uint64(cuckoo.MaxStashSize)+1 {
+			t.Fatalf("accepted a table of %d slots for %d items", size, n)
+		}
+	})
+}
+
+func FuzzStashRead(f *testing.F) {
+	for _, stashed := range []uint8{0, 1, 2, 3, cuckoo.MaxStashSize, 255} {
+		f.Add([]byte{stashed})
+	}
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var stashed int
+		err := stashRead(bytes.NewReader(b), cuckoo.DefaultParams, &stashed)
+		if err != nil {
+			if len(b) >= 1 && !errors.Is(err, ErrInvalidStash) {
+				t.Fatalf("unexpected error on a complete header: %v", err)
+			}
+			return
+		}
+		if stashed < 0 || stashed > cuckoo.DefaultParams.StashSize {
+			t.Fatalf("accepted %d stashed items", stashed)
+		}
+	})
+}
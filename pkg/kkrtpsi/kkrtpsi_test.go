@@ -0,0 +1,57 @@
+package kkrtpsi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/optable/match/internal/ot"
+	"github.com/optable/match/pkg/options"
+)
+
+// cheatingConn flips the first choice bit of the receiver in
+// every column of the OT extension it writes, columns being
+// the only writes of colLen bytes
+type cheatingConn struct {
+	net.Conn
+	colLen int
+}
+
+func (c cheatingConn) Write(b []byte) (int, error) {
+	if len(b) == c.colLen {
+		b = append([]byte{b[0] ^ 1}, b[1:]...)
+	}
+	return c.Conn.Write(b)
+}
+
+// identifiers returns a closed, buffered channel of n identifiers
+func identifiers(n int) <-chan []byte {
+	var c = make(chan []byte, n)
+	for i := 0; i < n; i++ {
+		c <- []byte(fmt.Sprintf("e:%d", i))
+	}
+	close(c)
+	return c
+}
+
+func TestKOSCheatingReceiver(t *testing.T) {
+	const n = 1000
+	// the first row of the receiver then differs from its codeword in
+	// every bit, and is checked against all the bits of the sender secret
+	m := int(cuckooParams(options.Cuckoo{}).Len(n)) + ot.ExtensionWidth
+	senderConn, receiverConn := net.Pipe()
+	var done = make(chan error)
+	go func() {
+		err := NewKOSSender(senderConn).Send(context.Background(), n, identifiers(n))
+		senderConn.Close()
+		done <- err
+	}()
+	r := NewKOSReceiver(cheatingConn{Conn: receiverConn, colLen: (m + 7) / 8})
+	r.Intersect(context.Background(), n, identifiers(n))
+	receiverConn.Close()
+	if err := <-done; !errors.Is(err, ErrConsistencyCheck) {
+		t.Fatalf("expected ErrConsistencyCheck, got %v", err)
+	}
+}
@@ -6,29 +6,43 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"runtime"
 	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/optable/match/internal/cuckoo"
 	"github.com/optable/match/internal/hash"
-	"github.com/optable/match/internal/oprf"
 	"github.com/optable/match/internal/util"
+	"github.com/optable/match/pkg/digest"
+	"github.com/optable/match/pkg/options"
 )
 
-// stage 1: read hash seeds for cuckoo hash, read local IDs until exhaustion
-//          and insert them all into a cuckoo hash table
+// stage 1: read the parameters and hash seeds for cuckoo hash, and the
+//          pseudorandom generator and the base OT of the OPRF, read local
+//          IDs until exhaustion and insert them all concurrently into a
+//          cuckoo hash table, and send the number of items in its stash
 // stage 2: OPRF Receive
-// stage 3: receive sender's OPRF encodings and intersect
+// stage 3: receive sender's truncated OPRF encodings, grouped by hash
+//          function, and intersect
 
 // Receiver side of the KKRTPSI protocol
 type Receiver struct {
-	rw io.ReadWriter
+	rw   io.ReadWriter
+	kos  bool
+	opts options.Options
 }
 
 // NewReceiver returns a KKRT receiver initialized to
 // use rw as the communication layer
-func NewReceiver(rw io.ReadWriter) *Receiver {
-	return &Receiver{rw: rw}
+func NewReceiver(rw io.ReadWriter, opts ...options.Option) *Receiver {
+	return &Receiver{rw: rw, opts: options.New(opts...)}
+}
+
+// NewKOSReceiver returns a KKRT receiver initialized to use rw
+// as the communication layer, that proves the consistency of its
+// OPRF inputs. The sender must be created with NewKOSSender.
+func NewKOSReceiver(rw io.ReadWriter, opts ...options.Option) *Receiver {
+	return &Receiver{rw: rw, kos: true, opts: options.New(opts...)}
 }
 
 // Intersect on matchables read from the identifiers channel,
@@ -40,25 +54,54 @@ func (r *Receiver) Intersect(ctx context.Context, n int64, identifiers <-chan []
 	// fetch and set up logger
 	logger := logr.FromContextOrDiscard(ctx)
 	logger = logger.WithValues("protocol", "kkrtpsi")
+	// fetch the limits enforced on the sender
+	l := r.opts.Limits
+	rw := l.ReadWriter(r.rw)
 
 	// start timer:
 	start := time.Now()
 	timer := time.Now()
 	var mem uint64
 
-	var seeds [cuckoo.Nhash][]byte
-	var oprfOutput = make([]map[uint64]uint64, cuckoo.Nhash)
+	var params cuckoo.Params
+	var generator options.PRG
+	var baseOT options.BaseOT
+	var oprfOutput [][]byte
 	var cuckooHashTable *cuckoo.Cuckoo
 	var secretKey []byte
+	var stashed int
 
-	// stage 1: read the hash seeds from the remote side
-	//          initiate a cuckoo hash table and insert all local
-	//          IDs into the cuckoo hash table.
+	// stage 1: read the cuckoo hash parameters and the hash seeds from
+	//          the remote side, initiate a cuckoo hash table and insert
+	//          all local IDs into the cuckoo hash table.
 	stage1 := func() error {
 		logger.V(1).Info("Starting stage 1")
+		// read the parameters, and validate them
+		// before they drive the allocations
+		if err := paramsRead(rw, &params); err != nil {
+			return fmt.Errorf("stage1: %v", err)
+		}
+		if err := params.Validate(uint64(n)); err != nil {
+			return fmt.Errorf("stage1: %w", err)
+		}
+		if err := r.opts.CheckHasher(params.Hasher); err != nil {
+			return fmt.Errorf("stage1: %w", err)
+		}
+		logger.V(1).Info("received hash function", "hasher", params.Hasher.String())
+		if err := oprfRead(rw, &generator, &baseOT); err != nil {
+			return fmt.Errorf("stage1: %v", err)
+		}
+		if err := r.opts.CheckPRG(generator); err != nil {
+			return fmt.Errorf("stage1: %w", err)
+		}
+		if err := r.opts.CheckBaseOT(baseOT); err != nil {
+			return fmt.Errorf("stage1: %w", err)
+		}
+		logger.V(1).Info("received OPRF", "prg", generator.String(), "base OT", baseOT.String())
+		var seeds = make([][]byte, params.Nhash)
 		for i := range seeds {
 			seeds[i] = make([]byte, hash.SaltLength)
-			if _, err := io.ReadFull(r.rw, seeds[i]); err != nil {
+			if _, err := io.ReadFull(rw, seeds[i]); err != nil {
 				return fmt.Errorf("stage1: %v", err)
 			}
 		}
@@ -69,16 +112,27 @@ func (r *Receiver) Intersect(ctx context.Context, n int64, identifiers <-chan []
 		}
 
 		// instantiate cuckoo hash table
-		cuckooHashTable = cuckoo.NewCuckoo(uint64(n), seeds)
+		var ids = make([][]byte, 0, n)
 		for id := range identifiers {
-			if err = cuckooHashTable.Insert(id); err != nil {
-				return err
-			}
+			ids = append(ids, id)
+		}
+		cuckooHashTable = cuckoo.NewCuckoo(uint64(n), seeds, params)
+		if err = cuckooHashTable.Build(ids, runtime.GOMAXPROCS(0)); err != nil {
+			return err
+		}
+		stats := cuckooHashTable.Stats()
+		logger.V(2).Info("stats", "stage", 1, "cuckoo stashed", stats.Stashed, "cuckoo evictions", stats.Evictions, "cuckoo eviction chains", stats.Chains, "cuckoo longest eviction chain", stats.MaxChain)
+
+		// send the number of items in the stash, the sender
+		// skips the encodings of the slots of the stash left empty
+		stashed = stats.Stashed
+		if err := stashWrite(r.rw, stashed); err != nil {
+			return err
 		}
 
 		// receive secret key for AES-128 (16 byte)
 		secretKey = make([]byte, 16)
-		if _, err := io.ReadFull(r.rw, secretKey); err != nil {
+		if _, err := io.ReadFull(rw, secretKey); err != nil {
 			return fmt.Errorf("stage1: %v", err)
 		}
 
@@ -92,7 +146,11 @@ func (r *Receiver) Intersect(ctx context.Context, n int64, identifiers <-chan []
 	stage2 := func() error {
 		logger.V(1).Info("Starting stage 2")
 		oprfInputSize := int(cuckooHashTable.Len())
-		oprfOutput, err = oprf.NewOPRF(oprfInputSize).Receive(cuckooHashTable, secretKey, r.rw)
+		o, err := newOPRF(oprfInputSize, r.kos, generator, baseOT)
+		if err != nil {
+			return err
+		}
+		oprfOutput, err = o.Receive(cuckooHashTable, secretKey, rw)
 		if err != nil {
 			return err
 		}
@@ -109,30 +167,69 @@ func (r *Receiver) Intersect(ctx context.Context, n int64, identifiers <-chan []
 		logger.V(1).Info("Starting stage 3")
 		// read number of remote IDs
 		var remoteN int64
-		if err := binary.Read(r.rw, binary.BigEndian, &remoteN); err != nil {
+		if err := sizeRead(rw, l, &remoteN); err != nil {
+			return fmt.Errorf("stage3: %w", err)
+		}
+		// read the length of the remote encodings, and validate it
+		var encodingLen int
+		if err := lenRead(rw, &encodingLen); err != nil {
 			return err
 		}
+		if err := digest.Check(r.opts.DigestLen, encodingLen); err != nil {
+			return fmt.Errorf("stage3: %w", err)
+		}
+		digest.Log(logger, n, remoteN, encodingLen)
 
-		// Add a buffer of 64k to amortize syscalls cost
-		var bufferedReader = bufio.NewReaderSize(r.rw, 1024*64)
-
-		// read remote encodings and intersect
-		for i := int64(0); i < remoteN; i++ {
-			// read cuckoo.Nhash possible encodings
-			var remoteEncoding [cuckoo.Nhash]uint64
-			if err := EncodingsRead(bufferedReader, &remoteEncoding); err != nil {
-				return err
+		// hash and index all local encodings, truncated to the length
+		// announced by the sender. The truncated hash of the encoding
+		// is the key, the index of the corresponding ID in the cuckoo
+		// hash table is the value. The encodings of the items in the
+		// stash are in the last map.
+		var truncated = make([]encoding, len(oprfOutput))
+		parallel(len(oprfOutput), func(lo, hi int) {
+			for bIdx := lo; bIdx < hi; bIdx++ {
+				if cuckooHashTable.GetBucket(uint64(bIdx)) != 0 {
+					truncated[bIdx] = truncate(oprfOutput[bIdx], encodingLen)
+				}
 			}
-			// intersect
-			for hashIdx, remoteHash := range remoteEncoding {
-				if idx, ok := oprfOutput[hashIdx][remoteHash]; ok {
+		})
+		oprfOutput = nil
+
+		var localEncodings = make([]map[encoding]uint64, params.Nhash+1)
+		for i := range localEncodings {
+			localEncodings[i] = make(map[encoding]uint64)
+		}
+		for bIdx, e := range truncated {
+			// check if it was an empty input
+			if idx := cuckooHashTable.GetBucket(uint64(bIdx)); idx != 0 {
+				// insert into proper map
+				_, hIdx := cuckooHashTable.GetItemWithHash(idx)
+				localEncodings[hIdx][e] = idx
+			}
+		}
+
+		// Add a buffer of 64k to amortize syscalls cost
+		var bufferedReader = bufio.NewReaderSize(rw, 1024*64)
+
+		// read the remote encodings, grouped by hash function and
+		// followed by a group for each slot of the stash in use, and intersect
+		for g := 0; g < params.Nhash+stashed; g++ {
+			// the encodings in the stash are
+			// hashed with the hash index Nhash
+			var local = localEncodings[min(g, params.Nhash)]
+			for i := int64(0); i < remoteN; i++ {
+				var remote encoding
+				if _, err := io.ReadFull(bufferedReader, remote[:encodingLen]); err != nil {
+					return err
+				}
+				if idx, ok := local[remote]; ok {
 					id, _ := cuckooHashTable.GetItemWithHash(idx)
 					if id == nil {
 						return fmt.Errorf("failed to retrieve item #%v", idx)
 					}
 					intersection = append(intersection, id)
 					// dedup
-					delete(oprfOutput[hashIdx], remoteHash)
+					delete(local, remote)
 				}
 			}
 		}
@@ -143,17 +240,17 @@ func (r *Receiver) Intersect(ctx context.Context, n int64, identifiers <-chan []
 	}
 
 	// run stage1
-	if err := util.Sel(ctx, stage1); err != nil {
+	if err := util.Sel(ctx, l.StageTimeout, stage1); err != nil {
 		return intersection, err
 	}
 
 	// run stage2
-	if err := util.Sel(ctx, stage2); err != nil {
+	if err := util.Sel(ctx, l.StageTimeout, stage2); err != nil {
 		return intersection, err
 	}
 
 	// run stage3
-	if err := util.Sel(ctx, stage3); err != nil {
+	if err := util.Sel(ctx, l.StageTimeout, stage3); err != nil {
 		return intersection, err
 	}
 
@@ -1,14 +1,12 @@
 package kkrtpsi
 
 import (
-	"bufio"
 	"context"
 	"crypto/aes"
 	"crypto/rand"
 	"encoding/binary"
 	"fmt"
 	"io"
-	"runtime"
 	"time"
 
 	"github.com/go-logr/logr"
@@ -17,36 +15,45 @@ import (
 	"github.com/optable/match/internal/hash"
 	"github.com/optable/match/internal/oprf"
 	"github.com/optable/match/internal/util"
+	"github.com/optable/match/pkg/digest"
+	"github.com/optable/match/pkg/options"
 	"golang.org/x/sync/errgroup"
 )
 
-// stage 1: samples cuckoo.Nhash hash seeds and sends them to receiver for cuckoo hash
+// stage 1: samples the cuckoo hash parameters and one hash seed per
+//          hash function, and sends them to receiver for cuckoo hash,
+//          along with the pseudorandom generator and the base OT of the OPRF
 // stage 2: act as sender in OPRF, and receive OPRF keys
-// stage 3: compute OPRF(k, id) and send them to receiver for intersection.
+// stage 3: compute OPRF(k, id) in each bucket of id and each slot of the stash
+//          in use by the receiver, and send them to receiver for intersection, grouped by hash
+//          function, shuffled and truncated.
 
 // Sender side of the KKRTPSI protocol
 type Sender struct {
-	rw io.ReadWriter
+	rw   io.ReadWriter
+	kos  bool
+	opts options.Options
 }
 
 // inputToOprfEncode stores the possible bucket
 // indexes in the receiver cuckoo hash table
 type inputToOprfEncode struct {
-	prcEncoded [cuckoo.Nhash][]byte // PseudoRandom Code
-	bucketIdx  [cuckoo.Nhash]uint64
-}
-
-// stage1Result is used to pass the OPRF encoded
-// inputs along with the hasher from stage 1 to stage 3
-type stage1Result struct {
-	inputs []inputToOprfEncode
-	hasher hash.Hasher
+	prcEncoded [][]byte // PseudoRandom Code, in each bucket then in the stash
+	bucketIdx  []uint64
 }
 
 // NewSender returns a KKRTPSI sender initialized to
 // use rw as the communication layer
-func NewSender(rw io.ReadWriter) *Sender {
-	return &Sender{rw: rw}
+func NewSender(rw io.ReadWriter, opts ...options.Option) *Sender {
+	return &Sender{rw: rw, opts: options.New(opts...)}
+}
+
+// NewKOSSender returns a KKRTPSI sender initialized to use rw as the
+// communication layer, that checks the consistency of the OPRF receiver
+// and aborts with ErrConsistencyCheck if it cheats. The receiver must
+// be created with NewKOSReceiver.
+func NewKOSSender(rw io.ReadWriter, opts ...options.Option) *Sender {
+	return &Sender{rw: rw, kos: true, opts: options.New(opts...)}
 }
 
 // Send initiates a KKRTPSI exchange
@@ -58,26 +65,61 @@ func (s *Sender) Send(ctx context.Context, n int64, identifiers <-chan []byte) (
 	// fetch and set up logger
 	logger := logr.FromContextOrDiscard(ctx)
 	logger = logger.WithValues("protocol", "kkrtpsi")
+	// fetch the limits enforced on the receiver
+	l := s.opts.Limits
+	rw := l.ReadWriter(s.rw)
 
 	// statistics
 	start := time.Now()
 	timer := time.Now()
 	var mem uint64
 
-	var seeds [cuckoo.Nhash][]byte
-	var remoteN int64     // receiver size
-	var oprfInputSize int // nb of OPRF keys
+	var params = cuckooParams(s.opts.Cuckoo)
+	var seeds = make([][]byte, params.Nhash)
+	var remoteN int64         // receiver size
+	var stashed int           // receiver stashed items
+	var oprfInputSize int     // nb of OPRF keys
+	var generator options.PRG // OPRF pseudorandom generator
+	var baseOT options.BaseOT // OPRF base OT
 
 	var oprfKey *oprf.Key
-	var encodedInputChan = make(chan stage1Result)
+	var encodedInputChan = make(chan []inputToOprfEncode)
 
-	// stage 1: sample hash seeds and write them to receiver
-	// for cuckoo hashing parameters agreement.
+	// stage 1: write the cuckoo hash parameters and sample hash seeds
+	// and write them to receiver for cuckoo hashing parameters agreement.
 	// read local ids and store the potential bucket indexes for each id.
 	stage1 := func() error {
 		logger.V(1).Info("Starting stage 1")
 
-		// sample cuckoo.Nhash hash seeds
+		// select the hash function of the cuckoo hash table
+		params.Hasher = s.opts.Hasher
+		if err := s.opts.CheckHasher(params.Hasher); err != nil {
+			return fmt.Errorf("stage1: %w", err)
+		}
+		logger.V(1).Info("selected hash function", "hasher", params.Hasher.String())
+		// the receiver checks the estimated security of the parameters for
+		// its number of items, only check that they are in bounds
+		if err := params.Validate(1); err != nil {
+			return fmt.Errorf("stage1: %w", err)
+		}
+		logger.V(1).Info("selected cuckoo hash parameters", "nhash", params.Nhash, "factor", params.Factor, "stash", params.StashSize)
+		if err := paramsWrite(s.rw, params); err != nil {
+			return err
+		}
+		// select the pseudorandom generator and the base OT of the OPRF
+		generator, baseOT = s.opts.PRG, s.opts.BaseOT
+		if err := s.opts.CheckPRG(generator); err != nil {
+			return fmt.Errorf("stage1: %w", err)
+		}
+		if err := s.opts.CheckBaseOT(baseOT); err != nil {
+			return fmt.Errorf("stage1: %w", err)
+		}
+		logger.V(1).Info("selected OPRF", "prg", generator.String(), "base OT", baseOT.String())
+		if err := oprfWrite(s.rw, generator, baseOT); err != nil {
+			return err
+		}
+
+		// sample params.Nhash hash seeds
 		for i := range seeds {
 			seeds[i] = make([]byte, hash.SaltLength)
 			if _, err := rand.Read(seeds[i]); err != nil {
@@ -89,9 +131,15 @@ func (s *Sender) Send(ctx context.Context, n int64, identifiers <-chan []byte) (
 			}
 		}
 
-		// read remote input size
-		if err := binary.Read(s.rw, binary.BigEndian, &remoteN); err != nil {
-			return err
+		// read remote input size, and validate it
+		// before it drives the OPRF allocations
+		if err := sizeRead(rw, l, &remoteN); err != nil {
+			return fmt.Errorf("stage1: %w", err)
+		}
+		// read the number of items in the stash of the receiver,
+		// only the slots in use are compared in stage 3
+		if err := stashRead(rw, params, &stashed); err != nil {
+			return fmt.Errorf("stage1: %w", err)
 		}
 
 		// sample random 16 byte secret key for AES-128 and send to the receiver
@@ -106,11 +154,8 @@ func (s *Sender) Send(ctx context.Context, n int64, identifiers <-chan []byte) (
 		}
 
 		// calculate number of OPRF from the receiver based on
-		// number of buckets in cuckooHashTable
-		oprfInputSize = int(cuckoo.Factor * float64(remoteN))
-		if 1 > oprfInputSize {
-			oprfInputSize = 1
-		}
+		// number of buckets and stash slots in cuckooHashTable
+		oprfInputSize = int(params.Len(uint64(remoteN)))
 
 		// instantiate an AES block
 		aesBlock, err := aes.NewCipher(secretKey)
@@ -118,29 +163,37 @@ func (s *Sender) Send(ctx context.Context, n int64, identifiers <-chan []byte) (
 			return err
 		}
 
+		// the pseudorandom codes of the checked OPRF
+		// are codewords of its linear code
+		var encode = crypto.PseudorandomCode
+		if s.kos {
+			encode = oprf.LinearPseudorandomCode
+		}
+
 		// exhaust local ids, and precompute all potential
 		// hashes and store them using the same
 		// cuckoo hash table parameters as the receiver.
 		go func() {
-			cuckooHasher := cuckoo.NewCuckooHasher(uint64(remoteN), seeds)
+			cuckooHasher := cuckoo.NewCuckooHasher(uint64(remoteN), seeds, params)
 
-			// prepare struct to send inputs and hasher to stage 3
-			var result stage1Result
-			result.inputs = make([]inputToOprfEncode, n)
+			// prepare the inputs to send to stage 3
+			var inputs = make([]inputToOprfEncode, 0, n)
 
-			var i int
 			for id := range identifiers {
-				// hash and calculate pseudorandom code given each possible hash index
-				var bytes [cuckoo.Nhash][]byte
-				for hIdx := 0; hIdx < cuckoo.Nhash; hIdx++ {
-					bytes[hIdx] = crypto.PseudorandomCode(aesBlock, id, byte(hIdx))
+				// hash and calculate pseudorandom code given each possible hash
+				// index, and the hash index params.Nhash of the stash
+				var nCodes = params.Nhash
+				if stashed > 0 {
+					nCodes++
+				}
+				var bytes = make([][]byte, nCodes)
+				for hIdx := range bytes {
+					bytes[hIdx] = encode(aesBlock, id, byte(hIdx))
 				}
-				result.inputs[i] = inputToOprfEncode{prcEncoded: bytes, bucketIdx: cuckooHasher.BucketIndices(id)}
-				i++
+				inputs = append(inputs, inputToOprfEncode{prcEncoded: bytes, bucketIdx: cuckooHasher.BucketIndices(id)})
 			}
 
-			result.hasher = cuckooHasher.GetHasher()
-			encodedInputChan <- result
+			encodedInputChan <- inputs
 		}()
 
 		// end stage1
@@ -154,10 +207,14 @@ func (s *Sender) Send(ctx context.Context, n int64, identifiers <-chan []byte) (
 		logger.V(1).Info("Starting stage 2")
 
 		// instantiate OPRF sender with agreed parameters
-		oprfKey, err = oprf.NewOPRF(oprfInputSize).Send(s.rw)
+		o, err := newOPRF(oprfInputSize, s.kos, generator, baseOT)
 		if err != nil {
 			return err
 		}
+		oprfKey, err = o.Send(rw)
+		if err != nil {
+			return fmt.Errorf("stage2: %w", err)
+		}
 
 		// end stage2
 		timer, mem = printStageStats(logger, 2, timer, start, mem)
@@ -169,87 +226,59 @@ func (s *Sender) Send(ctx context.Context, n int64, identifiers <-chan []byte) (
 	stage3 := func() error {
 		logger.V(1).Info("Starting stage 3")
 
-		// inform the receiver the number of local ID
-		if err := binary.Write(s.rw, binary.BigEndian, &n); err != nil {
+		inputs := <-encodedInputChan
+
+		// inform the receiver the number of local ID,
+		// and the length of their encodings
+		encodingLen, err := digest.Select(s.opts.DigestLen, remoteN, int64(len(inputs)))
+		if err != nil {
+			return fmt.Errorf("stage3: %w", err)
+		}
+		digest.Log(logger, remoteN, int64(len(inputs)), encodingLen)
+		if err := binary.Write(s.rw, binary.BigEndian, int64(len(inputs))); err != nil {
+			return err
+		}
+		if err := lenWrite(s.rw, encodingLen); err != nil {
 			return err
 		}
 
-		message := <-encodedInputChan
-		nWorkers := runtime.GOMAXPROCS(0)
-		var localEncodings = make(chan [][cuckoo.Nhash]uint64, nWorkers*2)
-
-		batchSize := 2048
-		nBatches := len(message.inputs) / batchSize
-		workerResp := nBatches / nWorkers
+		// the encodings are grouped by hash function, followed by one
+		// group for each slot of the stash in use by the receiver. Each
+		// group is randomly permuted, so that the receiver only learns
+		// which of its items match, and not which sender items they match.
+		var stashIdx = params.BucketSize(uint64(remoteN))
+		var groups = make(chan []byte, 1)
 
 		g, ctx := errgroup.WithContext(ctx)
 
-		// each worker is responsible to encode and hash workerResp batches and send them out
-		for w := 0; w < nWorkers; w++ {
-			w := w
-			g.Go(func() error {
-				for batchNumber := 0; batchNumber < workerResp; batchNumber++ {
-					batch := make([][cuckoo.Nhash]uint64, batchSize)
-					step := (w*workerResp + batchNumber) * batchSize
-					for bIdx := 0; bIdx < batchSize; bIdx++ {
-						batch[bIdx] = message.inputs[step+bIdx].encodeAndHash(oprfKey, message.hasher)
-					}
-
-					select {
-					case <-ctx.Done():
-						return ctx.Err()
-					// batch is filled; send it out
-					case localEncodings <- batch:
+		// compute the groups one after the other, so that
+		// one is computed while the previous one is written out
+		g.Go(func() error {
+			defer close(groups)
+			for gIdx := 0; gIdx < params.Nhash+stashed; gIdx++ {
+				var group = make([]byte, len(inputs)*encodingLen)
+				parallel(len(inputs), func(lo, hi int) {
+					for i := lo; i < hi; i++ {
+						inputs[i].encode(oprfKey, stashIdx, gIdx, stashed, encodingLen, group[i*encodingLen:])
 					}
+				})
+				if err := shuffle(group, encodingLen); err != nil {
+					return err
+				}
+				select {
+				case <-ctx.Done():
+					return ctx.Err()
+				// group is shuffled; send it out
+				case groups <- group:
 				}
-				return nil
-			})
-		}
-
-		// Extra worker deals with the remaining inputs
-		// In the case that nBatches < nWorkers, this worker will be responsible
-		// for the entire set of inputs. In addition, since it aggregates its
-		// inputs into a single large batch, this process is not pipelined.
-		g.Go(func() error {
-			workLeft := len(message.inputs) - (workerResp * nWorkers * batchSize)
-			if workLeft == 0 {
-				return nil
-			}
-
-			lastBatch := make([][cuckoo.Nhash]uint64, workLeft)
-			for bIdx := 0; bIdx < workLeft; bIdx++ {
-				lastBatch[bIdx] = message.inputs[len(message.inputs)-workLeft+bIdx].encodeAndHash(oprfKey, message.hasher)
-			}
-
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			// final batch filled; send it out
-			case localEncodings <- lastBatch:
-				return nil
 			}
+			return nil
 		})
 
 		g.Go(func() error {
-			// Add a buffer of 64k to amortize syscalls cost
-			var bufferedWriter = bufio.NewWriterSize(s.rw, 1024*64)
-			defer bufferedWriter.Flush()
-			var sent int
-			// no message
-			if len(message.inputs) == 0 {
-				close(localEncodings)
-			}
-
-			for batch := range localEncodings {
-				for _, hashedEncodings := range batch {
-					// send all encodings of an ID at once
-					if err := EncodingsWrite(bufferedWriter, hashedEncodings); err != nil {
-						return fmt.Errorf("stage3: %v", err)
-					}
-					sent++
-				}
-				if sent == len(message.inputs) {
-					close(localEncodings)
+			for group := range groups {
+				if _, err := s.rw.Write(group); err != nil {
+					return fmt.Errorf("stage3: %v", err)
 				}
 			}
 			return nil
@@ -266,17 +295,17 @@ func (s *Sender) Send(ctx context.Context, n int64, identifiers <-chan []byte) (
 	}
 
 	// run stage1
-	if err := util.Sel(ctx, stage1); err != nil {
+	if err := util.Sel(ctx, l.StageTimeout, stage1); err != nil {
 		return err
 	}
 
 	// run stage2
-	if err := util.Sel(ctx, stage2); err != nil {
+	if err := util.Sel(ctx, l.StageTimeout, stage2); err != nil {
 		return err
 	}
 
 	// run stage3
-	if err := util.Sel(ctx, stage3); err != nil {
+	if err := util.Sel(ctx, l.StageTimeout, stage3); err != nil {
 		return err
 	}
 
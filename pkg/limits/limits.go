@@ -0,0 +1,124 @@
+// Package limits bounds the resources a remote peer can make a sender or a
+// receiver commit to. Every protocol reads a cardinality announced by the
+// peer and allocates or loops on it, limits lets the caller refuse those
+// announcements before any allocation happens.
+//
+// Limits are set on a sender or a receiver with options.WithLimits.
+package limits
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/optable/match/internal/util"
+)
+
+// DefaultMaxCardinality is the largest set size a peer can announce
+// when no limits are configured
+const DefaultMaxCardinality = 1 << 34
+
+var (
+	// ErrInvalidCardinality is returned when a peer announces a negative set size
+	ErrInvalidCardinality = errors.New("peer announced an invalid cardinality")
+	// ErrCardinalityExceeded is returned when a peer announces a set size
+	// larger than the configured MaxCardinality
+	ErrCardinalityExceeded = errors.New("peer announced a cardinality over the configured limit")
+	// ErrCardinalityTooSmall is returned when a peer announces a set size
+	// smaller than the configured MinCardinality
+	ErrCardinalityTooSmall = errors.New("peer announced a cardinality under the configured minimum")
+	// ErrByteLimitExceeded is returned when a peer sends more bytes
+	// than the configured MaxBytes
+	ErrByteLimitExceeded = errors.New("peer sent more bytes than the configured limit")
+	// ErrStageTimeout is returned when a protocol stage runs longer
+	// than the configured StageTimeout
+	ErrStageTimeout = util.ErrStageTimeout
+)
+
+// Limits holds the resource limits enforced on the remote peer.
+// A zero value for any of the fields disables the corresponding check.
+type Limits struct {
+	// MaxCardinality is the largest number of identifiers
+	// the peer is allowed to announce
+	MaxCardinality int64
+	// MinCardinality is the smallest number of identifiers the peer is
+	// allowed to announce. Only the announced size is checked, which a
+	// peer reaches for free with junk identifiers or a psi.Padding, so it
+	// does not stop a peer from matching a handful of crafted identifiers
+	MinCardinality int64
+	// MaxBytes is the total number of bytes that can be
+	// read from the peer during one protocol run
+	MaxBytes int64
+	// StageTimeout bounds the duration of each protocol stage
+	StageTimeout time.Duration
+
+	// Observer, if set, is called with every non-negative cardinality
+	// the peer announces, before checking it, so that it can be audited
+	Observer func(n int64)
+}
+
+// Default returns the limits used when none are configured
+func Default() Limits {
+	return Limits{MaxCardinality: DefaultMaxCardinality}
+}
+
+// CheckCardinality validates a set size n announced by the peer
+func (l Limits) CheckCardinality(n int64) error {
+	if n < 0 {
+		return fmt.Errorf("%w: %d", ErrInvalidCardinality, n)
+	}
+	if l.Observer != nil {
+		l.Observer(n)
+	}
+	if l.MaxCardinality > 0 && n > l.MaxCardinality {
+		return fmt.Errorf("%w: %d > %d", ErrCardinalityExceeded, n, l.MaxCardinality)
+	}
+	if n < l.MinCardinality {
+		return fmt.Errorf("%w: %d < %d", ErrCardinalityTooSmall, n, l.MinCardinality)
+	}
+	return nil
+}
+
+// reader counts the bytes read from r and
+// fails once more than max bytes are requested
+type reader struct {
+	r         io.Reader
+	max, read int64
+}
+
+// Reader wraps r so that reading more than MaxBytes
+// from it returns ErrByteLimitExceeded
+func (l Limits) Reader(r io.Reader) io.Reader {
+	if l.MaxBytes <= 0 {
+		return r
+	}
+	return &reader{r: r, max: l.MaxBytes}
+}
+
+func (r *reader) Read(p []byte) (n int, err error) {
+	left := r.max - r.read
+	if left <= 0 {
+		return 0, fmt.Errorf("%w: %d bytes", ErrByteLimitExceeded, r.max)
+	}
+	if int64(len(p)) > left {
+		p = p[:left]
+	}
+	n, err = r.r.Read(p)
+	r.read += int64(n)
+	return n, err
+}
+
+type readWriter struct {
+	io.Reader
+	io.Writer
+}
+
+// ReadWriter wraps the read side of rw with Reader
+// and leaves the write side untouched
+func (l Limits) ReadWriter(rw io.ReadWriter) io.ReadWriter {
+	if l.MaxBytes <= 0 {
+		return rw
+	}
+	return readWriter{Reader: l.Reader(rw), Writer: rw}
+}
@@ -0,0 +1,62 @@
+package limits
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestCheckCardinality(t *testing.T) {
+	l := Limits{MaxCardinality: 100}
+	if err := l.CheckCardinality(100); err != nil {
+		t.Errorf("expected no error at the limit, got %v", err)
+	}
+	if err := l.CheckCardinality(101); !errors.Is(err, ErrCardinalityExceeded) {
+		t.Errorf("expected ErrCardinalityExceeded, got %v", err)
+	}
+	if err := l.CheckCardinality(-1); !errors.Is(err, ErrInvalidCardinality) {
+		t.Errorf("expected ErrInvalidCardinality, got %v", err)
+	}
+	// no limit
+	if err := (Limits{}).CheckCardinality(1 << 62); err != nil {
+		t.Errorf("expected no error without a limit, got %v", err)
+	}
+	if err := (Limits{MinCardinality: 100}).CheckCardinality(99); !errors.Is(err, ErrCardinalityTooSmall) {
+		t.Errorf("expected ErrCardinalityTooSmall, got %v", err)
+	}
+}
+
+func TestObserver(t *testing.T) {
+	var announced []int64
+	l := Limits{MaxCardinality: 10, Observer: func(n int64) {
+		announced = append(announced, n)
+	}}
+	l.CheckCardinality(5)
+	l.CheckCardinality(-1)
+	// refused cardinalities are observed too
+	l.CheckCardinality(11)
+	if len(announced) != 2 || announced[0] != 5 || announced[1] != 11 {
+		t.Errorf("expected 5 and 11 to be observed, got %v", announced)
+	}
+}
+
+func TestReader(t *testing.T) {
+	src := bytes.Repeat([]byte{1}, 100)
+	l := Limits{MaxBytes: 64}
+
+	r := l.Reader(bytes.NewReader(src))
+	b := make([]byte, 64)
+	if _, err := io.ReadFull(r, b); err != nil {
+		t.Fatalf("expected to read up to the limit, got %v", err)
+	}
+	if _, err := r.Read(b[:1]); !errors.Is(err, ErrByteLimitExceeded) {
+		t.Errorf("expected ErrByteLimitExceeded, got %v", err)
+	}
+
+	// no limit
+	r = (Limits{}).Reader(bytes.NewReader(src))
+	if b, err := io.ReadAll(r); err != nil || len(b) != len(src) {
+		t.Errorf("expected to read %d bytes, got %d (%v)", len(src), len(b), err)
+	}
+}
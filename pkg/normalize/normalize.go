@@ -0,0 +1,195 @@
+// Package normalize canonicalizes identifiers before they are matched, so
+// that "Foo@Gmail.com " of one party matches "foo@gmail.com" of the other.
+// A Transform normalizes one kind of identifier, optionally hashes it with
+// SHA-256 and prepends a type prefix such as "e:", and transforms compose
+// with Chain:
+//
+//	t := normalize.Chain(normalize.Email(normalize.EmailOptions{Gmail: true}), normalize.SHA256Hex, normalize.Prefix(normalize.EmailPrefix))
+//
+// A Transformer applies a Transform to the identifiers of a channel in front
+// of any psi.Sender or psi.Receiver:
+//
+//	sender := normalize.Transformer{Transform: t}.Sender(sender)
+//	err := sender.Send(ctx, n, identifiers)
+package normalize
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+const (
+	// EmailPrefix is the type prefix of emails
+	EmailPrefix = "e:"
+	// PhonePrefix is the type prefix of phone numbers
+	PhonePrefix = "p:"
+	// IDFAPrefix is the type prefix of Apple identifiers for advertisers
+	IDFAPrefix = "a:"
+	// GAIDPrefix is the type prefix of Google advertising IDs
+	GAIDPrefix = "g:"
+)
+
+var (
+	// ErrInvalidIdentifier is returned for an identifier which
+	// cannot be normalized. The identifier itself is not part of
+	// the error, which could be logged.
+	ErrInvalidIdentifier = errors.New("invalid identifier")
+	ErrInvalidEmail      = fmt.Errorf("%w: not an email", ErrInvalidIdentifier)
+	ErrInvalidPhone      = fmt.Errorf("%w: not an E.164 phone number", ErrInvalidIdentifier)
+	ErrInvalidMAID       = fmt.Errorf("%w: not a mobile ad ID", ErrInvalidIdentifier)
+)
+
+// A Transform returns the normalized form of identifier, in a new slice,
+// or an error wrapping ErrInvalidIdentifier
+type Transform func(identifier []byte) ([]byte, error)
+
+// Chain returns the Transform applying each of ts in turn
+func Chain(ts ...Transform) Transform {
+	return func(identifier []byte) ([]byte, error) {
+		var err error
+		for _, t := range ts {
+			if identifier, err = t(identifier); err != nil {
+				return nil, err
+			}
+		}
+		return identifier, nil
+	}
+}
+
+// SHA256Hex returns the lowercase hex encoding of the SHA-256 of identifier
+func SHA256Hex(identifier []byte) ([]byte, error) {
+	sum := sha256.Sum256(identifier)
+	out := make([]byte, hex.EncodedLen(len(sum)))
+	hex.Encode(out, sum[:])
+	return out, nil
+}
+
+// Prefix returns the Transform prepending p to identifiers
+func Prefix(p string) Transform {
+	return func(identifier []byte) ([]byte, error) {
+		out := make([]byte, 0, len(p)+len(identifier))
+		out = append(out, p...)
+		return append(out, identifier...), nil
+	}
+}
+
+// EmailOptions configures the normalization of emails
+type EmailOptions struct {
+	// Gmail removes the dots and the plus tag of the local part of the
+	// addresses of gmail.com and googlemail.com, which Gmail ignores,
+	// and maps googlemail.com to gmail.com
+	Gmail bool
+}
+
+// Email returns the Transform trimming and lowercasing emails,
+// which must have a single @ between a local part and a domain
+func Email(opts EmailOptions) Transform {
+	return func(identifier []byte) ([]byte, error) {
+		email := bytes.ToLower(bytes.TrimSpace(identifier))
+		at := bytes.IndexByte(email, '@')
+		if at <= 0 || at == len(email)-1 || bytes.IndexByte(email[at+1:], '@') >= 0 ||
+			bytes.ContainsAny(email, " \t\r\n") {
+			return nil, ErrInvalidEmail
+		}
+
+		local, domain := email[:at], email[at+1:]
+		if opts.Gmail && (string(domain) == "gmail.com" || string(domain) == "googlemail.com") {
+			if plus := bytes.IndexByte(local, '+'); plus >= 0 {
+				local = local[:plus]
+			}
+			local = bytes.ReplaceAll(local, []byte("."), nil)
+			if len(local) == 0 {
+				return nil, ErrInvalidEmail
+			}
+			return append(local, "@gmail.com"...), nil
+		}
+		return email, nil
+	}
+}
+
+const (
+	// e164MinDigits and e164MaxDigits bound the number of digits of
+	// a phone number in E.164, including its country calling code
+	e164MinDigits = 7
+	e164MaxDigits = 15
+)
+
+// Phone returns the Transform formatting phone numbers in E.164, a + followed
+// by the country calling code and the subscriber number. Numbers starting with
+// + or the international prefix 00 carry their calling code, other numbers are
+// national and get callingCode, such as "1" or "44", after their trunk prefix
+// 0 is removed. National numbers are invalid without a callingCode. Spaces,
+// dots, dashes, slashes and parentheses are ignored.
+func Phone(callingCode string) Transform {
+	return func(identifier []byte) ([]byte, error) {
+		phone := bytes.TrimSpace(identifier)
+		international := len(phone) > 0 && phone[0] == '+'
+		if international {
+			phone = phone[1:]
+		}
+
+		digits := make([]byte, 0, len(phone))
+		for _, c := range phone {
+			switch {
+			case c >= '0' && c <= '9':
+				digits = append(digits, c)
+			case bytes.IndexByte([]byte(" .-/()"), c) >= 0:
+			default:
+				return nil, ErrInvalidPhone
+			}
+		}
+
+		switch {
+		case international:
+		case bytes.HasPrefix(digits, []byte("00")):
+			digits = digits[2:]
+		case callingCode == "":
+			return nil, ErrInvalidPhone
+		case callingCode == "1" && len(digits) == 11 && digits[0] == '1':
+			// North American numbers are often written with their calling code
+		default:
+			digits = append([]byte(callingCode), bytes.TrimPrefix(digits, []byte("0"))...)
+		}
+
+		if len(digits) < e164MinDigits || len(digits) > e164MaxDigits || digits[0] == '0' {
+			return nil, ErrInvalidPhone
+		}
+		return append([]byte{'+'}, digits...), nil
+	}
+}
+
+// maidHyphens are the positions of the hyphens of a UUID
+var maidHyphens = map[int]bool{8: true, 13: true, 18: true, 23: true}
+
+// MAID is the Transform formatting mobile ad IDs, such as IDFAs and GAIDs,
+// as canonical lowercase UUIDs. The hyphens are optional. The zero UUID,
+// reported when the user limits ad tracking, is invalid.
+func MAID(identifier []byte) ([]byte, error) {
+	maid := bytes.TrimSpace(identifier)
+	if len(maid) == 36 {
+		compact := make([]byte, 0, 32)
+		for i, c := range maid {
+			if maidHyphens[i] != (c == '-') {
+				return nil, ErrInvalidMAID
+			}
+			if c != '-' {
+				compact = append(compact, c)
+			}
+		}
+		maid = compact
+	}
+
+	var id [16]byte
+	if len(maid) != 32 {
+		return nil, ErrInvalidMAID
+	}
+	if _, err := hex.Decode(id[:], maid); err != nil || id == [16]byte{} {
+		return nil, ErrInvalidMAID
+	}
+
+	h := hex.EncodeToString(id[:])
+	return []byte(h[:8] + "-" + h[8:12] + "-" + h[12:16] + "-" + h[16:20] + "-" + h[20:]), nil
+}
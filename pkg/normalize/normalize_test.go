@@ -0,0 +1,150 @@
+package normalize
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/optable/match/test/emails"
+)
+
+type normalizeTest struct {
+	in, want string
+	err      error
+}
+
+func testTransform(t *testing.T, name string, tr Transform, tests []normalizeTest) {
+	for _, test := range tests {
+		got, err := tr([]byte(test.in))
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s(%q): expected error %v, got %v", name, test.in, test.err, err)
+			continue
+		}
+		if err == nil && string(got) != test.want {
+			t.Errorf("%s(%q): expected %q, got %q", name, test.in, test.want, got)
+		}
+	}
+}
+
+func TestEmail(t *testing.T) {
+	testTransform(t, "Email", Email(EmailOptions{}), []normalizeTest{
+		{in: "Foo@Gmail.com ", want: "foo@gmail.com"},
+		{in: "\tfoo@gmail.com\r\n", want: "foo@gmail.com"},
+		{in: "f.o.o+news@gmail.com", want: "f.o.o+news@gmail.com"},
+		{in: "foo", err: ErrInvalidEmail},
+		{in: "@gmail.com", err: ErrInvalidEmail},
+		{in: "foo@", err: ErrInvalidEmail},
+		{in: "foo@bar@gmail.com", err: ErrInvalidEmail},
+		{in: "foo bar@gmail.com", err: ErrInvalidEmail},
+	})
+	testTransform(t, "Email(Gmail)", Email(EmailOptions{Gmail: true}), []normalizeTest{
+		{in: "F.o.o+News@Gmail.com", want: "foo@gmail.com"},
+		{in: "foo@googlemail.com", want: "foo@gmail.com"},
+		{in: "f.o.o+news@example.com", want: "f.o.o+news@example.com"},
+		{in: "+news@gmail.com", err: ErrInvalidEmail},
+	})
+}
+
+func TestPhone(t *testing.T) {
+	testTransform(t, "Phone", Phone("1"), []normalizeTest{
+		{in: "+1 (514) 555-0123", want: "+15145550123"},
+		{in: "514.555.0123", want: "+15145550123"},
+		{in: "1-514-555-0123", want: "+15145550123"},
+		{in: "0044 20 7946 0958", want: "+442079460958"},
+		{in: "+44 20 7946 0958", want: "+442079460958"},
+		{in: "555-0123 ext 4", err: ErrInvalidPhone},
+		{in: "+1234", err: ErrInvalidPhone},
+		{in: "+1234567890123456", err: ErrInvalidPhone},
+	})
+	testTransform(t, "Phone", Phone("44"), []normalizeTest{
+		{in: "020 7946 0958", want: "+442079460958"},
+	})
+	testTransform(t, "Phone", Phone(""), []normalizeTest{
+		{in: "020 7946 0958", err: ErrInvalidPhone},
+		{in: "+442079460958", want: "+442079460958"},
+	})
+}
+
+func TestMAID(t *testing.T) {
+	testTransform(t, "MAID", MAID, []normalizeTest{
+		{in: "6D92078A-8246-4BA4-AE5B-76104861E7DC", want: "6d92078a-8246-4ba4-ae5b-76104861e7dc"},
+		{in: " 6d92078a82464ba4ae5b76104861e7dc\n", want: "6d92078a-8246-4ba4-ae5b-76104861e7dc"},
+		{in: "00000000-0000-0000-0000-000000000000", err: ErrInvalidMAID},
+		{in: "6d92078a-82464-ba4-ae5b-76104861e7dc", err: ErrInvalidMAID},
+		{in: "6d92078a-8246-4ba4-ae5b-76104861e7dz", err: ErrInvalidMAID},
+		{in: "6d92078a", err: ErrInvalidMAID},
+	})
+}
+
+func TestChain(t *testing.T) {
+	// the hashed emails have the format of test/emails
+	tr := Chain(Email(EmailOptions{}), SHA256Hex, Prefix(EmailPrefix))
+	got, err := tr([]byte(" Foo@Example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := emails.Prefix + "321ba197033e81286fedb719d60d4ed5cecaed170733cb4a92013811afc0e3b6"
+	if string(got) != want {
+		t.Errorf("expected %s, got %s", want, got)
+	}
+	if _, err := tr([]byte("foo")); !errors.Is(err, ErrInvalidEmail) {
+		t.Errorf("expected ErrInvalidEmail, got %v", err)
+	}
+}
+
+// recorder is a psi.Sender and a psi.Receiver recording its identifiers
+type recorder struct {
+	identifiers [][]byte
+}
+
+func (r *recorder) Send(ctx context.Context, n int64, identifiers <-chan []byte) error {
+	for identifier := range identifiers {
+		r.identifiers = append(r.identifiers, identifier)
+	}
+	return ctx.Err()
+}
+
+func (r *recorder) Intersect(ctx context.Context, n int64, identifiers <-chan []byte) ([][]byte, error) {
+	return r.identifiers, r.Send(ctx, n, identifiers)
+}
+
+func feed(identifiers ...string) <-chan []byte {
+	c := make(chan []byte)
+	go func() {
+		defer close(c)
+		for _, identifier := range identifiers {
+			c <- []byte(identifier)
+		}
+	}()
+	return c
+}
+
+func TestTransformer(t *testing.T) {
+	tr := Transformer{Transform: Email(EmailOptions{})}
+	r := &recorder{}
+	if err := tr.Sender(r).Send(context.Background(), 2, feed("A@b.c", " a@b.c")); err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]byte{[]byte("a@b.c"), []byte("a@b.c")}; !reflect.DeepEqual(r.identifiers, want) {
+		t.Errorf("expected %q, got %q", want, r.identifiers)
+	}
+
+	// invalid identifiers fail the run
+	r = &recorder{}
+	_, err := tr.Receiver(r).Intersect(context.Background(), 3, feed("a@b.c", "invalid", "c@d.e"))
+	if !errors.Is(err, ErrInvalidEmail) {
+		t.Errorf("expected ErrInvalidEmail, got %v", err)
+	}
+
+	// or are kept
+	tr.KeepInvalid = true
+	r = &recorder{}
+	intersection, err := tr.Receiver(r).Intersect(context.Background(), 3, feed("A@b.c", "Invalid", "c@d.e"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := [][]byte{[]byte("a@b.c"), []byte("Invalid"), []byte("c@d.e")}; !reflect.DeepEqual(intersection, want) {
+		t.Errorf("expected %q, got %q", want, intersection)
+	}
+}
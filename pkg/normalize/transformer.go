@@ -0,0 +1,110 @@
+package normalize
+
+import (
+	"context"
+	"errors"
+
+	"github.com/optable/match/pkg/psi"
+)
+
+// Transformer applies a Transform to the identifiers of a channel
+type Transformer struct {
+	// Transform normalizes each identifier
+	Transform Transform
+	// KeepInvalid passes the identifiers rejected by Transform through
+	// unchanged instead of failing the run. Invalid identifiers cannot be
+	// dropped since the number of identifiers is announced to the peer.
+	KeepInvalid bool
+}
+
+// Channel returns the identifiers read from in, transformed. If an identifier
+// is rejected and KeepInvalid is not set, its error, which must wrap
+// ErrInvalidIdentifier, is recorded as the cause of ctx, which the caller
+// derives with context.WithCancelCause along with cancel. The rest of in
+// is then drained and the returned channel is closed.
+func (t Transformer) Channel(ctx context.Context, cancel context.CancelCauseFunc, in <-chan []byte) <-chan []byte {
+	out := make(chan []byte)
+	go func() {
+		defer close(out)
+		for identifier := range in {
+			normalized, err := t.Transform(identifier)
+			if err != nil {
+				if !t.KeepInvalid {
+					cancel(err)
+					go drain(in)
+					return
+				}
+				normalized = identifier
+			}
+
+			select {
+			case out <- normalized:
+			case <-ctx.Done():
+				go drain(in)
+				return
+			}
+		}
+	}()
+
+	return out
+}
+
+// drain reads in to exhaustion so that its producer does not block
+func drain(in <-chan []byte) {
+	for range in {
+	}
+}
+
+// rejected returns the error of the identifier rejected
+// by the Transformer which canceled ctx, if any
+func rejected(ctx context.Context) error {
+	if cause := context.Cause(ctx); errors.Is(cause, ErrInvalidIdentifier) {
+		return cause
+	}
+	return nil
+}
+
+// Sender returns a psi.Sender transforming the identifiers before s sends them
+func (t Transformer) Sender(s psi.Sender) psi.Sender {
+	return sender{t: t, s: s}
+}
+
+// Receiver returns a psi.Receiver transforming the identifiers before r
+// intersects them. The intersection holds the transformed identifiers.
+func (t Transformer) Receiver(r psi.Receiver) psi.Receiver {
+	return receiver{t: t, r: r}
+}
+
+type sender struct {
+	t Transformer
+	s psi.Sender
+}
+
+// Send transforms the identifiers and sends them, returning
+// the error of the first rejected identifier if any
+func (s sender) Send(ctx context.Context, n int64, identifiers <-chan []byte) error {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	err := s.s.Send(ctx, n, s.t.Channel(ctx, cancel, identifiers))
+	if cause := rejected(ctx); cause != nil {
+		return cause
+	}
+	return err
+}
+
+type receiver struct {
+	t Transformer
+	r psi.Receiver
+}
+
+// Intersect transforms the identifiers and intersects them,
+// returning the error of the first rejected identifier if any
+func (r receiver) Intersect(ctx context.Context, n int64, identifiers <-chan []byte) ([][]byte, error) {
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	intersection, err := r.r.Intersect(ctx, n, r.t.Channel(ctx, cancel, identifiers))
+	if cause := rejected(ctx); cause != nil {
+		return nil, cause
+	}
+	return intersection, err
+}
@@ -2,39 +2,126 @@ package npsi
 
 import (
 	"encoding/binary"
+	"fmt"
 	"io"
 
 	"github.com/optable/match/internal/hash"
+	"github.com/optable/match/pkg/digest"
+	"github.com/optable/match/pkg/limits"
 )
 
+// sum is a 128 bits hash truncated to the
+// digest length, and zero padded to digest.MaxLen
+type sum [digest.MaxLen]byte
+
 type hashPair struct {
 	x []byte
-	h uint64
+	h sum
+}
+
+// hashSum returns the hash of x truncated to l bytes
+func hashSum(h hash.Hasher128, x []byte, l int) (s sum) {
+	lo, hi := h.Hash128(x)
+	binary.BigEndian.PutUint64(s[:], lo)
+	binary.BigEndian.PutUint64(s[8:], hi)
+	clear(s[l:])
+	return s
 }
 
-// HashRead reads one hash
-func HashRead(r io.Reader, u *uint64) (err error) {
-	err = binary.Read(r, binary.BigEndian, u)
+// HashRead reads one hash of len(h) bytes
+func HashRead(r io.Reader, h []byte) (err error) {
+	_, err = io.ReadFull(r, h)
 	return
 }
 
 // HashWrite writes one hash out
-func HashWrite(w io.Writer, u uint64) error {
-	return binary.Write(w, binary.BigEndian, u)
+func HashWrite(w io.Writer, h []byte) error {
+	_, err := w.Write(h)
+	return err
+}
+
+// lenWrite writes the length of the hashes out
+func lenWrite(w io.Writer, l int) error {
+	return binary.Write(w, binary.BigEndian, uint8(l))
+}
+
+// lenRead reads the length of the hashes
+func lenRead(r io.Reader, l *int) error {
+	var u uint8
+	if err := binary.Read(r, binary.BigEndian, &u); err != nil {
+		return err
+	}
+	*l = int(u)
+	return nil
+}
+
+// classWrite writes the size class of a set of n identifiers out,
+// the sender only needs it to select the length of the hashes
+func classWrite(w io.Writer, n int64) error {
+	return binary.Write(w, binary.BigEndian, uint8(digest.Class(n)))
+}
+
+// classRead reads the size class of the set of the receiver,
+// and validates it against l
+func classRead(r io.Reader, l limits.Limits, class *int) error {
+	var u uint8
+	if err := binary.Read(r, binary.BigEndian, &u); err != nil {
+		return err
+	}
+	if u > digest.MaxClass {
+		return fmt.Errorf("%w: size class %d", limits.ErrInvalidCardinality, u)
+	}
+	if l.MaxCardinality > 0 && int(u) > digest.Class(l.MaxCardinality) {
+		return fmt.Errorf("%w: size class %d > %d", limits.ErrCardinalityExceeded, u, digest.Class(l.MaxCardinality))
+	}
+	*class = int(u)
+	return nil
+}
+
+// headerRead reads the number of hashes the sender is about to write and
+// their length, and validates them against l and the minimum length minLen
+func headerRead(r io.Reader, l limits.Limits, minLen int) (n int64, hashLen int, err error) {
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return 0, 0, err
+	}
+	if err := l.CheckCardinality(n); err != nil {
+		return 0, 0, err
+	}
+	if err := lenRead(r, &hashLen); err != nil {
+		return 0, 0, err
+	}
+	if err := digest.Check(minLen, hashLen); err != nil {
+		return 0, 0, err
+	}
+	return n, hashLen, nil
+}
+
+// hasherWrite writes the hash function out
+func hasherWrite(w io.Writer, id hash.ID) error {
+	return binary.Write(w, binary.BigEndian, uint8(id))
+}
+
+// hasherRead reads the hash function
+func hasherRead(r io.Reader, id *hash.ID) error {
+	var u uint8
+	if err := binary.Read(r, binary.BigEndian, &u); err != nil {
+		return err
+	}
+	*id = hash.ID(u)
+	return nil
 }
 
-// ReadAll reads from r until io.EOF and writes into a channel.
-// note that binary.Read will return EOF only if no bytes
-// are read and if an EOF happens after reading some but not all the bytes,
-// Read returns ErrUnexpectedEOF.
-func ReadAll(r io.Reader, n int64) <-chan uint64 {
-	var out = make(chan uint64)
+// ReadAll reads n hashes of l bytes from r and writes them into a channel.
+// It stops at the first error, io.EOF if no bytes are read
+// and io.ErrUnexpectedEOF if a hash is cut short.
+func ReadAll(r io.Reader, n int64, l int) <-chan sum {
+	var out = make(chan sum)
 	go func() {
 		defer close(out)
 		for i := int64(0); i < n; i++ {
-			var u uint64
-			if err := HashRead(r, &u); err == nil {
-				out <- u
+			var s sum
+			if err := HashRead(r, s[:l]); err == nil {
+				out <- s
 			} else {
 				return
 			}
@@ -43,17 +130,16 @@ func ReadAll(r io.Reader, n int64) <-chan uint64 {
 	return out
 }
 
-// HashAll reads all identifiers from identifiers
-// and hashes them until identifiers closes
-func HashAll(h hash.Hasher, identifiers <-chan []byte) <-chan hashPair {
+// HashAll reads all identifiers from identifiers and
+// hashes them to l bytes until identifiers closes
+func HashAll(h hash.Hasher128, l int, identifiers <-chan []byte) <-chan hashPair {
 	var pairs = make(chan hashPair)
 
 	// just read and hash baby
 	go func() {
 		defer close(pairs)
 		for identifier := range identifiers {
-			h := h.Hash64(identifier)
-			pairs <- hashPair{x: identifier, h: h}
+			pairs <- hashPair{x: identifier, h: hashSum(h, identifier, l)}
 		}
 	}()
 	return pairs
@@ -0,0 +1,72 @@
+package npsi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/optable/match/pkg/digest"
+	"github.com/optable/match/pkg/limits"
+)
+
+// fuzzLimits are small enough that an adversarial
+// header can never make the fuzzer allocate much
+var fuzzLimits = limits.Limits{MaxCardinality: 1 << 12, MaxBytes: 1 << 20}
+
+// header returns the wire encoding of the stage 2 header
+// of a sender of n hashes of length l
+func header(n int64, l uint8) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, n)
+	binary.Write(&b, binary.BigEndian, l)
+	return b.Bytes()
+}
+
+func FuzzHeaderRead(f *testing.F) {
+	for _, n := range []int64{0, 1, -1, 1 << 12, 1<<12 + 1, math.MaxInt64, math.MinInt64} {
+		for _, l := range []uint8{0, 1, 8, digest.MaxLen, digest.MaxLen + 1, math.MaxUint8} {
+			f.Add(header(n, l))
+		}
+	}
+	f.Add([]byte{})
+	f.Add([]byte{0, 0, 0})
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		n, l, err := headerRead(bytes.NewReader(b), fuzzLimits, 0)
+		if err != nil {
+			if len(b) >= 9 && !errors.Is(err, limits.ErrInvalidCardinality) && !errors.Is(err, limits.ErrCardinalityExceeded) && !errors.Is(err, digest.ErrInvalidLen) {
+				t.Fatalf("unexpected error on a complete header: %v", err)
+			}
+			return
+		}
+		if n < 0 || n > fuzzLimits.MaxCardinality {
+			t.Fatalf("accepted an announced size of %d", n)
+		}
+		if l < 1 || l > digest.MaxLen {
+			t.Fatalf("accepted a hash length of %d", l)
+		}
+	})
+}
+
+func FuzzClassRead(f *testing.F) {
+	for _, c := range []uint8{0, 1, 12, 13, digest.MaxClass, digest.MaxClass + 1, math.MaxUint8} {
+		f.Add([]byte{c})
+	}
+	f.Add([]byte{})
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var class int
+		err := classRead(bytes.NewReader(b), fuzzLimits, &class)
+		if err != nil {
+			if len(b) >= 1 && !errors.Is(err, limits.ErrInvalidCardinality) && !errors.Is(err, limits.ErrCardinalityExceeded) {
+				t.Fatalf("unexpected error on a complete header: %v", err)
+			}
+			return
+		}
+		if n := digest.ClassSize(class); n < 0 || n > fuzzLimits.MaxCardinality {
+			t.Fatalf("accepted the size class %d", class)
+		}
+	})
+}
@@ -16,10 +16,11 @@ var hOpBus = make(chan hOp)
 // hOp is a hash operation
 // being sent to the hashing engine
 type hOp struct {
-	hh hash.Hasher
+	hh hash.Hasher128
+	hl int // length of the hashes
 	l  int
 	x  [][]byte
-	h  []uint64
+	h  []sum
 	f  func(h hOp)
 }
 
@@ -27,9 +28,9 @@ func handler() {
 	for {
 		select {
 		case op := <-hOpBus:
-			var h = make([]uint64, op.l)
+			var h = make([]sum, op.l)
 			for i := 0; i < op.l; i++ {
-				h[i] = op.hh.Hash64(op.x[i])
+				h[i] = hashSum(op.hh, op.x[i], op.hl)
 			}
 			op.h = h
 			op.f(op)
@@ -44,9 +45,9 @@ func init() {
 	}
 }
 
-// HashAllParallel reads all identifiers from identifiers
-// and parallel hashes them until identifiers closes
-func HashAllParallel(h hash.Hasher, identifiers <-chan []byte) <-chan hashPair {
+// HashAllParallel reads all identifiers from identifiers and
+// parallel hashes them to l bytes until identifiers closes
+func HashAllParallel(h hash.Hasher128, l int, identifiers <-chan []byte) <-chan hashPair {
 	// one wg.Add() per batch + one for the batcher go routine
 	var wg sync.WaitGroup
 	var pairs = make(chan hashPair)
@@ -70,7 +71,7 @@ func HashAllParallel(h hash.Hasher, identifiers <-chan []byte) <-chan hashPair {
 		defer wg.Done()
 		var i = 0
 		// init a first batch
-		var batch = makeOp(h, batchSize, f)
+		var batch = makeOp(h, l, batchSize, f)
 		for identifier := range identifiers {
 			// accumulate a batch
 			batch.x[i] = identifier
@@ -80,7 +81,7 @@ func HashAllParallel(h hash.Hasher, identifiers <-chan []byte) <-chan hashPair {
 				wg.Add(1)
 				hOpBus <- batch
 				// reset batch
-				batch = makeOp(h, batchSize, f)
+				batch = makeOp(h, l, batchSize, f)
 				i = 0
 			}
 		}
@@ -101,6 +102,6 @@ func HashAllParallel(h hash.Hasher, identifiers <-chan []byte) <-chan hashPair {
 	return pairs
 }
 
-func makeOp(hh hash.Hasher, l int, f func(hOp)) hOp {
-	return hOp{hh: hh, l: l, x: make([][]byte, l), f: f}
+func makeOp(hh hash.Hasher128, hl, l int, f func(hOp)) hOp {
+	return hOp{hh: hh, hl: hl, l: l, x: make([][]byte, l), f: f}
 }
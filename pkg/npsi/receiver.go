@@ -4,27 +4,31 @@ import (
 	"bufio"
 	"context"
 	"crypto/rand"
-	"encoding/binary"
+	"fmt"
 	"io"
 	"sync"
 
 	"github.com/go-logr/logr"
 	"github.com/optable/match/internal/hash"
 	"github.com/optable/match/internal/util"
+	"github.com/optable/match/pkg/digest"
+	"github.com/optable/match/pkg/options"
 )
 
-// stage 1: P2 samples a random salt K and sends it to P1.
+// stage 1: P2 samples a random salt K and sends it to P1, along with
+//          the hash function it selected and its size class.
 // stage 2: P2 receives hashes from P1 and computes the intersection with its own hashes
 
 // Receiver represents the receiver side of the NPSI protocol
 type Receiver struct {
-	rw *bufio.ReadWriter
+	rw   *bufio.ReadWriter
+	opts options.Options
 }
 
 // NewReceiver returns a receiver initialized to
 // use rw as a buffered communication layer
-func NewReceiver(rw io.ReadWriter) *Receiver {
-	return &Receiver{rw: bufio.NewReadWriter(bufio.NewReader(rw), bufio.NewWriter(rw))}
+func NewReceiver(rw io.ReadWriter, opts ...options.Option) *Receiver {
+	return &Receiver{rw: bufio.NewReadWriter(bufio.NewReader(rw), bufio.NewWriter(rw)), opts: options.New(opts...)}
 }
 
 // Intersect intersects on matchables read from the identifiers channel,
@@ -35,21 +39,40 @@ func (r *Receiver) Intersect(ctx context.Context, n int64, identifiers <-chan []
 	// fetch and set up logger
 	logger := logr.FromContextOrDiscard(ctx)
 	logger = logger.WithValues("protocol", "npsi")
+	// fetch the limits enforced on the sender
+	l := r.opts.Limits
+	rd := l.Reader(r.rw)
 
 	var intersected [][]byte
 	var k = make([]byte, hash.SaltLength)
+	var id options.Hasher
 
-	// stage 1: P2 samples a random salt K and sends it to P1.
+	// stage 1: P2 samples a random salt K and sends it to P1, along with
+	// the hash function it selected and its size class.
 	stage1 := func() error {
 		logger.V(1).Info("Starting stage 1")
 		// stage1.1: generate a SaltLength salt
 		if _, err := rand.Read(k); err != nil {
 			return err
 		}
-		// stage1.2: send k to the sender
+		// stage1.2: select the hash function
+		id = r.opts.Hasher
+		if err := r.opts.CheckHasher(id); err != nil {
+			return fmt.Errorf("stage1: %w", err)
+		}
+		logger.V(1).Info("selected hash function", "hasher", id.String())
+		// stage1.3: send k and the hash function to the sender
 		if _, err := r.rw.Write(k); err != nil {
 			return err
 		}
+		if err := hasherWrite(r.rw, id); err != nil {
+			return err
+		}
+		// stage1.4: send the size class, from which the sender
+		// selects the length of the hashes, rather than the size
+		if err := classWrite(r.rw, n); err != nil {
+			return err
+		}
 		r.rw.Flush()
 
 		logger.V(1).Info("Finished stage 1")
@@ -60,35 +83,41 @@ func (r *Receiver) Intersect(ctx context.Context, n int64, identifiers <-chan []
 	stage2v2 := func() error {
 		logger.V(1).Info("Starting stage 2")
 
-		var localIDs = make(map[uint64][]byte)
-		var remoteIDs = make(map[uint64]bool)
+		var localIDs = make(map[sum][]byte)
+		var remoteIDs = make(map[sum]bool)
 		// get a hasher
-		h, err := hash.NewMetroHasher(k)
+		h, err := hash.New(id, k)
 		if err != nil {
 			return err
 		}
-		// sender sends the number
-		// of items its about to write first
-		var n int64
-		if err := binary.Read(r.rw, binary.BigEndian, &n); err != nil {
-			return err
+		// sender sends the number of items its about
+		// to write first, and the length of the hashes
+		remoteN, hashLen, err := headerRead(rd, l, r.opts.DigestLen)
+		if err != nil {
+			return fmt.Errorf("stage2: %w", err)
 		}
+		digest.Log(logger, n, remoteN, hashLen)
 		//
 		// stage2 : P2 receives hashes from P1 (Hi) and computes its own hashes from Xj,
 		// then the intersection with its own hashes (Hj)
 		//
-		// make a channel to receive hashes from the sender
-		sender := ReadAll(r.rw, n)
 		// make a channel to receive local x,h pairs
-		receiver := HashAllParallel(h, identifiers)
+		receiver := HashAllParallel(h, hashLen, identifiers)
 		// try to intersect and throw out intersected hashes as we get them
 		var wg sync.WaitGroup
+		var readErr error
 		// intersect
 		wg.Add(2)
 		go func() {
-			// index the sender
+			// index the sender, a stream cut
+			// short is reported instead of ignored
 			defer wg.Done()
-			for h := range sender {
+			for i := int64(0); i < remoteN; i++ {
+				var h sum
+				if err := HashRead(rd, h[:hashLen]); err != nil {
+					readErr = err
+					return
+				}
 				remoteIDs[h] = true
 			}
 		}()
@@ -101,6 +130,9 @@ func (r *Receiver) Intersect(ctx context.Context, n int64, identifiers <-chan []
 		}()
 		// let the indexing finish
 		wg.Wait()
+		if readErr != nil {
+			return fmt.Errorf("stage2: %w", readErr)
+		}
 		// intersect
 		for h, x := range localIDs {
 			if remoteIDs[h] {
@@ -114,12 +146,12 @@ func (r *Receiver) Intersect(ctx context.Context, n int64, identifiers <-chan []
 	}
 
 	// run stage 1
-	if err := util.Sel(ctx, stage1); err != nil {
+	if err := util.Sel(ctx, l.StageTimeout, stage1); err != nil {
 		return nil, err
 	}
 
 	// run stage 2
-	if err := util.Sel(ctx, stage2v2); err != nil {
+	if err := util.Sel(ctx, l.StageTimeout, stage2v2); err != nil {
 		return intersected, err
 	}
 
@@ -10,20 +10,24 @@ import (
 	"github.com/go-logr/logr"
 	"github.com/optable/match/internal/hash"
 	"github.com/optable/match/internal/util"
+	"github.com/optable/match/pkg/digest"
+	"github.com/optable/match/pkg/options"
 )
 
-// stage 1: receive a random salt K from P1
-// stage 2: send hashes salted with K to P1
+// stage 1: receive a random salt K, the hash function and the size class of P2 from P2
+// stage 2: send hashes salted with K to P2, truncated to a length
+//          selected from the size class of P2 and the size of P1
 
 // Sender represents sender side of the NPSI protocol
 type Sender struct {
-	rw *bufio.ReadWriter
+	rw   *bufio.ReadWriter
+	opts options.Options
 }
 
 // NewSender returns a sender initialized to
 // use rw as the communication layer
-func NewSender(rw io.ReadWriter) *Sender {
-	return &Sender{rw: bufio.NewReadWriter(bufio.NewReader(rw), bufio.NewWriter(rw))}
+func NewSender(rw io.ReadWriter, opts ...options.Option) *Sender {
+	return &Sender{rw: bufio.NewReadWriter(bufio.NewReader(rw), bufio.NewWriter(rw)), opts: options.New(opts...)}
 }
 
 // Send initiates a NPSI exchange
@@ -35,40 +39,68 @@ func (s *Sender) Send(ctx context.Context, n int64, identifiers <-chan []byte) e
 	// fetch and set up logger
 	logger := logr.FromContextOrDiscard(ctx)
 	logger = logger.WithValues("protocol", "npsi")
+	// fetch the limits enforced on the receiver
+	l := s.opts.Limits
+	rd := l.Reader(s.rw)
 
 	// hold k
 	var k = make([]byte, hash.SaltLength)
-	// stage 1: receive a random salt K from P1
+	var id options.Hasher
+	var remoteClass int
+	// stage 1: receive a random salt K, the hash function and the size class of P2 from P2
 	stage1 := func() error {
 		logger.V(1).Info("Starting stage 1")
-		if n, err := s.rw.Read(k); err != nil {
+		if n, err := io.ReadFull(rd, k); err != nil {
 			return fmt.Errorf("stage1: %v", err)
 		} else if n != hash.SaltLength {
 			return hash.ErrSaltLengthMismatch
 		}
+		// check the hash function selected by the receiver
+		if err := hasherRead(rd, &id); err != nil {
+			return fmt.Errorf("stage1: %v", err)
+		}
+		if err := s.opts.CheckHasher(id); err != nil {
+			return fmt.Errorf("stage1: %w", err)
+		}
+		logger.V(1).Info("received hash function", "hasher", id.String())
+		if err := classRead(rd, l, &remoteClass); err != nil {
+			return fmt.Errorf("stage1: %w", err)
+		}
 
 		logger.V(1).Info("Finished stage 1")
 		return nil
 	}
 
-	// stage 2: send hashes salted with K to P1
+	// stage 2: send hashes salted with K to P2
 	stage2 := func() error {
 		logger.V(1).Info("Starting stage 2")
 		// get a hasher
-		h, err := hash.NewMetroHasher(k)
+		h, err := hash.New(id, k)
 		if err != nil {
 			return err
 		}
+		// select the length of the hashes, from the
+		// largest size of the size class of P2
+		remoteN := digest.ClassSize(remoteClass)
+		hashLen, err := digest.Select(s.opts.DigestLen, remoteN, n)
+		if err != nil {
+			return fmt.Errorf("stage2: %w", err)
+		}
+		digest.Log(logger, remoteN, n, hashLen)
 		// inform the receiver of the size
-		// its about to receive
+		// its about to receive, and of the
+		// length of the hashes
 		if err := binary.Write(s.rw, binary.BigEndian, &n); err != nil {
 			return err
 		}
+		if err := lenWrite(s.rw, hashLen); err != nil {
+			return err
+		}
 		// make a channel to receive local x,h pairs
-		sender := HashAllParallel(h, identifiers)
+		sender := HashAllParallel(h, hashLen, identifiers)
 		// exhaust the hashes into the receiver
 		for hash := range sender {
-			if err := HashWrite(s.rw, hash.h); err != nil {
+			if err := HashWrite(s.rw, hash.h[:hashLen]); err != nil {
 				return fmt.Errorf("stage2: %v", err)
 			}
 		}
@@ -79,11 +111,11 @@ func (s *Sender) Send(ctx context.Context, n int64, identifiers <-chan []byte) e
 	}
 
 	// run stage1
-	if err := util.Sel(ctx, stage1); err != nil {
+	if err := util.Sel(ctx, l.StageTimeout, stage1); err != nil {
 		return err
 	}
 	// run stage 2
-	if err := util.Sel(ctx, stage2); err != nil {
+	if err := util.Sel(ctx, l.StageTimeout, stage2); err != nil {
 		return err
 	}
 
@@ -0,0 +1,216 @@
+// Package options configures the senders and receivers of the PSI protocols:
+// the limits enforced on the peer, and the parameters a party selects and
+// announces to its peer, or checks when its peer announces them. Options are
+// passed to the constructors of the senders and receivers:
+//
+//	r, err := psi.NewReceiver(protocol, rw,
+//		options.WithLimits(limits.Limits{MaxCardinality: 1 << 30}),
+//		options.WithHasher(options.HashSipHash), options.WithPRFRequired())
+//
+// A protocol ignores the options it has no use for.
+package options
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/optable/match/internal/crypto"
+	"github.com/optable/match/internal/hash"
+	"github.com/optable/match/internal/ot"
+	"github.com/optable/match/pkg/limits"
+)
+
+// Hasher identifies a hash function
+type Hasher = hash.ID
+
+const (
+	// HashMetro is MetroHash, the default
+	HashMetro = hash.Metro
+	// HashMurmur3 is Murmur3
+	HashMurmur3 = hash.Murmur3
+	// HashSipHash is SipHash-2-4, a keyed PRF
+	HashSipHash = hash.SipHash
+	// HashBlake3 is keyed BLAKE3, a keyed PRF
+	HashBlake3 = hash.Blake3
+	// HashXXH3 is XXH3
+	HashXXH3 = hash.XXH3
+)
+
+// PRG identifies a pseudorandom generator
+type PRG = crypto.PRG
+
+const (
+	// PRGBlake3 is the BLAKE3 XOF, the default
+	PRGBlake3 = crypto.PRGBlake3
+	// PRGAESCTR is AES-128 in counter mode
+	PRGAESCTR = crypto.PRGAESCTR
+	// PRGCTRDRBG is the CTR_DRBG of NIST SP 800-90A with AES-256
+	PRGCTRDRBG = crypto.PRGCTRDRBG
+)
+
+// BaseOT identifies the base OT of an OT extension
+type BaseOT uint8
+
+const (
+	// BaseOTNaorPinkas is the Naor-Pinkas OT on P-256, the default
+	BaseOTNaorPinkas BaseOT = ot.NaorPinkas
+	// BaseOTSimplest is the Simplest OT of Chou and Orlandi on ristretto255
+	BaseOTSimplest BaseOT = ot.Simplest
+	// BaseOTMasnyRindal is the endorsement OT of Masny and Rindal on ristretto255
+	BaseOTMasnyRindal BaseOT = ot.MasnyRindal
+)
+
+// String returns the name of b
+func (b BaseOT) String() string {
+	switch b {
+	case BaseOTNaorPinkas:
+		return "naor-pinkas"
+	case BaseOTSimplest:
+		return "simplest"
+	case BaseOTMasnyRindal:
+		return "masny-rindal"
+	default:
+		return "unknown"
+	}
+}
+
+var (
+	// ErrUnknownHasher is returned for an unknown hash function
+	ErrUnknownHasher = hash.ErrUnknownHasher
+	// ErrNotPRF is returned when a hash function which is not a
+	// keyed PRF is selected while a keyed PRF is required
+	ErrNotPRF = errors.New("hash function is not a keyed PRF")
+	// ErrUnknownPRG is returned for an unknown pseudorandom generator
+	ErrUnknownPRG = crypto.ErrUnknownPRG
+	// ErrNotDRBG is returned when a pseudorandom generator which is not
+	// a NIST SP 800-90A DRBG is selected while a DRBG is required
+	ErrNotDRBG = errors.New("pseudorandom generator is not a NIST SP 800-90A DRBG")
+	// ErrUnknownBaseOT is returned for an unknown base OT
+	ErrUnknownBaseOT = ot.ErrUnknownOT
+)
+
+// Cuckoo holds the parameters of the cuckoo hash table of the kkrtpsi
+// receiver. A zero field selects the default: 3 hash functions, a factor of
+// 1.4 and a stash of 2 slots. A larger factor lowers the failure probability
+// of larger sets, at the cost of more buckets.
+type Cuckoo struct {
+	// Nhash is the number of hash functions, between 3 and 8
+	Nhash int
+	// Factor is the number of buckets per item, between 1 and 4
+	Factor float64
+	// StashSize is the number of slots of the stash, at most 64,
+	// or -1 for no stash
+	StashSize int
+}
+
+// Options holds the configuration of a sender or a receiver.
+// The zero value of a field selects its default.
+type Options struct {
+	// Limits are the resource limits enforced on the peer,
+	// limits.Default() unless set with WithLimits
+	Limits limits.Limits
+	// DigestLen is the length in bytes of the digests compared by kkrtpsi,
+	// npsi and volepsi. On the sender, it replaces the automatic length
+	// digest.Len. On the receiver, it is the minimum length accepted.
+	DigestLen int
+	// Hasher is the hash function selected by the party
+	// which samples the salts: the npsi receiver, and the kkrtpsi sender
+	Hasher Hasher
+	// RequirePRF requires a keyed PRF, both when selecting the
+	// hash function and when checking the one of the peer
+	RequirePRF bool
+	// PRG is the pseudorandom generator of the OT extension
+	// of the kkrtpsi OPRF, selected by the sender
+	PRG PRG
+	// RequireDRBG requires a NIST SP 800-90A DRBG, both when selecting
+	// the pseudorandom generator and when checking the one of the peer
+	RequireDRBG bool
+	// Cuckoo are the parameters of the cuckoo hash table
+	// of the kkrtpsi receiver, selected by the sender
+	Cuckoo Cuckoo
+	// BaseOT is the base OT of the OT extension
+	// of the kkrtpsi OPRF, selected by the sender
+	BaseOT BaseOT
+}
+
+// Option sets a field of Options
+type Option func(*Options)
+
+// New returns the Options set by opts, applied in order
+func New(opts ...Option) Options {
+	o := Options{Limits: limits.Default()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithLimits sets the limits enforced on the peer
+func WithLimits(l limits.Limits) Option {
+	return func(o *Options) { o.Limits = l }
+}
+
+// WithDigestLen sets the length in bytes of the digests
+func WithDigestLen(l int) Option {
+	return func(o *Options) { o.DigestLen = l }
+}
+
+// WithHasher sets the hash function
+func WithHasher(h Hasher) Option {
+	return func(o *Options) { o.Hasher = h }
+}
+
+// WithPRFRequired requires a keyed PRF as hash function
+func WithPRFRequired() Option {
+	return func(o *Options) { o.RequirePRF = true }
+}
+
+// WithPRG sets the pseudorandom generator
+func WithPRG(p PRG) Option {
+	return func(o *Options) { o.PRG = p }
+}
+
+// WithDRBGRequired requires a NIST SP 800-90A DRBG as pseudorandom generator
+func WithDRBGRequired() Option {
+	return func(o *Options) { o.RequireDRBG = true }
+}
+
+// WithCuckoo sets the parameters of the cuckoo hash table
+func WithCuckoo(c Cuckoo) Option {
+	return func(o *Options) { o.Cuckoo = c }
+}
+
+// WithBaseOT sets the base OT
+func WithBaseOT(b BaseOT) Option {
+	return func(o *Options) { o.BaseOT = b }
+}
+
+// CheckHasher validates the hash function h against o
+func (o Options) CheckHasher(h Hasher) error {
+	if !h.Valid() {
+		return fmt.Errorf("%w: %d", ErrUnknownHasher, h)
+	}
+	if o.RequirePRF && !h.PRF() {
+		return fmt.Errorf("%w: %s", ErrNotPRF, h)
+	}
+	return nil
+}
+
+// CheckPRG validates the pseudorandom generator p against o
+func (o Options) CheckPRG(p PRG) error {
+	if !p.Valid() {
+		return fmt.Errorf("%w: %d", ErrUnknownPRG, p)
+	}
+	if o.RequireDRBG && !p.DRBG() {
+		return fmt.Errorf("%w: %s", ErrNotDRBG, p)
+	}
+	return nil
+}
+
+// CheckBaseOT validates the base OT b
+func (o Options) CheckBaseOT(b BaseOT) error {
+	if b > BaseOTMasnyRindal {
+		return fmt.Errorf("%w: %d", ErrUnknownBaseOT, b)
+	}
+	return nil
+}
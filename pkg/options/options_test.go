@@ -0,0 +1,42 @@
+package options
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/optable/match/pkg/limits"
+)
+
+func TestNew(t *testing.T) {
+	if o := New(); o.Limits.MaxCardinality != limits.DefaultMaxCardinality || o.Hasher != HashMetro || o.PRG != PRGBlake3 || o.BaseOT != BaseOTNaorPinkas {
+		t.Errorf("expected the defaults, got %+v", o)
+	}
+
+	o := New(WithDigestLen(8), WithHasher(HashSipHash), WithDigestLen(12))
+	if o.DigestLen != 12 || o.Hasher != HashSipHash {
+		t.Errorf("expected the options to be applied in order, got %+v", o)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"metro", New().CheckHasher(HashMetro), nil},
+		{"metro with PRF", New(WithPRFRequired()).CheckHasher(HashMetro), ErrNotPRF},
+		{"siphash with PRF", New(WithPRFRequired()).CheckHasher(HashSipHash), nil},
+		{"unknown hasher", New().CheckHasher(255), ErrUnknownHasher},
+		{"aes-ctr", New().CheckPRG(PRGAESCTR), nil},
+		{"aes-ctr with DRBG", New(WithDRBGRequired()).CheckPRG(PRGAESCTR), ErrNotDRBG},
+		{"ctr-drbg with DRBG", New(WithDRBGRequired()).CheckPRG(PRGCTRDRBG), nil},
+		{"unknown PRG", New().CheckPRG(255), ErrUnknownPRG},
+		{"masny-rindal", New().CheckBaseOT(BaseOTMasnyRindal), nil},
+		{"unknown base OT", New().CheckBaseOT(BaseOTMasnyRindal + 1), ErrUnknownBaseOT},
+	} {
+		if !errors.Is(c.err, c.want) || (c.want == nil && c.err != nil) {
+			t.Errorf("%s: expected %v, got %v", c.name, c.want, c.err)
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package psi
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+	mrand "math/rand/v2"
+	"slices"
+
+	"github.com/zeebo/blake3"
+)
+
+const (
+	// dummyLen is the length of the random dummy identifiers,
+	// which are too long to ever be guessed by a peer
+	dummyLen = 32
+	// nonceLen is the length of the random nonce of a tagged
+	// dummy, followed by its tag
+	nonceLen = 16
+)
+
+var (
+	ErrInvalidPadding = errors.New("padded size is smaller than the number of identifiers")
+	// ErrTooManyIdentifiers is returned when a padded Sender or
+	// Receiver reads more identifiers than the n it was called with
+	ErrTooManyIdentifiers = errors.New("more identifiers than announced")
+)
+
+// A Padding hides the number of identifiers of a Sender or a Receiver from
+// its peer by padding them with random dummy identifiers to a bucket size,
+// announced to the peer instead. The dummies are interleaved with the
+// identifiers at random positions, never match those of the peer, and are
+// stripped from the intersection of a Receiver, which recognises them by a
+// tag keyed for the run. Reading more than n identifiers fails the run with
+// ErrTooManyIdentifiers. Called with UnknownN, the identifiers are spooled
+// to be counted first, see Spool.
+type Padding struct {
+	// Size returns the padded size of n identifiers, such as PowerOfTwo
+	Size func(n int64) int64
+}
+
+// PowerOfTwo pads n to the next power of two
+func PowerOfTwo(n int64) int64 {
+	if n <= 1 {
+		return 1
+	}
+	return 1 << bits.Len64(uint64(n-1))
+}
+
+// Buckets returns the Size padding n to the smallest of sizes
+// holding it, or else to the next multiple of the largest one
+func Buckets(sizes ...int64) func(n int64) int64 {
+	sizes = slices.Clone(sizes)
+	slices.Sort(sizes)
+	return func(n int64) int64 {
+		for _, size := range sizes {
+			if size >= n {
+				return size
+			}
+		}
+		if len(sizes) == 0 || sizes[len(sizes)-1] <= 0 {
+			return n
+		}
+		largest := sizes[len(sizes)-1]
+		return (n + largest - 1) / largest * largest
+	}
+}
+
+// Sender returns a psi.Sender padding the identifiers s sends
+func (p Padding) Sender(s Sender) Sender {
+	return paddedSender{p: p, s: s}
+}
+
+// Receiver returns a psi.Receiver padding the identifiers r intersects
+func (p Padding) Receiver(r Receiver) Receiver {
+	return paddedReceiver{p: p, r: r}
+}
+
+type paddedSender struct {
+	p Padding
+	s Sender
+}
+
+// Send pads the identifiers and sends them
+func (s paddedSender) Send(ctx context.Context, n int64, identifiers <-chan []byte) error {
+	if n == UnknownN {
+		return Spool{}.run(ctx, identifiers, s.Send)
+	}
+
+	size := s.p.Size(n)
+	if size < n {
+		return ErrInvalidPadding
+	}
+	d, err := newDummies(false)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	padded, errs := pad(ctx, d, n, size, identifiers)
+	err = s.s.Send(ctx, size, padded)
+	cancel()
+	if perr := <-errs; perr != nil {
+		return perr
+	}
+	return err
+}
+
+type paddedReceiver struct {
+	p Padding
+	r Receiver
+}
+
+// Intersect pads the identifiers and intersects
+// them, stripping the dummies from the intersection
+func (r paddedReceiver) Intersect(ctx context.Context, n int64, identifiers <-chan []byte) ([][]byte, error) {
+	if n == UnknownN {
+		var intersection [][]byte
+		err := Spool{}.run(ctx, identifiers, func(ctx context.Context, n int64, identifiers <-chan []byte) (err error) {
+			intersection, err = r.Intersect(ctx, n, identifiers)
+			return err
+		})
+		return intersection, err
+	}
+
+	size := r.p.Size(n)
+	if size < n {
+		return nil, ErrInvalidPadding
+	}
+	d, err := newDummies(true)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	padded, errs := pad(ctx, d, n, size, identifiers)
+	intersection, err := r.r.Intersect(ctx, size, padded)
+	cancel()
+	if perr := <-errs; perr != nil {
+		return nil, perr
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return slices.DeleteFunc(intersection, d.is), nil
+}
+
+// dummies generates the random dummy identifiers of a run
+type dummies struct {
+	// rng is the source of the positions and the bytes of dummies
+	rng *mrand.Rand
+	// mac tags the dummies, nil if they are never stripped
+	mac *blake3.Hasher
+}
+
+// newDummies returns dummies seeded from crypto/rand,
+// tagged under a random key if tagged is set
+func newDummies(tagged bool) (*dummies, error) {
+	var seed [32]byte
+	if _, err := rand.Read(seed[:]); err != nil {
+		return nil, err
+	}
+	d := &dummies{rng: mrand.New(mrand.NewChaCha8(seed))}
+	if tagged {
+		var key [32]byte
+		if _, err := rand.Read(key[:]); err != nil {
+			return nil, err
+		}
+		mac, err := blake3.NewKeyed(key[:])
+		if err != nil {
+			return nil, err
+		}
+		d.mac = mac
+	}
+	return d, nil
+}
+
+// next returns a new dummy: random bytes, or if d is
+// tagged a random nonce followed by its tag
+func (d *dummies) next() []byte {
+	dummy := make([]byte, dummyLen)
+	for i := 0; i < dummyLen; i += 8 {
+		binary.LittleEndian.PutUint64(dummy[i:], d.rng.Uint64())
+	}
+	if d.mac != nil {
+		copy(dummy[nonceLen:], d.tag(dummy[:nonceLen]))
+	}
+	return dummy
+}
+
+// tag returns the tag of nonce
+func (d *dummies) tag(nonce []byte) []byte {
+	h := d.mac.Clone()
+	h.Write(nonce)
+	return h.Sum(nil)[:dummyLen-nonceLen]
+}
+
+// is reports whether identifier is a tagged dummy of d
+func (d *dummies) is(identifier []byte) bool {
+	return d.mac != nil && len(identifier) == dummyLen &&
+		bytes.Equal(identifier[nonceLen:], d.tag(identifier[:nonceLen]))
+}
+
+// pad returns the n identifiers read from in interleaved with size-n dummies
+// of d. Every identifier or dummy is picked with a probability proportional
+// to how many are left, so that the dummies are at uniformly random
+// positions. Once they are all sent, pad waits for in to close before closing
+// the returned channel, and sends ErrTooManyIdentifiers on the error channel
+// if in had more than n identifiers, or nil once it is done.
+func pad(ctx context.Context, d *dummies, n, size int64, in <-chan []byte) (<-chan []byte, <-chan error) {
+	out := make(chan []byte)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(errs)
+		defer close(out)
+
+		left := n
+		for total := size; total > 0; total-- {
+			var next []byte
+			if d.rng.Int64N(total) < left {
+				identifier, ok := <-in
+				if !ok {
+					// the protocol reports the missing identifiers
+					return
+				}
+				next = identifier
+				left--
+			} else {
+				next = d.next()
+			}
+
+			select {
+			case out <- next:
+			case <-ctx.Done():
+				go drain(in)
+				return
+			}
+		}
+
+		var extra bool
+		select {
+		case _, extra = <-in:
+		case <-ctx.Done():
+			// the protocol is done, only check for an identifier ready
+			select {
+			case _, extra = <-in:
+			default:
+			}
+		}
+		if extra {
+			errs <- fmt.Errorf("%w: read more than %d identifiers", ErrTooManyIdentifiers, n)
+		}
+		go drain(in)
+	}()
+
+	return out, errs
+}
+
+// drain reads in to exhaustion, not to block its producer
+func drain(in <-chan []byte) {
+	for range in {
+	}
+}
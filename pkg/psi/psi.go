@@ -3,12 +3,15 @@ package psi
 import (
 	"context"
 	"errors"
+	"fmt"
 	"io"
 
 	"github.com/optable/match/pkg/bpsi"
 	"github.com/optable/match/pkg/dhpsi"
 	"github.com/optable/match/pkg/kkrtpsi"
 	"github.com/optable/match/pkg/npsi"
+	"github.com/optable/match/pkg/options"
+	"github.com/optable/match/pkg/volepsi"
 )
 
 // Protocol is the matching protocol enumeration
@@ -20,6 +23,8 @@ const (
 	ProtocolNPSI
 	ProtocolBPSI
 	ProtocolKKRTPSI
+	ProtocolKKRTPSIKOS
+	ProtocolVOLEPSI
 )
 
 var ErrUnsupportedPSIProtocol = errors.New("unsupported PSI protocol")
@@ -34,16 +39,31 @@ type Receiver interface {
 	Intersect(ctx context.Context, n int64, identifiers <-chan []byte) ([][]byte, error)
 }
 
-func NewSender(protocol Protocol, rw io.ReadWriter) (Sender, error) {
+// NewSender returns the sender of protocol using rw as the communication
+// layer, configured with opts. Its n may be UnknownN, the identifiers are
+// then spooled to be counted.
+func NewSender(protocol Protocol, rw io.ReadWriter, opts ...options.Option) (Sender, error) {
+	s, err := newSender(protocol, rw, opts)
+	if err != nil {
+		return nil, err
+	}
+	return Spool{}.Sender(s), nil
+}
+
+func newSender(protocol Protocol, rw io.ReadWriter, opts []options.Option) (Sender, error) {
 	switch protocol {
 	case ProtocolDHPSI:
-		return dhpsi.NewSender(rw), nil
+		return dhpsi.NewSender(rw, opts...), nil
 	case ProtocolNPSI:
-		return npsi.NewSender(rw), nil
+		return npsi.NewSender(rw, opts...), nil
 	case ProtocolBPSI:
-		return bpsi.NewSender(rw), nil
+		return bpsi.NewSender(rw, opts...), nil
 	case ProtocolKKRTPSI:
-		return kkrtpsi.NewSender(rw), nil
+		return kkrtpsi.NewSender(rw, opts...), nil
+	case ProtocolKKRTPSIKOS:
+		return kkrtpsi.NewKOSSender(rw, opts...), nil
+	case ProtocolVOLEPSI:
+		return volepsi.NewSender(rw, opts...), nil
 	case ProtocolUnsupported:
 		fallthrough
 	default:
@@ -51,16 +71,31 @@ func NewSender(protocol Protocol, rw io.ReadWriter) (Sender, error) {
 	}
 }
 
-func NewReceiver(protocol Protocol, rw io.ReadWriter) (Receiver, error) {
+// NewReceiver returns the receiver of protocol using rw as the communication
+// layer, configured with opts. Its n may be UnknownN, the identifiers are
+// then spooled to be counted.
+func NewReceiver(protocol Protocol, rw io.ReadWriter, opts ...options.Option) (Receiver, error) {
+	r, err := newReceiver(protocol, rw, opts)
+	if err != nil {
+		return nil, err
+	}
+	return Spool{}.Receiver(r), nil
+}
+
+func newReceiver(protocol Protocol, rw io.ReadWriter, opts []options.Option) (Receiver, error) {
 	switch protocol {
 	case ProtocolDHPSI:
-		return dhpsi.NewReceiver(rw), nil
+		return dhpsi.NewReceiver(rw, opts...), nil
 	case ProtocolNPSI:
-		return npsi.NewReceiver(rw), nil
+		return npsi.NewReceiver(rw, opts...), nil
 	case ProtocolBPSI:
-		return bpsi.NewReceiver(rw), nil
+		return bpsi.NewReceiver(rw, opts...), nil
 	case ProtocolKKRTPSI:
-		return kkrtpsi.NewReceiver(rw), nil
+		return kkrtpsi.NewReceiver(rw, opts...), nil
+	case ProtocolKKRTPSIKOS:
+		return kkrtpsi.NewKOSReceiver(rw, opts...), nil
+	case ProtocolVOLEPSI:
+		return volepsi.NewReceiver(rw, opts...), nil
 	case ProtocolUnsupported:
 		fallthrough
 	default:
@@ -68,6 +103,27 @@ func NewReceiver(protocol Protocol, rw io.ReadWriter) (Receiver, error) {
 	}
 }
 
+// ParseProtocol returns the protocol named name, as returned
+// by String or in its short form, such as kkrt
+func ParseProtocol(name string) (Protocol, error) {
+	switch name {
+	case "dhpsi":
+		return ProtocolDHPSI, nil
+	case "npsi":
+		return ProtocolNPSI, nil
+	case "bpsi":
+		return ProtocolBPSI, nil
+	case "kkrt", "kkrtpsi":
+		return ProtocolKKRTPSI, nil
+	case "kkrt-kos", "kkrtpsi-kos":
+		return ProtocolKKRTPSIKOS, nil
+	case "vole", "volepsi":
+		return ProtocolVOLEPSI, nil
+	default:
+		return ProtocolUnsupported, fmt.Errorf("%w: %s", ErrUnsupportedPSIProtocol, name)
+	}
+}
+
 func (p Protocol) String() string {
 	switch p {
 	case ProtocolDHPSI:
@@ -78,6 +134,10 @@ func (p Protocol) String() string {
 		return "bpsi"
 	case ProtocolKKRTPSI:
 		return "kkrtpsi"
+	case ProtocolKKRTPSIKOS:
+		return "kkrtpsi-kos"
+	case ProtocolVOLEPSI:
+		return "volepsi"
 	case ProtocolUnsupported:
 		fallthrough
 	default:
@@ -0,0 +1,152 @@
+package psi
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+)
+
+// TypeSeparator ends the type prefix of an identifier, as in "e:" for emails
+const TypeSeparator = ':'
+
+var ErrUntypedIdentifier = errors.New("identifier has no type prefix")
+
+// A Record is an audience record identified by any of several
+// type-prefixed identifiers, such as an email, a phone and a MAID
+type Record struct {
+	ID          string
+	Identifiers [][]byte
+}
+
+// A Match is a record with at least one matching identifier
+type Match struct {
+	RecordID string
+	// Types are the sorted, distinct type prefixes,
+	// such as "e:", of the matching identifiers
+	Types []string
+}
+
+// recordIndex maps each distinct identifier to the records holding it
+type recordIndex struct {
+	// records holds the distinct record IDs in their input order
+	records []string
+	// positions maps record IDs to their index in records
+	positions map[string]int
+	// ids maps identifiers to indices of records
+	ids map[string][]int
+	// order holds the distinct identifiers in their input order
+	order [][]byte
+}
+
+// indexRecords reads records to exhaustion
+func indexRecords(records <-chan Record) (*recordIndex, error) {
+	idx := &recordIndex{positions: make(map[string]int), ids: make(map[string][]int)}
+	var err error
+	for record := range records {
+		if err != nil {
+			// do not block the producer of records
+			continue
+		}
+		// the identifiers of records of the same ID are merged
+		i, ok := idx.positions[record.ID]
+		if !ok {
+			i = len(idx.records)
+			idx.positions[record.ID] = i
+			idx.records = append(idx.records, record.ID)
+		}
+		for _, identifier := range record.Identifiers {
+			if identifierType(identifier) == "" {
+				err = fmt.Errorf("%w: in record %s", ErrUntypedIdentifier, record.ID)
+				break
+			}
+			holders, seen := idx.ids[string(identifier)]
+			if !seen {
+				idx.order = append(idx.order, identifier)
+			}
+			if !slices.Contains(holders, i) {
+				idx.ids[string(identifier)] = append(holders, i)
+			}
+		}
+	}
+
+	return idx, err
+}
+
+// identifiers returns the channel of the distinct identifiers of idx
+func (idx *recordIndex) identifiers() <-chan []byte {
+	c := make(chan []byte, len(idx.order))
+	for _, identifier := range idx.order {
+		c <- identifier
+	}
+	close(c)
+	return c
+}
+
+// identifierType returns the type prefix of identifier,
+// or an empty string if it has none
+func identifierType(identifier []byte) string {
+	if sep := bytes.IndexByte(identifier, TypeSeparator); sep > 0 {
+		return string(identifier[:sep+1])
+	}
+
+	return ""
+}
+
+// SendRecords runs s over the distinct identifiers of records, which are read
+// to exhaustion first so that their number can be announced to the receiver
+func SendRecords(ctx context.Context, s Sender, records <-chan Record) error {
+	idx, err := indexRecords(records)
+	if err != nil {
+		return err
+	}
+
+	return s.Send(ctx, int64(len(idx.order)), idx.identifiers())
+}
+
+// IntersectRecords runs r over the distinct identifiers of records, which are
+// read to exhaustion first, and returns the records with a matching identifier
+// in the order they were read, each with the types of its matching identifiers.
+func IntersectRecords(ctx context.Context, r Receiver, records <-chan Record) ([]Match, error) {
+	idx, err := indexRecords(records)
+	if err != nil {
+		return nil, err
+	}
+
+	intersection, err := r.Intersect(ctx, int64(len(idx.order)), idx.identifiers())
+	if err != nil {
+		return nil, err
+	}
+
+	// the types matched by each record
+	types := make(map[int]map[string]bool)
+	for _, identifier := range intersection {
+		t := identifierType(identifier)
+		for _, i := range idx.ids[string(identifier)] {
+			if types[i] == nil {
+				types[i] = make(map[string]bool)
+			}
+			types[i][t] = true
+		}
+	}
+
+	var matched = make([]int, 0, len(types))
+	for i := range types {
+		matched = append(matched, i)
+	}
+	sort.Ints(matched)
+
+	var matches = make([]Match, 0, len(matched))
+	for _, i := range matched {
+		m := Match{RecordID: idx.records[i]}
+		for t := range types[i] {
+			m.Types = append(m.Types, t)
+		}
+		sort.Strings(m.Types)
+		matches = append(matches, m)
+	}
+
+	return matches, nil
+}
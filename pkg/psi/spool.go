@@ -0,0 +1,231 @@
+package psi
+
+import (
+	"bufio"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+)
+
+// UnknownN is passed as n to Send and Intersect when the number of
+// identifiers is not known up front. The senders and receivers of NewSender
+// and NewReceiver then spool the identifiers to count them, see Spool.
+const UnknownN int64 = -1
+
+// DefaultSpoolWindow is the number of identifiers
+// a Spool holds in memory before spilling to disk
+const DefaultSpoolWindow = 1 << 20
+
+// A Spool counts the identifiers of a Sender or a Receiver called with
+// UnknownN before running its protocol, which announces their number to the
+// peer. The identifiers are read to exhaustion, holding up to Window of them
+// in memory and spilling the others to a temporary file in Dir, encrypted
+// with an ephemeral key so that no identifier is written to disk in the clear.
+// They are then replayed in order. Calls with a known n are passed through.
+type Spool struct {
+	// Window is the number of identifiers held in memory,
+	// DefaultSpoolWindow if 0 or less
+	Window int64
+	// Dir is the directory of the temporary file, the default
+	// directory for temporary files if empty
+	Dir string
+}
+
+// Sender returns a psi.Sender spooling the identifiers of s called with UnknownN
+func (sp Spool) Sender(s Sender) Sender {
+	return spoolSender{sp: sp, s: s}
+}
+
+// Receiver returns a psi.Receiver spooling the identifiers of r called with UnknownN
+func (sp Spool) Receiver(r Receiver) Receiver {
+	return spoolReceiver{sp: sp, r: r}
+}
+
+type spoolSender struct {
+	sp Spool
+	s  Sender
+}
+
+// Send counts the identifiers first if n is UnknownN
+func (s spoolSender) Send(ctx context.Context, n int64, identifiers <-chan []byte) error {
+	if n != UnknownN {
+		return s.s.Send(ctx, n, identifiers)
+	}
+	return s.sp.run(ctx, identifiers, s.s.Send)
+}
+
+type spoolReceiver struct {
+	sp Spool
+	r  Receiver
+}
+
+// Intersect counts the identifiers first if n is UnknownN
+func (r spoolReceiver) Intersect(ctx context.Context, n int64, identifiers <-chan []byte) ([][]byte, error) {
+	if n != UnknownN {
+		return r.r.Intersect(ctx, n, identifiers)
+	}
+	var intersection [][]byte
+	err := r.sp.run(ctx, identifiers, func(ctx context.Context, n int64, identifiers <-chan []byte) (err error) {
+		intersection, err = r.r.Intersect(ctx, n, identifiers)
+		return err
+	})
+	return intersection, err
+}
+
+// run spools identifiers and calls f with their number and their replay
+func (sp Spool) run(ctx context.Context, identifiers <-chan []byte, f func(context.Context, int64, <-chan []byte) error) error {
+	s, err := sp.fill(ctx, identifiers)
+	defer s.close()
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	replayed := make(chan []byte)
+	errs := make(chan error, 1)
+	go func() {
+		defer close(replayed)
+		errs <- s.replay(ctx, replayed)
+	}()
+
+	err = f(ctx, s.n, replayed)
+	// stop the replay before removing its file
+	cancel()
+	for range replayed {
+	}
+	if rerr := <-errs; err == nil && !errors.Is(rerr, context.Canceled) {
+		err = rerr
+	}
+	return err
+}
+
+// spooled identifiers
+type spooled struct {
+	n   int64
+	mem [][]byte
+	// the spilled identifiers
+	spilled int64
+	f       *os.File
+	block   cipher.Block
+	iv      [aes.BlockSize]byte
+	b       *bufio.Writer
+	w       io.Writer
+}
+
+// fill reads identifiers to exhaustion in a new spool
+func (sp Spool) fill(ctx context.Context, identifiers <-chan []byte) (*spooled, error) {
+	window := sp.Window
+	if window <= 0 {
+		window = DefaultSpoolWindow
+	}
+
+	s := &spooled{}
+	for {
+		select {
+		case <-ctx.Done():
+			return s, ctx.Err()
+		case identifier, ok := <-identifiers:
+			if !ok {
+				return s, nil
+			}
+			if s.n < window {
+				s.mem = append(s.mem, identifier)
+			} else if err := s.spill(sp.Dir, identifier); err != nil {
+				return s, err
+			}
+			s.n++
+		}
+	}
+}
+
+// spill writes identifier, length prefixed, to the temporary
+// file of s, which is created on first use
+func (s *spooled) spill(dir string, identifier []byte) error {
+	if s.f == nil {
+		var key [16]byte
+		if _, err := rand.Read(key[:]); err != nil {
+			return err
+		}
+		block, err := aes.NewCipher(key[:])
+		if err != nil {
+			return err
+		}
+		if _, err := rand.Read(s.iv[:]); err != nil {
+			return err
+		}
+		f, err := os.CreateTemp(dir, "psi-spool-")
+		if err != nil {
+			return err
+		}
+		s.f, s.block = f, block
+		s.b = bufio.NewWriter(f)
+		s.w = cipher.StreamWriter{S: cipher.NewCTR(block, s.iv[:]), W: s.b}
+	}
+
+	var l [binary.MaxVarintLen64]byte
+	if _, err := s.w.Write(l[:binary.PutUvarint(l[:], uint64(len(identifier)))]); err != nil {
+		return err
+	}
+	if _, err := s.w.Write(identifier); err != nil {
+		return err
+	}
+	s.spilled++
+	return nil
+}
+
+// replay writes the identifiers of s to out in the order they were spooled
+func (s *spooled) replay(ctx context.Context, out chan<- []byte) error {
+	send := func(identifier []byte) error {
+		select {
+		case out <- identifier:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	for i, identifier := range s.mem {
+		s.mem[i] = nil
+		if err := send(identifier); err != nil {
+			return err
+		}
+	}
+	if s.f == nil {
+		return nil
+	}
+
+	if err := s.b.Flush(); err != nil {
+		return err
+	}
+	if _, err := s.f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	r := bufio.NewReader(cipher.StreamReader{S: cipher.NewCTR(s.block, s.iv[:]), R: bufio.NewReader(s.f)})
+	for i := int64(0); i < s.spilled; i++ {
+		l, err := binary.ReadUvarint(r)
+		if err != nil {
+			return err
+		}
+		identifier := make([]byte, l)
+		if _, err := io.ReadFull(r, identifier); err != nil {
+			return err
+		}
+		if err := send(identifier); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// close removes the temporary file of s
+func (s *spooled) close() error {
+	if s.f == nil {
+		return nil
+	}
+	return errors.Join(s.f.Close(), os.Remove(s.f.Name()))
+}
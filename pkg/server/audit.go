@@ -0,0 +1,91 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+)
+
+// A Session is the audit record of a sender connection
+type Session struct {
+	Peer     string    `json:"peer"`
+	Protocol string    `json:"protocol"`
+	Start    time.Time `json:"start"`
+	// Duration is in nanoseconds
+	Duration time.Duration `json:"duration"`
+	// ReceiverSize is the number of identifiers of the receiver,
+	// and SenderSize the number announced by the sender, -1 if it
+	// is not known, such as for bpsi
+	ReceiverSize int64 `json:"receiver_size"`
+	SenderSize   int64 `json:"sender_size"`
+	Matches      int   `json:"matches"`
+	// Error is the reason the session failed or was refused
+	Error string `json:"error,omitempty"`
+	// Refused is set when the session was refused by the
+	// quota of the peer, it then does not count in the quota
+	Refused bool `json:"refused,omitempty"`
+}
+
+// An AuditLog appends the Session records to a file, one JSON object
+// per line, synced to disk before the result of the session is released
+type AuditLog struct {
+	mu sync.Mutex
+	f  *os.File
+}
+
+// OpenAuditLog opens the audit log at path, created if it does not exist
+func OpenAuditLog(path string) (*AuditLog, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &AuditLog{f: f}, nil
+}
+
+// Write appends s to the log
+func (a *AuditLog) Write(s Session) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.f.Write(append(b, '\n')); err != nil {
+		return err
+	}
+	return a.f.Sync()
+}
+
+// Close closes the file of the log
+func (a *AuditLog) Close() error {
+	return a.f.Close()
+}
+
+// ReadAuditLog returns the sessions recorded in the audit log at path
+// which started at or after since. A missing log holds no session.
+func ReadAuditLog(path string, since time.Time) ([]Session, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var sessions []Session
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var s Session
+		if err := json.Unmarshal(scanner.Bytes(), &s); err != nil {
+			return nil, err
+		}
+		if !s.Start.Before(since) {
+			sessions = append(sessions, s)
+		}
+	}
+	return sessions, scanner.Err()
+}
@@ -0,0 +1,131 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/dchest/siphash"
+)
+
+// SketchesSuffix is appended to the path of the audit log
+// for the path of the file of the overlap sketches
+const SketchesSuffix = ".sketches"
+
+// sketchSize is the number of hashes kept by a sketch, the Jaccard
+// similarity of two sketches is estimated within about 1/√sketchSize
+const sketchSize = 256
+
+// sketch is a bottom-k sketch of a set: the
+// sketchSize smallest keyed hashes of its elements
+type sketch []uint64
+
+// key of the hashes of the sketches
+type key struct {
+	k0, k1 uint64
+}
+
+// newKey returns a random key
+func newKey() (key, error) {
+	var k [16]byte
+	if _, err := rand.Read(k[:]); err != nil {
+		return key{}, err
+	}
+	return key{binary.LittleEndian.Uint64(k[:8]), binary.LittleEndian.Uint64(k[8:])}, nil
+}
+
+// sketches are the key and the sketches of the last
+// intersections of each peer, as persisted to a JSON file
+type sketches struct {
+	K0    uint64              `json:"k0"`
+	K1    uint64              `json:"k1"`
+	Peers map[string][]sketch `json:"peers"`
+}
+
+// readSketches reads the sketches of the file at path,
+// or returns new ones under a random key if it does not exist
+func readSketches(path string) (sketches, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		k, err := newKey()
+		return sketches{K0: k.k0, K1: k.k1, Peers: make(map[string][]sketch)}, err
+	} else if err != nil {
+		return sketches{}, err
+	}
+	var s sketches
+	if err := json.Unmarshal(b, &s); err != nil {
+		return sketches{}, fmt.Errorf("sketches %s: %w", path, err)
+	}
+	if s.Peers == nil {
+		s.Peers = make(map[string][]sketch)
+	}
+	return s, nil
+}
+
+// write writes s to a temporary file renamed over the file at path
+func (s sketches) write(path string) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// newSketch returns the sketch of the distinct identifiers of set
+func (k key) newSketch(set [][]byte) sketch {
+	var s = make(sketch, 0, len(set))
+	for _, identifier := range set {
+		s = append(s, siphash.Hash(k.k0, k.k1, identifier))
+	}
+	slices.Sort(s)
+	s = slices.Compact(s)
+	if len(s) > sketchSize {
+		s = s[:sketchSize]
+	}
+	return slices.Clip(s)
+}
+
+// jaccard estimates the Jaccard similarity of the sets of
+// a and b, the size of their intersection over their union,
+// from the smallest hashes of the union found in both
+func jaccard(a, b sketch) float64 {
+	var union, both int
+	for i, j := 0, 0; union < sketchSize && (i < len(a) || j < len(b)); union++ {
+		switch {
+		case j == len(b) || (i < len(a) && a[i] < b[j]):
+			i++
+		case i == len(a) || b[j] < a[i]:
+			j++
+		default:
+			both++
+			i++
+			j++
+		}
+	}
+	if union == 0 {
+		return 0
+	}
+	return float64(both) / float64(union)
+}
@@ -0,0 +1,343 @@
+// Package server runs a psi receiver for any number of senders, each session
+// against the same identifiers, while limiting what senders can learn about
+// specific people by matching many crafted sets: each peer has a quota of
+// sessions, and the result of a session whose intersection overlaps too much
+// with one of an earlier session of the same peer is withheld. Senders must
+// also announce a minimum number of identifiers, which a sender reaches by
+// padding its crafted identifiers with junk. Every session is recorded in a
+// persistent audit log.
+//
+//	s, err := server.New(server.Config{
+//		Protocol:      psi.ProtocolKKRTPSI,
+//		Source:        server.FileSource(n, "receiver-ids.csv.gz", opts),
+//		Quota:         server.Quota{Sessions: 10, Window: 24 * time.Hour},
+//		MinSenderSize: 1000,
+//		MaxOverlap:    0.9,
+//		AuditLog:      "audit.ndjson",
+//		Result:        write,
+//	})
+//	err = s.Serve(ctx, listener)
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/optable/match/pkg/input"
+	"github.com/optable/match/pkg/options"
+	"github.com/optable/match/pkg/psi"
+)
+
+// DefaultOverlapHistory is the number of earlier sessions
+// of a peer the intersection of a session is compared to
+const DefaultOverlapHistory = 32
+
+var (
+	// ErrQuotaExceeded is returned when a peer has used its sessions
+	ErrQuotaExceeded = errors.New("peer exceeded its session quota")
+	// ErrOverlap is returned when the intersection of a session overlaps
+	// too much with one of an earlier session of the same peer
+	ErrOverlap = errors.New("intersection overlaps with an earlier session")
+)
+
+// A Source opens the identifiers of the receiver for a session, returning
+// their number, a channel of them and a function releasing them
+type Source func() (n int64, identifiers <-chan []byte, release func() error, err error)
+
+// FileSource returns the Source of the n identifiers of the file at path,
+// as counted by input.Count
+func FileSource(n int64, path string, opts input.Options) Source {
+	return func() (int64, <-chan []byte, func() error, error) {
+		r, err := input.Open(path, opts)
+		if err != nil {
+			return 0, nil, nil, err
+		}
+		return n, r.Identifiers(n), func() error {
+			return errors.Join(r.Err(), r.Close())
+		}, nil
+	}
+}
+
+// A Quota bounds the number of sessions of a peer over a sliding window
+type Quota struct {
+	// Sessions is the number of sessions, unlimited if 0
+	Sessions int
+	// Window is required with a number of sessions
+	Window time.Duration
+}
+
+// Config configures a Server
+type Config struct {
+	Protocol psi.Protocol
+	// Options configure the receiver of every session
+	Options []options.Option
+	Source  Source
+	// Peer identifies the peer of a connection, the host of
+	// its remote address if nil. Quotas are enforced per peer.
+	Peer  func(c net.Conn) string
+	Quota Quota
+	// MinSenderSize is the smallest number of identifiers a sender
+	// can announce, see limits.Limits. It does not bound how many
+	// of them are real.
+	MinSenderSize int64
+	// MaxOverlap is the largest Jaccard similarity, from 0 to 1, allowed
+	// between the intersection of a session and that of any of the last
+	// OverlapHistory sessions of the same peer, unchecked if 0. The receiver
+	// only ever learns the intersection of a sender set, so the overlap of
+	// sender sets is measured on their intersections.
+	MaxOverlap     float64
+	OverlapHistory int
+	// AuditLog is the path of the audit log, which is also read back
+	// to restore the quotas when the server starts. The overlap sketches
+	// and their key are kept next to it, in AuditLog + SketchesSuffix,
+	// to be restored as well.
+	AuditLog string
+	// Result is called with the intersection of each
+	// successful session, once it is audited
+	Result func(ctx context.Context, s Session, intersection [][]byte) error
+}
+
+// A Server runs the sessions of senders connecting to it
+type Server struct {
+	cfg   Config
+	audit *AuditLog
+
+	mu sync.Mutex
+	// the start of the sessions of each peer within the quota window
+	sessions map[string][]time.Time
+	// the sketches of the last intersections of each peer
+	sketches sketches
+}
+
+// New returns a Server configured with cfg, restoring the quotas
+// and the overlap sketches of the peers from its audit log
+func New(cfg Config) (*Server, error) {
+	if cfg.Source == nil || cfg.AuditLog == "" {
+		return nil, errors.New("server: a source and an audit log are required")
+	}
+	if cfg.Quota.Sessions > 0 && cfg.Quota.Window <= 0 {
+		return nil, fmt.Errorf("server: a quota of %d sessions requires a window", cfg.Quota.Sessions)
+	}
+	if cfg.MaxOverlap < 0 || cfg.MaxOverlap > 1 {
+		return nil, fmt.Errorf("server: invalid overlap %v", cfg.MaxOverlap)
+	}
+	if cfg.OverlapHistory <= 0 {
+		cfg.OverlapHistory = DefaultOverlapHistory
+	}
+	if cfg.Peer == nil {
+		cfg.Peer = remoteHost
+	}
+
+	s := &Server{cfg: cfg, sessions: make(map[string][]time.Time)}
+	sk, err := readSketches(cfg.AuditLog + SketchesSuffix)
+	if err != nil {
+		return nil, err
+	}
+	s.sketches = sk
+
+	if cfg.Quota.Sessions > 0 {
+		recent, err := ReadAuditLog(cfg.AuditLog, time.Now().Add(-cfg.Quota.Window))
+		if err != nil {
+			return nil, err
+		}
+		for _, session := range recent {
+			if session.Refused {
+				continue
+			}
+			s.sessions[session.Peer] = append(s.sessions[session.Peer], session.Start)
+		}
+	}
+
+	audit, err := OpenAuditLog(cfg.AuditLog)
+	if err != nil {
+		return nil, err
+	}
+	s.audit = audit
+	return s, nil
+}
+
+// remoteHost returns the host of the remote address of c
+func remoteHost(c net.Conn) string {
+	addr := c.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
+
+// Serve accepts the connections of l and handles each of them in its own
+// goroutine, until ctx is done or l fails. It waits for the sessions to end
+// before returning.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	logger := logr.FromContextOrDiscard(ctx).WithValues("protocol", s.cfg.Protocol.String())
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	stop := context.AfterFunc(ctx, func() { l.Close() })
+	defer stop()
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer c.Close()
+			session, err := s.Handle(ctx, c)
+			if err != nil {
+				logger.Error(err, "session failed", "peer", session.Peer)
+			} else {
+				logger.V(1).Info("session finished", "peer", session.Peer, "matches", session.Matches)
+			}
+		}()
+	}
+}
+
+// Handle runs the session of the sender connected with c, returning its audit
+// record. The connection is left open.
+func (s *Server) Handle(ctx context.Context, c net.Conn) (Session, error) {
+	session := Session{Peer: s.cfg.Peer(c), Protocol: s.cfg.Protocol.String(), Start: time.Now().UTC(), SenderSize: -1}
+	intersection, err := s.run(ctx, c, &session)
+	session.Duration = time.Since(session.Start)
+	if err != nil {
+		session.Error = err.Error()
+		session.Refused = errors.Is(err, ErrQuotaExceeded)
+	} else {
+		session.Matches = len(intersection)
+	}
+
+	// nothing is released before it is audited
+	if aerr := s.audit.Write(session); aerr != nil {
+		return session, errors.Join(err, aerr)
+	}
+	if err != nil {
+		return session, err
+	}
+	if s.cfg.Result != nil {
+		return session, s.cfg.Result(ctx, session, intersection)
+	}
+	return session, nil
+}
+
+// run checks the quota of the peer of session
+// and intersects with the sender connected with c
+func (s *Server) run(ctx context.Context, c net.Conn, session *Session) ([][]byte, error) {
+	if err := s.reserve(session.Peer, session.Start); err != nil {
+		return nil, err
+	}
+
+	n, identifiers, release, err := s.cfg.Source()
+	if err != nil {
+		return nil, err
+	}
+	session.ReceiverSize = n
+
+	// the first cardinality announced by the sender is its size
+	var announced atomic.Int64
+	announced.Store(-1)
+	defer func() { session.SenderSize = announced.Load() }()
+	opts := append(slices.Clip(s.cfg.Options), func(o *options.Options) {
+		o.Limits.MinCardinality = max(o.Limits.MinCardinality, s.cfg.MinSenderSize)
+		o.Limits.Observer = func(n int64) {
+			announced.CompareAndSwap(-1, n)
+		}
+	})
+
+	r, err := psi.NewReceiver(s.cfg.Protocol, c, opts...)
+	if err != nil {
+		go drain(identifiers)
+		return nil, errors.Join(err, release())
+	}
+	intersection, err := r.Intersect(ctx, n, identifiers)
+	if err != nil {
+		// the source is not read to exhaustion
+		go func() {
+			drain(identifiers)
+			release()
+		}()
+		return nil, err
+	}
+	if err := release(); err != nil {
+		return nil, err
+	}
+
+	return intersection, s.checkOverlap(session.Peer, intersection)
+}
+
+// drain reads identifiers to exhaustion so that its producer does not block
+func drain(identifiers <-chan []byte) {
+	for range identifiers {
+	}
+}
+
+// reserve records a session of peer starting at start,
+// or returns ErrQuotaExceeded if it has no sessions left
+func (s *Server) reserve(peer string, start time.Time) error {
+	q := s.cfg.Quota
+	if q.Sessions <= 0 {
+		return nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var recent []time.Time
+	for _, t := range s.sessions[peer] {
+		if start.Sub(t) < q.Window {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent) >= q.Sessions {
+		s.sessions[peer] = recent
+		return fmt.Errorf("%w: %d sessions in %v", ErrQuotaExceeded, len(recent), q.Window)
+	}
+	s.sessions[peer] = append(recent, start)
+	return nil
+}
+
+// checkOverlap compares intersection to the last intersections of
+// peer, and records it unless MaxOverlap is 0. Empty intersections,
+// which reveal nothing specific, never overlap. The result is withheld
+// if the sketch of intersection cannot be persisted.
+func (s *Server) checkOverlap(peer string, intersection [][]byte) error {
+	if s.cfg.MaxOverlap == 0 || len(intersection) == 0 {
+		return nil
+	}
+
+	// the key is never changed once the server is created
+	sk := key{s.sketches.K0, s.sketches.K1}.newSketch(intersection)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous := s.sketches.Peers[peer]
+	history := previous
+	for _, earlier := range history {
+		if j := jaccard(sk, earlier); j > s.cfg.MaxOverlap {
+			return fmt.Errorf("%w: similarity of %.2f", ErrOverlap, j)
+		}
+	}
+	if len(history) >= s.cfg.OverlapHistory {
+		history = history[len(history)-s.cfg.OverlapHistory+1:]
+	}
+	s.sketches.Peers[peer] = append(slices.Clip(history), sk)
+	if err := s.sketches.write(s.cfg.AuditLog + SketchesSuffix); err != nil {
+		s.sketches.Peers[peer] = previous
+		return err
+	}
+	return nil
+}
+
+// Close closes the audit log of s, once Serve returned
+func (s *Server) Close() error {
+	return s.audit.Close()
+}
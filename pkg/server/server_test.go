@@ -0,0 +1,154 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/optable/match/pkg/limits"
+	"github.com/optable/match/pkg/psi"
+)
+
+func ids(prefix string, n int) (out [][]byte) {
+	for i := 0; i < n; i++ {
+		out = append(out, []byte(fmt.Sprintf("%s%d", prefix, i)))
+	}
+	return out
+}
+
+func feed(ids [][]byte) <-chan []byte {
+	c := make(chan []byte, len(ids))
+	for _, id := range ids {
+		c <- id
+	}
+	close(c)
+	return c
+}
+
+// sliceSource is the Source of ids
+func sliceSource(ids [][]byte) Source {
+	return func() (int64, <-chan []byte, func() error, error) {
+		return int64(len(ids)), feed(ids), func() error { return nil }, nil
+	}
+}
+
+// session runs a session of s with a sender of ids
+func session(s *Server, ids [][]byte) (Session, error) {
+	senderConn, receiverConn := net.Pipe()
+	defer receiverConn.Close()
+	go func() {
+		defer senderConn.Close()
+		sender, _ := psi.NewSender(psi.ProtocolNPSI, senderConn)
+		sender.Send(context.Background(), int64(len(ids)), feed(ids))
+	}()
+	return s.Handle(context.Background(), receiverConn)
+}
+
+func newServer(t *testing.T, cfg Config) *Server {
+	cfg.Protocol = psi.ProtocolNPSI
+	cfg.Source = sliceSource(ids("", 100))
+	cfg.Peer = func(net.Conn) string { return "acme" }
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func TestQuota(t *testing.T) {
+	audit := filepath.Join(t.TempDir(), "audit.ndjson")
+	cfg := Config{Quota: Quota{Sessions: 2, Window: time.Hour}, AuditLog: audit}
+	s := newServer(t, cfg)
+	for i := 0; i < 2; i++ {
+		if got, err := session(s, ids("", 20)); err != nil || got.Matches != 20 || got.SenderSize != 20 || got.ReceiverSize != 100 {
+			t.Fatalf("session %d: expected 20 of 20 identifiers to match 100, got %+v, %v", i, got, err)
+		}
+	}
+	if _, err := session(s, ids("", 20)); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected ErrQuotaExceeded, got %v", err)
+	}
+
+	// the sessions are audited
+	sessions, err := ReadAuditLog(audit, time.Time{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sessions) != 3 || sessions[0].Peer != "acme" || sessions[0].Protocol != "npsi" || !sessions[2].Refused {
+		t.Errorf("expected 3 sessions of acme, the last refused, got %+v", sessions)
+	}
+
+	// and the quota survives a restart
+	s.Close()
+	s = newServer(t, cfg)
+	if _, err := session(s, ids("", 20)); !errors.Is(err, ErrQuotaExceeded) {
+		t.Errorf("expected ErrQuotaExceeded after a restart, got %v", err)
+	}
+}
+
+func TestQuotaWindow(t *testing.T) {
+	cfg := Config{Protocol: psi.ProtocolNPSI, Source: sliceSource(nil), Quota: Quota{Sessions: 2}, AuditLog: filepath.Join(t.TempDir(), "audit.ndjson")}
+	if _, err := New(cfg); err == nil {
+		t.Error("expected a quota without a window to be rejected")
+	}
+}
+
+func TestMinSenderSize(t *testing.T) {
+	s := newServer(t, Config{MinSenderSize: 10, AuditLog: filepath.Join(t.TempDir(), "audit.ndjson")})
+	got, err := session(s, ids("", 5))
+	if !errors.Is(err, limits.ErrCardinalityTooSmall) {
+		t.Errorf("expected ErrCardinalityTooSmall, got %v", err)
+	}
+	if got.SenderSize != 5 {
+		t.Errorf("expected a sender size of 5, got %d", got.SenderSize)
+	}
+}
+
+func TestOverlap(t *testing.T) {
+	var results int
+	cfg := Config{MaxOverlap: 0.5, AuditLog: filepath.Join(t.TempDir(), "audit.ndjson")}
+	s := newServer(t, cfg)
+	s.cfg.Result = func(ctx context.Context, s Session, intersection [][]byte) error {
+		results++
+		return nil
+	}
+
+	probe := ids("", 30)
+	if _, err := session(s, probe); err != nil {
+		t.Fatal(err)
+	}
+	// the same set with one more identifier
+	if _, err := session(s, append(probe, []byte("30"))); !errors.Is(err, ErrOverlap) {
+		t.Errorf("expected ErrOverlap, got %v", err)
+	}
+	// a disjoint set
+	if _, err := session(s, ids("", 100)[50:]); err != nil {
+		t.Errorf("expected a disjoint set not to overlap, got %v", err)
+	}
+	if results != 2 {
+		t.Errorf("expected 2 results to be released, got %d", results)
+	}
+
+	// and the sketches survive a restart
+	s.Close()
+	s = newServer(t, cfg)
+	if _, err := session(s, append(probe, []byte("31"))); !errors.Is(err, ErrOverlap) {
+		t.Errorf("expected ErrOverlap after a restart, got %v", err)
+	}
+}
+
+func TestJaccard(t *testing.T) {
+	k := key{1, 2}
+	a, b := ids("", 1000), ids("", 1500)[500:]
+	// the sets share 500 of 1500 identifiers
+	if j := jaccard(k.newSketch(a), k.newSketch(b)); j < 0.23 || j > 0.43 {
+		t.Errorf("expected a similarity of about 0.33, got %.2f", j)
+	}
+	if j := jaccard(k.newSketch(a), k.newSketch(a)); j != 1 {
+		t.Errorf("expected a similarity of 1, got %.2f", j)
+	}
+}
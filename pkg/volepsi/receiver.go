@@ -0,0 +1,210 @@
+package volepsi
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/optable/match/internal/gf128"
+	"github.com/optable/match/internal/okvs"
+	"github.com/optable/match/internal/ot"
+	"github.com/optable/match/internal/util"
+	"github.com/optable/match/internal/vole"
+	"github.com/optable/match/pkg/digest"
+	"github.com/optable/match/pkg/options"
+)
+
+// stage 1: read local IDs until exhaustion, encode them in an OKVS
+//          and send its size and seed
+// stage 2: VOLE receive, and send the OKVS masked with the VOLE
+// stage 3: receive sender's OPRF outputs and intersect
+
+// Receiver side of the VOLEPSI protocol
+type Receiver struct {
+	rw   io.ReadWriter
+	opts options.Options
+}
+
+// NewReceiver returns a VOLEPSI receiver initialized to
+// use rw as the communication layer
+func NewReceiver(rw io.ReadWriter, opts ...options.Option) *Receiver {
+	return &Receiver{rw: rw, opts: options.New(opts...)}
+}
+
+// Intersect on matchables read from the identifiers channel,
+// returning the matching intersection, using the VOLEPSI protocol.
+// The format of an indentifier is string
+// example:
+//  0e1f461bbefa6e07cc2ef06b9ee1ed25101e24d4345af266ed2f5a58bcd26c5e
+func (r *Receiver) Intersect(ctx context.Context, n int64, identifiers <-chan []byte) (intersection [][]byte, err error) {
+	// fetch and set up logger
+	logger := logr.FromContextOrDiscard(ctx)
+	logger = logger.WithValues("protocol", "volepsi")
+	// fetch the limits enforced on the sender
+	l := r.opts.Limits
+	rw := l.ReadWriter(r.rw)
+
+	// start timer:
+	start := time.Now()
+	timer := time.Now()
+	var mem uint64
+
+	var items []item
+	var ids [][]byte
+	var table []gf128.Element
+	var c []gf128.Element
+
+	// stage 1: hash all local IDs, encode them in an OKVS that decodes
+	//          each of them to its hash, and send the size and seed of
+	//          the OKVS to the sender.
+	stage1 := func() error {
+		logger.V(1).Info("Starting stage 1")
+
+		// hash the identifiers once the table size is known
+		for id := range identifiers {
+			ids = append(ids, id)
+		}
+		size := okvs.Size(len(ids))
+
+		var seed [okvs.SeedLen]byte
+		for attempt := 0; ; attempt++ {
+			if _, err := rand.Read(seed[:]); err != nil {
+				return err
+			}
+			items = hashItems(okvs.NewHasher(seed, size), ids)
+			keys := make([]okvs.Key, len(items))
+			values := make([]gf128.Element, len(items))
+			for i := range items {
+				keys[i], values[i] = items[i].key, items[i].value
+			}
+			table, err = okvs.Encode(keys, values, size)
+			if errors.Is(err, okvs.ErrEncode) && attempt+1 < maxEncodeAttempts {
+				logger.V(1).Info("retrying OKVS encoding with another seed")
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("stage1: %w", err)
+			}
+			break
+		}
+
+		// send the number of identifiers and the seed
+		if err := binary.Write(r.rw, binary.BigEndian, int64(len(ids))); err != nil {
+			return err
+		}
+		if _, err := r.rw.Write(seed[:]); err != nil {
+			return err
+		}
+
+		// end stage1
+		timer, mem = printStageStats(logger, 1, start, start, 0)
+		logger.V(1).Info("Finished stage 1")
+		return nil
+	}
+
+	// stage 2: run a VOLE of the size of the OKVS, and send
+	//          the OKVS masked with the VOLE vector a
+	stage2 := func() error {
+		logger.V(1).Info("Starting stage 2")
+
+		b, err := ot.NewBaseOT(baseOT, ot.ExtensionBaseMsgLens())
+		if err != nil {
+			return err
+		}
+		a, vc, err := vole.NewReceiver(b).Receive(len(table), rw)
+		if err != nil {
+			return fmt.Errorf("stage2: %w", err)
+		}
+		c = vc
+
+		// send D = P + a
+		var bufferedWriter = bufio.NewWriterSize(r.rw, 1024*64)
+		var buf [gf128.Size]byte
+		for i := range table {
+			table[i].Add(a[i]).PutBytes(buf[:])
+			if _, err := bufferedWriter.Write(buf[:]); err != nil {
+				return err
+			}
+		}
+		if err := bufferedWriter.Flush(); err != nil {
+			return err
+		}
+
+		// end stage2
+		timer, mem = printStageStats(logger, 2, timer, start, mem)
+		logger.V(1).Info("Finished stage 2")
+		return nil
+	}
+
+	// stage 3: compute the local OPRF outputs, read the remote
+	//          OPRF outputs and compare to produce intersections
+	stage3 := func() error {
+		logger.V(1).Info("Starting stage 3")
+
+		// read number of remote IDs
+		var remoteN int64
+		if err := sizeRead(rw, l, &remoteN); err != nil {
+			return fmt.Errorf("stage3: %w", err)
+		}
+		// read the length of the remote OPRF outputs, and validate it
+		var outputLen int
+		if err := lenRead(rw, &outputLen); err != nil {
+			return err
+		}
+		if err := digest.Check(r.opts.DigestLen, outputLen); err != nil {
+			return fmt.Errorf("stage3: %w", err)
+		}
+		digest.Log(logger, n, remoteN, outputLen)
+
+		// the OPRF output of y is H(y, Decode(c, y)),
+		// truncated to the length announced by the sender
+		outputs := make(map[encoding]int, len(items))
+		for i, it := range items {
+			outputs[output(it.value, okvs.Decode(c, it.key), outputLen)] = i
+		}
+
+		// Add a buffer of 64k to amortize syscalls cost
+		var bufferedReader = bufio.NewReaderSize(rw, 1024*64)
+
+		// read remote outputs and intersect
+		for i := int64(0); i < remoteN; i++ {
+			var remoteOutput encoding
+			if _, err := io.ReadFull(bufferedReader, remoteOutput[:outputLen]); err != nil {
+				return err
+			}
+			if idx, ok := outputs[remoteOutput]; ok {
+				intersection = append(intersection, ids[idx])
+				// dedup
+				delete(outputs, remoteOutput)
+			}
+		}
+
+		// end stage3
+		_, _ = printStageStats(logger, 3, timer, start, mem)
+		logger.V(1).Info("Finished stage 3")
+		return nil
+	}
+
+	// run stage1
+	if err := util.Sel(ctx, l.StageTimeout, stage1); err != nil {
+		return intersection, err
+	}
+
+	// run stage2
+	if err := util.Sel(ctx, l.StageTimeout, stage2); err != nil {
+		return intersection, err
+	}
+
+	// run stage3
+	if err := util.Sel(ctx, l.StageTimeout, stage3); err != nil {
+		return intersection, err
+	}
+
+	return intersection, nil
+}
@@ -0,0 +1,186 @@
+package volepsi
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/optable/match/internal/gf128"
+	"github.com/optable/match/internal/okvs"
+	"github.com/optable/match/internal/ot"
+	"github.com/optable/match/internal/util"
+	"github.com/optable/match/internal/vole"
+	"github.com/optable/match/pkg/digest"
+	"github.com/optable/match/pkg/options"
+)
+
+// stage 1: receive the size and seed of the receiver OKVS, and hash
+//          local IDs with it
+// stage 2: VOLE send, and receive the OKVS masked with the VOLE
+// stage 3: compute the OPRF outputs of local IDs and send them to
+//          the receiver for intersection.
+
+// Sender side of the VOLEPSI protocol
+type Sender struct {
+	rw   io.ReadWriter
+	opts options.Options
+}
+
+// NewSender returns a VOLEPSI sender initialized to
+// use rw as the communication layer
+func NewSender(rw io.ReadWriter, opts ...options.Option) *Sender {
+	return &Sender{rw: rw, opts: options.New(opts...)}
+}
+
+// Send initiates a VOLEPSI exchange
+// that reads local IDs from identifiers, until identifiers closes.
+// The format of an indentifier is string
+// example:
+//  0e1f461bbefa6e07cc2ef06b9ee1ed25101e24d4345af266ed2f5a58bcd26c5e
+func (s *Sender) Send(ctx context.Context, n int64, identifiers <-chan []byte) (err error) {
+	// fetch and set up logger
+	logger := logr.FromContextOrDiscard(ctx)
+	logger = logger.WithValues("protocol", "volepsi")
+	// fetch the limits enforced on the receiver
+	l := s.opts.Limits
+	rw := l.ReadWriter(s.rw)
+
+	// statistics
+	start := time.Now()
+	timer := time.Now()
+	var mem uint64
+
+	var remoteN int64 // receiver size
+	var size int      // size of the receiver OKVS
+	var delta gf128.Element
+	var b, d []gf128.Element
+	var itemsChan = make(chan []item, 1)
+
+	// stage 1: read the size and seed of the receiver OKVS,
+	// and hash the local ids with them.
+	stage1 := func() error {
+		logger.V(1).Info("Starting stage 1")
+
+		// read remote input size, and validate it
+		// before it drives the VOLE allocations
+		if err := sizeRead(rw, l, &remoteN); err != nil {
+			return fmt.Errorf("stage1: %w", err)
+		}
+		var seed [okvs.SeedLen]byte
+		if _, err := io.ReadFull(rw, seed[:]); err != nil {
+			return err
+		}
+		size = okvs.Size(int(remoteN))
+
+		// exhaust local ids, and hash them while
+		// the VOLE runs
+		go func() {
+			var ids [][]byte
+			for id := range identifiers {
+				ids = append(ids, id)
+			}
+			itemsChan <- hashItems(okvs.NewHasher(seed, size), ids)
+		}()
+
+		// end stage1
+		timer, mem = printStageStats(logger, 1, start, start, 0)
+		logger.V(1).Info("Finished stage 1")
+		return nil
+	}
+
+	// stage 2: run a VOLE of the size of the OKVS, and
+	// read the OKVS masked with the VOLE vector a
+	stage2 := func() error {
+		logger.V(1).Info("Starting stage 2")
+
+		base, err := ot.NewBaseOT(baseOT, ot.ExtensionBaseMsgLens())
+		if err != nil {
+			return err
+		}
+		delta, b, err = vole.NewSender(base).Send(size, rw)
+		if err != nil {
+			return fmt.Errorf("stage2: %w", err)
+		}
+
+		// read D = P + a
+		var bufferedReader = bufio.NewReaderSize(rw, 1024*64)
+		var buf [gf128.Size]byte
+		d = make([]gf128.Element, size)
+		for i := range d {
+			if _, err := io.ReadFull(bufferedReader, buf[:]); err != nil {
+				return fmt.Errorf("stage2: %w", err)
+			}
+			d[i] = gf128.FromBytes(buf[:])
+		}
+
+		// end stage2
+		timer, mem = printStageStats(logger, 2, timer, start, mem)
+		logger.V(1).Info("Finished stage 2")
+		return nil
+	}
+
+	// stage 3: compute the OPRF outputs of the local ids and
+	// send them to the receiver
+	stage3 := func() error {
+		logger.V(1).Info("Starting stage 3")
+
+		items := <-itemsChan
+
+		// inform the receiver the number of local ID,
+		// and the length of their OPRF outputs
+		outputLen, err := digest.Select(s.opts.DigestLen, remoteN, int64(len(items)))
+		if err != nil {
+			return fmt.Errorf("stage3: %w", err)
+		}
+		digest.Log(logger, remoteN, int64(len(items)), outputLen)
+		if err := binary.Write(s.rw, binary.BigEndian, int64(len(items))); err != nil {
+			return err
+		}
+		if err := lenWrite(s.rw, outputLen); err != nil {
+			return err
+		}
+
+		// the OPRF key is K = b + D*delta, and the OPRF output of x is
+		// H(x, Decode(K, x) + H(x)*delta), computed with a single
+		// multiplication by delta since Decode is linear
+		mul := gf128.NewMultiplier(delta)
+		// Add a buffer of 64k to amortize syscalls cost
+		var bufferedWriter = bufio.NewWriterSize(s.rw, 1024*64)
+		for _, it := range items {
+			z := okvs.Decode(b, it.key).Add(mul.Mul(okvs.Decode(d, it.key).Add(it.value)))
+			e := output(it.value, z, outputLen)
+			if _, err := bufferedWriter.Write(e[:outputLen]); err != nil {
+				return fmt.Errorf("stage3: %v", err)
+			}
+		}
+		if err := bufferedWriter.Flush(); err != nil {
+			return err
+		}
+
+		// end stage3
+		_, _ = printStageStats(logger, 3, timer, start, mem)
+		logger.V(1).Info("Finished stage 3")
+		return nil
+	}
+
+	// run stage1
+	if err := util.Sel(ctx, l.StageTimeout, stage1); err != nil {
+		return err
+	}
+
+	// run stage2
+	if err := util.Sel(ctx, l.StageTimeout, stage2); err != nil {
+		return err
+	}
+
+	// run stage3
+	if err := util.Sel(ctx, l.StageTimeout, stage3); err != nil {
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,89 @@
+package volepsi
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+	"runtime"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/optable/match/internal/gf128"
+	"github.com/optable/match/internal/okvs"
+	"github.com/optable/match/internal/ot"
+	"github.com/optable/match/pkg/digest"
+	"github.com/optable/match/pkg/limits"
+	"github.com/zeebo/blake3"
+)
+
+const (
+	// baseOT is the base OT of the OT extension underlying the VOLE
+	baseOT = ot.Simplest
+	// maxEncodeAttempts is the number of seeds the receiver
+	// tries before giving up on encoding its OKVS
+	maxEncodeAttempts = 4
+)
+
+// item is a local identifier hashed for the OKVS
+type item struct {
+	key   okvs.Key
+	value gf128.Element
+}
+
+// hashItems hashes the identifiers with h
+func hashItems(h *okvs.Hasher, ids [][]byte) []item {
+	items := make([]item, len(ids))
+	for i, id := range ids {
+		items[i].key, items[i].value = h.Hash(id)
+	}
+	return items
+}
+
+// encoding is the OPRF output of an item truncated to
+// the digest length, and zero padded to digest.MaxLen
+type encoding [digest.MaxLen]byte
+
+// output returns the first l bytes of the OPRF output of an
+// item from its value and the decoding z of the OPRF key
+func output(value, z gf128.Element, l int) (e encoding) {
+	var b [2 * gf128.Size]byte
+	value.PutBytes(b[:])
+	z.PutBytes(b[gf128.Size:])
+	sum := blake3.Sum256(b[:])
+	copy(e[:l], sum[:])
+	return e
+}
+
+// sizeRead reads the number of items of the remote
+// party, and validates it against l
+func sizeRead(r io.Reader, l limits.Limits, n *int64) error {
+	if err := binary.Read(r, binary.BigEndian, n); err != nil {
+		return err
+	}
+	return l.CheckCardinality(*n)
+}
+
+// lenWrite writes the length of the OPRF outputs out
+func lenWrite(w io.Writer, l int) error {
+	return binary.Write(w, binary.BigEndian, uint8(l))
+}
+
+// lenRead reads the length of the OPRF outputs
+func lenRead(r io.Reader, l *int) error {
+	var u uint8
+	if err := binary.Read(r, binary.BigEndian, &u); err != nil {
+		return err
+	}
+	*l = int(u)
+	return nil
+}
+
+func printStageStats(log logr.Logger, stage int, prevTime, startTime time.Time, prevMem uint64) (time.Time, uint64) {
+	endTime := time.Now()
+	log.V(2).Info("stats", "stage", stage, "time", time.Since(prevTime).String(), "cumulative time", time.Since(startTime).String())
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	log.V(2).Info("stats", "stage", stage, "total memory from OS (MiB)", math.Round(float64(m.Sys-prevMem)*100/(1024*1024))/100)
+	log.V(2).Info("stats", "stage", stage, "cumulative GC calls", m.NumGC)
+	return endTime, m.Sys
+}
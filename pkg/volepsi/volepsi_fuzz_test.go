@@ -0,0 +1,39 @@
+package volepsi
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/optable/match/pkg/limits"
+)
+
+// fuzzLimits are small enough that an adversarial
+// header can never make the fuzzer allocate much
+var fuzzLimits = limits.Limits{MaxCardinality: 1 << 12, MaxBytes: 1 << 20}
+
+func FuzzSizeRead(f *testing.F) {
+	for _, n := range []int64{0, 1, -1, 1 << 12, 1<<12 + 1, math.MaxInt64, math.MinInt64} {
+		var b bytes.Buffer
+		binary.Write(&b, binary.BigEndian, n)
+		f.Add(b.Bytes())
+	}
+	f.Add([]byte{})
+	f.Add([]byte{0, 0, 0})
+
+	f.Fuzz(func(t *testing.T, b []byte) {
+		var n int64
+		err := sizeRead(bytes.NewReader(b), fuzzLimits, &n)
+		if err != nil {
+			if len(b) >= 8 && !errors.Is(err, limits.ErrInvalidCardinality) && !errors.Is(err, limits.ErrCardinalityExceeded) {
+				t.Fatalf("unexpected error on a complete header: %v", err)
+			}
+			return
+		}
+		if n < 0 || n > fuzzLimits.MaxCardinality {
+			t.Fatalf("accepted an announced size of %d", n)
+		}
+	})
+}
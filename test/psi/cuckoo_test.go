@@ -0,0 +1,56 @@
+package psi_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/optable/match/internal/cuckoo"
+	"github.com/optable/match/pkg/options"
+	"github.com/optable/match/pkg/psi"
+)
+
+func TestCuckooParams(t *testing.T) {
+	for _, p := range []cuckoo.Params{
+		{Nhash: 2, Factor: 1.4},
+		{Nhash: 1 << 20, Factor: 1.4},
+		{Nhash: 3, Factor: 1 << 20},
+		{Nhash: 3, Factor: 1.4, StashSize: 1 << 20},
+		{Nhash: 3, Factor: 0.5},
+		{Nhash: 3, Factor: 1.4, Hasher: 255},
+	} {
+		for _, protocol := range []psi.Protocol{psi.ProtocolKKRTPSI, psi.ProtocolKKRTPSIKOS} {
+			r, _ := psi.NewReceiver(protocol, peer{bytes.NewReader(kkrtpsiHeader(p))}, options.WithLimits(fuzzLimits))
+			if _, err := r.Intersect(context.Background(), 16, identifiers(16)); !errors.Is(err, cuckoo.ErrInvalidParams) {
+				t.Errorf("%s: expected ErrInvalidParams for %+v, got %v", protocol, p, err)
+			}
+		}
+	}
+}
+
+func TestKKRTPSIParams(t *testing.T) {
+	const n = 1 << 10
+	for _, p := range []psi.Protocol{psi.ProtocolKKRTPSI, psi.ProtocolKKRTPSIKOS} {
+		for _, params := range []options.Cuckoo{
+			{Nhash: 4},
+			{Nhash: 5, Factor: 2},
+			{StashSize: -1},
+			{Nhash: 8, Factor: 1.3, StashSize: 8},
+		} {
+			intersection, senderErr, receiverErr := run(p, n, []options.Option{options.WithCuckoo(params)}, nil)
+			if senderErr != nil || receiverErr != nil {
+				t.Fatalf("%s: expected %+v to run, got %v and %v", p, params, senderErr, receiverErr)
+			}
+			if len(intersection) != n {
+				t.Errorf("%s: expected %d matches with %+v, got %d", p, n, params, len(intersection))
+			}
+		}
+
+		// out of bounds parameters are rejected by the sender
+		opts := []options.Option{options.WithCuckoo(options.Cuckoo{Nhash: cuckoo.MaxNhash + 1})}
+		if _, err, _ := run(p, n, opts, nil); !errors.Is(err, cuckoo.ErrInvalidParams) {
+			t.Errorf("%s: expected ErrInvalidParams, got %v", p, err)
+		}
+	}
+}
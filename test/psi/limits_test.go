@@ -0,0 +1,168 @@
+// black box testing of all PSIs
+package psi_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/optable/match/internal/cuckoo"
+	"github.com/optable/match/pkg/limits"
+	"github.com/optable/match/pkg/options"
+	"github.com/optable/match/pkg/psi"
+	"github.com/optable/match/test/emails"
+)
+
+var protocols = []psi.Protocol{psi.ProtocolDHPSI, psi.ProtocolNPSI, psi.ProtocolBPSI, psi.ProtocolKKRTPSI, psi.ProtocolKKRTPSIKOS, psi.ProtocolVOLEPSI}
+
+// fuzzLimits are small enough that an adversarial
+// peer can never make the fuzzer allocate much
+var fuzzLimits = limits.Limits{MaxCardinality: 1 << 12, MaxBytes: 1 << 20, StageTimeout: 5 * time.Second}
+
+// peer is a scripted remote end: it replays b
+// and discards anything written to it
+type peer struct {
+	io.Reader
+}
+
+func (peer) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+// identifiers returns a closed, buffered channel of n identifiers
+// so that an aborted protocol never blocks the producer
+func identifiers(n int) <-chan []byte {
+	var c = make(chan []byte, n)
+	for id := range emails.Mix(nil, n, emails.HashLen) {
+		c <- id
+	}
+	close(c)
+	return c
+}
+
+// headers returns adversarial size headers, optionally
+// preceded by prefix bytes of fixed size protocol state
+func headers(prefix []byte) (out [][]byte) {
+	for _, n := range []int64{-1, 0, 1, 1 << 13, 1 << 40, math.MaxInt64, math.MinInt64} {
+		var b bytes.Buffer
+		b.Write(prefix)
+		binary.Write(&b, binary.BigEndian, n)
+		b.Write(make([]byte, 64))
+		out = append(out, b.Bytes())
+	}
+	return
+}
+
+// kkrtpsiHeader returns the cuckoo hash parameters, the pseudorandom
+// generator and base OT of the OPRF, and the seeds read by kkrtpsi before the size
+func kkrtpsiHeader(p cuckoo.Params) []byte {
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, struct {
+		Nhash, StashSize int64
+		Factor           float64
+		Hasher           uint8
+		PRG, BaseOT      uint8
+	}{int64(p.Nhash), int64(p.StashSize), p.Factor, uint8(p.Hasher), uint8(options.PRGBlake3), uint8(options.BaseOTNaorPinkas)})
+	b.Write(make([]byte, p.Nhash*32))
+	return b.Bytes()
+}
+
+func addHeaders(f *testing.F) {
+	// dhpsi and npsi read their header first
+	for _, b := range headers(nil) {
+		f.Add(b)
+	}
+	// kkrtpsi reads the cuckoo hash parameters
+	// and their seeds before the size
+	for _, p := range []cuckoo.Params{cuckoo.DefaultParams, {Nhash: cuckoo.MaxNhash, Factor: cuckoo.MaxFactor, StashSize: cuckoo.MaxStashSize}} {
+		for _, b := range headers(kkrtpsiHeader(p)) {
+			f.Add(b)
+		}
+	}
+	// bpsi reads m, k and the bitset length
+	for _, m := range []uint64{0, 1, 29, 1 << 40, math.MaxUint64} {
+		var b bytes.Buffer
+		binary.Write(&b, binary.BigEndian, [3]uint64{m, 21, m})
+		f.Add(b.Bytes())
+		b.Reset()
+		binary.Write(&b, binary.BigEndian, [3]uint64{m, math.MaxUint64, m})
+		f.Add(b.Bytes())
+	}
+	f.Add([]byte{})
+}
+
+// checkErr fails the test when a protocol got stuck on the input
+func checkErr(t *testing.T, p psi.Protocol, err error) {
+	if errors.Is(err, limits.ErrStageTimeout) {
+		t.Fatalf("%s: stuck on adversarial input", p)
+	}
+}
+
+func FuzzReceiver(f *testing.F) {
+	addHeaders(f)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		for _, p := range protocols {
+			r, _ := psi.NewReceiver(p, peer{bytes.NewReader(b)}, options.WithLimits(fuzzLimits))
+			_, err := r.Intersect(context.Background(), 16, identifiers(16))
+			checkErr(t, p, err)
+		}
+	})
+}
+
+func FuzzSender(f *testing.F) {
+	addHeaders(f)
+	f.Fuzz(func(t *testing.T, b []byte) {
+		for _, p := range protocols {
+			s, _ := psi.NewSender(p, peer{bytes.NewReader(b)}, options.WithLimits(fuzzLimits))
+			err := s.Send(context.Background(), 16, identifiers(16))
+			checkErr(t, p, err)
+		}
+	})
+}
+
+func TestCardinalityLimit(t *testing.T) {
+	for _, p := range []psi.Protocol{psi.ProtocolDHPSI, psi.ProtocolNPSI} {
+		b := headers(nil)[3]
+		r, _ := psi.NewReceiver(p, peer{bytes.NewReader(b)}, options.WithLimits(limits.Limits{MaxCardinality: 1 << 10}))
+		if _, err := r.Intersect(context.Background(), 16, identifiers(16)); !errors.Is(err, limits.ErrCardinalityExceeded) {
+			t.Errorf("%s: expected ErrCardinalityExceeded, got %v", p, err)
+		}
+	}
+}
+
+// run runs protocol p between a sender and a receiver of the same n
+// identifiers, configured with senderOpts and receiverOpts
+func run(p psi.Protocol, n int, senderOpts, receiverOpts []options.Option) (intersection [][]byte, senderErr, receiverErr error) {
+	var ids [][]byte
+	for id := range identifiers(n) {
+		ids = append(ids, id)
+	}
+	senderConn, receiverConn := net.Pipe()
+	var done = make(chan error)
+	go func() {
+		s, _ := psi.NewSender(p, senderConn, senderOpts...)
+		err := s.Send(context.Background(), int64(n), replay(ids))
+		senderConn.Close()
+		done <- err
+	}()
+	r, _ := psi.NewReceiver(p, receiverConn, receiverOpts...)
+	intersection, receiverErr = r.Intersect(context.Background(), int64(n), replay(ids))
+	receiverConn.Close()
+	return intersection, <-done, receiverErr
+}
+
+// replay returns a closed, buffered channel of ids
+func replay(ids [][]byte) <-chan []byte {
+	var c = make(chan []byte, len(ids))
+	for _, id := range ids {
+		c <- id
+	}
+	close(c)
+	return c
+}
@@ -0,0 +1,146 @@
+package psi_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/optable/match/pkg/digest"
+	"github.com/optable/match/pkg/options"
+	"github.com/optable/match/pkg/psi"
+)
+
+// TestNegotiation runs the parameters a party selects and announces to its
+// peer against the requirements of both parties. The party which selects a
+// parameter rejects its own selection when it does not meet its requirements,
+// and the peer rejects an announced parameter which does not meet its own.
+func TestNegotiation(t *testing.T) {
+	const n = 1 << 8
+	var (
+		kkrt     = []psi.Protocol{psi.ProtocolKKRTPSI, psi.ProtocolKKRTPSIKOS}
+		digests  = append([]psi.Protocol{psi.ProtocolNPSI, psi.ProtocolVOLEPSI}, kkrt...)
+		required = options.WithPRFRequired()
+	)
+	for _, c := range []struct {
+		name         string
+		protocols    []psi.Protocol
+		sender       []options.Option
+		receiver     []options.Option
+		senderErr    error
+		receiverErr  error
+		expectsMatch bool
+	}{
+		{
+			name:         "128 bits digests",
+			protocols:    digests,
+			sender:       []options.Option{options.WithDigestLen(digest.MaxLen)},
+			receiver:     []options.Option{options.WithDigestLen(digest.MaxLen)},
+			expectsMatch: true,
+		},
+		{
+			name:        "digests shorter than required by the receiver",
+			protocols:   digests,
+			sender:      []options.Option{options.WithDigestLen(4)},
+			receiver:    []options.Option{options.WithDigestLen(8)},
+			receiverErr: digest.ErrLenTooShort,
+		},
+		{
+			name:      "digests longer than possible",
+			protocols: digests,
+			sender:    []options.Option{options.WithDigestLen(digest.MaxLen + 1)},
+			senderErr: digest.ErrInvalidLen,
+		},
+		{
+			name:         "keyed PRF",
+			protocols:    []psi.Protocol{psi.ProtocolNPSI, psi.ProtocolKKRTPSI},
+			sender:       []options.Option{options.WithHasher(options.HashSipHash), required},
+			receiver:     []options.Option{options.WithHasher(options.HashSipHash), required},
+			expectsMatch: true,
+		},
+		{
+			// the sender selects the hash function of kkrtpsi
+			name:        "kkrtpsi hash function which is not a PRF",
+			protocols:   kkrt,
+			sender:      []options.Option{options.WithHasher(options.HashXXH3)},
+			receiver:    []options.Option{required},
+			receiverErr: options.ErrNotPRF,
+		},
+		{
+			// the receiver selects the hash function of npsi
+			name:      "npsi hash function which is not a PRF",
+			protocols: []psi.Protocol{psi.ProtocolNPSI},
+			sender:    []options.Option{required},
+			receiver:  []options.Option{options.WithHasher(options.HashXXH3)},
+			senderErr: options.ErrNotPRF,
+		},
+		{
+			name:      "selected hash function which is not a PRF",
+			protocols: kkrt,
+			sender:    []options.Option{options.WithHasher(options.HashMurmur3), required},
+			senderErr: options.ErrNotPRF,
+		},
+		{
+			name:      "unknown hash function",
+			protocols: kkrt,
+			sender:    []options.Option{options.WithHasher(255)},
+			senderErr: options.ErrUnknownHasher,
+		},
+		{
+			name:         "CTR_DRBG",
+			protocols:    kkrt,
+			sender:       []options.Option{options.WithPRG(options.PRGCTRDRBG), options.WithDRBGRequired()},
+			receiver:     []options.Option{options.WithDRBGRequired()},
+			expectsMatch: true,
+		},
+		{
+			name:        "pseudorandom generator which is not a DRBG",
+			protocols:   kkrt,
+			sender:      []options.Option{options.WithPRG(options.PRGAESCTR)},
+			receiver:    []options.Option{options.WithDRBGRequired()},
+			receiverErr: options.ErrNotDRBG,
+		},
+		{
+			name:      "unknown pseudorandom generator",
+			protocols: kkrt,
+			sender:    []options.Option{options.WithPRG(255)},
+			senderErr: options.ErrUnknownPRG,
+		},
+		{
+			name:         "Simplest OT",
+			protocols:    kkrt,
+			sender:       []options.Option{options.WithBaseOT(options.BaseOTSimplest)},
+			expectsMatch: true,
+		},
+		{
+			name:         "Masny-Rindal OT",
+			protocols:    kkrt,
+			sender:       []options.Option{options.WithBaseOT(options.BaseOTMasnyRindal)},
+			expectsMatch: true,
+		},
+		{
+			name:      "unknown base OT",
+			protocols: kkrt,
+			sender:    []options.Option{options.WithBaseOT(255)},
+			senderErr: options.ErrUnknownBaseOT,
+		},
+	} {
+		for _, p := range c.protocols {
+			t.Run(c.name+"/"+p.String(), func(t *testing.T) {
+				intersection, senderErr, receiverErr := run(p, n, c.sender, c.receiver)
+				if c.expectsMatch {
+					if senderErr != nil || receiverErr != nil {
+						t.Fatalf("expected a match, got %v and %v", senderErr, receiverErr)
+					}
+					if len(intersection) != n {
+						t.Errorf("expected %d matches, got %d", n, len(intersection))
+					}
+				}
+				if c.senderErr != nil && !errors.Is(senderErr, c.senderErr) {
+					t.Errorf("expected the sender to return %v, got %v", c.senderErr, senderErr)
+				}
+				if c.receiverErr != nil && !errors.Is(receiverErr, c.receiverErr) {
+					t.Errorf("expected the receiver to return %v, got %v", c.receiverErr, receiverErr)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,141 @@
+// black box testing of all PSIs
+package psi_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/optable/match/pkg/psi"
+)
+
+func TestPaddingSize(t *testing.T) {
+	for _, test := range []struct {
+		size    func(int64) int64
+		n, want int64
+	}{
+		{psi.PowerOfTwo, 0, 1},
+		{psi.PowerOfTwo, 1, 1},
+		{psi.PowerOfTwo, 5, 8},
+		{psi.PowerOfTwo, 1024, 1024},
+		{psi.Buckets(1000, 100), 10, 100},
+		{psi.Buckets(1000, 100), 101, 1000},
+		{psi.Buckets(1000, 100), 2500, 3000},
+	} {
+		if got := test.size(test.n); got != test.want {
+			t.Errorf("expected %d padded to %d, got %d", test.n, test.want, got)
+		}
+	}
+}
+
+// announced is a psi.Sender recording what it is given
+type announced struct {
+	n           int64
+	identifiers map[string]bool
+}
+
+func (a *announced) Send(ctx context.Context, n int64, identifiers <-chan []byte) error {
+	a.n, a.identifiers = n, make(map[string]bool)
+	for identifier := range identifiers {
+		a.identifiers[string(identifier)] = true
+	}
+	return nil
+}
+
+// echo is a psi.Receiver intersecting with everything it is given
+type echo struct{}
+
+func (echo) Intersect(ctx context.Context, n int64, identifiers <-chan []byte) (intersection [][]byte, err error) {
+	for identifier := range identifiers {
+		intersection = append(intersection, identifier)
+	}
+	return intersection, nil
+}
+
+func TestPaddingStrip(t *testing.T) {
+	var ids [][]byte
+	for id := range identifiers(100) {
+		ids = append(ids, id)
+	}
+
+	// only the dummies are stripped
+	intersection, err := psi.Padding{Size: psi.PowerOfTwo}.Receiver(echo{}).Intersect(context.Background(), int64(len(ids)), replay(ids))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(intersection) != len(ids) {
+		t.Fatalf("expected %d identifiers left, got %d", len(ids), len(intersection))
+	}
+	for i := range ids {
+		if string(intersection[i]) != string(ids[i]) {
+			t.Fatalf("expected identifier %s at %d, got %s", ids[i], i, intersection[i])
+		}
+	}
+}
+
+func TestPaddingTooManyIdentifiers(t *testing.T) {
+	var ids [][]byte
+	for id := range identifiers(3) {
+		ids = append(ids, id)
+	}
+
+	err := psi.Padding{Size: psi.PowerOfTwo}.Sender(&announced{}).Send(context.Background(), 2, replay(ids))
+	if !errors.Is(err, psi.ErrTooManyIdentifiers) {
+		t.Errorf("expected the sender to fail with %v, got %v", psi.ErrTooManyIdentifiers, err)
+	}
+	_, err = psi.Padding{Size: psi.PowerOfTwo}.Receiver(echo{}).Intersect(context.Background(), 2, replay(ids))
+	if !errors.Is(err, psi.ErrTooManyIdentifiers) {
+		t.Errorf("expected the receiver to fail with %v, got %v", psi.ErrTooManyIdentifiers, err)
+	}
+}
+
+func TestPadding(t *testing.T) {
+	var ids [][]byte
+	for id := range identifiers(100) {
+		ids = append(ids, id)
+	}
+
+	// the padded size is announced and the identifiers
+	// are sent along with distinct dummies
+	a := &announced{}
+	if err := (psi.Padding{Size: psi.PowerOfTwo}).Sender(a).Send(context.Background(), psi.UnknownN, replay(ids)); err != nil {
+		t.Fatal(err)
+	}
+	if a.n != 128 || len(a.identifiers) != 128 {
+		t.Errorf("expected 128 identifiers announced and sent, got %d and %d", a.n, len(a.identifiers))
+	}
+	for _, id := range ids {
+		if !a.identifiers[string(id)] {
+			t.Fatalf("identifier %s was not sent", id)
+		}
+	}
+
+	// the dummies never match
+	received := append([][]byte{}, ids[:50]...)
+	for id := range identifiers(30) {
+		received = append(received, id)
+	}
+	for _, p := range protocols {
+		senderConn, receiverConn := net.Pipe()
+		var done = make(chan error)
+		go func() {
+			s, _ := psi.NewSender(p, senderConn)
+			err := psi.Padding{Size: psi.PowerOfTwo}.Sender(s).Send(context.Background(), int64(len(ids)), replay(ids))
+			senderConn.Close()
+			done <- err
+		}()
+		r, _ := psi.NewReceiver(p, receiverConn)
+		intersection, err := psi.Padding{Size: psi.Buckets(1000)}.Receiver(r).Intersect(context.Background(), int64(len(received)), replay(received))
+		receiverConn.Close()
+		if err := <-done; err != nil {
+			t.Fatalf("%v: sender: %v", p, err)
+		}
+		if err != nil {
+			t.Fatalf("%v: receiver: %v", p, err)
+		}
+		if len(intersection) != 50 {
+			t.Errorf("%v: expected 50 matches, got %d", p, len(intersection))
+		}
+	}
+}
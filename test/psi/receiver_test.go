@@ -243,3 +243,39 @@ func TestKKRTReceiver(t *testing.T) {
 		}
 	}
 }
+
+func TestKKRTKOSReceiver(t *testing.T) {
+	for _, s := range test_sizes {
+		t.Logf("testing scenario %s", s.scenario)
+		// generate common data
+		common := emails.Common(s.commonLen, s.hashLen)
+		// test
+		if err := testReceiver(psi.ProtocolKKRTPSIKOS, common, s, true); err != nil {
+			t.Fatalf("%s: %v", s.scenario, err)
+		}
+	}
+}
+
+func TestVOLEReceiver(t *testing.T) {
+	for _, s := range test_sizes {
+		t.Logf("testing scenario %s", s.scenario)
+		// generate common data
+		common := emails.Common(s.commonLen, s.hashLen)
+		// test
+		if err := testReceiver(psi.ProtocolVOLEPSI, common, s, true); err != nil {
+			t.Fatalf("%s: %v", s.scenario, err)
+		}
+	}
+
+	for _, hashLen := range hashLenSizes {
+		hashLenTest := test_size{"same size with hash length", 100, 100, 200, hashLen}
+		scenario := hashLenTest.scenario + " with hash length: " + fmt.Sprint(hashDigestLen(hashLen))
+		t.Logf("testing scenario %s", scenario)
+		// generate common data
+		common := emails.Common(hashLenTest.commonLen, hashLen)
+		// test
+		if err := testReceiver(psi.ProtocolVOLEPSI, common, hashLenTest, true); err != nil {
+			t.Fatalf("%s: %v", hashLenTest.scenario, err)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// black box testing of all PSIs
+package psi_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/optable/match/pkg/psi"
+)
+
+// records returns a closed, buffered channel of records
+func records(rs ...psi.Record) <-chan psi.Record {
+	var c = make(chan psi.Record, len(rs))
+	for _, r := range rs {
+		c <- r
+	}
+	close(c)
+	return c
+}
+
+func record(id string, identifiers ...string) psi.Record {
+	r := psi.Record{ID: id}
+	for _, identifier := range identifiers {
+		r.Identifiers = append(r.Identifiers, []byte(identifier))
+	}
+	return r
+}
+
+func TestRecords(t *testing.T) {
+	senderRecords := []psi.Record{
+		record("s1", "e:alice", "p:+15145550100"),
+		record("s2", "a:6d92078a-8246-4ba4-ae5b-76104861e7dc"),
+		record("s3", "e:carol", "e:dave"),
+	}
+	receiverRecords := []psi.Record{
+		// matches on the phone of s1 only
+		record("r1", "e:alice2", "p:+15145550100"),
+		// matches on the email of s1 and the MAID of s2
+		record("r2", "e:alice", "a:6d92078a-8246-4ba4-ae5b-76104861e7dc"),
+		record("r3", "e:bob"),
+		// identifiers shared with r2, and a duplicate record
+		record("r4", "e:alice"),
+		record("r2", "e:dave"),
+	}
+	want := []psi.Match{
+		{RecordID: "r1", Types: []string{"p:"}},
+		{RecordID: "r2", Types: []string{"a:", "e:"}},
+		{RecordID: "r4", Types: []string{"e:"}},
+	}
+
+	for _, p := range protocols {
+		senderConn, receiverConn := net.Pipe()
+		var done = make(chan error)
+		go func() {
+			s, _ := psi.NewSender(p, senderConn)
+			err := psi.SendRecords(context.Background(), s, records(senderRecords...))
+			senderConn.Close()
+			done <- err
+		}()
+		r, _ := psi.NewReceiver(p, receiverConn)
+		matches, err := psi.IntersectRecords(context.Background(), r, records(receiverRecords...))
+		receiverConn.Close()
+		if err := <-done; err != nil {
+			t.Fatalf("%v: sender: %v", p, err)
+		}
+		if err != nil {
+			t.Fatalf("%v: receiver: %v", p, err)
+		}
+		if !reflect.DeepEqual(matches, want) {
+			t.Errorf("%v: expected %v, got %v", p, want, matches)
+		}
+	}
+
+	// identifiers must be typed
+	var r psi.Receiver
+	if _, err := psi.IntersectRecords(context.Background(), r, records(record("r1", "alice"))); !errors.Is(err, psi.ErrUntypedIdentifier) {
+		t.Errorf("expected ErrUntypedIdentifier, got %v", err)
+	}
+}
@@ -129,3 +129,11 @@ func TestBPSISender(t *testing.T) {
 func TestKKRTPSISender(t *testing.T) {
 	testSenderByProtocol(psi.ProtocolKKRTPSI, t)
 }
+
+func TestKKRTPSIKOSSender(t *testing.T) {
+	testSenderByProtocol(psi.ProtocolKKRTPSIKOS, t)
+}
+
+func TestVOLEPSISender(t *testing.T) {
+	testSenderByProtocol(psi.ProtocolVOLEPSI, t)
+}
@@ -0,0 +1,70 @@
+// black box testing of all PSIs
+package psi_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"testing"
+
+	"github.com/optable/match/pkg/dhpsi"
+	"github.com/optable/match/pkg/psi"
+)
+
+func TestUnknownN(t *testing.T) {
+	// the sender identifiers are all common
+	var sent [][]byte
+	for id := range identifiers(100) {
+		sent = append(sent, id)
+	}
+	received := append([][]byte{}, sent...)
+	for id := range identifiers(300) {
+		received = append(received, id)
+	}
+
+	dir := t.TempDir()
+	for _, p := range protocols {
+		senderConn, receiverConn := net.Pipe()
+		var done = make(chan error)
+		go func() {
+			// spill most of the identifiers
+			s, _ := psi.NewSender(p, senderConn)
+			err := psi.Spool{Window: 10, Dir: dir}.Sender(s).Send(context.Background(), psi.UnknownN, replay(sent))
+			senderConn.Close()
+			done <- err
+		}()
+		r, _ := psi.NewReceiver(p, receiverConn)
+		intersection, err := r.Intersect(context.Background(), psi.UnknownN, replay(received))
+		receiverConn.Close()
+		if err := <-done; err != nil {
+			t.Fatalf("%v: sender: %v", p, err)
+		}
+		if err != nil {
+			t.Fatalf("%v: receiver: %v", p, err)
+		}
+		if len(intersection) != len(sent) {
+			t.Errorf("%v: expected %d matches, got %d", p, len(sent), len(intersection))
+		}
+	}
+
+	// the spooled identifiers are removed
+	if files, _ := os.ReadDir(dir); len(files) != 0 {
+		t.Errorf("expected the spool to be removed, found %d files", len(files))
+	}
+}
+
+func TestMissingIdentifiers(t *testing.T) {
+	senderConn, receiverConn := net.Pipe()
+	defer receiverConn.Close()
+	go func() {
+		r, _ := psi.NewReceiver(psi.ProtocolDHPSI, receiverConn)
+		r.Intersect(context.Background(), 10, identifiers(10))
+	}()
+	s, _ := psi.NewSender(psi.ProtocolDHPSI, senderConn)
+	err := s.Send(context.Background(), 10, identifiers(5))
+	senderConn.Close()
+	if !errors.Is(err, dhpsi.ErrMissingIdentifiers) {
+		t.Errorf("expected ErrMissingIdentifiers, got %v", err)
+	}
+}